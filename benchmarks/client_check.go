@@ -49,7 +49,7 @@ func main() {
 	if err != nil {
 		fmt.Printf("   ⚠️  CreateTopic: %v (might already exist)\n", err)
 	}
-	err = client.Stream.Publish("test:stream", 0, "k1", []byte("Event 1"))
+	_, _, err = client.Stream.Publish("test:stream", 0, "k1", []byte("Event 1"))
 	if err != nil {
 		log.Fatalf("Stream Publish failed: %v", err)
 	}
@@ -15,6 +15,7 @@ type Client struct {
 	Queue  *QueueClient
 	Stream *StreamClient
 	DB     *DBClient
+	PubSub *PubSubClient
 
 	// Internal connection management
 	pool *net.ConnectionPool
@@ -85,6 +86,7 @@ func NewClient(opts *ClientOptions) (*Client, error) {
 	client.Queue = &QueueClient{pool: pool}
 	client.Stream = &StreamClient{pool: pool}
 	client.DB = &DBClient{pool: pool}
+	client.PubSub = &PubSubClient{pool: pool, opts: opts}
 
 	return client, nil
 }
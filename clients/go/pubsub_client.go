@@ -0,0 +1,302 @@
+package flin
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	stdnet "net"
+	"sync"
+	"time"
+
+	"github.com/skshohagmiah/flin/internal/net"
+	"github.com/skshohagmiah/flin/internal/protocol"
+)
+
+// ErrSubscriptionClosed is returned by Subscription methods after Close or
+// after the server dropped the connection
+var ErrSubscriptionClosed = errors.New("subscription closed")
+
+// PubSubClient handles non-persistent Pub/Sub messaging. Messages go only
+// to the subscribers connected when they are published.
+type PubSubClient struct {
+	pool *net.ConnectionPool
+	opts *ClientOptions
+}
+
+// PubSubMessage is a message received by a Subscription
+type PubSubMessage struct {
+	Channel string
+	// Pattern is the pattern that matched, empty for a channel subscription
+	Pattern string
+	Data    []byte
+}
+
+// ChannelInfo describes a channel with at least one subscriber
+type ChannelInfo struct {
+	Channel     string
+	Subscribers int
+	Published   uint64
+	Delivered   uint64
+}
+
+// Publish sends data to every current subscriber of channel and returns how
+// many received it
+func (c *PubSubClient) Publish(channel string, data []byte) (int, error) {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return 0, err
+	}
+	defer c.pool.Put(conn)
+
+	request := protocol.EncodePublishRequest(channel, data)
+	if err := conn.Write(request); err != nil {
+		return 0, err
+	}
+
+	value, err := readValueResponse(conn)
+	if err != nil {
+		return 0, err
+	}
+	if len(value) < 8 {
+		return 0, errors.New("invalid publish response")
+	}
+	return int(binary.BigEndian.Uint64(value)), nil
+}
+
+// Channels lists channels with subscribers, optionally filtered by a glob
+// pattern such as "orders.*"
+func (c *PubSubClient) Channels(pattern string) ([]ChannelInfo, error) {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer c.pool.Put(conn)
+
+	request := protocol.EncodePubSubChannelsRequest(pattern)
+	if err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	values, err := readMultiValueResponse(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	channels := make([]ChannelInfo, 0, len(values))
+	for _, v := range values {
+		// Decode: [2:nameLen][name][4:subscribers][8:published][8:delivered]
+		pos := 0
+		name, ok := readString16(v, &pos)
+		if !ok || len(v) < pos+20 {
+			return nil, errors.New("invalid channel entry")
+		}
+		channels = append(channels, ChannelInfo{
+			Channel:     name,
+			Subscribers: int(binary.BigEndian.Uint32(v[pos:])),
+			Published:   binary.BigEndian.Uint64(v[pos+4:]),
+			Delivered:   binary.BigEndian.Uint64(v[pos+12:]),
+		})
+	}
+	return channels, nil
+}
+
+// Subscribe opens a dedicated connection subscribed to channels
+func (c *PubSubClient) Subscribe(channels ...string) (*Subscription, error) {
+	sub, err := c.newSubscription()
+	if err != nil {
+		return nil, err
+	}
+	if err := sub.Subscribe(channels...); err != nil {
+		sub.Close()
+		return nil, err
+	}
+	return sub, nil
+}
+
+// PSubscribe opens a dedicated connection subscribed to every channel
+// matching patterns. Patterns are globs: "*" matches any run of characters
+// including ".", "?" one character and "[a-z]" a character class.
+func (c *PubSubClient) PSubscribe(patterns ...string) (*Subscription, error) {
+	sub, err := c.newSubscription()
+	if err != nil {
+		return nil, err
+	}
+	if err := sub.PSubscribe(patterns...); err != nil {
+		sub.Close()
+		return nil, err
+	}
+	return sub, nil
+}
+
+// Subscription receives messages on its own connection, since the server
+// pushes them at any time. The server drops a subscription whose unread
+// messages exceed its buffer; Messages is then closed and Err reports why.
+type Subscription struct {
+	conn    stdnet.Conn
+	opts    *ClientOptions
+	cmdMu   sync.Mutex
+	replies chan *protocol.Response
+
+	messages chan *PubSubMessage
+	closed   chan struct{} // closed by shutdown
+	done     chan struct{} // closed when the read loop exits
+	err      error
+	once     sync.Once
+}
+
+func (c *PubSubClient) newSubscription() (*Subscription, error) {
+	conn, err := stdnet.DialTimeout("tcp", c.opts.Address, c.opts.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Subscription{
+		conn:     conn,
+		opts:     c.opts,
+		replies:  make(chan *protocol.Response, 1),
+		messages: make(chan *PubSubMessage, 256),
+		closed:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go s.readLoop()
+	return s, nil
+}
+
+// Messages returns the channel messages are delivered on. It is closed
+// when the subscription ends.
+func (s *Subscription) Messages() <-chan *PubSubMessage {
+	return s.messages
+}
+
+// Err returns why the subscription ended, or nil while it is open
+func (s *Subscription) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// Subscribe adds channels to the subscription
+func (s *Subscription) Subscribe(channels ...string) error {
+	return s.command(protocol.EncodeSubscribeRequest(channels))
+}
+
+// PSubscribe adds patterns to the subscription
+func (s *Subscription) PSubscribe(patterns ...string) error {
+	return s.command(protocol.EncodePSubscribeRequest(patterns))
+}
+
+// Unsubscribe removes channels, or every channel when none are given
+func (s *Subscription) Unsubscribe(channels ...string) error {
+	return s.command(protocol.EncodeUnsubscribeRequest(channels))
+}
+
+// PUnsubscribe removes patterns, or every pattern when none are given
+func (s *Subscription) PUnsubscribe(patterns ...string) error {
+	return s.command(protocol.EncodePUnsubscribeRequest(patterns))
+}
+
+// Close ends the subscription and closes its connection
+func (s *Subscription) Close() error {
+	s.shutdown(ErrSubscriptionClosed)
+	<-s.done
+	return nil
+}
+
+// command sends a request and waits for its reply, which the read loop
+// separates from pushed messages
+func (s *Subscription) command(request []byte) error {
+	s.cmdMu.Lock()
+	defer s.cmdMu.Unlock()
+
+	if s.opts.WriteTimeout > 0 {
+		s.conn.SetWriteDeadline(time.Now().Add(s.opts.WriteTimeout))
+	}
+	if _, err := s.conn.Write(request); err != nil {
+		s.shutdown(err)
+		return err
+	}
+
+	var timeout <-chan time.Time
+	if s.opts.ReadTimeout > 0 {
+		timer := time.NewTimer(s.opts.ReadTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case resp := <-s.replies:
+		if resp.Status != protocol.StatusOK {
+			if resp.Error != "" {
+				return errors.New(resp.Error)
+			}
+			return errors.New("operation failed")
+		}
+		return nil
+	case <-s.done:
+		return s.err
+	case <-timeout:
+		// A late reply would be taken for the next command's, so give up
+		err := errors.New("timed out waiting for reply")
+		s.shutdown(err)
+		return err
+	}
+}
+
+func (s *Subscription) readLoop() {
+	defer close(s.done)
+	defer close(s.messages)
+
+	reader := bufio.NewReaderSize(s.conn, 65536)
+	header := make([]byte, 5)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			s.shutdown(err)
+			return
+		}
+		frame := make([]byte, 5+binary.BigEndian.Uint32(header[1:5]))
+		copy(frame, header)
+		if _, err := io.ReadFull(reader, frame[5:]); err != nil {
+			s.shutdown(err)
+			return
+		}
+
+		if frame[0] == protocol.StatusMessage {
+			channel, pattern, data, err := protocol.DecodeMessageFrame(frame[5:])
+			if err != nil {
+				s.shutdown(err)
+				return
+			}
+			select {
+			case s.messages <- &PubSubMessage{Channel: channel, Pattern: pattern, Data: data}:
+			case <-s.closed:
+				return
+			}
+			continue
+		}
+
+		resp, err := protocol.DecodeResponse(frame)
+		if err != nil {
+			s.shutdown(err)
+			return
+		}
+		select {
+		case s.replies <- resp:
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+// shutdown records why the subscription ended and closes the connection,
+// which stops the read loop
+func (s *Subscription) shutdown(err error) {
+	s.once.Do(func() {
+		s.err = err
+		close(s.closed)
+		s.conn.Close()
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"errors"
 
+	"github.com/skshohagmiah/flin/internal/headercodec"
 	"github.com/skshohagmiah/flin/internal/net"
 	"github.com/skshohagmiah/flin/internal/protocol"
 )
@@ -13,6 +14,31 @@ type QueueClient struct {
 	pool *net.ConnectionPool
 }
 
+// QueueMessage is a queue item together with its envelope
+type QueueMessage struct {
+	ID            uint64
+	EnqueuedAt    int64 // Unix milliseconds, 0 for items stored before envelopes
+	DeliveryCount uint32
+	Headers       map[string]string
+	Value         []byte
+}
+
+// QueueInfo describes a queue known to the server
+type QueueInfo struct {
+	Name      string
+	Depth     uint64
+	CreatedAt int64
+}
+
+// QueueStats holds per-queue counters
+type QueueStats struct {
+	Depth       uint64
+	Enqueued    uint64
+	Dequeued    uint64
+	OldestAgeMs int64
+	CreatedAt   int64
+}
+
 // Push adds an item to the queue
 func (c *QueueClient) Push(queue string, item []byte) error {
 	conn, err := c.pool.Get()
@@ -29,6 +55,75 @@ func (c *QueueClient) Push(queue string, item []byte) error {
 	return readOKResponse(conn)
 }
 
+// PushDedup adds an item unless dedupID was already pushed within the server's
+// dedup window. It returns the item's sequence number and whether it was a
+// duplicate; retries of the same push return the original sequence number.
+func (c *QueueClient) PushDedup(queue, dedupID string, item []byte) (uint64, bool, error) {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return 0, false, err
+	}
+	defer c.pool.Put(conn)
+
+	request := protocol.EncodeQPushIDRequest(queue, dedupID, item)
+	if err := conn.Write(request); err != nil {
+		return 0, false, err
+	}
+
+	value, err := readValueResponse(conn)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if len(value) != 9 {
+		return 0, false, errors.New("invalid push result")
+	}
+
+	return binary.BigEndian.Uint64(value[0:8]), value[8] == 1, nil
+}
+
+// PushMessage adds an item with headers and an optional dedup ID, returning
+// the item's sequence number and whether the push was a duplicate
+func (c *QueueClient) PushMessage(queue string, item []byte, headers map[string]string, dedupID string) (uint64, bool, error) {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return 0, false, err
+	}
+	defer c.pool.Put(conn)
+
+	request := protocol.EncodeQPushMsgRequest(queue, dedupID, headers, item)
+	if err := conn.Write(request); err != nil {
+		return 0, false, err
+	}
+
+	value, err := readValueResponse(conn)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if len(value) != 9 {
+		return 0, false, errors.New("invalid push result")
+	}
+
+	return binary.BigEndian.Uint64(value[0:8]), value[8] == 1, nil
+}
+
+// PushBatch adds several items to the queue in one round trip
+func (c *QueueClient) PushBatch(queue string, items [][]byte) error {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return err
+	}
+	defer c.pool.Put(conn)
+
+	request := protocol.EncodeQMPushRequest(queue, items)
+	if err := conn.Write(request); err != nil {
+		return err
+	}
+
+	return readOKResponse(conn)
+}
+
 // Pop removes and returns an item from the queue
 func (c *QueueClient) Pop(queue string) ([]byte, error) {
 	conn, err := c.pool.Get()
@@ -45,6 +140,43 @@ func (c *QueueClient) Pop(queue string) ([]byte, error) {
 	return readValueResponse(conn)
 }
 
+// PopMessage removes and returns an item from the queue with its envelope
+func (c *QueueClient) PopMessage(queue string) (*QueueMessage, error) {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer c.pool.Put(conn)
+
+	request := protocol.EncodeQPopMsgRequest(queue)
+	if err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	value, err := readValueResponse(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeQueueMessage(value)
+}
+
+// PopBatch removes and returns up to n items from the queue
+func (c *QueueClient) PopBatch(queue string, n int) ([][]byte, error) {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer c.pool.Put(conn)
+
+	request := protocol.EncodeQMPopRequest(queue, n)
+	if err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	return readMultiValueResponse(conn)
+}
+
 // Peek returns the next item without removing it
 func (c *QueueClient) Peek(queue string) ([]byte, error) {
 	conn, err := c.pool.Get()
@@ -61,6 +193,27 @@ func (c *QueueClient) Peek(queue string) ([]byte, error) {
 	return readValueResponse(conn)
 }
 
+// PeekMessage returns the next item with its envelope without removing it
+func (c *QueueClient) PeekMessage(queue string) (*QueueMessage, error) {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer c.pool.Put(conn)
+
+	request := protocol.EncodeQPeekMsgRequest(queue)
+	if err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	value, err := readValueResponse(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeQueueMessage(value)
+}
+
 // Len returns the number of items in the queue
 func (c *QueueClient) Len(queue string) (int64, error) {
 	conn, err := c.pool.Get()
@@ -101,3 +254,139 @@ func (c *QueueClient) Clear(queue string) error {
 
 	return readOKResponse(conn)
 }
+
+// Create registers an empty queue
+func (c *QueueClient) Create(queue string) error {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return err
+	}
+	defer c.pool.Put(conn)
+
+	request := protocol.EncodeQCreateRequest(queue)
+	if err := conn.Write(request); err != nil {
+		return err
+	}
+
+	return readOKResponse(conn)
+}
+
+// Delete removes a queue and all of its items
+func (c *QueueClient) Delete(queue string) error {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return err
+	}
+	defer c.pool.Put(conn)
+
+	request := protocol.EncodeQDeleteRequest(queue)
+	if err := conn.Write(request); err != nil {
+		return err
+	}
+
+	return readOKResponse(conn)
+}
+
+// List returns all queues with their depth
+func (c *QueueClient) List() ([]QueueInfo, error) {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer c.pool.Put(conn)
+
+	request := protocol.EncodeQListRequest()
+	if err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	values, err := readMultiValueResponse(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	queues := make([]QueueInfo, 0, len(values))
+	for _, v := range values {
+		// Decode queue: [2:nameLen][name][8:depth][8:createdAt]
+		if len(v) < 2 {
+			return nil, errors.New("invalid queue entry")
+		}
+		nameLen := int(binary.BigEndian.Uint16(v[0:2]))
+		if len(v) < 2+nameLen+16 {
+			return nil, errors.New("invalid queue entry")
+		}
+		pos := 2 + nameLen
+		queues = append(queues, QueueInfo{
+			Name:      string(v[2:pos]),
+			Depth:     binary.BigEndian.Uint64(v[pos:]),
+			CreatedAt: int64(binary.BigEndian.Uint64(v[pos+8:])),
+		})
+	}
+
+	return queues, nil
+}
+
+// Stats returns the counters for a queue
+func (c *QueueClient) Stats(queue string) (*QueueStats, error) {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer c.pool.Put(conn)
+
+	request := protocol.EncodeQStatsRequest(queue)
+	if err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	value, err := readValueResponse(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(value) != 40 {
+		return nil, errors.New("invalid stats value")
+	}
+
+	return &QueueStats{
+		Depth:       binary.BigEndian.Uint64(value[0:8]),
+		Enqueued:    binary.BigEndian.Uint64(value[8:16]),
+		Dequeued:    binary.BigEndian.Uint64(value[16:24]),
+		OldestAgeMs: int64(binary.BigEndian.Uint64(value[24:32])),
+		CreatedAt:   int64(binary.BigEndian.Uint64(value[32:40])),
+	}, nil
+}
+
+// decodeQueueMessage parses [8:id][8:enqueuedAt][4:deliveryCount][headers][4:valueLen][value]
+func decodeQueueMessage(data []byte) (*QueueMessage, error) {
+	if len(data) < 20 {
+		return nil, errors.New("invalid queue message")
+	}
+
+	msg := &QueueMessage{
+		ID:            binary.BigEndian.Uint64(data[0:8]),
+		EnqueuedAt:    int64(binary.BigEndian.Uint64(data[8:16])),
+		DeliveryCount: binary.BigEndian.Uint32(data[16:20]),
+	}
+	pos := 20
+
+	headers, n, err := headercodec.Decode(data[pos:])
+	if err != nil {
+		return nil, err
+	}
+	msg.Headers = headers
+	pos += n
+
+	if len(data) < pos+4 {
+		return nil, errors.New("invalid queue message")
+	}
+	valueLen := int(binary.BigEndian.Uint32(data[pos:]))
+	pos += 4
+	if len(data) < pos+valueLen {
+		return nil, errors.New("invalid queue message")
+	}
+	msg.Value = make([]byte, valueLen)
+	copy(msg.Value, data[pos:pos+valueLen])
+
+	return msg, nil
+}
@@ -1,13 +1,28 @@
 package flin
 
 import (
-	"encoding/json"
-	"fmt"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
 
+	"github.com/skshohagmiah/flin/internal/headercodec"
 	"github.com/skshohagmiah/flin/internal/net"
 	"github.com/skshohagmiah/flin/internal/protocol"
 )
 
+// ErrRebalanceInProgress is returned when the group has rebalanced since
+// the consumer last subscribed; call Subscribe again to rejoin
+var ErrRebalanceInProgress = errors.New("rebalance in progress")
+
+var (
+	// ErrDuplicateSequence is returned when a producer resends a batch or
+	// transaction that was already committed, other than its latest one
+	ErrDuplicateSequence = errors.New("duplicate sequence number")
+	// ErrOutOfOrderSequence is returned when a producer skips sequence numbers
+	ErrOutOfOrderSequence = errors.New("out of order sequence number")
+)
+
 // StreamClient handles Stream Processing operations
 type StreamClient struct {
 	pool *net.ConnectionPool
@@ -21,6 +36,9 @@ type StreamMessage struct {
 	Value     []byte
 	Partition int
 	Offset    uint64
+	// EventTime is the producer-supplied time in Unix milliseconds, 0 if unset
+	EventTime int64
+	Headers   map[string]string
 }
 
 // CreateTopic creates a new topic with partitions and retention
@@ -39,15 +57,38 @@ func (c *StreamClient) CreateTopic(topic string, partitions int, retentionMs int
 	return readOKResponse(conn)
 }
 
-// Publish publishes a message to a topic
-func (c *StreamClient) Publish(topic string, partition int, key string, value []byte) error {
+// TopicConfig holds the settings for CreateTopicWithConfig
+type TopicConfig struct {
+	Partitions  int
+	RetentionMs int64
+	// RetentionBytes caps the stored size of each partition; 0 means unlimited
+	RetentionBytes int64
+	// CleanupPolicy is "delete" (default), "compact" or "compact,delete".
+	// Compaction keeps the latest message per key; publishing an empty
+	// value for a key acts as a tombstone that deletes it.
+	CleanupPolicy string
+	// Compression is "none" (default), "snappy", "zstd" or "gzip". Values
+	// are compressed by the server on append and decompressed on consume.
+	Compression string
+	// Partitioner picks the partition when publishing with partition -1:
+	// "fnv" (default) or "murmur2" hash the key, so records with the same
+	// key stay in order on one partition, and spread keyless records
+	// round-robin. murmur2 matches Kafka's default partitioner.
+	// "roundrobin" ignores keys. "sticky" hashes keys with murmur2 and
+	// fills one partition with keyless records before moving to the next.
+	Partitioner string
+}
+
+// CreateTopicWithConfig creates a new topic with size retention, cleanup
+// policy, compression and partitioner settings
+func (c *StreamClient) CreateTopicWithConfig(topic string, cfg TopicConfig) error {
 	conn, err := c.pool.Get()
 	if err != nil {
 		return err
 	}
 	defer c.pool.Put(conn)
 
-	request := protocol.EncodeSPublishRequest(topic, partition, key, value)
+	request := protocol.EncodeSCreateTopicConfigRequest(topic, cfg.Partitions, cfg.RetentionMs, cfg.RetentionBytes, cfg.CleanupPolicy, cfg.Compression, cfg.Partitioner)
 	if err := conn.Write(request); err != nil {
 		return err
 	}
@@ -55,6 +96,456 @@ func (c *StreamClient) Publish(topic string, partition int, key string, value []
 	return readOKResponse(conn)
 }
 
+// StreamRecord is a message to publish. EventTime (Unix milliseconds) and
+// Headers are optional and returned to consumers unchanged.
+type StreamRecord struct {
+	Key       string
+	Value     []byte
+	EventTime int64
+	Headers   map[string]string
+}
+
+// TopicInfo describes a topic's configuration
+type TopicInfo struct {
+	Name           string
+	Partitions     int
+	RetentionMs    int64
+	RetentionBytes int64
+	CreatedAt      int64
+	CleanupPolicy  string
+	Compression    string
+	Partitioner    string
+}
+
+// PartitionStats describes the retained log of one partition
+type PartitionStats struct {
+	Partition      int
+	EarliestOffset uint64
+	// LatestOffset is the next offset to be written
+	LatestOffset uint64
+	Messages     int64
+	Bytes        int64
+}
+
+// TopicDescription is a topic with its per-partition stats
+type TopicDescription struct {
+	Topic      TopicInfo
+	Partitions []PartitionStats
+}
+
+// PartitionOffsets is the retained offset range of a partition
+type PartitionOffsets struct {
+	Partition int
+	Earliest  uint64
+	// Latest is the next offset to be written
+	Latest uint64
+}
+
+// ListTopics returns every topic
+func (c *StreamClient) ListTopics() ([]TopicInfo, error) {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer c.pool.Put(conn)
+
+	request := protocol.EncodeSListTopicsRequest()
+	if err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	values, err := readMultiValueResponse(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	topics := make([]TopicInfo, 0, len(values))
+	for _, v := range values {
+		info, err := decodeTopicInfo(v)
+		if err != nil {
+			return nil, err
+		}
+		topics = append(topics, info)
+	}
+
+	return topics, nil
+}
+
+// DescribeTopic returns a topic's configuration with per-partition offsets,
+// message counts and sizes
+func (c *StreamClient) DescribeTopic(topic string) (*TopicDescription, error) {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer c.pool.Put(conn)
+
+	request := protocol.EncodeSDescribeRequest(topic)
+	if err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	values, err := readMultiValueResponse(conn)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, errors.New("invalid topic description")
+	}
+
+	info, err := decodeTopicInfo(values[0])
+	if err != nil {
+		return nil, err
+	}
+
+	desc := &TopicDescription{Topic: info, Partitions: make([]PartitionStats, 0, len(values)-1)}
+	for _, v := range values[1:] {
+		// Decode: [4:partition][8:earliest][8:latest][8:messages][8:bytes]
+		if len(v) < 36 {
+			return nil, errors.New("invalid partition stats")
+		}
+		desc.Partitions = append(desc.Partitions, PartitionStats{
+			Partition:      int(binary.BigEndian.Uint32(v)),
+			EarliestOffset: binary.BigEndian.Uint64(v[4:]),
+			LatestOffset:   binary.BigEndian.Uint64(v[12:]),
+			Messages:       int64(binary.BigEndian.Uint64(v[20:])),
+			Bytes:          int64(binary.BigEndian.Uint64(v[28:])),
+		})
+	}
+
+	return desc, nil
+}
+
+// GetOffsets returns the earliest and latest offsets of every partition
+func (c *StreamClient) GetOffsets(topic string) ([]PartitionOffsets, error) {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer c.pool.Put(conn)
+
+	request := protocol.EncodeSGetOffsetsRequest(topic)
+	if err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	values, err := readMultiValueResponse(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := make([]PartitionOffsets, 0, len(values))
+	for _, v := range values {
+		// Decode: [4:partition][8:earliest][8:latest]
+		if len(v) < 20 {
+			return nil, errors.New("invalid partition offsets")
+		}
+		offsets = append(offsets, PartitionOffsets{
+			Partition: int(binary.BigEndian.Uint32(v)),
+			Earliest:  binary.BigEndian.Uint64(v[4:]),
+			Latest:    binary.BigEndian.Uint64(v[12:]),
+		})
+	}
+
+	return offsets, nil
+}
+
+// GroupInfo summarizes a consumer group. Groups with committed offsets
+// but no live members have Members == 0.
+type GroupInfo struct {
+	Name       string
+	Topics     []string
+	Members    int
+	Generation uint64
+	Strategy   string
+}
+
+// PartitionLag is a group's progress on one partition
+type PartitionLag struct {
+	Topic     string
+	Partition int
+	// Committed is the next offset the group will read
+	Committed uint64
+	// HighWatermark is the next offset to be written
+	HighWatermark uint64
+	Lag           uint64
+	// LastCommit is the last commit time; zero if never committed
+	LastCommit time.Time
+	// Consumer is the assigned member, empty if unassigned
+	Consumer string
+}
+
+// ListGroups returns all consumer groups, active or with committed offsets
+func (c *StreamClient) ListGroups() ([]GroupInfo, error) {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer c.pool.Put(conn)
+
+	request := protocol.EncodeSListGroupsRequest()
+	if err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	values, err := readMultiValueResponse(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]GroupInfo, 0, len(values))
+	for _, v := range values {
+		// Decode: [2:nameLen][name][4:members][8:generation][2:strategyLen][strategy][2:topicCount]([2:topicLen][topic])...
+		var g GroupInfo
+		pos := 0
+		name, ok := readString16(v, &pos)
+		if !ok || len(v) < pos+12 {
+			return nil, errors.New("invalid group entry")
+		}
+		g.Name = name
+		g.Members = int(binary.BigEndian.Uint32(v[pos:]))
+		g.Generation = binary.BigEndian.Uint64(v[pos+4:])
+		pos += 12
+		if g.Strategy, ok = readString16(v, &pos); !ok || len(v) < pos+2 {
+			return nil, errors.New("invalid group entry")
+		}
+		count := int(binary.BigEndian.Uint16(v[pos:]))
+		pos += 2
+		for i := 0; i < count; i++ {
+			topic, ok := readString16(v, &pos)
+			if !ok {
+				return nil, errors.New("invalid group entry")
+			}
+			g.Topics = append(g.Topics, topic)
+		}
+		groups = append(groups, g)
+	}
+
+	return groups, nil
+}
+
+// GroupLag returns the committed offset, high-water mark, lag, last commit
+// time and assigned consumer for every partition the group consumes
+func (c *StreamClient) GroupLag(group string) ([]PartitionLag, error) {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer c.pool.Put(conn)
+
+	request := protocol.EncodeSGroupLagRequest(group)
+	if err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	values, err := readMultiValueResponse(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	lags := make([]PartitionLag, 0, len(values))
+	for _, v := range values {
+		// Decode: [2:topicLen][topic][4:partition][8:committed][8:highWatermark][8:lag][8:lastCommit][2:consumerLen][consumer]
+		var l PartitionLag
+		pos := 0
+		topic, ok := readString16(v, &pos)
+		if !ok || len(v) < pos+36 {
+			return nil, errors.New("invalid partition lag")
+		}
+		l.Topic = topic
+		l.Partition = int(binary.BigEndian.Uint32(v[pos:]))
+		l.Committed = binary.BigEndian.Uint64(v[pos+4:])
+		l.HighWatermark = binary.BigEndian.Uint64(v[pos+12:])
+		l.Lag = binary.BigEndian.Uint64(v[pos+20:])
+		if ms := int64(binary.BigEndian.Uint64(v[pos+28:])); ms > 0 {
+			l.LastCommit = time.UnixMilli(ms)
+		}
+		pos += 36
+		if l.Consumer, ok = readString16(v, &pos); !ok {
+			return nil, errors.New("invalid partition lag")
+		}
+		lags = append(lags, l)
+	}
+
+	return lags, nil
+}
+
+// readString16 reads a [2:len][bytes] string at *pos and advances it
+func readString16(data []byte, pos *int) (string, bool) {
+	if len(data) < *pos+2 {
+		return "", false
+	}
+	n := int(binary.BigEndian.Uint16(data[*pos:]))
+	if len(data) < *pos+2+n {
+		return "", false
+	}
+	s := string(data[*pos+2 : *pos+2+n])
+	*pos += 2 + n
+	return s, true
+}
+
+// DeleteTopic removes a topic with all its messages, consumer groups and
+// committed offsets
+func (c *StreamClient) DeleteTopic(topic string) error {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return err
+	}
+	defer c.pool.Put(conn)
+
+	request := protocol.EncodeSDeleteTopicRequest(topic)
+	if err := conn.Write(request); err != nil {
+		return err
+	}
+
+	return readOKResponse(conn)
+}
+
+// AddPartitions grows a topic by count partitions and returns the new total
+func (c *StreamClient) AddPartitions(topic string, count int) (int, error) {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return 0, err
+	}
+	defer c.pool.Put(conn)
+
+	request := protocol.EncodeSAddPartsRequest(topic, count)
+	if err := conn.Write(request); err != nil {
+		return 0, err
+	}
+
+	value, err := readValueResponse(conn)
+	if err != nil {
+		return 0, err
+	}
+	if len(value) != 4 {
+		return 0, errors.New("invalid partition count")
+	}
+
+	return int(binary.BigEndian.Uint32(value)), nil
+}
+
+// Publish publishes a message to a topic and returns the partition and
+// offset it was written to
+func (c *StreamClient) Publish(topic string, partition int, key string, value []byte) (int, uint64, error) {
+	return c.PublishRecord(topic, partition, StreamRecord{Key: key, Value: value})
+}
+
+// PublishRecord publishes a message with optional event time and headers
+// and returns the partition and offset it was written to
+func (c *StreamClient) PublishRecord(topic string, partition int, rec StreamRecord) (int, uint64, error) {
+	return c.sendPublish(encodePublishRecord(topic, partition, rec, 0, 0))
+}
+
+// encodePublishRecord encodes a SPUBLISH request, adding the optional tail
+// for idempotent producers or records with metadata
+func encodePublishRecord(topic string, partition int, rec StreamRecord, producerID, sequence uint64) []byte {
+	frame := protocol.EncodeSPublishRequest(topic, partition, rec.Key, rec.Value)
+	metas := recordMetas([]StreamRecord{rec})
+	if producerID == 0 && metas == nil {
+		return frame
+	}
+	return protocol.EncodeSPublishMetaRequest(frame, producerID, sequence, metas)
+}
+
+// recordMetas returns the records' event times and headers, or nil if
+// none are set
+func recordMetas(records []StreamRecord) []protocol.RecordMeta {
+	var metas []protocol.RecordMeta
+	for i, r := range records {
+		if r.EventTime == 0 && len(r.Headers) == 0 {
+			continue
+		}
+		if metas == nil {
+			metas = make([]protocol.RecordMeta, len(records))
+		}
+		metas[i] = protocol.RecordMeta{EventTime: r.EventTime, Headers: r.Headers}
+	}
+	return metas
+}
+
+// sendPublish sends an encoded SPUBLISH request
+func (c *StreamClient) sendPublish(request []byte) (int, uint64, error) {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer c.pool.Put(conn)
+
+	if err := conn.Write(request); err != nil {
+		return 0, 0, err
+	}
+
+	result, err := readValueResponse(conn)
+	if err != nil {
+		return 0, 0, streamError(err)
+	}
+	if len(result) != 12 {
+		return 0, 0, errors.New("invalid publish result")
+	}
+
+	return int(binary.BigEndian.Uint32(result)), binary.BigEndian.Uint64(result[4:]), nil
+}
+
+// PublishBatch atomically appends records to a single partition and returns
+// the partition and each record's offset. With partition -1 the partition
+// is chosen from the first record key; the server refuses a batch whose
+// keys belong to different partitions.
+func (c *StreamClient) PublishBatch(topic string, partition int, records []StreamRecord) (int, []uint64, error) {
+	return c.sendPublishBatch(encodePublishBatch(topic, partition, records, 0, 0))
+}
+
+// encodePublishBatch encodes a SMPUBLISH request, adding the optional tail
+// for idempotent producers or records with metadata
+func encodePublishBatch(topic string, partition int, records []StreamRecord, producerID, sequence uint64) []byte {
+	keys := make([]string, len(records))
+	values := make([][]byte, len(records))
+	for i, r := range records {
+		keys[i] = r.Key
+		values[i] = r.Value
+	}
+
+	frame := protocol.EncodeSMPublishRequest(topic, partition, keys, values)
+	metas := recordMetas(records)
+	if producerID == 0 && metas == nil {
+		return frame
+	}
+	return protocol.EncodeSPublishMetaRequest(frame, producerID, sequence, metas)
+}
+
+// sendPublishBatch sends an encoded SMPUBLISH request
+func (c *StreamClient) sendPublishBatch(request []byte) (int, []uint64, error) {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return 0, nil, err
+	}
+	defer c.pool.Put(conn)
+
+	if err := conn.Write(request); err != nil {
+		return 0, nil, err
+	}
+
+	result, err := readValueResponse(conn)
+	if err != nil {
+		return 0, nil, streamError(err)
+	}
+	if len(result) < 6 {
+		return 0, nil, errors.New("invalid publish result")
+	}
+
+	count := int(binary.BigEndian.Uint16(result[4:]))
+	if len(result) != 6+8*count {
+		return 0, nil, errors.New("invalid publish result")
+	}
+
+	offsets := make([]uint64, count)
+	for i := range offsets {
+		offsets[i] = binary.BigEndian.Uint64(result[6+8*i:])
+	}
+
+	return int(binary.BigEndian.Uint32(result)), offsets, nil
+}
+
 // Subscribe subscribes a consumer group to a topic
 func (c *StreamClient) Subscribe(topic, group, consumer string) error {
 	conn, err := c.pool.Get()
@@ -71,41 +562,156 @@ func (c *StreamClient) Subscribe(topic, group, consumer string) error {
 	return readOKResponse(conn)
 }
 
-// Consume consumes messages from a topic
-func (c *StreamClient) Consume(topic, group, consumer string, count int) ([]StreamMessage, error) {
+// SubscribeOptions configures a group membership
+type SubscribeOptions struct {
+	// SessionTimeout evicts consumers that stop heartbeating; zero keeps
+	// the group's current timeout
+	SessionTimeout time.Duration
+	// Strategy is the partition assignor: "range" (default), "roundrobin"
+	// or "sticky". It is fixed when the group is created.
+	Strategy string
+	// Filter is evaluated on the server so Consume only returns matching
+	// messages, e.g. `key ^= "orders-" && header.region = "eu"`. Skipped
+	// messages still advance the consumer's position.
+	Filter string
+}
+
+// StreamAssignment is a consumer's current partition assignment
+type StreamAssignment struct {
+	Generation uint64
+	Strategy   string
+	Partitions []int
+}
+
+// SubscribeWithOptions subscribes a consumer group to a topic with options
+func (c *StreamClient) SubscribeWithOptions(topic, group, consumer string, opts SubscribeOptions) error {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return err
+	}
+	defer c.pool.Put(conn)
+
+	request := protocol.EncodeSSubscribeOptsRequest(topic, group, consumer, int(opts.SessionTimeout.Milliseconds()), opts.Strategy, opts.Filter)
+	if err := conn.Write(request); err != nil {
+		return err
+	}
+
+	return readOKResponse(conn)
+}
+
+// Heartbeat keeps a consumer's session alive and returns the group generation.
+// ErrRebalanceInProgress means the consumer should Subscribe again.
+func (c *StreamClient) Heartbeat(topic, group, consumer string) (uint64, error) {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return 0, err
+	}
+	defer c.pool.Put(conn)
+
+	request := protocol.EncodeSHeartbeatRequest(topic, group, consumer)
+	if err := conn.Write(request); err != nil {
+		return 0, err
+	}
+
+	value, err := readValueResponse(conn)
+	if err != nil {
+		return 0, streamError(err)
+	}
+	if len(value) != 8 {
+		return 0, errors.New("invalid heartbeat result")
+	}
+
+	return binary.BigEndian.Uint64(value), nil
+}
+
+// Assignment returns the partitions currently assigned to a consumer
+func (c *StreamClient) Assignment(topic, group, consumer string) (*StreamAssignment, error) {
 	conn, err := c.pool.Get()
 	if err != nil {
 		return nil, err
 	}
 	defer c.pool.Put(conn)
 
-	request := protocol.EncodeSConsumeRequest(topic, group, consumer, count)
+	request := protocol.EncodeSAssignmentRequest(topic, group, consumer)
 	if err := conn.Write(request); err != nil {
 		return nil, err
 	}
 
-	// Read response
-	status, payloadLen, err := conn.ReadHeader()
+	value, err := readValueResponse(conn)
 	if err != nil {
 		return nil, err
 	}
 
-	if status != protocol.StatusOK {
-		return nil, fmt.Errorf("server error: status %d", status)
+	if len(value) < 10 {
+		return nil, errors.New("invalid assignment")
+	}
+	assignment := &StreamAssignment{Generation: binary.BigEndian.Uint64(value)}
+	pos := 8
+
+	strategyLen := int(binary.BigEndian.Uint16(value[pos:]))
+	pos += 2
+	if len(value) < pos+strategyLen+2 {
+		return nil, errors.New("invalid assignment")
+	}
+	assignment.Strategy = string(value[pos : pos+strategyLen])
+	pos += strategyLen
+
+	count := int(binary.BigEndian.Uint16(value[pos:]))
+	pos += 2
+	if len(value) < pos+4*count {
+		return nil, errors.New("invalid assignment")
+	}
+	assignment.Partitions = make([]int, count)
+	for i := range assignment.Partitions {
+		assignment.Partitions[i] = int(binary.BigEndian.Uint32(value[pos:]))
+		pos += 4
 	}
 
-	payload, err := conn.Read(int(payloadLen))
+	return assignment, nil
+}
+
+// Consume consumes messages from a topic
+func (c *StreamClient) Consume(topic, group, consumer string, count int) ([]StreamMessage, error) {
+	conn, err := c.pool.Get()
 	if err != nil {
 		return nil, err
 	}
+	defer c.pool.Put(conn)
 
-	// Parse messages
-	var messages []StreamMessage
-	if err := json.Unmarshal(payload, &messages); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal messages: %w", err)
+	request := protocol.EncodeSConsumeRequest(topic, group, consumer, count)
+	if err := conn.Write(request); err != nil {
+		return nil, err
 	}
 
-	return messages, nil
+	return readStreamMessages(conn)
+}
+
+// ConsumeOptions configures a long-poll consume
+type ConsumeOptions struct {
+	// MaxWait is how long the server waits for new messages when none are
+	// available (capped at 20s); zero returns immediately
+	MaxWait time.Duration
+	// MinBytes keeps waiting until this many value bytes are collected
+	MinBytes int
+	// Filter overrides the subscription filter for this request
+	Filter string
+}
+
+// ConsumeWithOptions consumes messages, waiting up to opts.MaxWait for new
+// ones instead of returning an empty batch, and applying opts.Filter
+func (c *StreamClient) ConsumeWithOptions(topic, group, consumer string, count int, opts ConsumeOptions) ([]StreamMessage, error) {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer c.pool.Put(conn)
+
+	request := protocol.EncodeSConsumeOptsRequest(topic, group, consumer, count, int(opts.MaxWait.Milliseconds()), opts.MinBytes, opts.Filter)
+	if err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	return readStreamMessages(conn)
 }
 
 // Commit commits an offset for a consumer group
@@ -124,6 +730,59 @@ func (c *StreamClient) Commit(topic, group string, partition int, offset uint64)
 	return readOKResponse(conn)
 }
 
+// CommitAs commits an offset on behalf of a group member. It fails with
+// ErrRebalanceInProgress if the group rebalanced since the consumer subscribed.
+func (c *StreamClient) CommitAs(topic, group, consumer string, partition int, offset uint64) error {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return err
+	}
+	defer c.pool.Put(conn)
+
+	request := protocol.EncodeSCommitAsRequest(topic, group, consumer, partition, offset)
+	if err := conn.Write(request); err != nil {
+		return err
+	}
+
+	return streamError(readOKResponse(conn))
+}
+
+// Seek moves a group's position in a partition to offset, the next message
+// to read. Use partition -1 for every partition of the topic.
+func (c *StreamClient) Seek(group, topic string, partition int, offset uint64) error {
+	return c.seek(group, topic, partition, protocol.SeekOffset, int64(offset))
+}
+
+// SeekToBeginning moves a group to the oldest retained message
+func (c *StreamClient) SeekToBeginning(group, topic string, partition int) error {
+	return c.seek(group, topic, partition, protocol.SeekBeginning, 0)
+}
+
+// SeekToEnd moves a group past the newest message so it only sees new ones
+func (c *StreamClient) SeekToEnd(group, topic string, partition int) error {
+	return c.seek(group, topic, partition, protocol.SeekEnd, 0)
+}
+
+// SeekToTimestamp moves a group to the first message at or after ts (Unix ms)
+func (c *StreamClient) SeekToTimestamp(group, topic string, partition int, ts int64) error {
+	return c.seek(group, topic, partition, protocol.SeekTimestamp, ts)
+}
+
+func (c *StreamClient) seek(group, topic string, partition int, mode byte, value int64) error {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return err
+	}
+	defer c.pool.Put(conn)
+
+	request := protocol.EncodeSSeekRequest(topic, group, partition, mode, value)
+	if err := conn.Write(request); err != nil {
+		return err
+	}
+
+	return readOKResponse(conn)
+}
+
 // Unsubscribe removes a consumer from a group
 func (c *StreamClient) Unsubscribe(topic, group, consumer string) error {
 	conn, err := c.pool.Get()
@@ -139,3 +798,411 @@ func (c *StreamClient) Unsubscribe(topic, group, consumer string) error {
 
 	return readOKResponse(conn)
 }
+
+// streamError maps server error messages to the client's sentinel errors
+func streamError(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, sentinel := range []error{ErrRebalanceInProgress, ErrDuplicateSequence, ErrOutOfOrderSequence} {
+		if err.Error() == sentinel.Error() {
+			return sentinel
+		}
+	}
+	return err
+}
+
+// decodeStreamMessage decodes [8:offset][8:timestamp][2:keyLen][key][4:valueLen][value][4:partition]
+// [8:eventTime][headers]
+func decodeStreamMessage(data []byte) (StreamMessage, error) {
+	var msg StreamMessage
+	if len(data) < 18 {
+		return msg, errors.New("invalid stream message")
+	}
+
+	msg.Offset = binary.BigEndian.Uint64(data)
+	msg.ID = msg.Offset
+	msg.Timestamp = int64(binary.BigEndian.Uint64(data[8:]))
+	pos := 16
+
+	keyLen := int(binary.BigEndian.Uint16(data[pos:]))
+	pos += 2
+	if len(data) < pos+keyLen+4 {
+		return msg, errors.New("invalid stream message")
+	}
+	msg.Key = string(data[pos : pos+keyLen])
+	pos += keyLen
+
+	valueLen := int(binary.BigEndian.Uint32(data[pos:]))
+	pos += 4
+	if len(data) < pos+valueLen {
+		return msg, errors.New("invalid stream message")
+	}
+	msg.Value = data[pos : pos+valueLen]
+	pos += valueLen
+
+	if len(data) >= pos+4 {
+		msg.Partition = int(binary.BigEndian.Uint32(data[pos:]))
+		pos += 4
+	}
+
+	if len(data) >= pos+8+2 {
+		msg.EventTime = int64(binary.BigEndian.Uint64(data[pos:]))
+		pos += 8
+		headers, _, err := headercodec.Decode(data[pos:])
+		if err != nil {
+			return msg, err
+		}
+		msg.Headers = headers
+	}
+
+	return msg, nil
+}
+
+func readStreamMessages(conn *net.Connection) ([]StreamMessage, error) {
+	values, err := readMultiValueResponse(conn)
+	if err != nil {
+		return nil, streamError(err)
+	}
+
+	messages := make([]StreamMessage, 0, len(values))
+	for _, v := range values {
+		msg, err := decodeStreamMessage(v)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
+
+// decodeTopicInfo decodes [2:nameLen][name][4:partitions][8:retentionMs][8:retentionBytes][8:createdAt]
+// [2:policyLen][policy][2:compressionLen][compression][2:partitionerLen][partitioner]
+func decodeTopicInfo(data []byte) (TopicInfo, error) {
+	var info TopicInfo
+	if len(data) < 2 {
+		return info, errors.New("invalid topic entry")
+	}
+	nameLen := int(binary.BigEndian.Uint16(data))
+	if len(data) < 2+nameLen+28 {
+		return info, errors.New("invalid topic entry")
+	}
+
+	pos := 2 + nameLen
+	info.Name = string(data[2:pos])
+	info.Partitions = int(binary.BigEndian.Uint32(data[pos:]))
+	info.RetentionMs = int64(binary.BigEndian.Uint64(data[pos+4:]))
+	info.RetentionBytes = int64(binary.BigEndian.Uint64(data[pos+12:]))
+	info.CreatedAt = int64(binary.BigEndian.Uint64(data[pos+20:]))
+	pos += 28
+
+	var ok bool
+	if info.CleanupPolicy, ok = readString16(data, &pos); ok {
+		if info.Compression, ok = readString16(data, &pos); ok {
+			info.Partitioner, _ = readString16(data, &pos)
+		}
+	}
+
+	return info, nil
+}
+
+// Producer publishes idempotently: each batch carries the producer's ID and
+// a per-topic sequence number, so resending after a timeout or connection
+// error never duplicates messages. The sequence only advances on success,
+// so a failed call can simply be retried with the same records.
+type Producer struct {
+	client *StreamClient
+	id     uint64
+
+	mu     sync.Mutex
+	seqs   map[string]uint64
+	txnSeq uint64
+}
+
+// NewProducer allocates a producer ID from the server
+func (c *StreamClient) NewProducer() (*Producer, error) {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer c.pool.Put(conn)
+
+	if err := conn.Write(protocol.EncodeSInitProducerRequest()); err != nil {
+		return nil, err
+	}
+
+	result, err := readValueResponse(conn)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) != 8 {
+		return nil, errors.New("invalid producer ID")
+	}
+
+	return &Producer{
+		client: c,
+		id:     binary.BigEndian.Uint64(result),
+		seqs:   make(map[string]uint64),
+		txnSeq: 1,
+	}, nil
+}
+
+// ID returns the producer's server-assigned ID
+func (p *Producer) ID() uint64 {
+	return p.id
+}
+
+// Publish appends a message like StreamClient.Publish, deduplicating retries
+func (p *Producer) Publish(topic string, partition int, key string, value []byte) (int, uint64, error) {
+	return p.PublishRecord(topic, partition, StreamRecord{Key: key, Value: value})
+}
+
+// PublishRecord appends a message like StreamClient.PublishRecord,
+// deduplicating retries
+func (p *Producer) PublishRecord(topic string, partition int, rec StreamRecord) (int, uint64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	seq := p.seqs[topic]
+	part, offset, err := p.client.sendPublish(encodePublishRecord(topic, partition, rec, p.id, seq))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	p.seqs[topic] = seq + 1
+	return part, offset, nil
+}
+
+// PublishBatch appends records like StreamClient.PublishBatch,
+// deduplicating retries
+func (p *Producer) PublishBatch(topic string, partition int, records []StreamRecord) (int, []uint64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	seq := p.seqs[topic]
+	part, offsets, err := p.client.sendPublishBatch(encodePublishBatch(topic, partition, records, p.id, seq))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	p.seqs[topic] = seq + uint64(len(records))
+	return part, offsets, nil
+}
+
+// StreamTxn collects messages to publish and offsets to commit; Commit
+// applies them atomically
+type StreamTxn struct {
+	producer *Producer
+	group    string
+	consumer string
+	seq      uint64
+	records  []protocol.TxnRecord
+	offsets  []protocol.TxnOffset
+}
+
+// StreamOffset is where a transactional message was written
+type StreamOffset struct {
+	Topic     string
+	Partition int
+	Offset    uint64
+}
+
+// BeginTxn starts a transaction that commits offsets for group. If
+// consumer is set, Commit fails with ErrRebalanceInProgress unless it is
+// still a member of the group's current generation.
+func (p *Producer) BeginTxn(group, consumer string) *StreamTxn {
+	p.mu.Lock()
+	seq := p.txnSeq
+	p.mu.Unlock()
+
+	return &StreamTxn{producer: p, group: group, consumer: consumer, seq: seq}
+}
+
+// Publish adds a message to the transaction. With partition -1 the
+// partition is chosen from the key.
+func (t *StreamTxn) Publish(topic string, partition int, key string, value []byte) {
+	t.PublishRecord(topic, partition, StreamRecord{Key: key, Value: value})
+}
+
+// PublishRecord adds a message with optional event time and headers to the
+// transaction
+func (t *StreamTxn) PublishRecord(topic string, partition int, rec StreamRecord) {
+	t.records = append(t.records, protocol.TxnRecord{
+		Topic:      topic,
+		Partition:  partition,
+		Key:        rec.Key,
+		Value:      rec.Value,
+		RecordMeta: protocol.RecordMeta{EventTime: rec.EventTime, Headers: rec.Headers},
+	})
+}
+
+// CommitOffset adds a consumer offset, the next offset to read, to the
+// transaction
+func (t *StreamTxn) CommitOffset(topic string, partition int, offset uint64) {
+	t.offsets = append(t.offsets, protocol.TxnOffset{Topic: topic, Partition: partition, Offset: int64(offset)})
+}
+
+// Commit atomically publishes the messages and commits the offsets,
+// returning where each message was written. A failed Commit may be
+// retried; if an earlier attempt already succeeded, it returns that
+// attempt's offsets and nothing is applied twice.
+func (t *StreamTxn) Commit() ([]StreamOffset, error) {
+	c := t.producer.client
+	conn, err := c.pool.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer c.pool.Put(conn)
+
+	request := protocol.EncodeSTxnCommitRequest(t.producer.id, t.seq, t.group, t.consumer, t.records, t.offsets)
+	if err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	result, err := readValueResponse(conn)
+	if err != nil {
+		err = streamError(err)
+		if err == ErrDuplicateSequence {
+			t.producer.advanceTxn(t.seq)
+		}
+		return nil, err
+	}
+	if len(result) < 4 {
+		return nil, errors.New("invalid transaction result")
+	}
+	count := int(binary.BigEndian.Uint32(result))
+	if len(result) != 4+12*count || count != len(t.records) {
+		return nil, errors.New("invalid transaction result")
+	}
+
+	t.producer.advanceTxn(t.seq)
+
+	offsets := make([]StreamOffset, count)
+	for i := range offsets {
+		offsets[i] = StreamOffset{
+			Topic:     t.records[i].Topic,
+			Partition: int(binary.BigEndian.Uint32(result[4+12*i:])),
+			Offset:    binary.BigEndian.Uint64(result[8+12*i:]),
+		}
+	}
+	return offsets, nil
+}
+
+// advanceTxn moves the producer past a committed transaction sequence
+func (p *Producer) advanceTxn(seq uint64) {
+	p.mu.Lock()
+	if p.txnSeq <= seq {
+		p.txnSeq = seq + 1
+	}
+	p.mu.Unlock()
+}
+
+// CopyConfig describes a server-side job copying a topic into another
+// topic, on the same server or on another Flin node
+type CopyConfig struct {
+	// Source and Target are topic names; the target is created with the
+	// source's settings if it does not exist
+	Source string
+	Target string
+	// TargetAddr is the address of a remote node; empty copies locally
+	TargetAddr string
+	// StartOffset is the first offset copied from each partition
+	StartOffset uint64
+	// EndOffset stops each partition before this offset; 0 mirrors the
+	// source indefinitely
+	EndOffset uint64
+}
+
+// CopyJob is the state and progress of a copy job
+type CopyJob struct {
+	Name string
+	CopyConfig
+	// State is "running", "completed", "stopped" or "failed"
+	State string
+	Error string
+	// Copied counts messages copied since the job last started
+	Copied int64
+	// Lag is how many source messages remain to be copied
+	Lag int64
+}
+
+// StartCopy starts (or resumes) the named copy job on the server. The job
+// checkpoints its progress as offsets of the consumer group "__copy.<name>",
+// so it survives restarts and its lag appears in GroupLag.
+func (c *StreamClient) StartCopy(name string, cfg CopyConfig) error {
+	return c.copyRequest(protocol.EncodeSCopyStartRequest(name, cfg.Source, cfg.Target, cfg.TargetAddr, int64(cfg.StartOffset), int64(cfg.EndOffset)))
+}
+
+// StopCopy stops a copy job, keeping its checkpoints for StartCopy
+func (c *StreamClient) StopCopy(name string) error {
+	return c.copyRequest(protocol.EncodeSCopyStopRequest(name))
+}
+
+// DeleteCopy stops a copy job and removes it with its checkpoints
+func (c *StreamClient) DeleteCopy(name string) error {
+	return c.copyRequest(protocol.EncodeSCopyDeleteRequest(name))
+}
+
+func (c *StreamClient) copyRequest(request []byte) error {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return err
+	}
+	defer c.pool.Put(conn)
+
+	if err := conn.Write(request); err != nil {
+		return err
+	}
+
+	return readOKResponse(conn)
+}
+
+// ListCopyJobs returns every copy job on the server
+func (c *StreamClient) ListCopyJobs() ([]CopyJob, error) {
+	conn, err := c.pool.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer c.pool.Put(conn)
+
+	request := protocol.EncodeSCopyListRequest()
+	if err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	values, err := readMultiValueResponse(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]CopyJob, 0, len(values))
+	for _, v := range values {
+		// Decode: [2:name][2:source][2:target][2:addr][8:start][8:end][2:state][2:error][8:copied][8:lag]
+		var j CopyJob
+		pos := 0
+		ok := true
+		for _, field := range []*string{&j.Name, &j.Source, &j.Target, &j.TargetAddr} {
+			if ok {
+				*field, ok = readString16(v, &pos)
+			}
+		}
+		if !ok || len(v) < pos+16 {
+			return nil, errors.New("invalid copy job entry")
+		}
+		j.StartOffset = binary.BigEndian.Uint64(v[pos:])
+		j.EndOffset = binary.BigEndian.Uint64(v[pos+8:])
+		pos += 16
+		if j.State, ok = readString16(v, &pos); ok {
+			j.Error, ok = readString16(v, &pos)
+		}
+		if !ok || len(v) < pos+16 {
+			return nil, errors.New("invalid copy job entry")
+		}
+		j.Copied = int64(binary.BigEndian.Uint64(v[pos:]))
+		j.Lag = int64(binary.BigEndian.Uint64(v[pos+8:]))
+		jobs = append(jobs, j)
+	}
+
+	return jobs, nil
+}
@@ -11,7 +11,9 @@ import (
 
 	"github.com/skshohagmiah/clusterkit"
 	"github.com/skshohagmiah/flin/internal/db"
+	"github.com/skshohagmiah/flin/internal/kafka"
 	"github.com/skshohagmiah/flin/internal/kv"
+	"github.com/skshohagmiah/flin/internal/pubsub"
 	"github.com/skshohagmiah/flin/internal/queue"
 	"github.com/skshohagmiah/flin/internal/server"
 	"github.com/skshohagmiah/flin/internal/stream"
@@ -28,6 +30,11 @@ var (
 	partitionCount = flag.Int("partitions", 64, "Number of partitions")
 	workerCount    = flag.Int("workers", 64, "Number of worker goroutines")
 	useMemory      = flag.Bool("memory", false, "Use in-memory storage (like Redis)")
+	dedupWindow    = flag.Duration("queue-dedup-window", 5*time.Minute, "How long queue dedup IDs are remembered")
+	pubsubBuffer   = flag.Int("pubsub-buffer", pubsub.DefaultBufferLimit, "Undelivered Pub/Sub messages a subscriber may queue before it is dropped")
+	kafkaPort      = flag.String("kafka-port", "", "Kafka protocol port for streams (empty disables it)")
+	kafkaAdvertise = flag.String("kafka-advertised", "", "host:port Kafka clients are told to connect to (defaults to -kafka-port)")
+	kafkaAutoTopic = flag.Bool("kafka-auto-create", true, "Create topics requested by Kafka clients that do not exist")
 )
 
 func main() {
@@ -50,6 +57,9 @@ func main() {
 	fmt.Printf("   Raft:        %s\n", *raftAddr)
 	fmt.Printf("   KV Port:     %s\n", *kvPort)
 	fmt.Printf("   Queue Port:  %s\n", *queuePort)
+	if *kafkaPort != "" {
+		fmt.Printf("   Kafka Port:  %s\n", *kafkaPort)
+	}
 
 	if *useMemory {
 		fmt.Printf("   Storage:  IN-MEMORY (like Redis)\n")
@@ -94,6 +104,7 @@ func main() {
 		log.Fatalf("Failed to create queue store: %v", err)
 	}
 	defer queueStore.Close()
+	queueStore.SetDedupWindow(*dedupWindow)
 
 	// Create Stream store (always disk-based)
 	streamDataDir := *dataDir + "/stream"
@@ -158,6 +169,7 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to create server: %v", err)
 	}
+	srv.GetPubSub().SetBufferLimit(*pubsubBuffer)
 
 	// Start HTTP API server in a goroutine
 	httpAPIAddr := ":8888" // Default HTTP API port
@@ -173,6 +185,24 @@ func main() {
 		}
 	}()
 
+	// Start the Kafka protocol listener for streams
+	var kafkaServer *kafka.Server
+	if *kafkaPort != "" {
+		kafkaServer, err = kafka.New(streamStore, *kafkaPort, kafka.Options{
+			Advertised:       *kafkaAdvertise,
+			AutoCreateTopics: *kafkaAutoTopic,
+		})
+		if err != nil {
+			log.Fatalf("Failed to create Kafka server: %v", err)
+		}
+		go func() {
+			log.Printf("📨 Kafka protocol server starting on %s", *kafkaPort)
+			if err := kafkaServer.Start(); err != nil {
+				log.Printf("❌ Kafka protocol server error: %v", err)
+			}
+		}()
+	}
+
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -181,6 +211,9 @@ func main() {
 		<-sigChan
 		fmt.Println("\nShutting down server...")
 		srv.Stop()
+		if kafkaServer != nil {
+			kafkaServer.Stop()
+		}
 		ck.Stop()
 		// Note: store, queueStore, streamStore, and docStore are closed via defer
 		os.Exit(0)
@@ -3,6 +3,7 @@ package db
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -15,8 +16,9 @@ import (
 type DocStore struct {
 	storage *storage.DocStorage
 	mu      sync.RWMutex
-	// Index tracking: collection -> field -> value -> document IDs
-	indexes map[string]map[string]map[interface{}][]string
+	// Indexed fields: collection -> field -> definition. The entries
+	// themselves are idx: keys in storage.
+	indexes map[string]map[string]*IndexMetadata
 }
 
 // New creates a new document store
@@ -28,7 +30,7 @@ func New(path string) (*DocStore, error) {
 
 	ds := &DocStore{
 		storage: store,
-		indexes: make(map[string]map[string]map[interface{}][]string),
+		indexes: make(map[string]map[string]*IndexMetadata),
 	}
 
 	// Load existing indexes from metadata
@@ -72,14 +74,26 @@ func (ds *DocStore) Insert(collection string, doc Document) (string, error) {
 		return "", fmt.Errorf("failed to marshal document: %w", err)
 	}
 
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
 	key := makeKey(collection, id)
-	if err := ds.storage.Set(key, data); err != nil {
+	err = ds.storage.Update(func(tx *storage.DocTxn) error {
+		// An insert with an existing ID replaces that document
+		oldDoc, err := getDocument(tx, key)
+		if err != nil && err != ErrDocumentNotFound {
+			return err
+		}
+
+		if err := tx.Set(key, data); err != nil {
+			return err
+		}
+		return ds.writeIndexes(tx, collection, id, oldDoc, doc)
+	})
+	if err != nil {
 		return "", fmt.Errorf("failed to insert document: %w", err)
 	}
 
-	// Update indexes
-	ds.updateIndexes(collection, id, doc)
-
 	return id, nil
 }
 
@@ -112,20 +126,59 @@ func (ds *DocStore) Find(collection string, opts FindOptions) ([]Document, error
 		return nil, ErrInvalidCollection
 	}
 
-	prefix := makeCollectionPrefix(collection)
-	var results []Document
+	// Hold the lock so no index is rebuilt while it is read
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	plan, err := ds.planQuery(collection, opts)
+	if err != nil {
+		return nil, err
+	}
 
-	err := ds.storage.Scan(prefix, func(key string, data []byte) error {
+	var results []Document
+	collect := func(key string, data []byte) error {
 		var doc Document
 		if err := json.Unmarshal(data, &doc); err != nil {
 			return err
 		}
 
-		// Apply filters
+		// Index lookups can find extra documents, so every filter is
+		// applied
 		if matchesFilters(doc, opts.Filters) {
 			results = append(results, doc)
 		}
 
+		return nil
+	}
+
+	// Index entries and documents are read from one snapshot
+	err = ds.storage.View(func(tx *storage.DocTxn) error {
+		if plan.Index == "" {
+			return tx.Scan(makeCollectionPrefix(collection), collect)
+		}
+
+		ids, err := candidates(tx, plan)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			// Sorted candidates can stop once the requested page is full
+			if plan.Sorted && opts.Limit > 0 && len(results) >= opts.Skip+opts.Limit {
+				break
+			}
+
+			key := makeKey(collection, id)
+			data, err := tx.Get(key)
+			if err == badger.ErrKeyNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := collect(key, data); err != nil {
+				return err
+			}
+		}
 		return nil
 	})
 
@@ -134,7 +187,7 @@ func (ds *DocStore) Find(collection string, opts FindOptions) ([]Document, error
 	}
 
 	// Apply sorting
-	if opts.Sort != nil {
+	if opts.Sort != nil && !plan.Sorted {
 		sortResults(results, opts.Sort)
 	}
 
@@ -175,52 +228,51 @@ func (ds *DocStore) Update(collection, id string, opts UpdateOptions) error {
 		return ErrInvalidDocument
 	}
 
-	// Get existing document
-	doc, err := ds.Get(collection, id)
-	if err != nil {
-		return err
-	}
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
 
-	// Save old doc for index updates
-	oldDoc := make(Document)
-	for k, v := range doc {
-		oldDoc[k] = v
-	}
+	key := makeKey(collection, id)
+	return ds.storage.Update(func(tx *storage.DocTxn) error {
+		// Get existing document
+		oldDoc, err := getDocument(tx, key)
+		if err != nil {
+			return err
+		}
 
-	// Apply updates
-	if opts.Merge {
-		for k, v := range opts.Set {
+		doc := make(Document)
+		for k, v := range oldDoc {
 			doc[k] = v
 		}
-	} else {
-		doc = opts.Set
-		doc["_id"] = id // Preserve ID
-	}
 
-	// Update timestamp
-	doc["_updated_at"] = time.Now().UnixMilli()
+		// Apply updates
+		if opts.Merge {
+			for k, v := range opts.Set {
+				doc[k] = v
+			}
+		} else {
+			doc = opts.Set
+			doc["_id"] = id // Preserve ID
+		}
 
-	// Remove unset fields
-	for _, field := range opts.Unset {
-		delete(doc, field)
-	}
+		// Update timestamp
+		doc["_updated_at"] = time.Now().UnixMilli()
 
-	// Marshal and store
-	data, err := json.Marshal(doc)
-	if err != nil {
-		return fmt.Errorf("failed to marshal document: %w", err)
-	}
-
-	key := makeKey(collection, id)
-	if err := ds.storage.Set(key, data); err != nil {
-		return err
-	}
+		// Remove unset fields
+		for _, field := range opts.Unset {
+			delete(doc, field)
+		}
 
-	// Update indexes
-	ds.removeIndexes(collection, id, oldDoc)
-	ds.updateIndexes(collection, id, doc)
+		// Marshal and store
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return fmt.Errorf("failed to marshal document: %w", err)
+		}
 
-	return nil
+		if err := tx.Set(key, data); err != nil {
+			return err
+		}
+		return ds.writeIndexes(tx, collection, id, oldDoc, doc)
+	})
 }
 
 // Delete removes a document
@@ -229,21 +281,22 @@ func (ds *DocStore) Delete(collection, id string) error {
 		return ErrInvalidDocument
 	}
 
-	// Get document before deletion for index updates
-	doc, err := ds.Get(collection, id)
-	if err != nil {
-		return err
-	}
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
 
 	key := makeKey(collection, id)
-	if err := ds.storage.Delete(key); err != nil {
-		return err
-	}
-
-	// Update indexes
-	ds.removeIndexes(collection, id, doc)
+	return ds.storage.Update(func(tx *storage.DocTxn) error {
+		// Get document before deletion for index updates
+		doc, err := getDocument(tx, key)
+		if err != nil {
+			return err
+		}
 
-	return nil
+		if err := tx.Delete(key); err != nil {
+			return err
+		}
+		return ds.writeIndexes(tx, collection, id, doc, nil)
+	})
 }
 
 // DeleteMany removes all documents matching a query
@@ -277,53 +330,56 @@ func (ds *DocStore) Count(collection string) (int64, error) {
 	return ds.storage.Count(prefix)
 }
 
-// CreateIndex builds an index on a field
-func (ds *DocStore) CreateIndex(collection, field string) error {
+// CreateIndex builds an index named field on that field, or on
+// opts.Fields for a compound index. Creating an existing index rebuilds it
+// with the new options. A unique index fails with a *UniqueViolationError
+// if documents already repeat its values.
+func (ds *DocStore) CreateIndex(collection, field string, opts ...IndexOptions) error {
 	if collection == "" || field == "" {
 		return ErrInvalidDocument
 	}
 
-	ds.mu.Lock()
-	defer ds.mu.Unlock()
-
-	// Initialize collection indexes if needed
-	if _, ok := ds.indexes[collection]; !ok {
-		ds.indexes[collection] = make(map[string]map[interface{}][]string)
+	meta := &IndexMetadata{
+		Collection: collection,
+		Field:      field,
+		Fields:     []string{field},
+		CreatedAt:  time.Now().UnixMilli(),
 	}
-
-	// Initialize field index
-	if _, ok := ds.indexes[collection][field]; !ok {
-		ds.indexes[collection][field] = make(map[interface{}][]string)
+	for _, o := range opts {
+		if len(o.Fields) > 0 {
+			meta.Fields = append([]string(nil), o.Fields...)
+		}
+		meta.Unique = meta.Unique || o.Unique
 	}
 
-	// Scan all documents and build index
-	prefix := makeCollectionPrefix(collection)
-	err := ds.storage.Scan(prefix, func(key string, data []byte) error {
-		var doc Document
-		if err := json.Unmarshal(data, &doc); err != nil {
-			return err
+	seen := make(map[string]bool)
+	for _, f := range meta.Fields {
+		if f == "" || seen[f] {
+			return ErrInvalidDocument
 		}
+		seen[f] = true
+	}
 
-		id, ok := doc["_id"].(string)
-		if !ok {
-			return nil
-		}
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
 
-		// Add to index
-		if val, ok := doc[field]; ok {
-			if _, exists := ds.indexes[collection][field][val]; !exists {
-				ds.indexes[collection][field][val] = []string{}
+	if err := ds.buildIndex(meta); err != nil {
+		// The build cleared the index's entries, so restore any index it
+		// was replacing
+		if old, ok := ds.indexes[collection][field]; ok {
+			if rebuildErr := ds.buildIndex(old); rebuildErr != nil {
+				return rebuildErr
 			}
-			ds.indexes[collection][field][val] = append(ds.indexes[collection][field][val], id)
 		}
-
-		return nil
-	})
-
-	if err != nil {
 		return err
 	}
 
+	// Initialize collection indexes if needed
+	if _, ok := ds.indexes[collection]; !ok {
+		ds.indexes[collection] = make(map[string]*IndexMetadata)
+	}
+	ds.indexes[collection][field] = meta
+
 	return ds.saveIndexMetadata()
 }
 
@@ -336,10 +392,15 @@ func (ds *DocStore) DropIndex(collection, field string) error {
 		delete(coll, field)
 	}
 
-	return ds.saveIndexMetadata()
+	// Forget the index before deleting its entries, so a crash leaves
+	// only unused keys behind
+	if err := ds.saveIndexMetadata(); err != nil {
+		return err
+	}
+	return ds.clearIndex(collection, field)
 }
 
-// ListIndexes returns all indexes for a collection
+// ListIndexes returns the names of all indexes for a collection
 func (ds *DocStore) ListIndexes(collection string) []string {
 	ds.mu.RLock()
 	defer ds.mu.RUnlock()
@@ -350,9 +411,26 @@ func (ds *DocStore) ListIndexes(collection string) []string {
 			indexes = append(indexes, field)
 		}
 	}
+	sort.Strings(indexes)
 	return indexes
 }
 
+// IndexDefinitions returns the definitions of all indexes for a
+// collection, ordered by name
+func (ds *DocStore) IndexDefinitions(collection string) []IndexMetadata {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	var defs []IndexMetadata
+	for _, meta := range ds.indexes[collection] {
+		defs = append(defs, *meta)
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].Field < defs[j].Field
+	})
+	return defs
+}
+
 // Query returns a query builder for the collection
 func (ds *DocStore) Query(collection string) *QueryBuilder {
 	return NewQueryBuilder(collection)
@@ -368,58 +446,60 @@ func makeCollectionPrefix(collection string) string {
 	return fmt.Sprintf("doc:%s:", collection)
 }
 
-func (ds *DocStore) updateIndexes(collection, id string, doc Document) {
-	ds.mu.Lock()
-	defer ds.mu.Unlock()
-
-	coll, ok := ds.indexes[collection]
-	if !ok {
-		return
+// getDocument reads and decodes a document within a transaction
+func getDocument(tx *storage.DocTxn, key string) (Document, error) {
+	data, err := tx.Get(key)
+	if err != nil {
+		if err == badger.ErrKeyNotFound {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
 	}
 
-	for field, fieldIndex := range coll {
-		if val, exists := doc[field]; exists {
-			if _, ok := fieldIndex[val]; !ok {
-				fieldIndex[val] = []string{}
-			}
-			fieldIndex[val] = append(fieldIndex[val], id)
-		}
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
 	}
+	return doc, nil
 }
 
-func (ds *DocStore) removeIndexes(collection, id string, doc Document) {
-	ds.mu.Lock()
-	defer ds.mu.Unlock()
+// Index metadata keys. indexesKey holds the index definitions;
+// legacyIndexesKey is the field list written by older versions, which
+// kept index entries only in memory.
+const (
+	indexesKey       = "db:indexes"
+	legacyIndexesKey = "db:indexes_metadata"
+)
 
-	coll, ok := ds.indexes[collection]
-	if !ok {
-		return
-	}
-
-	for field, fieldIndex := range coll {
-		if val, exists := doc[field]; exists {
-			if ids, ok := fieldIndex[val]; ok {
-				newIds := []string{}
-				for _, existingId := range ids {
-					if existingId != id {
-						newIds = append(newIds, existingId)
-					}
-				}
-				if len(newIds) == 0 {
-					delete(fieldIndex, val)
-				} else {
-					fieldIndex[val] = newIds
-				}
-			}
+func (ds *DocStore) loadIndexMetadata() error {
+	var metadata []IndexMetadata
+	err := ds.storage.GetJSON(indexesKey, &metadata)
+	if err == badger.ErrKeyNotFound {
+		return ds.migrateIndexMetadata()
+	}
+	if err != nil {
+		return err
+	}
+
+	for i := range metadata {
+		meta := &metadata[i]
+		if len(meta.Fields) == 0 {
+			meta.Fields = []string{meta.Field}
+		}
+		if _, ok := ds.indexes[meta.Collection]; !ok {
+			ds.indexes[meta.Collection] = make(map[string]*IndexMetadata)
 		}
+		ds.indexes[meta.Collection][meta.Field] = meta
 	}
-}
 
-func (ds *DocStore) loadIndexMetadata() error {
-	metadataKey := "db:indexes_metadata"
+	return nil
+}
 
-	var metadata map[string][]string
-	err := ds.storage.GetJSON(metadataKey, &metadata)
+// migrateIndexMetadata builds the stored entries of indexes listed in the
+// legacy metadata, then replaces it with the current format
+func (ds *DocStore) migrateIndexMetadata() error {
+	var legacy map[string][]string
+	err := ds.storage.GetJSON(legacyIndexesKey, &legacy)
 	if err != nil {
 		if err == badger.ErrKeyNotFound {
 			return nil // No metadata yet
@@ -427,26 +507,39 @@ func (ds *DocStore) loadIndexMetadata() error {
 		return err
 	}
 
-	// Rebuild index structure
-	for collection, fields := range metadata {
-		if _, ok := ds.indexes[collection]; !ok {
-			ds.indexes[collection] = make(map[string]map[interface{}][]string)
-		}
+	now := time.Now().UnixMilli()
+	for collection, fields := range legacy {
 		for _, field := range fields {
-			ds.indexes[collection][field] = make(map[interface{}][]string)
+			meta := &IndexMetadata{Collection: collection, Field: field, Fields: []string{field}, CreatedAt: now}
+			if err := ds.buildIndex(meta); err != nil {
+				return err
+			}
+			if _, ok := ds.indexes[collection]; !ok {
+				ds.indexes[collection] = make(map[string]*IndexMetadata)
+			}
+			ds.indexes[collection][field] = meta
 		}
 	}
 
-	return nil
+	if err := ds.saveIndexMetadata(); err != nil {
+		return err
+	}
+	return ds.storage.Delete(legacyIndexesKey)
 }
 
 func (ds *DocStore) saveIndexMetadata() error {
-	metadata := make(map[string][]string)
-	for collection, coll := range ds.indexes {
-		for field := range coll {
-			metadata[collection] = append(metadata[collection], field)
+	metadata := []IndexMetadata{}
+	for _, coll := range ds.indexes {
+		for _, meta := range coll {
+			metadata = append(metadata, *meta)
 		}
 	}
+	sort.Slice(metadata, func(i, j int) bool {
+		if metadata[i].Collection != metadata[j].Collection {
+			return metadata[i].Collection < metadata[j].Collection
+		}
+		return metadata[i].Field < metadata[j].Field
+	})
 
-	return ds.storage.SetJSON("db:indexes_metadata", metadata)
+	return ds.storage.SetJSON(indexesKey, metadata)
 }
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"errors"
 	"testing"
 	"time"
 )
@@ -215,6 +216,442 @@ func TestIndex(t *testing.T) {
 	}
 }
 
+// TestIndexedFind tests that index-backed queries return the same
+// documents as a collection scan
+func TestIndexedFind(t *testing.T) {
+	db := createTestDB(t)
+	defer db.Close()
+
+	for i := 0; i < 20; i++ {
+		db.Insert("users", Document{
+			"name":  "User " + string(rune('A'+i)),
+			"age":   20 + i%5,
+			"email": "user" + string(rune('a'+i)) + "@example.com",
+		})
+	}
+
+	queries := []FindOptions{
+		{Filters: []Query{{Field: "age", Operator: "eq", Value: 22}}},
+		{Filters: []Query{{Field: "age", Operator: "in", Value: []interface{}{21, 23, 99}}}},
+		{Filters: []Query{{Field: "age", Operator: "gte", Value: 22}, {Field: "age", Operator: "lt", Value: 24}}},
+		{Filters: []Query{{Field: "age", Operator: "gt", Value: 21}, {Field: "name", Operator: "eq", Value: "User H"}}},
+		{Filters: []Query{{Field: "age", Operator: "eq", Value: "22"}}},
+	}
+
+	var want [][]Document
+	for _, q := range queries {
+		results, err := db.Find("users", q)
+		if err != nil {
+			t.Fatalf("Failed to find: %v", err)
+		}
+		want = append(want, results)
+	}
+
+	if err := db.CreateIndex("users", "age"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	for i, q := range queries {
+		plan, err := db.Explain("users", q)
+		if err != nil {
+			t.Fatalf("Failed to explain: %v", err)
+		}
+		if plan.Index != "age" {
+			t.Errorf("Query %d: expected index on age, got %s", i, plan)
+		}
+
+		results, err := db.Find("users", q)
+		if err != nil {
+			t.Fatalf("Failed to find: %v", err)
+		}
+		if len(results) != len(want[i]) {
+			t.Fatalf("Query %d: expected %d results, got %d", i, len(want[i]), len(results))
+		}
+		for j := range results {
+			if results[j]["_id"] != want[i][j]["_id"] {
+				t.Errorf("Query %d: result %d differs from scan", i, j)
+			}
+		}
+	}
+
+	// Indexed results follow updates and deletes
+	results, _ := db.Find("users", queries[0])
+	id := results[0]["_id"].(string)
+	db.Update("users", id, UpdateOptions{Set: Document{"age": 40}, Merge: true})
+	db.Delete("users", results[1]["_id"].(string))
+
+	results, _ = db.Find("users", queries[0])
+	if len(results) != len(want[0])-2 {
+		t.Errorf("Expected %d results after update and delete, got %d", len(want[0])-2, len(results))
+	}
+	results, _ = db.Find("users", FindOptions{Filters: []Query{{Field: "age", Operator: "gte", Value: 40}}})
+	if len(results) != 1 || results[0]["_id"] != id {
+		t.Errorf("Expected updated document in range, got %d results", len(results))
+	}
+}
+
+// TestExplain tests query plan selection
+func TestExplain(t *testing.T) {
+	db := createTestDB(t)
+	defer db.Close()
+
+	db.Insert("users", Document{"email": "a@example.com", "age": 30})
+	db.CreateIndex("users", "email")
+	db.CreateIndex("users", "age")
+
+	plan, err := db.Explain("users", FindOptions{Filters: []Query{
+		{Field: "age", Operator: "gt", Value: 20},
+		{Field: "email", Operator: "eq", Value: "a@example.com"},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to explain: %v", err)
+	}
+	if plan.Index != "email" || plan.Lookup != PlanEq || len(plan.Filters) != 1 {
+		t.Errorf("Expected eq lookup on email, got %s", plan)
+	}
+
+	plan, _ = db.Explain("users", FindOptions{Filters: []Query{{Field: "name", Operator: "eq", Value: "x"}}})
+	if plan.Index != "" || plan.Lookup != PlanScan {
+		t.Errorf("Expected collection scan, got %s", plan)
+	}
+
+	plan, _ = db.Explain("users", FindOptions{
+		Filters:   []Query{{Field: "age", Operator: "gt", Value: 20}, {Field: "email", Operator: "eq", Value: "a@example.com"}},
+		IndexName: "age",
+	})
+	if plan.Index != "age" || plan.Lookup != PlanRange {
+		t.Errorf("Expected range lookup on hinted index, got %s", plan)
+	}
+
+	if _, err := db.Find("users", FindOptions{IndexName: "missing"}); err == nil {
+		t.Error("Expected error for unknown index")
+	}
+}
+
+// TestIndexPersistence tests that index entries survive a restart and
+// follow writes made before it
+func TestIndexPersistence(t *testing.T) {
+	dir := t.TempDir()
+	db, err := New(dir)
+	if err != nil {
+		t.Fatalf("Failed to create test DB: %v", err)
+	}
+
+	db.CreateIndex("users", "age")
+	var ids []string
+	for i := 0; i < 6; i++ {
+		id, _ := db.Insert("users", Document{"age": 20 + i})
+		ids = append(ids, id)
+	}
+	db.Update("users", ids[0], UpdateOptions{Set: Document{"age": 25}, Merge: true})
+	db.Delete("users", ids[1])
+	db.Close()
+
+	db, err = New(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	defer db.Close()
+
+	if indexes := db.ListIndexes("users"); len(indexes) != 1 || indexes[0] != "age" {
+		t.Fatalf("Expected index on age after restart, got %v", indexes)
+	}
+
+	results, err := db.Find("users", FindOptions{Filters: []Query{{Field: "age", Operator: "eq", Value: 25}}})
+	if err != nil {
+		t.Fatalf("Failed to find: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("Expected 2 documents with age 25, got %d", len(results))
+	}
+
+	results, _ = db.Find("users", FindOptions{Filters: []Query{{Field: "age", Operator: "lt", Value: 22}}})
+	if len(results) != 0 {
+		t.Errorf("Expected no documents below 22, got %d", len(results))
+	}
+}
+
+// TestIndexMatchesScan tests that indexed queries over values of every
+// kind return what a collection scan returns, in the same order, and that
+// filters the index cannot answer exactly are left to the scan
+func TestIndexMatchesScan(t *testing.T) {
+	dir := t.TempDir()
+	db, err := New(dir)
+	if err != nil {
+		t.Fatalf("Failed to create test DB: %v", err)
+	}
+	defer db.Close()
+
+	values := []interface{}{-10.5, -1, 0, 0.25, 3, 3, 1e9, "", "3", "a", "a\x00b", "true", true, false, nil, "<nil>", []interface{}{"x", 1}}
+	for i, v := range values {
+		db.Insert("items", Document{"v": v, "g": i % 2})
+	}
+	db.Insert("items", Document{"g": 0})
+
+	tests := []struct {
+		name   string
+		opts   FindOptions
+		lookup string
+		sorted bool
+	}{
+		{"number eq matches string", FindOptions{Filters: []Query{{Field: "v", Operator: "eq", Value: 3}}}, PlanEq, false},
+		{"string eq matches number", FindOptions{Filters: []Query{{Field: "v", Operator: "eq", Value: "3"}}}, PlanEq, false},
+		{"bool eq", FindOptions{Filters: []Query{{Field: "v", Operator: "eq", Value: true}}}, PlanEq, false},
+		{"null eq", FindOptions{Filters: []Query{{Field: "v", Operator: "eq", Value: nil}}}, PlanEq, false},
+		{"string eq", FindOptions{Filters: []Query{{Field: "v", Operator: "eq", Value: "a\x00b"}}}, PlanEq, false},
+		{"array eq", FindOptions{Filters: []Query{{Field: "v", Operator: "eq", Value: []interface{}{"x", 1}}}}, PlanScan, false},
+		{"in", FindOptions{Filters: []Query{{Field: "v", Operator: "in", Value: []interface{}{false, "<nil>", 3, "a"}}}}, PlanIn, false},
+		{"in with array", FindOptions{Filters: []Query{{Field: "v", Operator: "in", Value: []interface{}{3, []interface{}{"x", 1}}}}}, PlanScan, false},
+		{"range above 0", FindOptions{Filters: []Query{{Field: "v", Operator: "gt", Value: 0}}}, PlanRange, false},
+		{"range below 0", FindOptions{Filters: []Query{{Field: "v", Operator: "lte", Value: -1}}}, PlanRange, false},
+		{"range with string bound", FindOptions{Filters: []Query{{Field: "v", Operator: "gte", Value: "a"}}}, PlanScan, false},
+		{"range holding 0", FindOptions{Filters: []Query{{Field: "v", Operator: "gt", Value: -2}}}, PlanScan, false},
+		{"empty range", FindOptions{Filters: []Query{{Field: "v", Operator: "gt", Value: 5}, {Field: "v", Operator: "lt", Value: 1}}}, PlanRange, false},
+		{"sorted range", FindOptions{Filters: []Query{{Field: "v", Operator: "gt", Value: 0}}, Sort: &SortOption{Field: "v", Direction: SortDesc}, Limit: 3}, PlanRange, true},
+		{"sorted negative range", FindOptions{Filters: []Query{{Field: "v", Operator: "lt", Value: 0}}, Sort: &SortOption{Field: "v", Direction: SortAsc}}, PlanRange, true},
+		{"eq sorted by next field", FindOptions{Filters: []Query{{Field: "g", Operator: "eq", Value: 0}}, Sort: &SortOption{Field: "v", Direction: SortAsc}}, PlanEq, false},
+		{"eq and range", FindOptions{Filters: []Query{{Field: "g", Operator: "eq", Value: "1"}, {Field: "v", Operator: "gte", Value: 3}}, Sort: &SortOption{Field: "v", Direction: SortAsc}}, PlanRange, true},
+	}
+
+	var want [][]Document
+	for _, tt := range tests {
+		results, err := db.Find("items", tt.opts)
+		if err != nil {
+			t.Fatalf("%s: failed to scan: %v", tt.name, err)
+		}
+		want = append(want, results)
+	}
+
+	db.CreateIndex("items", "v")
+	db.CreateIndex("items", "g_v", IndexOptions{Fields: []string{"g", "v"}})
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := db.Explain("items", tt.opts)
+			if err != nil {
+				t.Fatalf("Failed to explain: %v", err)
+			}
+			if plan.Lookup != tt.lookup || plan.Sorted != tt.sorted {
+				t.Errorf("Expected %s lookup, sorted %v, got %s", tt.lookup, tt.sorted, plan)
+			}
+
+			results, err := db.Find("items", tt.opts)
+			if err != nil {
+				t.Fatalf("Failed to find: %v", err)
+			}
+			if len(results) != len(want[i]) {
+				t.Fatalf("Expected %d results as a scan, got %d", len(want[i]), len(results))
+			}
+			for j := range results {
+				if results[j]["_id"] != want[i][j]["_id"] {
+					t.Errorf("Result %d differs from scan: %v, want %v", j, results[j]["v"], want[i][j]["v"])
+				}
+			}
+		})
+	}
+}
+
+// TestLegacyIndexMetadata tests that indexes recorded by older versions
+// are built when the store opens
+func TestLegacyIndexMetadata(t *testing.T) {
+	dir := t.TempDir()
+	db, err := New(dir)
+	if err != nil {
+		t.Fatalf("Failed to create test DB: %v", err)
+	}
+	db.Insert("users", Document{"email": "a@example.com"})
+	db.storage.SetJSON(legacyIndexesKey, map[string][]string{"users": {"email"}})
+	db.Close()
+
+	db, err = New(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	defer db.Close()
+
+	plan, _ := db.Explain("users", FindOptions{Filters: []Query{{Field: "email", Operator: "eq", Value: "a@example.com"}}})
+	if plan.Index != "email" {
+		t.Fatalf("Expected migrated index on email, got %s", plan)
+	}
+	results, _ := db.Find("users", FindOptions{Filters: []Query{{Field: "email", Operator: "eq", Value: "a@example.com"}}})
+	if len(results) != 1 {
+		t.Errorf("Expected 1 result from migrated index, got %d", len(results))
+	}
+}
+
+// TestUniqueIndex tests that a unique index rejects duplicate values
+func TestUniqueIndex(t *testing.T) {
+	db := createTestDB(t)
+	defer db.Close()
+
+	if err := db.CreateIndex("users", "email", IndexOptions{Unique: true}); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	id, err := db.Insert("users", Document{"email": "a@example.com"})
+	if err != nil {
+		t.Fatalf("Failed to insert: %v", err)
+	}
+
+	_, err = db.Insert("users", Document{"email": "a@example.com"})
+	var violation *UniqueViolationError
+	if !errors.As(err, &violation) || !errors.Is(err, ErrDuplicateKey) {
+		t.Fatalf("Expected unique violation, got %v", err)
+	}
+	if violation.Index != "email" || violation.ExistingID != id {
+		t.Errorf("Unexpected violation details: %+v", violation)
+	}
+
+	// Documents without the field are not constrained
+	db.Insert("users", Document{"name": "no email"})
+	if _, err := db.Insert("users", Document{"name": "no email"}); err != nil {
+		t.Errorf("Expected documents without email to insert, got %v", err)
+	}
+
+	other, _ := db.Insert("users", Document{"email": "b@example.com"})
+	err = db.Update("users", other, UpdateOptions{Set: Document{"email": "a@example.com"}, Merge: true})
+	if !errors.Is(err, ErrDuplicateKey) {
+		t.Fatalf("Expected unique violation on update, got %v", err)
+	}
+	doc, _ := db.Get("users", other)
+	if doc["email"] != "b@example.com" {
+		t.Errorf("Expected rejected update to leave document unchanged, got %v", doc["email"])
+	}
+
+	// Rewriting a document with its own value is allowed
+	if err := db.Update("users", id, UpdateOptions{Set: Document{"name": "A"}, Merge: true}); err != nil {
+		t.Errorf("Failed to update document keeping its email: %v", err)
+	}
+
+	count, _ := db.Count("users")
+	if count != 4 {
+		t.Errorf("Expected 4 documents, got %d", count)
+	}
+}
+
+// TestUniqueIndexExistingDuplicates tests that a unique index cannot be
+// created over repeated values
+func TestUniqueIndexExistingDuplicates(t *testing.T) {
+	db := createTestDB(t)
+	defer db.Close()
+
+	db.Insert("users", Document{"email": "a@example.com"})
+	db.Insert("users", Document{"email": "a@example.com"})
+	db.CreateIndex("users", "email")
+
+	err := db.CreateIndex("users", "email", IndexOptions{Unique: true})
+	if !errors.Is(err, ErrDuplicateKey) {
+		t.Fatalf("Expected unique violation, got %v", err)
+	}
+
+	// The existing index is kept and still answers queries
+	defs := db.IndexDefinitions("users")
+	if len(defs) != 1 || defs[0].Unique {
+		t.Fatalf("Expected original non-unique index, got %+v", defs)
+	}
+	results, _ := db.Find("users", FindOptions{Filters: []Query{{Field: "email", Operator: "eq", Value: "a@example.com"}}})
+	if len(results) != 2 {
+		t.Errorf("Expected 2 results, got %d", len(results))
+	}
+}
+
+// TestCompoundIndex tests equality-prefix, range and sorted queries on a
+// compound index
+func TestCompoundIndex(t *testing.T) {
+	dir := t.TempDir()
+	db, err := New(dir)
+	if err != nil {
+		t.Fatalf("Failed to create test DB: %v", err)
+	}
+
+	for i := 0; i < 30; i++ {
+		db.Insert("events", Document{
+			"tenant_id":  "t" + string(rune('0'+i%3)),
+			"created_at": 1000 + (i*7)%30,
+			"kind":       []string{"a", "b"}[i%2],
+		})
+	}
+
+	err = db.CreateIndex("events", "tenant_created", IndexOptions{Fields: []string{"tenant_id", "created_at"}})
+	if err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	db.Close()
+
+	db, err = New(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen DB: %v", err)
+	}
+	defer db.Close()
+
+	defs := db.IndexDefinitions("events")
+	if len(defs) != 1 || len(defs[0].Fields) != 2 || defs[0].Fields[1] != "created_at" {
+		t.Fatalf("Expected compound index definition after restart, got %+v", defs)
+	}
+
+	queries := []FindOptions{
+		{Filters: []Query{{Field: "tenant_id", Operator: "eq", Value: "t1"}}},
+		{Filters: []Query{{Field: "created_at", Operator: "gte", Value: 1010}, {Field: "tenant_id", Operator: "eq", Value: "t2"}, {Field: "created_at", Operator: "lt", Value: 1020}}},
+		{Filters: []Query{{Field: "tenant_id", Operator: "eq", Value: "t0"}, {Field: "created_at", Operator: "eq", Value: 1021}}},
+		{Filters: []Query{{Field: "tenant_id", Operator: "in", Value: []interface{}{"t0", "t2"}}, {Field: "kind", Operator: "eq", Value: "a"}}},
+		{Filters: []Query{{Field: "tenant_id", Operator: "eq", Value: "t1"}}, Sort: &SortOption{Field: "created_at", Direction: SortDesc}, Skip: 2, Limit: 4},
+		{Filters: []Query{{Field: "tenant_id", Operator: "eq", Value: "t1"}, {Field: "created_at", Operator: "gt", Value: 1005}}, Sort: &SortOption{Field: "created_at", Direction: SortAsc}},
+	}
+	lookups := []string{PlanEq, PlanRange, PlanEq, PlanIn, PlanEq, PlanRange}
+	sorted := []bool{false, false, false, false, false, true}
+
+	for i, q := range queries {
+		plan, err := db.Explain("events", q)
+		if err != nil {
+			t.Fatalf("Failed to explain: %v", err)
+		}
+		if plan.Index != "tenant_created" || plan.Lookup != lookups[i] || plan.Sorted != sorted[i] {
+			t.Errorf("Query %d: unexpected plan %s", i, plan)
+		}
+
+		results, err := db.Find("events", q)
+		if err != nil {
+			t.Fatalf("Failed to find: %v", err)
+		}
+
+		// Compare with the query applied to a collection scan
+		all, _ := db.Find("events", FindOptions{})
+		want := filterDocs(all, q)
+
+		if len(results) != len(want) {
+			t.Fatalf("Query %d: expected %d results, got %d", i, len(want), len(results))
+		}
+		for j := range results {
+			if results[j]["_id"] != want[j]["_id"] {
+				t.Errorf("Query %d: result %d differs from scan", i, j)
+			}
+		}
+	}
+}
+
+// filterDocs applies a query to documents in memory
+func filterDocs(docs []Document, opts FindOptions) []Document {
+	var out []Document
+	for _, doc := range docs {
+		if matchesFilters(doc, opts.Filters) {
+			out = append(out, doc)
+		}
+	}
+	if opts.Sort != nil {
+		sortResults(out, opts.Sort)
+	}
+	if opts.Skip > 0 {
+		if opts.Skip >= len(out) {
+			return nil
+		}
+		out = out[opts.Skip:]
+	}
+	if opts.Limit > 0 && len(out) > opts.Limit {
+		out = out[:opts.Limit]
+	}
+	return out
+}
+
 // TestCount tests counting documents
 func TestCount(t *testing.T) {
 	db := createTestDB(t)
@@ -1,7 +1,9 @@
 package db
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 // matchesFilters checks if a document matches all filter conditions
@@ -44,6 +46,110 @@ func matchesFilter(doc Document, filter Query) bool {
 
 // Comparison functions
 
+// Kinds of values, in the order an index sorts them
+const (
+	kindNull = iota
+	kindBool
+	kindNumber
+	kindString
+	// kindOther covers arrays and objects, which have no order
+	kindOther
+)
+
+func valueKind(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return kindNull
+	case bool:
+		return kindBool
+	case float64:
+		return kindNumber
+	case string:
+		return kindString
+	default:
+		return kindOther
+	}
+}
+
+// normalizeValue converts Go numeric types to float64, as JSON decoding
+// does, so a value compares the same before and after it is stored
+func normalizeValue(v interface{}) interface{} {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int8:
+		return float64(n)
+	case int16:
+		return float64(n)
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case uint:
+		return float64(n)
+	case uint8:
+		return float64(n)
+	case uint16:
+		return float64(n)
+	case uint32:
+		return float64(n)
+	case uint64:
+		return float64(n)
+	case float32:
+		return float64(n)
+	case json.Number:
+		if f, err := n.Float64(); err == nil {
+			return f
+		}
+		return n.String()
+	}
+	return v
+}
+
+// compareValues orders two values of the same kind: numbers numerically,
+// strings lexicographically and false before true. ok is false when the
+// kinds differ or the values are arrays or objects, which have no order.
+func compareValues(a, b interface{}) (int, bool) {
+	a, b = normalizeValue(a), normalizeValue(b)
+	if valueKind(a) != valueKind(b) {
+		return 0, false
+	}
+
+	switch av := a.(type) {
+	case nil:
+		return 0, true
+	case bool:
+		bv := b.(bool)
+		switch {
+		case av == bv:
+			return 0, true
+		case !av:
+			return -1, true
+		default:
+			return 1, true
+		}
+	case float64:
+		bv := b.(float64)
+		switch {
+		case av < bv:
+			return -1, true
+		case av > bv:
+			return 1, true
+		default:
+			return 0, true
+		}
+	case string:
+		return strings.Compare(av, b.(string)), true
+	}
+	return 0, false
+}
+
+// Filters and sorting keep the comparisons Find has always used: values
+// are equal when they print the same, so 30 equals "30", and ranges
+// compare numbers, with any other value counting as 0. compareValues
+// above is the stricter order an index keeps; the planner only uses an
+// index where both agree.
+
 func equal(a, b interface{}) bool {
 	return fmt.Sprintf("%v", a) == fmt.Sprintf("%v", b)
 }
@@ -73,21 +179,27 @@ func lessThanOrEqual(a, b interface{}) bool {
 }
 
 func inArray(val interface{}, list interface{}) bool {
+	for _, item := range listValues(list) {
+		if equal(val, item) {
+			return true
+		}
+	}
+	return false
+}
+
+// listValues returns the elements of an "in" filter value
+func listValues(list interface{}) []interface{} {
 	switch v := list.(type) {
 	case []interface{}:
-		for _, item := range v {
-			if equal(val, item) {
-				return true
-			}
-		}
+		return v
 	case []string:
-		for _, item := range v {
-			if equal(val, item) {
-				return true
-			}
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = item
 		}
+		return out
 	}
-	return false
+	return nil
 }
 
 func toFloat64(val interface{}) float64 {
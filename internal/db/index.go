@@ -0,0 +1,414 @@
+package db
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/skshohagmiah/flin/internal/storage"
+)
+
+// Index entries are stored as empty Badger keys of the form
+//
+//	idx:{collection}:{index}:{encodedValue}:{id}
+//
+// A compound index concatenates the encoded values of its fields, in
+// order. The value encoding preserves order, so the entries for one index
+// sort by kind and then by value the way compareValues orders them, and a
+// range filter reads one contiguous run of keys. Each encoding starts with
+// a tag byte for its kind:
+//
+//	missing tag, for a field absent from the document
+//	null    tag
+//	bool    tag, then 0 or 1
+//	number  tag, then the float64 bits flipped to sort as unsigned bytes
+//	string  tag, then the bytes with 0x00 escaped as 0x00 0xff, then 0x00 0x01
+//	other   tag, then the JSON encoding, escaped and terminated like a string
+//
+// Every encoding ends where it can be told apart from a longer one, so the
+// encodings of a prefix of an index's fields prefix exactly the entries
+// holding those values. Arrays and objects have no order, but their
+// canonical JSON lets an eq or in filter find them.
+const (
+	tagMissing = byte(0)
+	tagNull    = byte(kindNull + 1)
+	tagBool    = byte(kindBool + 1)
+	tagNumber  = byte(kindNumber + 1)
+	tagString  = byte(kindString + 1)
+	tagOther   = byte(kindOther + 1)
+)
+
+// indexBatchSize is how many index entries are written per transaction
+// when an index is built or dropped
+const indexBatchSize = 1000
+
+func makeIndexPrefix(collection, name string) string {
+	return fmt.Sprintf("idx:%s:%s:", collection, name)
+}
+
+// encodeIndexValue returns the order-preserving encoding of v
+func encodeIndexValue(v interface{}) string {
+	v = normalizeValue(v)
+	kind := valueKind(v)
+	buf := []byte{byte(kind + 1)}
+
+	switch val := v.(type) {
+	case nil:
+	case bool:
+		if val {
+			buf = append(buf, 1)
+		} else {
+			buf = append(buf, 0)
+		}
+	case float64:
+		if val == 0 {
+			val = 0 // -0 equals 0
+		}
+		bits := math.Float64bits(val)
+		if bits&(1<<63) == 0 {
+			bits |= 1 << 63
+		} else {
+			bits = ^bits
+		}
+		buf = binary.BigEndian.AppendUint64(buf, bits)
+	case string:
+		buf = appendEscaped(buf, val)
+	default:
+		data, err := json.Marshal(val)
+		if err != nil {
+			data = []byte(fmt.Sprint(val))
+		}
+		buf = appendEscaped(buf, string(data))
+	}
+	return string(buf)
+}
+
+func appendEscaped(buf []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		if s[i] == 0 {
+			buf = append(buf, 0, 0xff)
+		} else {
+			buf = append(buf, s[i])
+		}
+	}
+	return append(buf, 0, 1)
+}
+
+// encodedLen returns the length of the encoded value starting s, or 0 if
+// s does not start with one
+func encodedLen(s string) int {
+	if s == "" {
+		return 0
+	}
+
+	switch s[0] {
+	case tagMissing, tagNull:
+		return 1
+	case tagBool:
+		if len(s) >= 2 {
+			return 2
+		}
+	case tagNumber:
+		if len(s) >= 9 {
+			return 9
+		}
+	case tagString, tagOther:
+		for i := 1; i+1 < len(s); i++ {
+			if s[i] != 0 {
+				continue
+			}
+			if s[i+1] == 1 {
+				return i + 2
+			}
+			i++ // skip the escaped byte
+		}
+	}
+	return 0
+}
+
+// indexEntry is an index key split into its encoded values, one per
+// indexed field, and the document ID
+type indexEntry struct {
+	values []string
+	id     string
+}
+
+// splitIndexEntry splits the part of an index key after its prefix into
+// n encoded values and the document ID
+func splitIndexEntry(entry string, n int) (indexEntry, bool) {
+	e := indexEntry{values: make([]string, n)}
+	for i := 0; i < n; i++ {
+		l := encodedLen(entry)
+		if l == 0 {
+			return indexEntry{}, false
+		}
+		e.values[i], entry = entry[:l], entry[l:]
+	}
+
+	if len(entry) < 2 || entry[0] != ':' {
+		return indexEntry{}, false
+	}
+	e.id = entry[1:]
+	return e, true
+}
+
+// encodeIndexValues returns the encoded values a document holds for an
+// index. present is false when the document has none of the index's
+// fields, so it gets no entry; complete is true when it has them all.
+func encodeIndexValues(meta *IndexMetadata, doc Document) (values string, present, complete bool) {
+	complete = true
+	for _, field := range meta.Fields {
+		val, ok := doc[field]
+		if !ok {
+			values += string(tagMissing)
+			complete = false
+			continue
+		}
+		values += encodeIndexValue(val)
+		present = true
+	}
+	return values, present, complete
+}
+
+// writeIndexes replaces a document's index entries for oldDoc with those
+// for newDoc, touching only the entries that change. Either document may
+// be nil. It returns a *UniqueViolationError, writing nothing, if newDoc
+// shares the values of a unique index with another document. Callers hold
+// ds.mu.
+func (ds *DocStore) writeIndexes(tx *storage.DocTxn, collection, id string, oldDoc, newDoc Document) error {
+	for _, meta := range ds.indexes[collection] {
+		prefix := makeIndexPrefix(collection, meta.Field)
+		oldValues, oldPresent, _ := encodeIndexValues(meta, oldDoc)
+		newValues, newPresent, complete := encodeIndexValues(meta, newDoc)
+
+		if meta.Unique && newPresent && complete {
+			if err := checkUnique(tx, meta, prefix+newValues, id, newDoc); err != nil {
+				return err
+			}
+		}
+
+		if oldPresent && newPresent && oldValues == newValues {
+			continue
+		}
+		if oldPresent {
+			if err := tx.Delete(prefix + oldValues + ":" + id); err != nil {
+				return err
+			}
+		}
+		if newPresent {
+			if err := tx.Set(prefix+newValues+":"+id, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkUnique returns a *UniqueViolationError if a document other than id
+// holds the values that key prefixes
+func checkUnique(tx *storage.DocTxn, meta *IndexMetadata, key, id string, doc Document) error {
+	key += ":"
+
+	var existing string
+	err := tx.Keys(key, key, func(k string) bool {
+		if other := k[len(key):]; other != id {
+			existing = other
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if existing == "" {
+		return nil
+	}
+	return newUniqueViolation(meta, doc, existing)
+}
+
+func newUniqueViolation(meta *IndexMetadata, doc Document, existingID string) *UniqueViolationError {
+	values := make([]interface{}, len(meta.Fields))
+	for i, field := range meta.Fields {
+		values[i] = doc[field]
+	}
+	return &UniqueViolationError{
+		Collection: meta.Collection,
+		Index:      meta.Field,
+		Fields:     meta.Fields,
+		Values:     values,
+		ExistingID: existingID,
+	}
+}
+
+// scanIndex returns the entries of an index whose leading values are the
+// encoded prefix and, if r is not nil, whose next value lies within r.
+// Entries are in key order.
+func scanIndex(tx *storage.DocTxn, meta *IndexMetadata, prefix []string, r *valueRange) ([]indexEntry, error) {
+	base := makeIndexPrefix(meta.Collection, meta.Field)
+	keyPrefix := base + strings.Join(prefix, "")
+	n := len(meta.Fields)
+	k := len(prefix)
+
+	// A range holds only numbers, so its scan stays within them
+	var lower, upper string
+	tag := string(tagNumber)
+	start := keyPrefix
+	if r != nil {
+		if r.hasLower {
+			lower = encodeIndexValue(r.lower)
+		}
+		if r.hasUpper {
+			upper = encodeIndexValue(r.upper)
+		}
+
+		start = keyPrefix + tag
+		if r.hasLower {
+			start = keyPrefix + lower
+		}
+	}
+
+	var entries []indexEntry
+	err := tx.Keys(keyPrefix, start, func(key string) bool {
+		e, ok := splitIndexEntry(key[len(base):], n)
+		if !ok {
+			return true
+		}
+		if r != nil {
+			value := e.values[k]
+			if value[:1] != tag {
+				return false
+			}
+			if r.hasUpper {
+				c := strings.Compare(value, upper)
+				if c > 0 || c == 0 && !r.upperInclusive {
+					return false
+				}
+			}
+			if r.hasLower && !r.lowerInclusive && value == lower {
+				return true
+			}
+		}
+		entries = append(entries, e)
+		return true
+	})
+	return entries, err
+}
+
+// clearIndex deletes every entry of an index. Callers hold ds.mu.
+func (ds *DocStore) clearIndex(collection, name string) error {
+	prefix := makeIndexPrefix(collection, name)
+
+	for {
+		var keys []string
+		err := ds.storage.View(func(tx *storage.DocTxn) error {
+			return tx.Keys(prefix, prefix, func(key string) bool {
+				// Skip the entries of an index whose name extends this one
+				if encodedLen(key[len(prefix):]) > 0 {
+					keys = append(keys, key)
+				}
+				return len(keys) < indexBatchSize
+			})
+		})
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+		if err := ds.storage.BatchDelete(keys); err != nil {
+			return err
+		}
+	}
+}
+
+// buildIndex writes the entries of an index from the documents of its
+// collection, replacing any left from an earlier build. A unique index
+// whose documents already repeat values is cleared again and its
+// *UniqueViolationError returned. Callers hold ds.mu.
+func (ds *DocStore) buildIndex(meta *IndexMetadata) error {
+	if err := ds.clearIndex(meta.Collection, meta.Field); err != nil {
+		return err
+	}
+
+	indexPrefix := makeIndexPrefix(meta.Collection, meta.Field)
+	batch := make(map[string][]byte)
+	err := ds.storage.Scan(makeCollectionPrefix(meta.Collection), func(key string, data []byte) error {
+		var doc Document
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+
+		id, ok := doc["_id"].(string)
+		if !ok {
+			return nil
+		}
+
+		if values, present, _ := encodeIndexValues(meta, doc); present {
+			batch[indexPrefix+values+":"+id] = nil
+		}
+		if len(batch) >= indexBatchSize {
+			if err := ds.storage.BatchSet(batch); err != nil {
+				return err
+			}
+			batch = make(map[string][]byte)
+		}
+		return nil
+	})
+	if err == nil {
+		err = ds.storage.BatchSet(batch)
+	}
+	if err == nil && meta.Unique {
+		err = ds.checkBuiltUnique(meta)
+	}
+
+	if err != nil {
+		if clearErr := ds.clearIndex(meta.Collection, meta.Field); clearErr != nil {
+			return clearErr
+		}
+		return err
+	}
+	return nil
+}
+
+// checkBuiltUnique scans a built index for neighbouring entries with the
+// same complete values
+func (ds *DocStore) checkBuiltUnique(meta *IndexMetadata) error {
+	var first, second string
+	err := ds.storage.View(func(tx *storage.DocTxn) error {
+		prefix := makeIndexPrefix(meta.Collection, meta.Field)
+		var last indexEntry
+		return tx.Keys(prefix, prefix, func(key string) bool {
+			e, ok := splitIndexEntry(key[len(prefix):], len(meta.Fields))
+			if !ok || !complete(e) {
+				return true
+			}
+			if last.values != nil && strings.Join(last.values, "") == strings.Join(e.values, "") {
+				first, second = last.id, e.id
+				return false
+			}
+			last = e
+			return true
+		})
+	})
+	if err != nil || first == "" {
+		return err
+	}
+
+	doc, err := ds.Get(meta.Collection, second)
+	if err != nil {
+		return err
+	}
+	return newUniqueViolation(meta, doc, first)
+}
+
+// complete reports whether an entry holds a value for every field
+func complete(e indexEntry) bool {
+	for _, v := range e.values {
+		if v[0] == tagMissing {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,372 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/skshohagmiah/flin/internal/storage"
+)
+
+// Plan describes how Find answers a query
+type Plan struct {
+	Collection string
+	// Index names the index used to find candidate documents, empty when
+	// the whole collection is scanned
+	Index string
+	// Fields are the index's fields, in key order
+	Fields []string
+	// Lookup is how the index is read: PlanEq, PlanIn or PlanRange, or
+	// PlanScan for a collection scan
+	Lookup string
+	// IndexFilters are answered by the index
+	IndexFilters []Query
+	// Filters are applied to each candidate document
+	Filters []Query
+	// Sorted is set when the index returns candidates in the requested
+	// sort order, so they need no sorting
+	Sorted bool
+
+	meta *IndexMetadata
+	eq   [][]interface{} // values looked up on each leading field, in field order
+	in   []interface{}   // values looked up on the field after them
+	r    *valueRange     // range read on the field after them
+	desc bool
+}
+
+// Plan lookups, from most to least selective
+const (
+	PlanEq    = "eq"
+	PlanIn    = "in"
+	PlanRange = "range"
+	PlanScan  = "scan"
+)
+
+var lookupRank = map[string]int{PlanEq: 0, PlanIn: 1, PlanRange: 2, PlanScan: 3}
+
+// String summarizes the plan, e.g. "index users.email eq, 1 filters"
+func (p *Plan) String() string {
+	if p.Index == "" {
+		return fmt.Sprintf("scan %s, %d filters", p.Collection, len(p.Filters))
+	}
+	s := fmt.Sprintf("index %s.%s %s, %d filters", p.Collection, p.Index, p.Lookup, len(p.Filters))
+	if p.Sorted {
+		s += ", sorted"
+	}
+	return s
+}
+
+// better reports whether p should be preferred to other: a more selective
+// lookup, then more filters answered by the index, then a sorted result
+func (p *Plan) better(other *Plan) bool {
+	if lookupRank[p.Lookup] != lookupRank[other.Lookup] {
+		return lookupRank[p.Lookup] < lookupRank[other.Lookup]
+	}
+	if len(p.IndexFilters) != len(other.IndexFilters) {
+		return len(p.IndexFilters) > len(other.IndexFilters)
+	}
+	return p.Sorted && !other.Sorted
+}
+
+// Explain returns the plan Find would use for a query without running it
+func (ds *DocStore) Explain(collection string, opts FindOptions) (*Plan, error) {
+	if collection == "" {
+		return nil, ErrInvalidCollection
+	}
+
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	return ds.planQuery(collection, opts)
+}
+
+// planQuery picks the best index for a query, or a collection scan if no
+// index can answer any of its filters. FindOptions.IndexName restricts the
+// choice to that index. Callers hold ds.mu.
+func (ds *DocStore) planQuery(collection string, opts FindOptions) (*Plan, error) {
+	coll := ds.indexes[collection]
+
+	var names []string
+	if opts.IndexName != "" {
+		if _, ok := coll[opts.IndexName]; !ok {
+			return nil, fmt.Errorf("%w: no index %s on %s", ErrInvalidQuery, opts.IndexName, collection)
+		}
+		names = append(names, opts.IndexName)
+	} else {
+		for name := range coll {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	var best *Plan
+	for _, name := range names {
+		if p := planIndex(coll[name], opts); p != nil && (best == nil || p.better(best)) {
+			best = p
+		}
+	}
+
+	if best == nil {
+		best = &Plan{Collection: collection, Lookup: PlanScan, Filters: opts.Filters}
+	}
+	return best, nil
+}
+
+// planIndex returns how an index answers a query: eq filters on as many
+// leading fields as possible, then an in filter or range filters on the
+// next field. It returns nil if no filter can use the index.
+//
+// Filters compare values loosely (see equal), so a lookup lists every
+// indexed value a filter can match, and filters that could match values
+// the index cannot find that way are left to the scan.
+func planIndex(meta *IndexMetadata, opts FindOptions) *Plan {
+	p := &Plan{
+		Collection: meta.Collection,
+		Index:      meta.Field,
+		Fields:     meta.Fields,
+		Lookup:     PlanEq,
+		meta:       meta,
+	}
+
+	used := make([]bool, len(opts.Filters))
+	// Only the first eq or in filter on a field is looked up; others stay
+	// filters
+	first := func(field, op string) int {
+		for i, f := range opts.Filters {
+			if !used[i] && f.Field == field && f.Operator == op {
+				return i
+			}
+		}
+		return -1
+	}
+
+	for _, field := range meta.Fields {
+		i := first(field, OpEq)
+		if i < 0 {
+			break
+		}
+		values, ok := eqLookupValues(opts.Filters[i].Value)
+		if !ok {
+			break
+		}
+		used[i] = true
+		p.eq = append(p.eq, values)
+	}
+
+	k := len(p.eq)
+	if k < len(meta.Fields) {
+		field := meta.Fields[k]
+		if i := first(field, OpIn); i >= 0 {
+			if values, ok := inLookupValues(opts.Filters[i].Value); ok {
+				used[i] = true
+				p.in = values
+				p.Lookup = PlanIn
+			}
+		}
+		if p.Lookup == PlanEq {
+			p.planRange(field, opts.Filters, used)
+		}
+	}
+
+	if k == 0 && p.Lookup == PlanEq {
+		return nil
+	}
+
+	for i, f := range opts.Filters {
+		if used[i] {
+			p.IndexFilters = append(p.IndexFilters, f)
+		} else {
+			p.Filters = append(p.Filters, f)
+		}
+	}
+
+	// Within a range, entries are numbers ordered by the ranged field, as
+	// sortResults orders them
+	if s := opts.Sort; s != nil && p.Lookup == PlanRange && s.Field == meta.Fields[k] {
+		p.Sorted = true
+		p.desc = s.Direction == SortDesc
+	}
+
+	return p
+}
+
+// planRange makes p read a range of the field from its range filters.
+// Filters count values other than numbers as 0, so a range that holds 0
+// matches values the index keeps elsewhere and is left to the scan.
+func (p *Plan) planRange(field string, filters []Query, used []bool) {
+	var ranged []int
+	var bounds []Query
+	for i, f := range filters {
+		if !used[i] && f.Field == field && isRangeFilter(f) {
+			ranged = append(ranged, i)
+			bounds = append(bounds, f)
+		}
+	}
+	if len(bounds) == 0 {
+		return
+	}
+
+	r := newValueRange(bounds)
+	if r.holdsZero() {
+		return
+	}
+	for _, i := range ranged {
+		used[i] = true
+	}
+	p.r = r
+	p.Lookup = PlanRange
+}
+
+// isRangeFilter reports whether a filter bounds a range of numbers
+func isRangeFilter(f Query) bool {
+	switch f.Operator {
+	case OpGt, OpGte, OpLt, OpLte:
+		return true
+	}
+	return false
+}
+
+// eqLookupValues returns the indexed values an eq filter on v matches:
+// those printing as v does, so 22 looks up both 22 and "22". ok is false
+// when an array or object could match, since the index cannot find those
+// by how they print.
+func eqLookupValues(v interface{}) ([]interface{}, bool) {
+	s := fmt.Sprintf("%v", v)
+	if strings.HasPrefix(s, "[") || strings.HasPrefix(s, "map[") {
+		return nil, false
+	}
+
+	values := []interface{}{s}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && fmt.Sprintf("%v", f) == s {
+		values = append(values, f)
+	}
+	switch s {
+	case "true":
+		values = append(values, true)
+	case "false":
+		values = append(values, false)
+	case "<nil>":
+		values = append(values, nil)
+	}
+	return values, true
+}
+
+// inLookupValues returns the indexed values an in filter matches
+func inLookupValues(list interface{}) ([]interface{}, bool) {
+	var values []interface{}
+	seen := make(map[string]bool)
+	for _, item := range listValues(list) {
+		found, ok := eqLookupValues(item)
+		if !ok {
+			return nil, false
+		}
+		for _, v := range found {
+			if enc := encodeIndexValue(v); !seen[enc] {
+				seen[enc] = true
+				values = append(values, v)
+			}
+		}
+	}
+	return values, true
+}
+
+// candidates returns the IDs of the documents the plan's lookups find, in
+// the plan's sort order when it is Sorted and otherwise in ID order, the
+// order a collection scan reads them in. Lookups may find more documents
+// than the index filters match, such as -0 for 0, so callers still apply
+// every filter.
+func candidates(tx *storage.DocTxn, plan *Plan) ([]string, error) {
+	lookups := plan.eq
+	if plan.Lookup == PlanIn {
+		lookups = append(lookups[:len(lookups):len(lookups)], plan.in)
+	}
+
+	// One key prefix per combination of looked up values
+	prefixes := [][]string{nil}
+	for _, values := range lookups {
+		next := make([][]string, 0, len(prefixes)*len(values))
+		for _, prefix := range prefixes {
+			for _, v := range values {
+				next = append(next, append(prefix[:len(prefix):len(prefix)], encodeIndexValue(v)))
+			}
+		}
+		prefixes = next
+	}
+
+	var entries []indexEntry
+	for _, prefix := range prefixes {
+		found, err := scanIndex(tx, plan.meta, prefix, plan.r)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, found...)
+	}
+
+	if plan.Sorted {
+		// Equal values keep ID order, as the stable sortResults would
+		k := len(plan.eq)
+		sort.Slice(entries, func(i, j int) bool {
+			a, b := entries[i].values[k], entries[j].values[k]
+			if a != b {
+				return a < b != plan.desc
+			}
+			return entries[i].id < entries[j].id
+		})
+
+		ids := make([]string, len(entries))
+		for i, e := range entries {
+			ids[i] = e.id
+		}
+		return ids, nil
+	}
+
+	ids := make([]string, 0, len(entries))
+	seen := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		if !seen[e.id] {
+			seen[e.id] = true
+			ids = append(ids, e.id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// valueRange is the intersection of the range filters on one field. Its
+// bounds are numbers, as filters compare them.
+type valueRange struct {
+	lower, upper                   float64
+	hasLower, hasUpper             bool
+	lowerInclusive, upperInclusive bool
+}
+
+// newValueRange combines range filters into one range
+func newValueRange(filters []Query) *valueRange {
+	r := &valueRange{}
+	for _, f := range filters {
+		v := toFloat64(f.Value)
+		inclusive := f.Operator == OpGte || f.Operator == OpLte
+
+		switch f.Operator {
+		case OpGt, OpGte:
+			if r.hasLower && (v < r.lower || v == r.lower && inclusive) {
+				continue
+			}
+			r.lower, r.hasLower, r.lowerInclusive = v, true, inclusive
+		case OpLt, OpLte:
+			if r.hasUpper && (v > r.upper || v == r.upper && inclusive) {
+				continue
+			}
+			r.upper, r.hasUpper, r.upperInclusive = v, true, inclusive
+		}
+	}
+	return r
+}
+
+// holdsZero reports whether 0 lies within the range
+func (r *valueRange) holdsZero() bool {
+	aboveLower := !r.hasLower || r.lower < 0 || r.lower == 0 && r.lowerInclusive
+	belowUpper := !r.hasUpper || r.upper > 0 || r.upper == 0 && r.upperInclusive
+	return aboveLower && belowUpper
+}
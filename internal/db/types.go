@@ -1,6 +1,9 @@
 package db
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // Common errors
 var (
@@ -8,8 +11,27 @@ var (
 	ErrInvalidQuery      = errors.New("invalid query")
 	ErrInvalidCollection = errors.New("invalid collection")
 	ErrInvalidDocument   = errors.New("invalid document")
+	ErrDuplicateKey      = errors.New("duplicate key")
 )
 
+// UniqueViolationError is returned when a write would give two documents
+// the same values in a unique index. It matches ErrDuplicateKey.
+type UniqueViolationError struct {
+	Collection string
+	Index      string
+	Fields     []string
+	Values     []interface{}
+	ExistingID string // Document already holding the values
+}
+
+func (e *UniqueViolationError) Error() string {
+	return fmt.Sprintf("duplicate key: index %s.%s %v already held by document %s", e.Collection, e.Index, e.Values, e.ExistingID)
+}
+
+func (e *UniqueViolationError) Unwrap() error {
+	return ErrDuplicateKey
+}
+
 // Document represents a single document in a collection
 type Document map[string]interface{}
 
@@ -42,10 +64,24 @@ type UpdateOptions struct {
 	Merge bool     // If true, merge with existing doc; if false, replace
 }
 
+// IndexOptions configures an index
+type IndexOptions struct {
+	// Fields makes a compound index over these fields, in order. Queries
+	// use it with eq filters on leading fields, then optionally an in or
+	// range filter on the next one. When empty, the index covers the field
+	// it is named after.
+	Fields []string
+	// Unique rejects a write that gives two documents the same values for
+	// all the index's fields. Documents missing one of them are not checked.
+	Unique bool
+}
+
 // IndexMetadata represents index configuration
 type IndexMetadata struct {
 	Collection string
-	Field      string
+	Field      string   // Index name: its field, unless Fields says otherwise
+	Fields     []string // Indexed fields, in key order
+	Unique     bool
 	CreatedAt  int64
 }
 
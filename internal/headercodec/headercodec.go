@@ -0,0 +1,68 @@
+// Package headercodec holds the binary encoding of message headers shared by
+// the wire protocol and the storage formats
+package headercodec
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Encode encodes headers as [2:count][for each: [2:keyLen][key][2:valueLen][value]]
+func Encode(headers map[string]string) []byte {
+	size := 2
+	for k, v := range headers {
+		size += 2 + len(k) + 2 + len(v)
+	}
+
+	buf := make([]byte, size)
+	binary.BigEndian.PutUint16(buf, uint16(len(headers)))
+	pos := 2
+
+	for k, v := range headers {
+		binary.BigEndian.PutUint16(buf[pos:], uint16(len(k)))
+		pos += 2
+		pos += copy(buf[pos:], k)
+		binary.BigEndian.PutUint16(buf[pos:], uint16(len(v)))
+		pos += 2
+		pos += copy(buf[pos:], v)
+	}
+
+	return buf
+}
+
+// Decode parses headers written by Encode and returns the bytes consumed
+func Decode(data []byte) (map[string]string, int, error) {
+	if len(data) < 2 {
+		return nil, 0, fmt.Errorf("invalid headers")
+	}
+
+	count := int(binary.BigEndian.Uint16(data))
+	pos := 2
+	if count == 0 {
+		return nil, pos, nil
+	}
+
+	headers := make(map[string]string, count)
+	for i := 0; i < count; i++ {
+		if len(data) < pos+2 {
+			return nil, 0, fmt.Errorf("invalid headers")
+		}
+		keyLen := int(binary.BigEndian.Uint16(data[pos:]))
+		pos += 2
+		if len(data) < pos+keyLen+2 {
+			return nil, 0, fmt.Errorf("invalid headers")
+		}
+		key := string(data[pos : pos+keyLen])
+		pos += keyLen
+
+		valueLen := int(binary.BigEndian.Uint16(data[pos:]))
+		pos += 2
+		if len(data) < pos+valueLen {
+			return nil, 0, fmt.Errorf("invalid headers")
+		}
+		headers[key] = string(data[pos : pos+valueLen])
+		pos += valueLen
+	}
+
+	return headers, pos, nil
+}
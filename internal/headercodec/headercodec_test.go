@@ -0,0 +1,46 @@
+package headercodec
+
+import (
+	"testing"
+)
+
+// TestRoundTrip tests that encoded headers decode to the same map and
+// report the bytes consumed
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+	}{
+		{"none", nil},
+		{"one", map[string]string{"trace": "abc"}},
+		{"several", map[string]string{"a": "", "": "b", "content-type": "application/json"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := append(Encode(tt.headers), 0xff)
+			got, n, err := Decode(data)
+			if err != nil {
+				t.Fatalf("Failed to decode: %v", err)
+			}
+			if n != len(data)-1 {
+				t.Errorf("Expected %d bytes consumed, got %d", len(data)-1, n)
+			}
+			if len(got) != len(tt.headers) {
+				t.Fatalf("Expected %v, got %v", tt.headers, got)
+			}
+			for k, v := range tt.headers {
+				if got[k] != v {
+					t.Errorf("Expected %s=%q, got %q", k, v, got[k])
+				}
+			}
+		})
+	}
+
+	full := Encode(map[string]string{"key": "value"})
+	for i := 0; i < len(full); i++ {
+		if _, _, err := Decode(full[:i]); err == nil {
+			t.Errorf("Expected %d truncated bytes to fail", i)
+		}
+	}
+}
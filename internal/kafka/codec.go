@@ -0,0 +1,216 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errMalformed = errors.New("kafka: malformed request")
+
+// decoder reads Kafka's big-endian primitive types. The first short read
+// sets err, after which every read returns a zero value, so handlers check
+// err once at the end.
+type decoder struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.buf)-d.pos < n {
+		d.err = errMalformed
+		return nil
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b
+}
+
+func (d *decoder) int8() int8 {
+	b := d.take(1)
+	if b == nil {
+		return 0
+	}
+	return int8(b[0])
+}
+
+func (d *decoder) bool() bool {
+	return d.int8() != 0
+}
+
+func (d *decoder) int16() int16 {
+	b := d.take(2)
+	if b == nil {
+		return 0
+	}
+	return int16(binary.BigEndian.Uint16(b))
+}
+
+func (d *decoder) int32() int32 {
+	b := d.take(4)
+	if b == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(b))
+}
+
+func (d *decoder) int64() int64 {
+	b := d.take(8)
+	if b == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+func (d *decoder) string() string {
+	s, _ := d.nullableString()
+	return s
+}
+
+// nullableString returns false for a null string
+func (d *decoder) nullableString() (string, bool) {
+	n := d.int16()
+	if n < 0 {
+		return "", false
+	}
+	return string(d.take(int(n))), d.err == nil
+}
+
+// bytes returns nil for null bytes
+func (d *decoder) bytes() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+	return d.take(int(n))
+}
+
+// arrayLen returns the element count, or -1 for a null array. Counts that
+// cannot fit in the remaining bytes are rejected so a bad length cannot
+// drive a huge allocation.
+func (d *decoder) arrayLen() int {
+	n := d.int32()
+	if n < 0 {
+		return -1
+	}
+	if int(n) > len(d.buf)-d.pos {
+		d.err = errMalformed
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) int32Array() []int32 {
+	n := d.arrayLen()
+	if n < 0 {
+		return nil
+	}
+	out := make([]int32, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		out = append(out, d.int32())
+	}
+	return out
+}
+
+// varint reads a zigzag-encoded varint as used inside record batches
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf[d.pos:])
+	if n <= 0 {
+		d.err = errMalformed
+		return 0
+	}
+	d.pos += n
+	return v
+}
+
+// varbytes reads a varint length and that many bytes, nil for length -1
+func (d *decoder) varbytes() []byte {
+	n := d.varint()
+	if n < 0 {
+		return nil
+	}
+	return d.take(int(n))
+}
+
+func (d *decoder) remaining() int {
+	return len(d.buf) - d.pos
+}
+
+// encoder appends Kafka's big-endian primitive types
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) int8(v int8) {
+	e.buf = append(e.buf, byte(v))
+}
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.int8(1)
+	} else {
+		e.int8(0)
+	}
+}
+
+func (e *encoder) int16(v int16) {
+	e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(v))
+}
+
+func (e *encoder) int32(v int32) {
+	e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(v))
+}
+
+func (e *encoder) int64(v int64) {
+	e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(v))
+}
+
+func (e *encoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// nullString writes a null nullable string
+func (e *encoder) nullString() {
+	e.int16(-1)
+}
+
+func (e *encoder) bytes(b []byte) {
+	if b == nil {
+		e.int32(-1)
+		return
+	}
+	e.int32(int32(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) arrayLen(n int) {
+	e.int32(int32(n))
+}
+
+func (e *encoder) int32Array(vs []int32) {
+	e.arrayLen(len(vs))
+	for _, v := range vs {
+		e.int32(v)
+	}
+}
+
+func (e *encoder) varint(v int64) {
+	e.buf = binary.AppendVarint(e.buf, v)
+}
+
+// varbytes writes a varint length and the bytes, length -1 for nil
+func (e *encoder) varbytes(b []byte) {
+	if b == nil {
+		e.varint(-1)
+		return
+	}
+	e.varint(int64(len(b)))
+	e.buf = append(e.buf, b...)
+}
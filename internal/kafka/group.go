@@ -0,0 +1,545 @@
+package kafka
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type groupState int
+
+const (
+	groupEmpty groupState = iota
+	groupPreparingRebalance
+	groupCompletingRebalance
+	groupStable
+)
+
+const (
+	// pendingMemberTimeout is how long a member ID handed out with
+	// MEMBER_ID_REQUIRED stays valid for the follow-up join
+	pendingMemberTimeout = 5 * time.Minute
+	groupCheckInterval   = time.Second
+)
+
+type protocolMetadata struct {
+	name     string
+	metadata []byte
+}
+
+type joinResult struct {
+	errorCode  int16
+	generation int32
+	protocol   string
+	leader     string
+	memberID   string
+	// members is filled in only for the leader
+	members []joinMember
+}
+
+type joinMember struct {
+	id       string
+	metadata []byte
+}
+
+type syncResult struct {
+	errorCode  int16
+	assignment []byte
+}
+
+type member struct {
+	id               string
+	sessionTimeout   time.Duration
+	rebalanceTimeout time.Duration
+	protocols        []protocolMetadata
+	lastSeen         time.Time
+	assignment       []byte
+
+	// joinCh is set while the member waits for the join phase to finish
+	joinCh chan joinResult
+	// syncCh is set while the member waits for the leader's assignments
+	syncCh chan syncResult
+}
+
+// group is a Kafka consumer group. Kafka clients choose assignments
+// themselves, so unlike stream.ConsumerGroup the coordinator only runs the
+// join and sync phases and hands the leader's assignments to the members.
+type group struct {
+	mu           sync.Mutex
+	id           string
+	state        groupState
+	generation   int32
+	protocolType string
+	protocol     string
+	leader       string
+	members      map[string]*member
+	pending      map[string]time.Time
+	// rebalanceDeadline ends the join phase for members that did not rejoin
+	rebalanceDeadline time.Time
+}
+
+// coordinator owns every Kafka consumer group. Group membership is kept in
+// memory; committed offsets go to the stream's storage.
+type coordinator struct {
+	mu     sync.Mutex
+	groups map[string]*group
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+func newCoordinator() *coordinator {
+	c := &coordinator{
+		groups:   make(map[string]*group),
+		stopChan: make(chan struct{}),
+	}
+	c.wg.Add(1)
+	go c.expiryLoop()
+	return c
+}
+
+func (c *coordinator) close() {
+	close(c.stopChan)
+	c.wg.Wait()
+}
+
+// group returns a group by ID, creating it if create is set
+func (c *coordinator) group(id string, create bool) *group {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	g, ok := c.groups[id]
+	if !ok && create {
+		g = &group{
+			id:      id,
+			members: make(map[string]*member),
+			pending: make(map[string]time.Time),
+		}
+		c.groups[id] = g
+	}
+	return g
+}
+
+// join adds or refreshes a member and waits for the join phase to finish
+// or ctx to end. An empty memberID gets a fresh ID; when requireKnownID is
+// set (JoinGroup v4+) the client must rejoin with it.
+func (c *coordinator) join(ctx context.Context, groupID, memberID, clientID, protocolType string, protocols []protocolMetadata,
+	sessionTimeout, rebalanceTimeout time.Duration, requireKnownID bool) joinResult {
+
+	g := c.group(groupID, true)
+	g.mu.Lock()
+
+	if g.state != groupEmpty && g.protocolType != protocolType || !g.supports(protocols) {
+		g.mu.Unlock()
+		return joinResult{errorCode: errInconsistentGroupProtocol, generation: -1, memberID: memberID}
+	}
+
+	if memberID == "" {
+		memberID = clientID + "-" + uuid.NewString()
+		if requireKnownID {
+			g.pending[memberID] = time.Now()
+			g.mu.Unlock()
+			return joinResult{errorCode: errMemberIDRequired, generation: -1, memberID: memberID}
+		}
+	} else if _, ok := g.members[memberID]; !ok {
+		if _, ok := g.pending[memberID]; !ok {
+			g.mu.Unlock()
+			return joinResult{errorCode: errUnknownMemberID, generation: -1, memberID: memberID}
+		}
+	}
+	delete(g.pending, memberID)
+
+	m, ok := g.members[memberID]
+	if !ok {
+		m = &member{id: memberID}
+		g.members[memberID] = m
+	}
+	if m.joinCh != nil {
+		// A retried join replaces the one still waiting
+		m.joinCh <- joinResult{errorCode: errRebalanceInProgress, generation: -1, memberID: memberID}
+	}
+	m.sessionTimeout = sessionTimeout
+	m.rebalanceTimeout = rebalanceTimeout
+	m.protocols = protocols
+	m.lastSeen = time.Now()
+	ch := make(chan joinResult, 1)
+	m.joinCh = ch
+	g.protocolType = protocolType
+
+	if g.state != groupPreparingRebalance {
+		g.prepareRebalance()
+	}
+	g.maybeCompleteJoin(false)
+	g.mu.Unlock()
+
+	select {
+	case result := <-ch:
+		return result
+	case <-ctx.Done():
+		return joinResult{errorCode: errRebalanceInProgress, generation: -1, memberID: memberID}
+	}
+}
+
+// sync stores the leader's assignments and returns the member's own,
+// waiting for the leader if it has not synced yet
+func (c *coordinator) sync(ctx context.Context, groupID, memberID string, generation int32, assignments map[string][]byte) syncResult {
+	g := c.group(groupID, false)
+	if g == nil {
+		return syncResult{errorCode: errUnknownMemberID}
+	}
+
+	g.mu.Lock()
+	m, ok := g.members[memberID]
+	switch {
+	case !ok:
+		g.mu.Unlock()
+		return syncResult{errorCode: errUnknownMemberID}
+	case generation != g.generation:
+		g.mu.Unlock()
+		return syncResult{errorCode: errIllegalGeneration}
+	case g.state == groupPreparingRebalance:
+		g.mu.Unlock()
+		return syncResult{errorCode: errRebalanceInProgress}
+	case g.state == groupStable:
+		m.lastSeen = time.Now()
+		result := syncResult{assignment: m.assignment}
+		g.mu.Unlock()
+		return result
+	}
+
+	m.lastSeen = time.Now()
+	if memberID == g.leader {
+		for id, other := range g.members {
+			other.assignment = assignments[id]
+			if other.syncCh != nil {
+				other.syncCh <- syncResult{assignment: other.assignment}
+				other.syncCh = nil
+			}
+		}
+		g.state = groupStable
+		result := syncResult{assignment: m.assignment}
+		g.mu.Unlock()
+		return result
+	}
+
+	if m.syncCh != nil {
+		m.syncCh <- syncResult{errorCode: errRebalanceInProgress}
+	}
+	ch := make(chan syncResult, 1)
+	m.syncCh = ch
+	g.mu.Unlock()
+
+	select {
+	case result := <-ch:
+		return result
+	case <-ctx.Done():
+		return syncResult{errorCode: errRebalanceInProgress}
+	}
+}
+
+// heartbeat keeps a member alive and tells it when to rejoin
+func (c *coordinator) heartbeat(groupID, memberID string, generation int32) int16 {
+	g := c.group(groupID, false)
+	if g == nil {
+		return errUnknownMemberID
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	m, ok := g.members[memberID]
+	if !ok {
+		return errUnknownMemberID
+	}
+	m.lastSeen = time.Now()
+	if generation != g.generation {
+		return errIllegalGeneration
+	}
+	if g.state == groupPreparingRebalance {
+		return errRebalanceInProgress
+	}
+	return errNone
+}
+
+// leave removes a member and rebalances the rest of the group
+func (c *coordinator) leave(groupID, memberID string) int16 {
+	g := c.group(groupID, false)
+	if g == nil {
+		return errUnknownMemberID
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.members[memberID]; !ok {
+		return errUnknownMemberID
+	}
+	g.removeMember(memberID)
+	return errNone
+}
+
+// checkCommit validates the group generation sent with an offset commit.
+// Commits with generation -1 come from consumers managing partitions
+// themselves and are always accepted.
+func (c *coordinator) checkCommit(groupID, memberID string, generation int32) int16 {
+	if generation < 0 {
+		return errNone
+	}
+
+	g := c.group(groupID, false)
+	if g == nil {
+		return errUnknownMemberID
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	m, ok := g.members[memberID]
+	if !ok {
+		return errUnknownMemberID
+	}
+	m.lastSeen = time.Now()
+	if generation != g.generation {
+		return errIllegalGeneration
+	}
+	if g.state == groupPreparingRebalance {
+		return errRebalanceInProgress
+	}
+	return errNone
+}
+
+func (c *coordinator) expiryLoop() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(groupCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		case <-ticker.C:
+			c.expire()
+		}
+	}
+}
+
+// expire evicts members whose session lapsed and ends join phases that ran
+// past their deadline. Empty groups are kept, as Kafka keeps them.
+func (c *coordinator) expire() {
+	now := time.Now()
+
+	c.mu.Lock()
+	groups := make([]*group, 0, len(c.groups))
+	for _, g := range c.groups {
+		groups = append(groups, g)
+	}
+	c.mu.Unlock()
+
+	for _, g := range groups {
+		g.mu.Lock()
+		for id, at := range g.pending {
+			if now.Sub(at) > pendingMemberTimeout {
+				delete(g.pending, id)
+			}
+		}
+		for id, m := range g.members {
+			if m.joinCh == nil && now.Sub(m.lastSeen) > m.sessionTimeout {
+				g.removeMember(id)
+			}
+		}
+		if g.state == groupPreparingRebalance && now.After(g.rebalanceDeadline) {
+			g.maybeCompleteJoin(true)
+		}
+		g.mu.Unlock()
+	}
+}
+
+// supports reports whether every current member shares a protocol with
+// the joining member. Callers hold g.mu.
+func (g *group) supports(protocols []protocolMetadata) bool {
+	if len(protocols) == 0 {
+		return false
+	}
+	for _, m := range g.members {
+		shared := false
+		for _, p := range protocols {
+			if m.supports(p.name) {
+				shared = true
+				break
+			}
+		}
+		if !shared {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *member) supports(protocol string) bool {
+	for _, p := range m.protocols {
+		if p.name == protocol {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareRebalance starts a join phase, failing members still waiting on
+// the previous sync so they rejoin. Callers hold g.mu.
+func (g *group) prepareRebalance() {
+	g.state = groupPreparingRebalance
+
+	var timeout time.Duration
+	for _, m := range g.members {
+		if m.rebalanceTimeout > timeout {
+			timeout = m.rebalanceTimeout
+		}
+		if m.syncCh != nil {
+			m.syncCh <- syncResult{errorCode: errRebalanceInProgress}
+			m.syncCh = nil
+		}
+	}
+	g.rebalanceDeadline = time.Now().Add(timeout)
+}
+
+// maybeCompleteJoin finishes the join phase once every member has rejoined,
+// or when force is set, after dropping the members that have not. Callers
+// hold g.mu.
+func (g *group) maybeCompleteJoin(force bool) {
+	for id, m := range g.members {
+		if m.joinCh == nil {
+			if !force {
+				return
+			}
+			delete(g.members, id)
+		}
+	}
+
+	if len(g.members) == 0 {
+		g.state = groupEmpty
+		g.generation++
+		g.leader = ""
+		g.protocol = ""
+		return
+	}
+
+	g.generation++
+	g.protocol = g.selectProtocol()
+	if _, ok := g.members[g.leader]; !ok {
+		g.leader = ""
+		for id := range g.members {
+			if g.leader == "" || id < g.leader {
+				g.leader = id
+			}
+		}
+	}
+	g.state = groupCompletingRebalance
+
+	var members []joinMember
+	for id, m := range g.members {
+		members = append(members, joinMember{id: id, metadata: m.metadataFor(g.protocol)})
+	}
+
+	for id, m := range g.members {
+		result := joinResult{
+			generation: g.generation,
+			protocol:   g.protocol,
+			leader:     g.leader,
+			memberID:   id,
+		}
+		if id == g.leader {
+			result.members = members
+		}
+		m.assignment = nil
+		m.lastSeen = time.Now()
+		m.joinCh <- result
+		m.joinCh = nil
+	}
+}
+
+// selectProtocol picks, among the protocols every member supports, the
+// one most members prefer. Callers hold g.mu.
+func (g *group) selectProtocol() string {
+	var candidates []string
+	for _, m := range g.members {
+		for _, p := range m.protocols {
+			if g.allSupport(p.name) && !contains(candidates, p.name) {
+				candidates = append(candidates, p.name)
+			}
+		}
+	}
+	sort.Strings(candidates)
+
+	votes := make(map[string]int)
+	for _, m := range g.members {
+		for _, p := range m.protocols {
+			if contains(candidates, p.name) {
+				votes[p.name]++
+				break
+			}
+		}
+	}
+
+	best := ""
+	for _, name := range candidates {
+		if best == "" || votes[name] > votes[best] {
+			best = name
+		}
+	}
+	return best
+}
+
+func (g *group) allSupport(protocol string) bool {
+	for _, m := range g.members {
+		if !m.supports(protocol) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *member) metadataFor(protocol string) []byte {
+	for _, p := range m.protocols {
+		if p.name == protocol {
+			return p.metadata
+		}
+	}
+	return nil
+}
+
+// removeMember drops a member and rebalances the rest. Callers hold g.mu.
+func (g *group) removeMember(id string) {
+	m := g.members[id]
+	delete(g.members, id)
+
+	if m.joinCh != nil {
+		m.joinCh <- joinResult{errorCode: errUnknownMemberID, generation: -1, memberID: id}
+	}
+	if m.syncCh != nil {
+		m.syncCh <- syncResult{errorCode: errUnknownMemberID}
+	}
+
+	switch g.state {
+	case groupStable, groupCompletingRebalance:
+		if len(g.members) == 0 {
+			g.state = groupEmpty
+			return
+		}
+		g.prepareRebalance()
+	case groupPreparingRebalance:
+		g.maybeCompleteJoin(false)
+	}
+}
@@ -0,0 +1,937 @@
+package kafka
+
+import (
+	"errors"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/skshohagmiah/flin/internal/storage"
+	"github.com/skshohagmiah/flin/internal/stream"
+)
+
+const (
+	// fetchMaxMessages caps how many messages one partition reads per fetch
+	fetchMaxMessages = 1000
+
+	// Session timeout bounds, Kafka's group.min/max.session.timeout.ms
+	minSessionTimeout = 6 * time.Second
+	maxSessionTimeout = 30 * time.Minute
+)
+
+// handle runs one request and returns its encoded response, or nil when
+// there is none
+func (c *conn) handle(req *request) []byte {
+	if !supported(req.apiKey, req.version) {
+		if req.apiKey == apiApiVersions {
+			// Clients retry with a version from the v0 error response
+			return c.respond(req, c.apiVersions(0, errUnsupportedVersion))
+		}
+		return c.reject(req, "unsupported version")
+	}
+
+	var body []byte
+	switch req.apiKey {
+	case apiApiVersions:
+		body = c.apiVersions(req.version, errNone)
+	case apiMetadata:
+		body = c.handleMetadata(req)
+	case apiProduce:
+		var noResponse bool
+		body, noResponse = c.handleProduce(req)
+		if noResponse {
+			return nil
+		}
+	case apiFetch:
+		body = c.handleFetch(req)
+	case apiListOffsets:
+		body = c.handleListOffsets(req)
+	case apiFindCoordinator:
+		body = c.handleFindCoordinator(req)
+	case apiJoinGroup:
+		body = c.handleJoinGroup(req)
+	case apiSyncGroup:
+		body = c.handleSyncGroup(req)
+	case apiHeartbeat:
+		body = c.handleHeartbeat(req)
+	case apiLeaveGroup:
+		body = c.handleLeaveGroup(req)
+	case apiOffsetCommit:
+		body = c.handleOffsetCommit(req)
+	case apiOffsetFetch:
+		body = c.handleOffsetFetch(req)
+	case apiInitProducerID:
+		body = c.handleInitProducerID(req)
+	}
+
+	if req.body.err != nil || body == nil {
+		return c.reject(req, "malformed request")
+	}
+	return c.respond(req, body)
+}
+
+// respond prefixes a response body with its header
+func (c *conn) respond(req *request, body []byte) []byte {
+	e := &encoder{buf: make([]byte, 0, 4+len(body))}
+	e.int32(req.correlationID)
+	e.buf = append(e.buf, body...)
+	return e.buf
+}
+
+// reject closes the connection, which is how Kafka brokers answer requests
+// they cannot parse
+func (c *conn) reject(req *request, reason string) []byte {
+	log.Printf("[KAFKA] Closing %s: %s (api %d v%d)", c.netConn.RemoteAddr(), reason, req.apiKey, req.version)
+	c.netConn.Close()
+	return nil
+}
+
+func (c *conn) apiVersions(version, errorCode int16) []byte {
+	e := &encoder{}
+	e.int16(errorCode)
+	e.arrayLen(len(apiVersions))
+	for _, v := range apiVersions {
+		e.int16(v.key)
+		e.int16(v.min)
+		e.int16(v.max)
+	}
+	if version >= 1 {
+		e.int32(0) // throttle_time_ms
+	}
+	return e.buf
+}
+
+// topic returns a topic's metadata, or nil if it does not exist
+func (c *conn) topic(name string) *storage.TopicMetadata {
+	meta, err := c.server.stream.GetTopicMetadata(name)
+	if err != nil {
+		return nil
+	}
+	return meta
+}
+
+// partitionError is the error for a partition that does not exist
+func partitionError(meta *storage.TopicMetadata, partition int32) int16 {
+	if meta == nil || partition < 0 || int(partition) >= meta.Partitions {
+		return errUnknownTopicOrPartition
+	}
+	return errNone
+}
+
+func (c *conn) handleMetadata(req *request) []byte {
+	d, v := req.body, req.version
+
+	n := d.arrayLen()
+	all := n < 0 || v == 0 && n == 0
+	names := make([]string, 0, max(n, 0))
+	for i := 0; i < n; i++ {
+		names = append(names, d.string())
+	}
+	autoCreate := true
+	if v >= 4 {
+		autoCreate = d.bool()
+	}
+	if v >= 8 {
+		d.bool() // include_cluster_authorized_operations
+		d.bool() // include_topic_authorized_operations
+	}
+	if d.err != nil {
+		return nil
+	}
+
+	type topicResult struct {
+		name      string
+		errorCode int16
+		meta      *storage.TopicMetadata
+	}
+	var topics []topicResult
+	if all {
+		metas, err := c.server.stream.ListTopics()
+		if err != nil {
+			log.Printf("[KAFKA] Failed to list topics: %v", err)
+		}
+		sort.Slice(metas, func(i, j int) bool { return metas[i].Name < metas[j].Name })
+		for _, meta := range metas {
+			topics = append(topics, topicResult{name: meta.Name, meta: meta})
+		}
+	} else {
+		for _, name := range names {
+			t := topicResult{name: name, meta: c.topic(name)}
+			switch {
+			case name == "":
+				t.errorCode = errInvalidTopic
+			case t.meta == nil && autoCreate && c.server.opts.AutoCreateTopics:
+				t.meta = c.createTopic(name)
+			}
+			if t.meta == nil && t.errorCode == errNone {
+				t.errorCode = errUnknownTopicOrPartition
+			}
+			topics = append(topics, t)
+		}
+	}
+
+	e := &encoder{}
+	if v >= 3 {
+		e.int32(0) // throttle_time_ms
+	}
+	e.arrayLen(1)
+	e.int32(nodeID)
+	e.string(c.server.host)
+	e.int32(c.server.port)
+	if v >= 1 {
+		e.nullString() // rack
+	}
+	if v >= 2 {
+		e.string(clusterID)
+	}
+	if v >= 1 {
+		e.int32(nodeID) // controller_id
+	}
+
+	e.arrayLen(len(topics))
+	for _, t := range topics {
+		e.int16(t.errorCode)
+		e.string(t.name)
+		if v >= 1 {
+			e.bool(false) // is_internal
+		}
+		partitions := 0
+		if t.meta != nil {
+			partitions = t.meta.Partitions
+		}
+		e.arrayLen(partitions)
+		for p := 0; p < partitions; p++ {
+			e.int16(errNone)
+			e.int32(int32(p))
+			e.int32(nodeID) // leader
+			if v >= 7 {
+				e.int32(-1) // leader_epoch: unknown, skips epoch validation
+			}
+			e.int32Array([]int32{nodeID}) // replicas
+			e.int32Array([]int32{nodeID}) // isr
+			if v >= 5 {
+				e.int32Array(nil) // offline_replicas
+			}
+		}
+		if v >= 8 {
+			e.int32(math.MinInt32) // topic_authorized_operations: not requested
+		}
+	}
+	if v >= 8 {
+		e.int32(math.MinInt32) // cluster_authorized_operations
+	}
+	return e.buf
+}
+
+// createTopic auto-creates a topic. Keys are hashed with murmur2 so Flin
+// producers that omit the partition agree with Kafka's default partitioner.
+func (c *conn) createTopic(name string) *storage.TopicMetadata {
+	err := c.server.stream.CreateTopicWithConfig(name, stream.TopicConfig{
+		Partitions:  c.server.opts.DefaultPartitions,
+		Partitioner: storage.PartitionerMurmur2,
+	})
+	if err != nil {
+		// Another client may have created it first
+		return c.topic(name)
+	}
+	log.Printf("[KAFKA] Auto-created topic %s", name)
+	return c.topic(name)
+}
+
+// handleProduce appends each partition's record batches. Batches from
+// idempotent producers are deduplicated by producer ID and sequence, so a
+// retried batch is not written twice.
+func (c *conn) handleProduce(req *request) ([]byte, bool) {
+	d, v := req.body, req.version
+
+	d.nullableString() // transactional_id
+	acks := d.int16()
+	d.int32() // timeout_ms
+
+	e := &encoder{}
+	topics := d.arrayLen()
+	e.arrayLen(max(topics, 0))
+	for i := 0; i < topics && d.err == nil; i++ {
+		name := d.string()
+		meta := c.topic(name)
+		e.string(name)
+
+		partitions := d.arrayLen()
+		e.arrayLen(max(partitions, 0))
+		for j := 0; j < partitions && d.err == nil; j++ {
+			partition := d.int32()
+			data := d.bytes()
+
+			errorCode := partitionError(meta, partition)
+			baseOffset := int64(-1)
+			if errorCode == errNone && d.err == nil {
+				baseOffset, errorCode = c.produce(name, partition, data)
+			}
+
+			e.int32(partition)
+			e.int16(errorCode)
+			e.int64(baseOffset)
+			e.int64(-1) // log_append_time_ms: topics use CreateTime
+			if v >= 5 {
+				e.int64(-1) // log_start_offset
+			}
+			if v >= 8 {
+				e.arrayLen(0)  // record_errors
+				e.nullString() // error_message
+			}
+		}
+	}
+	e.int32(0) // throttle_time_ms
+
+	if d.err != nil {
+		return nil, false
+	}
+	return e.buf, acks == 0
+}
+
+func (c *conn) produce(topic string, partition int32, data []byte) (int64, int16) {
+	batches, err := decodeBatches(data)
+	switch err {
+	case nil:
+	case errUnsupportedCompression:
+		return -1, errUnsupportedCompressionType
+	case errUnsupportedMagic:
+		return -1, errUnsupportedForMessageFormat
+	default:
+		return -1, errCorruptMessage
+	}
+
+	baseOffset := int64(-1)
+	for _, b := range batches {
+		var offsets []int64
+		if b.producerID >= 0 {
+			offsets, err = c.server.stream.PublishPartitionIdempotent(topic, int(partition), b.records,
+				uint64(b.producerID), uint64(b.baseSequence))
+		} else {
+			_, offsets, err = c.server.stream.PublishBatch(topic, int(partition), b.records)
+		}
+
+		switch {
+		case errors.Is(err, storage.ErrDuplicateSequence):
+			return baseOffset, errDuplicateSequenceNumber
+		case errors.Is(err, storage.ErrOutOfOrderSequence):
+			return baseOffset, errOutOfOrderSequenceNumber
+		case err != nil:
+			log.Printf("[KAFKA] Produce to %s/%d failed: %v", topic, partition, err)
+			return -1, errUnknownServerError
+		}
+		if baseOffset < 0 {
+			baseOffset = offsets[0]
+		}
+	}
+	return baseOffset, errNone
+}
+
+type fetchPartition struct {
+	index    int32
+	offset   int64
+	maxBytes int32
+
+	errorCode     int16
+	highWatermark int64
+	logStart      int64
+	records       []byte
+}
+
+type fetchTopic struct {
+	name       string
+	partitions []*fetchPartition
+}
+
+// handleFetch reads from each requested partition, waiting up to
+// max_wait_ms for min_bytes to arrive. Fetch sessions are not kept:
+// session_id 0 tells clients to send full requests every time.
+func (c *conn) handleFetch(req *request) []byte {
+	d, v := req.body, req.version
+
+	d.int32() // replica_id
+	maxWait := time.Duration(d.int32()) * time.Millisecond
+	minBytes := int(d.int32())
+	maxBytes := int(d.int32())
+	d.int8() // isolation_level
+	if v >= 7 {
+		d.int32() // session_id
+		d.int32() // session_epoch
+	}
+
+	n := d.arrayLen()
+	topics := make([]*fetchTopic, 0, max(n, 0))
+	for i := 0; i < n && d.err == nil; i++ {
+		t := &fetchTopic{name: d.string()}
+		parts := d.arrayLen()
+		for j := 0; j < parts && d.err == nil; j++ {
+			p := &fetchPartition{index: d.int32()}
+			if v >= 9 {
+				d.int32() // current_leader_epoch
+			}
+			p.offset = d.int64()
+			if v >= 5 {
+				d.int64() // log_start_offset
+			}
+			p.maxBytes = d.int32()
+			t.partitions = append(t.partitions, p)
+		}
+		topics = append(topics, t)
+	}
+	if v >= 7 {
+		forgotten := d.arrayLen()
+		for i := 0; i < forgotten && d.err == nil; i++ {
+			d.string()
+			d.int32Array()
+		}
+	}
+	if v >= 11 {
+		d.string() // rack_id
+	}
+	if d.err != nil {
+		return nil
+	}
+
+	if maxWait > stream.MaxConsumeWait {
+		maxWait = stream.MaxConsumeWait
+	}
+	deadline := time.Now().Add(maxWait)
+
+	for {
+		// Watch before reading so an append in between still wakes us
+		wake := make(chan struct{}, 1)
+		notify := func() {
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		}
+		var cancels []func()
+		for _, t := range topics {
+			partitions := make([]int, len(t.partitions))
+			for i, p := range t.partitions {
+				partitions[i] = int(p.index)
+			}
+			cancels = append(cancels, c.server.stream.Watch(t.name, partitions, notify))
+		}
+
+		total, failed := c.readFetch(topics, maxBytes)
+		wait := time.Until(deadline)
+		if total >= minBytes || failed || wait <= 0 {
+			for _, cancel := range cancels {
+				cancel()
+			}
+			break
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-wake:
+		case <-timer.C:
+		case <-c.ctx.Done():
+		}
+		timer.Stop()
+		for _, cancel := range cancels {
+			cancel()
+		}
+		if c.ctx.Err() != nil {
+			break
+		}
+	}
+
+	e := &encoder{}
+	e.int32(0) // throttle_time_ms
+	if v >= 7 {
+		e.int16(errNone)
+		e.int32(0) // session_id
+	}
+	e.arrayLen(len(topics))
+	for _, t := range topics {
+		e.string(t.name)
+		e.arrayLen(len(t.partitions))
+		for _, p := range t.partitions {
+			e.int32(p.index)
+			e.int16(p.errorCode)
+			e.int64(p.highWatermark)
+			e.int64(p.highWatermark) // last_stable_offset
+			if v >= 5 {
+				e.int64(p.logStart)
+			}
+			e.arrayLen(0) // aborted_transactions
+			if v >= 11 {
+				e.int32(-1) // preferred_read_replica
+			}
+			if p.records == nil {
+				e.bytes([]byte{})
+			} else {
+				e.bytes(p.records)
+			}
+		}
+	}
+	return e.buf
+}
+
+// readFetch fills in every partition of a fetch and returns the bytes read
+// and whether any partition failed. Like Kafka, the first non-empty
+// partition returns at least one message even if it exceeds the limits.
+func (c *conn) readFetch(topics []*fetchTopic, maxBytes int) (int, bool) {
+	total := 0
+	failed := false
+
+	for _, t := range topics {
+		offsets, err := c.server.stream.GetOffsets(t.name)
+		for _, p := range t.partitions {
+			p.records = nil
+			p.errorCode = errNone
+			if err != nil || p.index < 0 || int(p.index) >= len(offsets) {
+				p.errorCode = errUnknownTopicOrPartition
+				p.highWatermark, p.logStart = -1, -1
+				failed = true
+				continue
+			}
+
+			po := offsets[p.index]
+			p.highWatermark, p.logStart = po.Latest, po.Earliest
+			if p.offset < po.Earliest || p.offset > po.Latest {
+				p.errorCode = errOffsetOutOfRange
+				failed = true
+				continue
+			}
+			limit := min(int(p.maxBytes), maxBytes-total)
+			if p.offset == po.Latest || limit <= 0 && total > 0 {
+				continue
+			}
+
+			msgs, err := c.server.stream.Fetch(t.name, int(p.index), p.offset, fetchMaxMessages)
+			if err != nil {
+				log.Printf("[KAFKA] Fetch from %s/%d failed: %v", t.name, p.index, err)
+				p.errorCode = errUnknownServerError
+				failed = true
+				continue
+			}
+			p.records, _ = encodeBatch(msgs, limit, total == 0)
+			total += len(p.records)
+		}
+	}
+
+	return total, failed
+}
+
+func (c *conn) handleListOffsets(req *request) []byte {
+	d, v := req.body, req.version
+
+	d.int32() // replica_id
+	if v >= 2 {
+		d.int8() // isolation_level
+	}
+
+	e := &encoder{}
+	if v >= 2 {
+		e.int32(0) // throttle_time_ms
+	}
+	topics := d.arrayLen()
+	e.arrayLen(max(topics, 0))
+	for i := 0; i < topics && d.err == nil; i++ {
+		name := d.string()
+		e.string(name)
+		offsets, err := c.server.stream.GetOffsets(name)
+
+		partitions := d.arrayLen()
+		e.arrayLen(max(partitions, 0))
+		for j := 0; j < partitions && d.err == nil; j++ {
+			partition := d.int32()
+			if v >= 4 {
+				d.int32() // current_leader_epoch
+			}
+			timestamp := d.int64()
+
+			errorCode := errNone
+			ts, offset := int64(-1), int64(-1)
+			switch {
+			case err != nil || partition < 0 || int(partition) >= len(offsets):
+				errorCode = errUnknownTopicOrPartition
+			case timestamp == -1: // latest
+				offset = offsets[partition].Latest
+			case timestamp == -2: // earliest
+				offset = offsets[partition].Earliest
+			default:
+				ts, offset, errorCode = c.offsetForTimestamp(name, partition, timestamp, offsets[partition].Latest)
+			}
+
+			e.int32(partition)
+			e.int16(errorCode)
+			e.int64(ts)
+			e.int64(offset)
+			if v >= 4 {
+				e.int32(-1) // leader_epoch
+			}
+		}
+	}
+	return e.buf
+}
+
+// offsetForTimestamp finds the first message appended at or after ts,
+// returning -1 for both timestamp and offset when there is none
+func (c *conn) offsetForTimestamp(topic string, partition int32, ts, latest int64) (int64, int64, int16) {
+	offset, err := c.server.stream.OffsetForTimestamp(topic, int(partition), ts)
+	if err != nil {
+		log.Printf("[KAFKA] Offset lookup on %s/%d failed: %v", topic, partition, err)
+		return -1, -1, errUnknownServerError
+	}
+	if offset >= latest {
+		return -1, -1, errNone
+	}
+	msgs, err := c.server.stream.Fetch(topic, int(partition), offset, 1)
+	if err != nil || len(msgs) == 0 {
+		return -1, -1, errNone
+	}
+	return msgs[0].Timestamp, msgs[0].Offset, errNone
+}
+
+// handleFindCoordinator names this server as the coordinator of every
+// group. Transaction coordinators are not available.
+func (c *conn) handleFindCoordinator(req *request) []byte {
+	d, v := req.body, req.version
+
+	d.string() // key
+	keyType := int8(0)
+	if v >= 1 {
+		keyType = d.int8()
+	}
+
+	e := &encoder{}
+	if v >= 1 {
+		e.int32(0) // throttle_time_ms
+	}
+	if keyType != 0 {
+		e.int16(errCoordinatorNotAvailable)
+		if v >= 1 {
+			e.nullString()
+		}
+		e.int32(-1)
+		e.string("")
+		e.int32(-1)
+		return e.buf
+	}
+	e.int16(errNone)
+	if v >= 1 {
+		e.nullString() // error_message
+	}
+	e.int32(nodeID)
+	e.string(c.server.host)
+	e.int32(c.server.port)
+	return e.buf
+}
+
+func (c *conn) handleJoinGroup(req *request) []byte {
+	d, v := req.body, req.version
+
+	groupID := d.string()
+	sessionTimeout := time.Duration(d.int32()) * time.Millisecond
+	rebalanceTimeout := sessionTimeout
+	if v >= 1 {
+		rebalanceTimeout = time.Duration(d.int32()) * time.Millisecond
+	}
+	memberID := d.string()
+	if v >= 5 {
+		d.nullableString() // group_instance_id: static membership is not supported
+	}
+	protocolType := d.string()
+	n := d.arrayLen()
+	protocols := make([]protocolMetadata, 0, max(n, 0))
+	for i := 0; i < n && d.err == nil; i++ {
+		protocols = append(protocols, protocolMetadata{name: d.string(), metadata: d.bytes()})
+	}
+	if d.err != nil {
+		return nil
+	}
+
+	var result joinResult
+	switch {
+	case groupID == "":
+		result = joinResult{errorCode: errInvalidGroupID, generation: -1, memberID: memberID}
+	case sessionTimeout < minSessionTimeout || sessionTimeout > maxSessionTimeout:
+		result = joinResult{errorCode: errInvalidSessionTimeout, generation: -1, memberID: memberID}
+	default:
+		result = c.server.groups.join(c.ctx, groupID, memberID, req.clientID, protocolType, protocols,
+			sessionTimeout, rebalanceTimeout, v >= 4)
+	}
+
+	e := &encoder{}
+	if v >= 2 {
+		e.int32(0) // throttle_time_ms
+	}
+	e.int16(result.errorCode)
+	e.int32(result.generation)
+	e.string(result.protocol)
+	e.string(result.leader)
+	e.string(result.memberID)
+	e.arrayLen(len(result.members))
+	for _, m := range result.members {
+		e.string(m.id)
+		if v >= 5 {
+			e.nullString() // group_instance_id
+		}
+		e.bytes(m.metadata)
+	}
+	return e.buf
+}
+
+func (c *conn) handleSyncGroup(req *request) []byte {
+	d, v := req.body, req.version
+
+	groupID := d.string()
+	generation := d.int32()
+	memberID := d.string()
+	if v >= 3 {
+		d.nullableString() // group_instance_id
+	}
+	n := d.arrayLen()
+	assignments := make(map[string][]byte, max(n, 0))
+	for i := 0; i < n && d.err == nil; i++ {
+		id := d.string()
+		assignments[id] = d.bytes()
+	}
+	if d.err != nil {
+		return nil
+	}
+
+	result := c.server.groups.sync(c.ctx, groupID, memberID, generation, assignments)
+
+	e := &encoder{}
+	if v >= 1 {
+		e.int32(0) // throttle_time_ms
+	}
+	e.int16(result.errorCode)
+	if result.assignment == nil {
+		e.bytes([]byte{})
+	} else {
+		e.bytes(result.assignment)
+	}
+	return e.buf
+}
+
+func (c *conn) handleHeartbeat(req *request) []byte {
+	d, v := req.body, req.version
+
+	groupID := d.string()
+	generation := d.int32()
+	memberID := d.string()
+	if v >= 3 {
+		d.nullableString() // group_instance_id
+	}
+	if d.err != nil {
+		return nil
+	}
+
+	e := &encoder{}
+	if v >= 1 {
+		e.int32(0) // throttle_time_ms
+	}
+	e.int16(c.server.groups.heartbeat(groupID, memberID, generation))
+	return e.buf
+}
+
+func (c *conn) handleLeaveGroup(req *request) []byte {
+	d, v := req.body, req.version
+
+	groupID := d.string()
+	var memberIDs []string
+	if v >= 3 {
+		n := d.arrayLen()
+		for i := 0; i < n && d.err == nil; i++ {
+			memberIDs = append(memberIDs, d.string())
+			d.nullableString() // group_instance_id
+		}
+	} else {
+		memberIDs = append(memberIDs, d.string())
+	}
+	if d.err != nil {
+		return nil
+	}
+
+	e := &encoder{}
+	if v >= 1 {
+		e.int32(0) // throttle_time_ms
+	}
+	if v < 3 {
+		e.int16(c.server.groups.leave(groupID, memberIDs[0]))
+		return e.buf
+	}
+
+	e.int16(errNone)
+	e.arrayLen(len(memberIDs))
+	for _, id := range memberIDs {
+		e.string(id)
+		e.nullString() // group_instance_id
+		e.int16(c.server.groups.leave(groupID, id))
+	}
+	return e.buf
+}
+
+// handleOffsetCommit stores offsets through the stream, so Kafka groups
+// show up in Flin's group listing and lag reports
+func (c *conn) handleOffsetCommit(req *request) []byte {
+	d, v := req.body, req.version
+
+	groupID := d.string()
+	generation := int32(-1)
+	memberID := ""
+	if v >= 1 {
+		generation = d.int32()
+		memberID = d.string()
+	}
+	if v >= 2 && v <= 4 {
+		d.int64() // retention_time_ms
+	}
+	if v >= 7 {
+		d.nullableString() // group_instance_id
+	}
+	if d.err != nil {
+		return nil
+	}
+
+	groupError := c.server.groups.checkCommit(groupID, memberID, generation)
+	if groupID == "" {
+		groupError = errInvalidGroupID
+	}
+
+	e := &encoder{}
+	if v >= 3 {
+		e.int32(0) // throttle_time_ms
+	}
+	topics := d.arrayLen()
+	e.arrayLen(max(topics, 0))
+	for i := 0; i < topics && d.err == nil; i++ {
+		name := d.string()
+		meta := c.topic(name)
+		e.string(name)
+
+		partitions := d.arrayLen()
+		e.arrayLen(max(partitions, 0))
+		for j := 0; j < partitions && d.err == nil; j++ {
+			partition := d.int32()
+			offset := d.int64()
+			if v == 1 {
+				d.int64() // commit_timestamp
+			}
+			if v >= 6 {
+				d.int32() // committed_leader_epoch
+			}
+			d.nullableString() // committed_metadata
+
+			errorCode := groupError
+			if errorCode == errNone {
+				errorCode = partitionError(meta, partition)
+			}
+			if errorCode == errNone && d.err == nil {
+				if err := c.server.stream.Commit(name, groupID, int(partition), offset); err != nil {
+					log.Printf("[KAFKA] Commit for %s on %s/%d failed: %v", groupID, name, partition, err)
+					errorCode = errUnknownServerError
+				}
+			}
+			e.int32(partition)
+			e.int16(errorCode)
+		}
+	}
+	return e.buf
+}
+
+func (c *conn) handleOffsetFetch(req *request) []byte {
+	d, v := req.body, req.version
+
+	groupID := d.string()
+	requested := make(map[string][]int32)
+	var names []string
+	n := d.arrayLen()
+	for i := 0; i < n && d.err == nil; i++ {
+		name := d.string()
+		names = append(names, name)
+		requested[name] = d.int32Array()
+	}
+	if d.err != nil {
+		return nil
+	}
+
+	// A null topic list (v2+) asks for every committed offset
+	if n < 0 {
+		metas, _ := c.server.stream.ListTopics()
+		sort.Slice(metas, func(i, j int) bool { return metas[i].Name < metas[j].Name })
+		for _, meta := range metas {
+			var committed []int32
+			for p := 0; p < meta.Partitions; p++ {
+				if _, ok, _ := c.server.stream.CommittedOffset(groupID, meta.Name, p); ok {
+					committed = append(committed, int32(p))
+				}
+			}
+			if len(committed) > 0 {
+				names = append(names, meta.Name)
+				requested[meta.Name] = committed
+			}
+		}
+	}
+
+	e := &encoder{}
+	if v >= 3 {
+		e.int32(0) // throttle_time_ms
+	}
+	e.arrayLen(len(names))
+	for _, name := range names {
+		e.string(name)
+		partitions := requested[name]
+		e.arrayLen(len(partitions))
+		for _, partition := range partitions {
+			offset, ok, err := c.server.stream.CommittedOffset(groupID, name, int(partition))
+			errorCode := errNone
+			if err != nil {
+				errorCode = errUnknownServerError
+			}
+			if !ok {
+				offset = -1
+			}
+
+			e.int32(partition)
+			e.int64(offset)
+			if v >= 5 {
+				e.int32(-1) // committed_leader_epoch
+			}
+			e.string("") // metadata
+			e.int16(errorCode)
+		}
+	}
+	if v >= 2 {
+		e.int16(errNone)
+	}
+	return e.buf
+}
+
+// handleInitProducerID hands out producer IDs for idempotent producers.
+// Transactional producers are refused.
+func (c *conn) handleInitProducerID(req *request) []byte {
+	d := req.body
+
+	_, transactional := d.nullableString()
+	d.int32() // transaction_timeout_ms
+	if d.err != nil {
+		return nil
+	}
+
+	errorCode := errNone
+	producerID := int64(-1)
+	if transactional {
+		errorCode = errInvalidRequest
+	} else if id, err := c.server.stream.InitProducer(); err != nil {
+		log.Printf("[KAFKA] InitProducerId failed: %v", err)
+		errorCode = errUnknownServerError
+	} else {
+		producerID = int64(id)
+	}
+
+	e := &encoder{}
+	e.int32(0) // throttle_time_ms
+	e.int16(errorCode)
+	e.int64(producerID)
+	e.int16(0) // producer_epoch
+	return e.buf
+}
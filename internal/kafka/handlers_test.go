@@ -0,0 +1,124 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/skshohagmiah/flin/internal/stream"
+)
+
+// Helper function to create a connection backed by a test stream
+func createTestConn(t *testing.T) *conn {
+	st, err := stream.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create stream: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return &conn{server: &Server{stream: st}}
+}
+
+// TestApiVersions tests the advertised API ranges and the v0 fallback
+func TestApiVersions(t *testing.T) {
+	c := &conn{}
+
+	tests := []struct {
+		version   int16
+		errorCode int16
+	}{
+		{0, errNone},
+		{2, errNone},
+		{0, errUnsupportedVersion},
+	}
+
+	for _, tt := range tests {
+		d := &decoder{buf: c.apiVersions(tt.version, tt.errorCode)}
+		if code := d.int16(); code != tt.errorCode {
+			t.Errorf("v%d: expected error %d, got %d", tt.version, tt.errorCode, code)
+		}
+
+		n := d.arrayLen()
+		if n != len(apiVersions) {
+			t.Fatalf("v%d: expected %d APIs, got %d", tt.version, len(apiVersions), n)
+		}
+		for i := 0; i < n; i++ {
+			key, min, max := d.int16(), d.int16(), d.int16()
+			if want := apiVersions[i]; key != want.key || min != want.min || max != want.max {
+				t.Errorf("v%d: expected %+v, got {%d %d %d}", tt.version, want, key, min, max)
+			}
+		}
+		if tt.version >= 1 {
+			d.int32() // throttle_time_ms
+		}
+		if d.err != nil || d.remaining() != 0 {
+			t.Errorf("v%d: expected the response to end after its fields (%v, %d left)", tt.version, d.err, d.remaining())
+		}
+	}
+
+	if !supported(apiProduce, 8) || supported(apiProduce, 9) || supported(apiProduce, 2) {
+		t.Error("Expected Produce v3-v8 to be served")
+	}
+	if supported(99, 0) {
+		t.Error("Expected unknown APIs to be unsupported")
+	}
+}
+
+// TestProduceIdempotent tests that a retried batch from an idempotent
+// producer is written once and sequence gaps are refused
+func TestProduceIdempotent(t *testing.T) {
+	c := createTestConn(t)
+	if err := c.server.stream.CreateTopic("events", 2, 0); err != nil {
+		t.Fatalf("Failed to create topic: %v", err)
+	}
+
+	batch, _ := encodeBatch(testMessages, 1<<20, false)
+	records := batch[batchHeaderSize:]
+	n := int32(len(testMessages))
+
+	tests := []struct {
+		name       string
+		partition  int32
+		producerID int64
+		sequence   int32
+		wantOffset int64
+		wantCode   int16
+	}{
+		{"first batch", 0, 1, 0, 0, errNone},
+		{"retry of last batch", 0, 1, 0, 0, errNone},
+		{"next batch", 0, 1, n, 3, errNone},
+		{"older batch", 0, 1, 0, -1, errDuplicateSequenceNumber},
+		{"gap", 0, 1, 3 * n, -1, errOutOfOrderSequenceNumber},
+		{"own sequence per partition", 1, 1, 0, 0, errNone},
+		{"own sequence per producer", 0, 2, 0, 6, errNone},
+		{"non-idempotent resend", 0, -1, -1, 9, errNone},
+		{"non-idempotent resend again", 0, -1, -1, 12, errNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := rewriteBatch(batch, compressionNone, tt.producerID, tt.sequence, records)
+			offset, code := c.produce("events", tt.partition, data)
+			if code != tt.wantCode || offset != tt.wantOffset {
+				t.Errorf("Expected offset %d code %d, got offset %d code %d", tt.wantOffset, tt.wantCode, offset, code)
+			}
+		})
+	}
+
+	offsets, err := c.server.stream.GetOffsets("events")
+	if err != nil {
+		t.Fatalf("Failed to get offsets: %v", err)
+	}
+	if offsets[0].Latest != 15 || offsets[1].Latest != 3 {
+		t.Errorf("Expected 15 and 3 messages written, got %+v", offsets)
+	}
+
+	// Deleting the topic forgets its producer sequences
+	if err := c.server.stream.DeleteTopic("events"); err != nil {
+		t.Fatalf("Failed to delete topic: %v", err)
+	}
+	if err := c.server.stream.CreateTopic("events", 1, 0); err != nil {
+		t.Fatalf("Failed to recreate topic: %v", err)
+	}
+	data := rewriteBatch(batch, compressionNone, 1, 0, records)
+	if offset, code := c.produce("events", 0, data); code != errNone || offset != 0 {
+		t.Errorf("Expected a fresh sequence after recreate, got offset %d code %d", offset, code)
+	}
+}
@@ -0,0 +1,74 @@
+package kafka
+
+// API keys
+const (
+	apiProduce         int16 = 0
+	apiFetch           int16 = 1
+	apiListOffsets     int16 = 2
+	apiMetadata        int16 = 3
+	apiOffsetCommit    int16 = 8
+	apiOffsetFetch     int16 = 9
+	apiFindCoordinator int16 = 10
+	apiJoinGroup       int16 = 11
+	apiHeartbeat       int16 = 12
+	apiLeaveGroup      int16 = 13
+	apiSyncGroup       int16 = 14
+	apiApiVersions     int16 = 18
+	apiInitProducerID  int16 = 22
+)
+
+// Error codes
+const (
+	errNone                        int16 = 0
+	errOffsetOutOfRange            int16 = 1
+	errCorruptMessage              int16 = 2
+	errUnknownTopicOrPartition     int16 = 3
+	errCoordinatorNotAvailable     int16 = 15
+	errInvalidTopic                int16 = 17
+	errIllegalGeneration           int16 = 22
+	errInconsistentGroupProtocol   int16 = 23
+	errInvalidGroupID              int16 = 24
+	errUnknownMemberID             int16 = 25
+	errInvalidSessionTimeout       int16 = 26
+	errRebalanceInProgress         int16 = 27
+	errUnsupportedVersion          int16 = 35
+	errInvalidRequest              int16 = 42
+	errUnsupportedForMessageFormat int16 = 43
+	errOutOfOrderSequenceNumber    int16 = 45
+	errDuplicateSequenceNumber     int16 = 46
+	errUnknownServerError          int16 = -1
+	errUnsupportedCompressionType  int16 = 76
+	errMemberIDRequired            int16 = 79
+)
+
+// apiVersion is the range of versions served for one API. Every range
+// stops before the API's first flexible version, whose tagged-field
+// encoding is not implemented.
+type apiVersion struct {
+	key, min, max int16
+}
+
+var apiVersions = []apiVersion{
+	{apiProduce, 3, 8},
+	{apiFetch, 4, 11},
+	{apiListOffsets, 1, 5},
+	{apiMetadata, 0, 8},
+	{apiOffsetCommit, 0, 7},
+	{apiOffsetFetch, 0, 5},
+	{apiFindCoordinator, 0, 2},
+	{apiJoinGroup, 0, 5},
+	{apiHeartbeat, 0, 3},
+	{apiLeaveGroup, 0, 3},
+	{apiSyncGroup, 0, 3},
+	{apiApiVersions, 0, 2},
+	{apiInitProducerID, 0, 1},
+}
+
+func supported(key, version int16) bool {
+	for _, v := range apiVersions {
+		if v.key == key {
+			return version >= v.min && version <= v.max
+		}
+	}
+	return false
+}
@@ -0,0 +1,311 @@
+package kafka
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"sort"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/skshohagmiah/flin/internal/storage"
+)
+
+// Record batch attributes
+const (
+	compressionMask   = 0x07
+	compressionNone   = 0
+	compressionGzip   = 1
+	compressionSnappy = 2
+	compressionLZ4    = 3
+	compressionZstd   = 4
+
+	attrControl = 0x20
+)
+
+const (
+	batchMagic = 2
+	// batchHeaderSize is the size of a v2 record batch header up to and
+	// including the record count
+	batchHeaderSize = 61
+	// batchLengthOffset is where batchLength starts; the length counts the
+	// bytes after it
+	batchLengthOffset = 8
+	batchCRCOffset    = 17
+	batchAttrsOffset  = 21
+)
+
+var (
+	errCorruptBatch           = errors.New("kafka: corrupt record batch")
+	errUnsupportedMagic       = errors.New("kafka: only record batch v2 is supported")
+	errUnsupportedCompression = errors.New("kafka: unsupported compression codec")
+
+	castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+	// zstd decoders are safe for concurrent DecodeAll
+	zstdDecoder, _ = zstd.NewReader(nil)
+
+	// xerialHeader starts snappy data framed the way the Java client writes it
+	xerialHeader = []byte{0x82, 'S', 'N', 'A', 'P', 'P', 'Y', 0}
+)
+
+// recordBatch is a decoded record batch. producerID is -1 unless the
+// producer is idempotent, in which case baseSequence numbers the first
+// record.
+type recordBatch struct {
+	producerID   int64
+	baseSequence int32
+	records      []storage.Record
+}
+
+// decodeBatches converts the record batches of one Produce partition into
+// Flin records. Transaction control batches are skipped, and the record
+// timestamp becomes the record's EventTime.
+func decodeBatches(data []byte) ([]recordBatch, error) {
+	var batches []recordBatch
+
+	for len(data) > 0 {
+		if len(data) < batchHeaderSize {
+			return nil, errCorruptBatch
+		}
+		end := batchLengthOffset + 4 + int(int32(binary.BigEndian.Uint32(data[batchLengthOffset:])))
+		if end < batchHeaderSize || end > len(data) {
+			return nil, errCorruptBatch
+		}
+		batch := data[:end]
+		data = data[end:]
+
+		if batch[16] != batchMagic {
+			return nil, errUnsupportedMagic
+		}
+		if crc32.Checksum(batch[batchAttrsOffset:], castagnoli) != binary.BigEndian.Uint32(batch[batchCRCOffset:]) {
+			return nil, errCorruptBatch
+		}
+
+		d := &decoder{buf: batch, pos: batchAttrsOffset}
+		attrs := d.int16()
+		d.int32() // lastOffsetDelta
+		firstTimestamp := d.int64()
+		d.int64() // maxTimestamp
+		rb := recordBatch{producerID: d.int64()}
+		d.int16() // producerEpoch
+		rb.baseSequence = d.int32()
+		count := int(d.int32())
+
+		if attrs&attrControl != 0 {
+			continue
+		}
+
+		body, err := decompress(int(attrs&compressionMask), batch[batchHeaderSize:])
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 || count > len(body) {
+			return nil, errCorruptBatch
+		}
+
+		rd := &decoder{buf: body}
+		for i := 0; i < count; i++ {
+			rec, err := decodeRecord(rd, firstTimestamp)
+			if err != nil {
+				return nil, err
+			}
+			rb.records = append(rb.records, rec)
+		}
+		if len(rb.records) > 0 {
+			batches = append(batches, rb)
+		}
+	}
+
+	return batches, nil
+}
+
+func decodeRecord(d *decoder, firstTimestamp int64) (storage.Record, error) {
+	length := d.varint()
+	if d.err != nil || length < 0 || length > int64(d.remaining()) {
+		return storage.Record{}, errCorruptBatch
+	}
+	end := d.pos + int(length)
+
+	d.int8() // attributes
+	timestampDelta := d.varint()
+	d.varint() // offsetDelta
+	key := d.varbytes()
+	value := d.varbytes()
+
+	rec := storage.Record{
+		Key:       string(key),
+		Value:     value,
+		EventTime: firstTimestamp + timestampDelta,
+	}
+
+	headers := d.varint()
+	if headers < 0 || headers > int64(d.remaining()) {
+		return storage.Record{}, errCorruptBatch
+	}
+	if headers > 0 {
+		rec.Headers = make(map[string]string, headers)
+		for i := int64(0); i < headers; i++ {
+			k := d.varbytes()
+			v := d.varbytes()
+			rec.Headers[string(k)] = string(v)
+		}
+	}
+
+	if d.err != nil || d.pos != end {
+		return storage.Record{}, errCorruptBatch
+	}
+	return rec, nil
+}
+
+func decompress(codec int, data []byte) ([]byte, error) {
+	switch codec {
+	case compressionNone:
+		return data, nil
+	case compressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, errCorruptBatch
+		}
+		defer r.Close()
+		out, err := io.ReadAll(r)
+		if err != nil {
+			return nil, errCorruptBatch
+		}
+		return out, nil
+	case compressionSnappy:
+		return decodeSnappy(data)
+	case compressionZstd:
+		out, err := zstdDecoder.DecodeAll(data, nil)
+		if err != nil {
+			return nil, errCorruptBatch
+		}
+		return out, nil
+	}
+	return nil, errUnsupportedCompression
+}
+
+// decodeSnappy accepts both raw snappy blocks and the xerial framing used
+// by the Java client: the header, two version ints, then length-prefixed
+// blocks
+func decodeSnappy(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, xerialHeader) {
+		out, err := snappy.Decode(nil, data)
+		if err != nil {
+			return nil, errCorruptBatch
+		}
+		return out, nil
+	}
+
+	var out []byte
+	data = data[len(xerialHeader)+8:]
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, errCorruptBatch
+		}
+		n := int(binary.BigEndian.Uint32(data))
+		if n > len(data)-4 {
+			return nil, errCorruptBatch
+		}
+		block, err := snappy.Decode(nil, data[4:4+n])
+		if err != nil {
+			return nil, errCorruptBatch
+		}
+		out = append(out, block...)
+		data = data[4+n:]
+	}
+	return out, nil
+}
+
+// encodeBatch builds one uncompressed record batch from messages in offset
+// order, stopping before the batch would exceed maxBytes. At least one
+// message is included when force is set, so a message larger than the
+// limit cannot stall a consumer. It returns the batch and how many
+// messages it holds.
+func encodeBatch(msgs []*storage.Message, maxBytes int, force bool) ([]byte, int) {
+	if len(msgs) == 0 {
+		return nil, 0
+	}
+
+	baseOffset := msgs[0].Offset
+	firstTimestamp := recordTimestamp(msgs[0])
+	maxTimestamp := firstTimestamp
+
+	body := &encoder{}
+	rec := &encoder{}
+	n := 0
+	for _, msg := range msgs {
+		ts := recordTimestamp(msg)
+
+		rec.buf = rec.buf[:0]
+		rec.int8(0) // attributes
+		rec.varint(ts - firstTimestamp)
+		rec.varint(msg.Offset - baseOffset)
+		if msg.Key == "" {
+			rec.varbytes(nil)
+		} else {
+			rec.varbytes([]byte(msg.Key))
+		}
+		if len(msg.Value) == 0 {
+			// An empty value is a Flin tombstone, which Kafka writes as null
+			rec.varbytes(nil)
+		} else {
+			rec.varbytes(msg.Value)
+		}
+		rec.varint(int64(len(msg.Headers)))
+		keys := make([]string, 0, len(msg.Headers))
+		for k := range msg.Headers {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			rec.varbytes([]byte(k))
+			rec.varbytes([]byte(msg.Headers[k]))
+		}
+
+		size := len(body.buf) + binary.MaxVarintLen32 + len(rec.buf)
+		if batchHeaderSize+size > maxBytes && !(force && n == 0) {
+			break
+		}
+		body.varint(int64(len(rec.buf)))
+		body.buf = append(body.buf, rec.buf...)
+		if ts > maxTimestamp {
+			maxTimestamp = ts
+		}
+		n++
+	}
+	if n == 0 {
+		return nil, 0
+	}
+
+	e := &encoder{buf: make([]byte, 0, batchHeaderSize+len(body.buf))}
+	e.int64(baseOffset)
+	e.int32(int32(batchHeaderSize - batchLengthOffset - 4 + len(body.buf)))
+	e.int32(-1) // partitionLeaderEpoch
+	e.int8(batchMagic)
+	e.int32(0) // crc, filled in below
+	e.int16(0) // attributes: uncompressed, CreateTime
+	e.int32(int32(msgs[n-1].Offset - baseOffset))
+	e.int64(firstTimestamp)
+	e.int64(maxTimestamp)
+	e.int64(-1) // producerId
+	e.int16(-1) // producerEpoch
+	e.int32(-1) // baseSequence
+	e.int32(int32(n))
+	e.buf = append(e.buf, body.buf...)
+
+	binary.BigEndian.PutUint32(e.buf[batchCRCOffset:], crc32.Checksum(e.buf[batchAttrsOffset:], castagnoli))
+	return e.buf, n
+}
+
+// recordTimestamp is the producer's timestamp when one was given, else the
+// time Flin appended the message
+func recordTimestamp(msg *storage.Message) int64 {
+	if msg.EventTime > 0 {
+		return msg.EventTime
+	}
+	return msg.Timestamp
+}
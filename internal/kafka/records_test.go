@@ -0,0 +1,178 @@
+package kafka
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/skshohagmiah/flin/internal/storage"
+)
+
+var testMessages = []*storage.Message{
+	{Offset: 10, Key: "a", Value: []byte("one"), Timestamp: 1000},
+	{Offset: 11, Key: "", Value: []byte("two"), Timestamp: 1001, EventTime: 900},
+	{Offset: 12, Key: "b", Value: nil, Timestamp: 1002, Headers: map[string]string{"h": "v"}},
+}
+
+// rewriteBatch replaces a batch's records section, attributes and producer
+// fields and recomputes its length and CRC
+func rewriteBatch(batch []byte, attrs int16, producerID int64, baseSequence int32, records []byte) []byte {
+	out := append([]byte{}, batch[:batchHeaderSize]...)
+	out = append(out, records...)
+	binary.BigEndian.PutUint32(out[batchLengthOffset:], uint32(len(out)-batchLengthOffset-4))
+	binary.BigEndian.PutUint16(out[batchAttrsOffset:], uint16(attrs))
+	binary.BigEndian.PutUint64(out[43:], uint64(producerID))
+	binary.BigEndian.PutUint32(out[53:], uint32(baseSequence))
+	binary.BigEndian.PutUint32(out[batchCRCOffset:], crc32.Checksum(out[batchAttrsOffset:], castagnoli))
+	return out
+}
+
+func checkRecords(t *testing.T, got []storage.Record) {
+	t.Helper()
+	if len(got) != len(testMessages) {
+		t.Fatalf("Expected %d records, got %d", len(testMessages), len(got))
+	}
+	for i, msg := range testMessages {
+		rec := got[i]
+		if rec.Key != msg.Key || string(rec.Value) != string(msg.Value) {
+			t.Errorf("Record %d: expected %q=%q, got %q=%q", i, msg.Key, msg.Value, rec.Key, rec.Value)
+		}
+		if rec.EventTime != recordTimestamp(msg) {
+			t.Errorf("Record %d: expected event time %d, got %d", i, recordTimestamp(msg), rec.EventTime)
+		}
+		if len(rec.Headers) != len(msg.Headers) || rec.Headers["h"] != msg.Headers["h"] {
+			t.Errorf("Record %d: expected headers %v, got %v", i, msg.Headers, rec.Headers)
+		}
+	}
+}
+
+// TestRecordBatchRoundTrip tests that batches written for Fetch decode
+// back to the same records, uncompressed and with each supported codec
+func TestRecordBatchRoundTrip(t *testing.T) {
+	batch, n := encodeBatch(testMessages, 1<<20, false)
+	if n != len(testMessages) {
+		t.Fatalf("Expected %d messages encoded, got %d", len(testMessages), n)
+	}
+	if got := int64(binary.BigEndian.Uint64(batch)); got != 10 {
+		t.Errorf("Expected base offset 10, got %d", got)
+	}
+	records := batch[batchHeaderSize:]
+
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(records)
+	w.Close()
+
+	// The Java client frames snappy the xerial way
+	block := snappy.Encode(nil, records)
+	xerial := append(append([]byte{}, xerialHeader...), 0, 0, 0, 1, 0, 0, 0, 1)
+	xerial = binary.BigEndian.AppendUint32(xerial, uint32(len(block)))
+	xerial = append(xerial, block...)
+
+	enc, _ := zstd.NewWriter(nil)
+	zstdRecords := enc.EncodeAll(records, nil)
+	enc.Close()
+
+	tests := []struct {
+		name    string
+		codec   int16
+		records []byte
+	}{
+		{"none", compressionNone, records},
+		{"gzip", compressionGzip, gz.Bytes()},
+		{"snappy", compressionSnappy, snappy.Encode(nil, records)},
+		{"snappy xerial", compressionSnappy, xerial},
+		{"zstd", compressionZstd, zstdRecords},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := rewriteBatch(batch, tt.codec, -1, -1, tt.records)
+			batches, err := decodeBatches(data)
+			if err != nil {
+				t.Fatalf("Failed to decode: %v", err)
+			}
+			if len(batches) != 1 {
+				t.Fatalf("Expected 1 batch, got %d", len(batches))
+			}
+			if batches[0].producerID != -1 {
+				t.Errorf("Expected no producer ID, got %d", batches[0].producerID)
+			}
+			checkRecords(t, batches[0].records)
+		})
+	}
+}
+
+// TestDecodeBatchesErrors tests the errors for batches that cannot be
+// decoded
+func TestDecodeBatchesErrors(t *testing.T) {
+	batch, _ := encodeBatch(testMessages, 1<<20, false)
+
+	badCRC := append([]byte{}, batch...)
+	badCRC[len(badCRC)-1] ^= 0xff
+
+	oldMagic := append([]byte{}, batch...)
+	oldMagic[16] = 1
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"truncated header", batch[:batchHeaderSize-1], errCorruptBatch},
+		{"truncated records", batch[:len(batch)-1], errCorruptBatch},
+		{"bad crc", badCRC, errCorruptBatch},
+		{"magic v1", oldMagic, errUnsupportedMagic},
+		{"lz4", rewriteBatch(batch, compressionLZ4, -1, -1, batch[batchHeaderSize:]), errUnsupportedCompression},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeBatches(tt.data); err != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+// TestDecodeBatchesSkipsControl tests that transaction markers are dropped
+// and producer fields are kept
+func TestDecodeBatchesSkipsControl(t *testing.T) {
+	batch, _ := encodeBatch(testMessages, 1<<20, false)
+	records := batch[batchHeaderSize:]
+
+	data := rewriteBatch(batch, attrControl, 7, 0, records)
+	data = append(data, rewriteBatch(batch, compressionNone, 7, 3, records)...)
+
+	batches, err := decodeBatches(data)
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if len(batches) != 1 {
+		t.Fatalf("Expected the control batch skipped, got %d batches", len(batches))
+	}
+	if batches[0].producerID != 7 || batches[0].baseSequence != 3 {
+		t.Errorf("Expected producer 7 sequence 3, got %d sequence %d", batches[0].producerID, batches[0].baseSequence)
+	}
+	checkRecords(t, batches[0].records)
+}
+
+// TestEncodeBatchLimit tests that batches stop before maxBytes unless
+// forced to hold one message
+func TestEncodeBatchLimit(t *testing.T) {
+	full, _ := encodeBatch(testMessages, 1<<20, false)
+
+	if _, n := encodeBatch(testMessages, len(full)-1, false); n != len(testMessages)-1 {
+		t.Errorf("Expected %d messages under the limit, got %d", len(testMessages)-1, n)
+	}
+	if _, n := encodeBatch(testMessages, 1, false); n != 0 {
+		t.Errorf("Expected no messages under a tiny limit, got %d", n)
+	}
+	if _, n := encodeBatch(testMessages, 1, true); n != 1 {
+		t.Errorf("Expected one forced message, got %d", n)
+	}
+}
@@ -0,0 +1,257 @@
+// Package kafka serves a subset of the Kafka wire protocol on top of Flin
+// streams, so standard Kafka producers and consumers can use Flin topics
+// without code changes. The server presents itself as a single broker that
+// leads every partition; topics, messages and committed offsets are the
+// ones stored by internal/stream.
+package kafka
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/skshohagmiah/flin/internal/stream"
+)
+
+const (
+	// maxRequestSize bounds a single request frame, matching Kafka's
+	// default socket.request.max.bytes
+	maxRequestSize = 100 * 1024 * 1024
+	// maxInFlight is how many requests a connection may have pending
+	// before the server stops reading from it
+	maxInFlight = 64
+
+	nodeID    = 0
+	clusterID = "flin"
+)
+
+// Options configures the Kafka listener
+type Options struct {
+	// Advertised is the host:port clients are told to connect to. Empty
+	// means the listen address, with "localhost" for a wildcard host.
+	Advertised string
+	// AutoCreateTopics creates unknown topics named in Metadata requests,
+	// as Kafka's auto.create.topics.enable does
+	AutoCreateTopics bool
+	// DefaultPartitions is the partition count for auto-created topics;
+	// zero uses the stream default
+	DefaultPartitions int
+}
+
+// Server accepts Kafka client connections
+type Server struct {
+	stream   *stream.Stream
+	listener net.Listener
+	opts     Options
+	host     string
+	port     int32
+	groups   *coordinator
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	conns  sync.Map // net.Conn -> struct{}
+	wg     sync.WaitGroup
+}
+
+// New listens on addr and returns a server backed by st
+func New(st *stream.Stream, addr string, opts Options) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	advertised := opts.Advertised
+	if advertised == "" {
+		advertised = listener.Addr().String()
+	}
+	host, portStr, err := net.SplitHostPort(advertised)
+	if err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("invalid advertised address %q: %w", advertised, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("invalid advertised port %q", portStr)
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		stream:   st,
+		listener: listener,
+		opts:     opts,
+		host:     host,
+		port:     int32(port),
+		groups:   newCoordinator(),
+		ctx:      ctx,
+		cancel:   cancel,
+	}, nil
+}
+
+// Addr returns the address the server listens on
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Start accepts connections until Stop is called
+func (s *Server) Start() error {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.ctx.Done():
+				return nil
+			default:
+				continue
+			}
+		}
+
+		s.wg.Add(1)
+		go s.handleConnection(conn)
+	}
+}
+
+// Stop closes the listener and every client connection
+func (s *Server) Stop() error {
+	s.cancel()
+	err := s.listener.Close()
+	s.conns.Range(func(key, _ any) bool {
+		key.(net.Conn).Close()
+		return true
+	})
+	s.wg.Wait()
+	s.groups.close()
+	return err
+}
+
+// request is a decoded request header with the undecoded body
+type request struct {
+	apiKey        int16
+	version       int16
+	correlationID int32
+	clientID      string
+	body          *decoder
+}
+
+// conn is one client connection. Requests are handled concurrently, since
+// Fetch and JoinGroup may block, but responses are written in request
+// order as the protocol requires.
+type conn struct {
+	server  *Server
+	netConn net.Conn
+	ctx     context.Context
+	// responses holds one slot per request in arrival order. A slot
+	// receives the response header and body, or nil when the request gets
+	// no response (Produce with acks=0).
+	responses chan chan []byte
+}
+
+func (s *Server) handleConnection(netConn net.Conn) {
+	defer s.wg.Done()
+
+	s.conns.Store(netConn, struct{}{})
+	defer s.conns.Delete(netConn)
+
+	if tcpConn, ok := netConn.(*net.TCPConn); ok {
+		tcpConn.SetNoDelay(true)
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	c := &conn{
+		server:    s,
+		netConn:   netConn,
+		ctx:       ctx,
+		responses: make(chan chan []byte, maxInFlight),
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.writeLoop()
+	}()
+
+	c.readLoop()
+	cancel()
+	close(c.responses)
+	<-done
+	netConn.Close()
+}
+
+func (c *conn) readLoop() {
+	reader := bufio.NewReaderSize(c.netConn, 64*1024)
+	header := make([]byte, 4)
+
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return
+		}
+		size := int(int32(binary.BigEndian.Uint32(header)))
+		if size < 8 || size > maxRequestSize {
+			log.Printf("[KAFKA] Closing %s: invalid request size %d", c.netConn.RemoteAddr(), size)
+			return
+		}
+		frame := make([]byte, size)
+		if _, err := io.ReadFull(reader, frame); err != nil {
+			return
+		}
+
+		d := &decoder{buf: frame}
+		req := &request{
+			apiKey:        d.int16(),
+			version:       d.int16(),
+			correlationID: d.int32(),
+			body:          d,
+		}
+		req.clientID, _ = d.nullableString()
+		if d.err != nil {
+			return
+		}
+
+		slot := make(chan []byte, 1)
+		select {
+		case c.responses <- slot:
+		case <-c.ctx.Done():
+			return
+		}
+		go func() {
+			slot <- c.handle(req)
+		}()
+	}
+}
+
+// writeLoop writes responses in request order. After a write error it
+// keeps draining slots so the read loop never blocks on a full queue.
+func (c *conn) writeLoop() {
+	writer := bufio.NewWriterSize(c.netConn, 64*1024)
+	failed := false
+
+	for slot := range c.responses {
+		body := <-slot
+		if body == nil || failed {
+			continue
+		}
+
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(body)))
+		_, err := writer.Write(size[:])
+		if err == nil {
+			_, err = writer.Write(body)
+		}
+		if err == nil {
+			err = writer.Flush()
+		}
+		if err != nil {
+			failed = true
+			c.netConn.Close()
+		}
+	}
+}
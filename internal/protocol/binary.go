@@ -3,6 +3,8 @@ package protocol
 import (
 	"encoding/binary"
 	"fmt"
+
+	"github.com/skshohagmiah/flin/internal/headercodec"
 )
 
 // Binary protocol format for maximum performance
@@ -41,6 +43,7 @@ import (
 //   0x01 = Error
 //   0x02 = NotFound
 //   0x03 = MultiValue (for batch responses)
+//   0x04 = Message (pushed to a Pub/Sub subscriber)
 
 const (
 	// Operation codes
@@ -55,11 +58,21 @@ const (
 	OpMDel   byte = 0x12
 
 	// Queue operation codes
-	OpQPush  byte = 0x20
-	OpQPop   byte = 0x21
-	OpQPeek  byte = 0x22
-	OpQLen   byte = 0x23
-	OpQClear byte = 0x24
+	OpQPush    byte = 0x20
+	OpQPop     byte = 0x21
+	OpQPeek    byte = 0x22
+	OpQLen     byte = 0x23
+	OpQClear   byte = 0x24
+	OpQCreate  byte = 0x25
+	OpQDelete  byte = 0x26
+	OpQList    byte = 0x27
+	OpQStats   byte = 0x28
+	OpQMPush   byte = 0x29
+	OpQMPop    byte = 0x2A
+	OpQPushID  byte = 0x2B
+	OpQPushMsg byte = 0x2C
+	OpQPopMsg  byte = 0x2D
+	OpQPeekMsg byte = 0x2E
 
 	// Stream operation codes
 	OpSPublish     byte = 0x30
@@ -69,6 +82,15 @@ const (
 	OpSSubscribe   byte = 0x34
 	OpSUnsubscribe byte = 0x35
 	OpSGetOffsets  byte = 0x36
+	OpSHeartbeat   byte = 0x37
+	OpSAssignment  byte = 0x38
+	OpSMPublish    byte = 0x39
+	OpSSeek        byte = 0x3A
+	OpSListTopics  byte = 0x3B
+	OpSDescribe    byte = 0x3C
+	OpSDeleteTopic byte = 0x3D
+	OpSAddParts    byte = 0x3E
+	OpSListGroups  byte = 0x3F
 
 	// Document operation codes
 	OpDocInsert byte = 0x40
@@ -77,11 +99,36 @@ const (
 	OpDocDelete byte = 0x43
 	OpDocIndex  byte = 0x44
 
+	// Stream operation codes, continued. 0x45-0x7F is left free since it
+	// overlaps the first letter of text protocol commands.
+	OpSGroupLag     byte = 0x80
+	OpSInitProducer byte = 0x81
+	OpSTxnCommit    byte = 0x82
+	OpSCopyStart    byte = 0x83
+	OpSCopyStop     byte = 0x84
+	OpSCopyDelete   byte = 0x85
+	OpSCopyList     byte = 0x86
+
+	// Pub/Sub operation codes
+	OpPublish        byte = 0x90
+	OpSubscribe      byte = 0x91
+	OpPSubscribe     byte = 0x92
+	OpUnsubscribe    byte = 0x93
+	OpPUnsubscribe   byte = 0x94
+	OpPubSubChannels byte = 0x95
+
+	// Seek modes for SSEEK
+	SeekOffset    byte = 0x00
+	SeekBeginning byte = 0x01
+	SeekEnd       byte = 0x02
+	SeekTimestamp byte = 0x03
+
 	// Status codes
 	StatusOK         byte = 0x00
 	StatusError      byte = 0x01
 	StatusNotFound   byte = 0x02
 	StatusMultiValue byte = 0x03
+	StatusMessage    byte = 0x04 // pushed to a subscriber, not a reply
 
 	// Protocol constants
 	MaxKeyLen    = 65535   // 2 bytes
@@ -89,6 +136,29 @@ const (
 	MaxBatchSize = 10000   // Maximum keys per batch
 )
 
+// RecordMeta is the producer-supplied event time and headers of a
+// published record
+type RecordMeta struct {
+	EventTime int64
+	Headers   map[string]string
+}
+
+// TxnRecord is a record published by an STXNCOMMIT request
+type TxnRecord struct {
+	Topic     string
+	Partition int
+	Key       string
+	Value     []byte
+	RecordMeta
+}
+
+// TxnOffset is a consumer offset committed by an STXNCOMMIT request
+type TxnOffset struct {
+	Topic     string
+	Partition int
+	Offset    int64
+}
+
 // Request represents a parsed binary request
 type Request struct {
 	OpCode byte
@@ -105,8 +175,32 @@ type Request struct {
 	Count       int
 	RetentionMs int64
 
+	SessionTimeoutMs int
+	Strategy         string
+	SeekMode         byte
+	Offset           int64
+	MaxWaitMs        int
+	MinBytes         int
+	RetentionBytes   int64
+	CleanupPolicy    string
+	Compression      string
+	Partitioner      string
+	ProducerID       uint64
+	Sequence         uint64
+	TxnRecords       []TxnRecord
+	TxnOffsets       []TxnOffset
+	RecordMetas      []RecordMeta
+	Filter           string
+	Target           string
+	TargetAddr       string
+	EndOffset        int64
+
 	// DocStore fields
 	Collection string
+
+	// Queue fields
+	DedupID string
+	Headers map[string]string
 }
 
 // Response represents a binary response
@@ -346,6 +440,90 @@ func EncodeQPushRequest(queueName string, value []byte) []byte {
 	return buf
 }
 
+// EncodeQPushIDRequest encodes a QPUSH request carrying a dedup ID
+func EncodeQPushIDRequest(queueName, dedupID string, value []byte) []byte {
+	nameLen := len(queueName)
+	idLen := len(dedupID)
+	valueLen := len(value)
+
+	// Format: [1:opcode][4:payloadLen][2:nameLen][name][2:idLen][id][4:valueLen][value]
+	totalSize := 1 + 4 + 2 + nameLen + 2 + idLen + 4 + valueLen
+	buf := make([]byte, totalSize)
+
+	pos := 0
+	buf[pos] = OpQPushID
+	pos++
+
+	payloadLen := totalSize - 5
+	binary.BigEndian.PutUint32(buf[pos:], uint32(payloadLen))
+	pos += 4
+
+	binary.BigEndian.PutUint16(buf[pos:], uint16(nameLen))
+	pos += 2
+	copy(buf[pos:], queueName)
+	pos += nameLen
+
+	binary.BigEndian.PutUint16(buf[pos:], uint16(idLen))
+	pos += 2
+	copy(buf[pos:], dedupID)
+	pos += idLen
+
+	binary.BigEndian.PutUint32(buf[pos:], uint32(valueLen))
+	pos += 4
+	copy(buf[pos:], value)
+
+	return buf
+}
+
+// EncodeQPushMsgRequest encodes a QPUSH request carrying headers and an optional dedup ID
+func EncodeQPushMsgRequest(queueName, dedupID string, headers map[string]string, value []byte) []byte {
+	nameLen := len(queueName)
+	idLen := len(dedupID)
+	headerData := headercodec.Encode(headers)
+	valueLen := len(value)
+
+	// Format: [1:opcode][4:payloadLen][2:nameLen][name][2:idLen][id][headers][4:valueLen][value]
+	totalSize := 1 + 4 + 2 + nameLen + 2 + idLen + len(headerData) + 4 + valueLen
+	buf := make([]byte, totalSize)
+
+	pos := 0
+	buf[pos] = OpQPushMsg
+	pos++
+
+	payloadLen := totalSize - 5
+	binary.BigEndian.PutUint32(buf[pos:], uint32(payloadLen))
+	pos += 4
+
+	binary.BigEndian.PutUint16(buf[pos:], uint16(nameLen))
+	pos += 2
+	copy(buf[pos:], queueName)
+	pos += nameLen
+
+	binary.BigEndian.PutUint16(buf[pos:], uint16(idLen))
+	pos += 2
+	copy(buf[pos:], dedupID)
+	pos += idLen
+
+	copy(buf[pos:], headerData)
+	pos += len(headerData)
+
+	binary.BigEndian.PutUint32(buf[pos:], uint32(valueLen))
+	pos += 4
+	copy(buf[pos:], value)
+
+	return buf
+}
+
+// EncodeQPopMsgRequest encodes a QPOP request that returns the message envelope
+func EncodeQPopMsgRequest(queueName string) []byte {
+	return encodeSimpleRequest(OpQPopMsg, queueName)
+}
+
+// EncodeQPeekMsgRequest encodes a QPEEK request that returns the message envelope
+func EncodeQPeekMsgRequest(queueName string) []byte {
+	return encodeSimpleRequest(OpQPeekMsg, queueName)
+}
+
 // EncodeQPopRequest encodes a QPOP request
 func EncodeQPopRequest(queueName string) []byte {
 	return encodeSimpleRequest(OpQPop, queueName)
@@ -366,6 +544,90 @@ func EncodeQClearRequest(queueName string) []byte {
 	return encodeSimpleRequest(OpQClear, queueName)
 }
 
+// EncodeQCreateRequest encodes a QCREATE request
+func EncodeQCreateRequest(queueName string) []byte {
+	return encodeSimpleRequest(OpQCreate, queueName)
+}
+
+// EncodeQDeleteRequest encodes a QDELETE request
+func EncodeQDeleteRequest(queueName string) []byte {
+	return encodeSimpleRequest(OpQDelete, queueName)
+}
+
+// EncodeQListRequest encodes a QLIST request
+func EncodeQListRequest() []byte {
+	return encodeSimpleRequest(OpQList, "")
+}
+
+// EncodeQStatsRequest encodes a QSTATS request
+func EncodeQStatsRequest(queueName string) []byte {
+	return encodeSimpleRequest(OpQStats, queueName)
+}
+
+// EncodeQMPushRequest encodes a batch QPUSH request
+func EncodeQMPushRequest(queueName string, values [][]byte) []byte {
+	nameLen := len(queueName)
+
+	// Format: [1:opcode][4:payloadLen][2:nameLen][name][2:count][for each: [4:valueLen][value]]
+	totalSize := 1 + 4 + 2 + nameLen + 2
+	for _, v := range values {
+		totalSize += 4 + len(v)
+	}
+
+	buf := make([]byte, totalSize)
+	pos := 0
+
+	buf[pos] = OpQMPush
+	pos++
+
+	payloadLen := totalSize - 5
+	binary.BigEndian.PutUint32(buf[pos:], uint32(payloadLen))
+	pos += 4
+
+	binary.BigEndian.PutUint16(buf[pos:], uint16(nameLen))
+	pos += 2
+	copy(buf[pos:], queueName)
+	pos += nameLen
+
+	binary.BigEndian.PutUint16(buf[pos:], uint16(len(values)))
+	pos += 2
+
+	for _, v := range values {
+		binary.BigEndian.PutUint32(buf[pos:], uint32(len(v)))
+		pos += 4
+		copy(buf[pos:], v)
+		pos += len(v)
+	}
+
+	return buf
+}
+
+// EncodeQMPopRequest encodes a batch QPOP request
+func EncodeQMPopRequest(queueName string, count int) []byte {
+	nameLen := len(queueName)
+
+	// Format: [1:opcode][4:payloadLen][2:nameLen][name][2:count]
+	totalSize := 1 + 4 + 2 + nameLen + 2
+	buf := make([]byte, totalSize)
+
+	pos := 0
+	buf[pos] = OpQMPop
+	pos++
+
+	payloadLen := totalSize - 5
+	binary.BigEndian.PutUint32(buf[pos:], uint32(payloadLen))
+	pos += 4
+
+	binary.BigEndian.PutUint16(buf[pos:], uint16(nameLen))
+	pos += 2
+	copy(buf[pos:], queueName)
+	pos += nameLen
+
+	binary.BigEndian.PutUint16(buf[pos:], uint16(count))
+
+	return buf
+}
+
 // DecodeRequest parses a binary request
 func DecodeRequest(data []byte) (*Request, error) {
 	if len(data) < 5 {
@@ -393,8 +655,16 @@ func DecodeRequest(data []byte) (*Request, error) {
 		return decodeMGetRequest(req.OpCode, payload)
 	case OpQPush:
 		return decodeQPushRequest(payload)
-	case OpQPop, OpQPeek, OpQLen, OpQClear:
+	case OpQPop, OpQPeek, OpQLen, OpQClear, OpQCreate, OpQDelete, OpQList, OpQStats, OpQPopMsg, OpQPeekMsg:
 		return decodeSimpleRequest(req.OpCode, payload)
+	case OpQPushID:
+		return decodeQPushIDRequest(payload)
+	case OpQPushMsg:
+		return decodeQPushMsgRequest(payload)
+	case OpQMPush:
+		return decodeQMPushRequest(payload)
+	case OpQMPop:
+		return decodeQMPopRequest(payload)
 	case OpSPublish:
 		return decodeSPublishRequest(payload)
 	case OpSConsume:
@@ -407,6 +677,39 @@ func DecodeRequest(data []byte) (*Request, error) {
 		return decodeSSubscribeRequest(payload)
 	case OpSUnsubscribe:
 		return decodeSUnsubscribeRequest(payload)
+	case OpSHeartbeat:
+		return decodeSHeartbeatRequest(payload)
+	case OpSMPublish:
+		return decodeSMPublishRequest(payload)
+	case OpSSeek:
+		return decodeSSeekRequest(payload)
+	case OpSListTopics, OpSDescribe, OpSDeleteTopic, OpSGetOffsets, OpSListGroups, OpSGroupLag, OpSInitProducer,
+		OpSCopyStop, OpSCopyDelete, OpSCopyList:
+		return decodeSimpleRequest(req.OpCode, payload)
+	case OpSAddParts:
+		return decodeSAddPartsRequest(payload)
+	case OpSTxnCommit:
+		return decodeSTxnCommitRequest(payload)
+	case OpSCopyStart:
+		return decodeSCopyStartRequest(payload)
+	case OpPublish:
+		req, err := decodeSetRequest(payload)
+		if err != nil {
+			return nil, err
+		}
+		req.OpCode = OpPublish
+		return req, nil
+	case OpSubscribe, OpPSubscribe, OpUnsubscribe, OpPUnsubscribe:
+		return decodeMGetRequest(req.OpCode, payload)
+	case OpPubSubChannels:
+		return decodeSimpleRequest(req.OpCode, payload)
+	case OpSAssignment:
+		req, err := decodeSHeartbeatRequest(payload)
+		if err != nil {
+			return nil, err
+		}
+		req.OpCode = OpSAssignment
+		return req, nil
 	case OpDocInsert:
 		return decodeDocInsertRequest(payload)
 	case OpDocFind:
@@ -573,125 +876,457 @@ func decodeQPushRequest(payload []byte) (*Request, error) {
 	return req, nil
 }
 
-// EncodeOKResponse encodes a success response
-func EncodeOKResponse() []byte {
-	buf := make([]byte, 5)
-	buf[0] = StatusOK
-	binary.BigEndian.PutUint32(buf[1:], 0) // No payload
-	return buf
-}
-
-// EncodeValueResponse encodes a single value response
-func EncodeValueResponse(value []byte) []byte {
-	totalSize := 5 + len(value)
-	buf := make([]byte, totalSize)
-
-	buf[0] = StatusOK
-	binary.BigEndian.PutUint32(buf[1:], uint32(len(value)))
-	copy(buf[5:], value)
-
-	return buf
-}
-
-// EncodeMultiValueResponse encodes a batch response
-func EncodeMultiValueResponse(values [][]byte) []byte {
-	// Calculate size: status + payload len + count + (len + value) for each
-	totalSize := 5 + 2
-	for _, v := range values {
-		totalSize += 4 + len(v)
+func decodeQPushIDRequest(payload []byte) (*Request, error) {
+	if len(payload) < 8 {
+		return nil, fmt.Errorf("invalid QPUSHID payload")
 	}
 
-	buf := make([]byte, totalSize)
+	req := &Request{OpCode: OpQPushID}
 	pos := 0
 
-	buf[pos] = StatusMultiValue
-	pos++
-
-	payloadLen := totalSize - 5
-	binary.BigEndian.PutUint32(buf[pos:], uint32(payloadLen))
-	pos += 4
+	// Queue name
+	nameLen := int(binary.BigEndian.Uint16(payload[pos:]))
+	pos += 2
+	if len(payload) < pos+nameLen+2 {
+		return nil, fmt.Errorf("invalid QPUSHID payload")
+	}
+	req.Key = string(payload[pos : pos+nameLen])
+	pos += nameLen
 
-	binary.BigEndian.PutUint16(buf[pos:], uint16(len(values)))
+	// Dedup ID
+	idLen := int(binary.BigEndian.Uint16(payload[pos:]))
 	pos += 2
+	if len(payload) < pos+idLen+4 {
+		return nil, fmt.Errorf("invalid QPUSHID payload")
+	}
+	req.DedupID = string(payload[pos : pos+idLen])
+	pos += idLen
 
-	for _, v := range values {
-		binary.BigEndian.PutUint32(buf[pos:], uint32(len(v)))
-		pos += 4
-		copy(buf[pos:], v)
-		pos += len(v)
+	// Value
+	valueLen := int(binary.BigEndian.Uint32(payload[pos:]))
+	pos += 4
+	if len(payload) < pos+valueLen {
+		return nil, fmt.Errorf("invalid QPUSHID payload")
 	}
+	req.Value = payload[pos : pos+valueLen]
 
-	return buf
+	return req, nil
 }
 
-// EncodeErrorResponse encodes an error response
-func EncodeErrorResponse(err error) []byte {
-	errMsg := err.Error()
-	totalSize := 5 + len(errMsg)
-	buf := make([]byte, totalSize)
-
-	buf[0] = StatusError
-	binary.BigEndian.PutUint32(buf[1:], uint32(len(errMsg)))
-	copy(buf[5:], errMsg)
+func decodeQPushMsgRequest(payload []byte) (*Request, error) {
+	if len(payload) < 10 {
+		return nil, fmt.Errorf("invalid QPUSHMSG payload")
+	}
 
-	return buf
-}
+	req := &Request{OpCode: OpQPushMsg}
+	pos := 0
 
-// DecodeResponse parses a binary response
-func DecodeResponse(data []byte) (*Response, error) {
-	if len(data) < 5 {
-		return nil, fmt.Errorf("response too short")
+	// Queue name
+	nameLen := int(binary.BigEndian.Uint16(payload[pos:]))
+	pos += 2
+	if len(payload) < pos+nameLen+2 {
+		return nil, fmt.Errorf("invalid QPUSHMSG payload")
 	}
+	req.Key = string(payload[pos : pos+nameLen])
+	pos += nameLen
 
-	resp := &Response{}
-	resp.Status = data[0]
-	payloadLen := binary.BigEndian.Uint32(data[1:5])
-
-	if len(data) < int(5+payloadLen) {
-		return nil, fmt.Errorf("incomplete response")
+	// Dedup ID
+	idLen := int(binary.BigEndian.Uint16(payload[pos:]))
+	pos += 2
+	if len(payload) < pos+idLen {
+		return nil, fmt.Errorf("invalid QPUSHMSG payload")
 	}
+	req.DedupID = string(payload[pos : pos+idLen])
+	pos += idLen
 
-	payload := data[5 : 5+payloadLen]
+	// Headers
+	headers, n, err := headercodec.Decode(payload[pos:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid QPUSHMSG payload")
+	}
+	req.Headers = headers
+	pos += n
 
-	switch resp.Status {
-	case StatusOK:
-		if len(payload) > 0 {
-			resp.Value = payload
-		}
-	case StatusError:
-		resp.Error = string(payload)
-	case StatusMultiValue:
-		return decodeMultiValueResponse(payload)
-	case StatusNotFound:
-		// No payload
-	default:
-		return nil, fmt.Errorf("unknown status: %d", resp.Status)
+	// Value
+	if len(payload) < pos+4 {
+		return nil, fmt.Errorf("invalid QPUSHMSG payload")
+	}
+	valueLen := int(binary.BigEndian.Uint32(payload[pos:]))
+	pos += 4
+	if len(payload) < pos+valueLen {
+		return nil, fmt.Errorf("invalid QPUSHMSG payload")
 	}
+	req.Value = payload[pos : pos+valueLen]
 
-	return resp, nil
+	return req, nil
 }
 
-func decodeMultiValueResponse(payload []byte) (*Response, error) {
-	if len(payload) < 2 {
-		return nil, fmt.Errorf("invalid multi-value response")
+func decodeQMPushRequest(payload []byte) (*Request, error) {
+	if len(payload) < 4 {
+		return nil, fmt.Errorf("invalid QMPUSH payload")
 	}
 
-	resp := &Response{Status: StatusMultiValue}
-	count := binary.BigEndian.Uint16(payload[0:2])
-	pos := 2
+	req := &Request{OpCode: OpQMPush}
+	pos := 0
 
-	resp.Values = make([][]byte, 0, count)
+	nameLen := int(binary.BigEndian.Uint16(payload[pos:]))
+	pos += 2
+	if len(payload) < pos+nameLen+2 {
+		return nil, fmt.Errorf("invalid QMPUSH payload")
+	}
+	req.Key = string(payload[pos : pos+nameLen])
+	pos += nameLen
 
-	for i := 0; i < int(count); i++ {
+	count := int(binary.BigEndian.Uint16(payload[pos:]))
+	pos += 2
+
+	req.Values = make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
 		if len(payload) < pos+4 {
-			return nil, fmt.Errorf("invalid multi-value response")
+			return nil, fmt.Errorf("invalid QMPUSH payload")
 		}
-
-		valueLen := binary.BigEndian.Uint32(payload[pos:])
+		valueLen := int(binary.BigEndian.Uint32(payload[pos:]))
 		pos += 4
 
-		if len(payload) < pos+int(valueLen) {
-			return nil, fmt.Errorf("invalid multi-value response")
+		if len(payload) < pos+valueLen {
+			return nil, fmt.Errorf("invalid QMPUSH payload")
+		}
+		req.Values = append(req.Values, payload[pos:pos+valueLen])
+		pos += valueLen
+	}
+
+	return req, nil
+}
+
+// decodePublishTail reads the optional fields after a publish payload:
+// [8:producerID][8:sequence] then, for each of count records,
+// [8:eventTime][headers]
+func decodePublishTail(req *Request, rest []byte, count int) error {
+	if len(rest) < 16 {
+		return nil
+	}
+	req.ProducerID = binary.BigEndian.Uint64(rest)
+	req.Sequence = binary.BigEndian.Uint64(rest[8:])
+
+	metas, _, err := decodeRecordMetas(rest[16:], count)
+	if err != nil {
+		return err
+	}
+	req.RecordMetas = metas
+	return nil
+}
+
+// decodeRecordMetas reads count [8:eventTime][headers] entries, or none if
+// data is empty, and returns the bytes consumed
+func decodeRecordMetas(data []byte, count int) ([]RecordMeta, int, error) {
+	if len(data) == 0 {
+		return nil, 0, nil
+	}
+
+	metas := make([]RecordMeta, count)
+	pos := 0
+	for i := range metas {
+		if len(data) < pos+8 {
+			return nil, 0, fmt.Errorf("invalid record metadata")
+		}
+		metas[i].EventTime = int64(binary.BigEndian.Uint64(data[pos:]))
+		pos += 8
+		headers, n, err := headercodec.Decode(data[pos:])
+		if err != nil {
+			return nil, 0, err
+		}
+		metas[i].Headers = headers
+		pos += n
+	}
+	return metas, pos, nil
+}
+
+// encodeRecordMetas encodes [8:eventTime][headers] for each record, or
+// nothing if no record has metadata
+func encodeRecordMetas(metas []RecordMeta) []byte {
+	var buf []byte
+	for _, m := range metas {
+		if m.EventTime != 0 || len(m.Headers) > 0 {
+			buf = make([]byte, 0, len(metas)*10)
+			break
+		}
+	}
+	if buf == nil {
+		return nil
+	}
+
+	for _, m := range metas {
+		var ts [8]byte
+		binary.BigEndian.PutUint64(ts[:], uint64(m.EventTime))
+		buf = append(buf, ts[:]...)
+		buf = append(buf, headercodec.Encode(m.Headers)...)
+	}
+	return buf
+}
+
+func decodeSCopyStartRequest(payload []byte) (*Request, error) {
+	errInvalid := fmt.Errorf("invalid SCOPYSTART payload")
+	req := &Request{OpCode: OpSCopyStart}
+	pos := 0
+
+	for _, field := range []*string{&req.Key, &req.Topic, &req.Target, &req.TargetAddr} {
+		if len(payload) < pos+2 {
+			return nil, errInvalid
+		}
+		n := int(binary.BigEndian.Uint16(payload[pos:]))
+		pos += 2
+		if len(payload) < pos+n {
+			return nil, errInvalid
+		}
+		*field = string(payload[pos : pos+n])
+		pos += n
+	}
+
+	if len(payload) < pos+16 {
+		return nil, errInvalid
+	}
+	req.Offset = int64(binary.BigEndian.Uint64(payload[pos:]))
+	req.EndOffset = int64(binary.BigEndian.Uint64(payload[pos+8:]))
+
+	return req, nil
+}
+
+func decodeSTxnCommitRequest(payload []byte) (*Request, error) {
+	errInvalid := fmt.Errorf("invalid STXNCOMMIT payload")
+	if len(payload) < 16 {
+		return nil, errInvalid
+	}
+
+	req := &Request{OpCode: OpSTxnCommit}
+	req.ProducerID = binary.BigEndian.Uint64(payload)
+	req.Sequence = binary.BigEndian.Uint64(payload[8:])
+	pos := 16
+
+	readString := func() (string, bool) {
+		if len(payload) < pos+2 {
+			return "", false
+		}
+		n := int(binary.BigEndian.Uint16(payload[pos:]))
+		pos += 2
+		if len(payload) < pos+n {
+			return "", false
+		}
+		str := string(payload[pos : pos+n])
+		pos += n
+		return str, true
+	}
+
+	var ok bool
+	if req.Group, ok = readString(); !ok {
+		return nil, errInvalid
+	}
+	if req.Consumer, ok = readString(); !ok {
+		return nil, errInvalid
+	}
+
+	// Records
+	if len(payload) < pos+4 {
+		return nil, errInvalid
+	}
+	count := int(binary.BigEndian.Uint32(payload[pos:]))
+	pos += 4
+	if count > MaxBatchSize {
+		return nil, fmt.Errorf("batch too large: %d", count)
+	}
+	req.TxnRecords = make([]TxnRecord, 0, count)
+	for i := 0; i < count; i++ {
+		var rec TxnRecord
+		if rec.Topic, ok = readString(); !ok || len(payload) < pos+4 {
+			return nil, errInvalid
+		}
+		rec.Partition = int(int32(binary.BigEndian.Uint32(payload[pos:])))
+		pos += 4
+		if rec.Key, ok = readString(); !ok || len(payload) < pos+4 {
+			return nil, errInvalid
+		}
+		valueLen := int(binary.BigEndian.Uint32(payload[pos:]))
+		pos += 4
+		if len(payload) < pos+valueLen {
+			return nil, errInvalid
+		}
+		rec.Value = payload[pos : pos+valueLen]
+		pos += valueLen
+		req.TxnRecords = append(req.TxnRecords, rec)
+	}
+
+	// Offsets
+	if len(payload) < pos+4 {
+		return nil, errInvalid
+	}
+	count = int(binary.BigEndian.Uint32(payload[pos:]))
+	pos += 4
+	if count > MaxBatchSize {
+		return nil, fmt.Errorf("batch too large: %d", count)
+	}
+	req.TxnOffsets = make([]TxnOffset, 0, count)
+	for i := 0; i < count; i++ {
+		var off TxnOffset
+		if off.Topic, ok = readString(); !ok || len(payload) < pos+12 {
+			return nil, errInvalid
+		}
+		off.Partition = int(binary.BigEndian.Uint32(payload[pos:]))
+		off.Offset = int64(binary.BigEndian.Uint64(payload[pos+4:]))
+		pos += 12
+		req.TxnOffsets = append(req.TxnOffsets, off)
+	}
+
+	// Optional event time and headers per record
+	metas, _, err := decodeRecordMetas(payload[pos:], len(req.TxnRecords))
+	if err != nil {
+		return nil, err
+	}
+	for i, m := range metas {
+		req.TxnRecords[i].RecordMeta = m
+	}
+
+	return req, nil
+}
+
+func decodeQMPopRequest(payload []byte) (*Request, error) {
+	if len(payload) < 4 {
+		return nil, fmt.Errorf("invalid QMPOP payload")
+	}
+
+	req := &Request{OpCode: OpQMPop}
+	pos := 0
+
+	nameLen := int(binary.BigEndian.Uint16(payload[pos:]))
+	pos += 2
+	if len(payload) < pos+nameLen+2 {
+		return nil, fmt.Errorf("invalid QMPOP payload")
+	}
+	req.Key = string(payload[pos : pos+nameLen])
+	pos += nameLen
+
+	req.Count = int(binary.BigEndian.Uint16(payload[pos:]))
+
+	return req, nil
+}
+
+// EncodeOKResponse encodes a success response
+func EncodeOKResponse() []byte {
+	buf := make([]byte, 5)
+	buf[0] = StatusOK
+	binary.BigEndian.PutUint32(buf[1:], 0) // No payload
+	return buf
+}
+
+// EncodeValueResponse encodes a single value response
+func EncodeValueResponse(value []byte) []byte {
+	totalSize := 5 + len(value)
+	buf := make([]byte, totalSize)
+
+	buf[0] = StatusOK
+	binary.BigEndian.PutUint32(buf[1:], uint32(len(value)))
+	copy(buf[5:], value)
+
+	return buf
+}
+
+// EncodeMultiValueResponse encodes a batch response
+func EncodeMultiValueResponse(values [][]byte) []byte {
+	// Calculate size: status + payload len + count + (len + value) for each
+	totalSize := 5 + 2
+	for _, v := range values {
+		totalSize += 4 + len(v)
+	}
+
+	buf := make([]byte, totalSize)
+	pos := 0
+
+	buf[pos] = StatusMultiValue
+	pos++
+
+	payloadLen := totalSize - 5
+	binary.BigEndian.PutUint32(buf[pos:], uint32(payloadLen))
+	pos += 4
+
+	binary.BigEndian.PutUint16(buf[pos:], uint16(len(values)))
+	pos += 2
+
+	for _, v := range values {
+		binary.BigEndian.PutUint32(buf[pos:], uint32(len(v)))
+		pos += 4
+		copy(buf[pos:], v)
+		pos += len(v)
+	}
+
+	return buf
+}
+
+// EncodeErrorResponse encodes an error response
+func EncodeErrorResponse(err error) []byte {
+	errMsg := err.Error()
+	totalSize := 5 + len(errMsg)
+	buf := make([]byte, totalSize)
+
+	buf[0] = StatusError
+	binary.BigEndian.PutUint32(buf[1:], uint32(len(errMsg)))
+	copy(buf[5:], errMsg)
+
+	return buf
+}
+
+// DecodeResponse parses a binary response
+func DecodeResponse(data []byte) (*Response, error) {
+	if len(data) < 5 {
+		return nil, fmt.Errorf("response too short")
+	}
+
+	resp := &Response{}
+	resp.Status = data[0]
+	payloadLen := binary.BigEndian.Uint32(data[1:5])
+
+	if len(data) < int(5+payloadLen) {
+		return nil, fmt.Errorf("incomplete response")
+	}
+
+	payload := data[5 : 5+payloadLen]
+
+	switch resp.Status {
+	case StatusOK:
+		if len(payload) > 0 {
+			resp.Value = payload
+		}
+	case StatusError:
+		resp.Error = string(payload)
+	case StatusMultiValue:
+		return decodeMultiValueResponse(payload)
+	case StatusNotFound:
+		// No payload
+	default:
+		return nil, fmt.Errorf("unknown status: %d", resp.Status)
+	}
+
+	return resp, nil
+}
+
+func decodeMultiValueResponse(payload []byte) (*Response, error) {
+	if len(payload) < 2 {
+		return nil, fmt.Errorf("invalid multi-value response")
+	}
+
+	resp := &Response{Status: StatusMultiValue}
+	count := binary.BigEndian.Uint16(payload[0:2])
+	pos := 2
+
+	resp.Values = make([][]byte, 0, count)
+
+	for i := 0; i < int(count); i++ {
+		if len(payload) < pos+4 {
+			return nil, fmt.Errorf("invalid multi-value response")
+		}
+
+		valueLen := binary.BigEndian.Uint32(payload[pos:])
+		pos += 4
+
+		if len(payload) < pos+int(valueLen) {
+			return nil, fmt.Errorf("invalid multi-value response")
 		}
 
 		value := payload[pos : pos+int(valueLen)]
@@ -957,77 +1592,413 @@ func EncodeDocFindRequest(collection string, query []byte) []byte {
 	buf[pos] = OpDocFind
 	pos++
 
-	payloadLen := totalSize - 5
-	binary.BigEndian.PutUint32(buf[pos:], uint32(payloadLen))
-	pos += 4
+	payloadLen := totalSize - 5
+	binary.BigEndian.PutUint32(buf[pos:], uint32(payloadLen))
+	pos += 4
+
+	binary.BigEndian.PutUint16(buf[pos:], uint16(collLen))
+	pos += 2
+	copy(buf[pos:], collection)
+	pos += collLen
+
+	binary.BigEndian.PutUint32(buf[pos:], uint32(queryLen))
+	pos += 4
+	copy(buf[pos:], query)
+
+	return buf
+}
+
+// EncodeDocUpdateRequest encodes a DOCUPDATE request
+func EncodeDocUpdateRequest(collection string, updateOpts []byte) []byte {
+	collLen := len(collection)
+	optsLen := len(updateOpts)
+
+	// Format: [1:opcode][4:payloadLen][2:collLen][collection][4:optsLen][opts]
+	totalSize := 1 + 4 + 2 + collLen + 4 + optsLen
+	buf := make([]byte, totalSize)
+
+	pos := 0
+	buf[pos] = OpDocUpdate
+	pos++
+
+	payloadLen := totalSize - 5
+	binary.BigEndian.PutUint32(buf[pos:], uint32(payloadLen))
+	pos += 4
+
+	binary.BigEndian.PutUint16(buf[pos:], uint16(collLen))
+	pos += 2
+	copy(buf[pos:], collection)
+	pos += collLen
+
+	binary.BigEndian.PutUint32(buf[pos:], uint32(optsLen))
+	pos += 4
+	copy(buf[pos:], updateOpts)
+
+	return buf
+}
+
+// EncodeDocDeleteRequest encodes a DOCDELETE request
+func EncodeDocDeleteRequest(collection string, deleteOpts []byte) []byte {
+	collLen := len(collection)
+	optsLen := len(deleteOpts)
+
+	// Format: [1:opcode][4:payloadLen][2:collLen][collection][4:optsLen][opts]
+	totalSize := 1 + 4 + 2 + collLen + 4 + optsLen
+	buf := make([]byte, totalSize)
+
+	pos := 0
+	buf[pos] = OpDocDelete
+	pos++
+
+	payloadLen := totalSize - 5
+	binary.BigEndian.PutUint32(buf[pos:], uint32(payloadLen))
+	pos += 4
+
+	binary.BigEndian.PutUint16(buf[pos:], uint16(collLen))
+	pos += 2
+	copy(buf[pos:], collection)
+	pos += collLen
+
+	binary.BigEndian.PutUint32(buf[pos:], uint32(optsLen))
+	pos += 4
+	copy(buf[pos:], deleteOpts)
+
+	return buf
+}
+
+// EncodeSSubscribeOptsRequest encodes a SSUBSCRIBE request carrying a
+// group session timeout, assignment strategy and consumer filter
+func EncodeSSubscribeOptsRequest(topic, group, consumer string, sessionTimeoutMs int, strategy, filter string) []byte {
+	// Format: SSUBSCRIBE payload followed by
+	// [4:sessionTimeoutMs][2:strategyLen][strategy][2:filterLen][filter]
+	extra := make([]byte, 4+2+len(strategy)+2+len(filter))
+	binary.BigEndian.PutUint32(extra, uint32(sessionTimeoutMs))
+	binary.BigEndian.PutUint16(extra[4:], uint16(len(strategy)))
+	copy(extra[6:], strategy)
+	pos := 6 + len(strategy)
+	binary.BigEndian.PutUint16(extra[pos:], uint16(len(filter)))
+	copy(extra[pos+2:], filter)
+	return extendFrame(EncodeSSubscribeRequest(topic, group, consumer), extra)
+}
+
+// EncodeSCreateTopicConfigRequest encodes a SCREATETOPIC request with size
+// retention, cleanup policy and compression
+func EncodeSCreateTopicConfigRequest(name string, partitions int, retentionMs, retentionBytes int64, cleanupPolicy, compression, partitioner string) []byte {
+	// Format: SCREATETOPIC payload followed by
+	// [8:retentionBytes][2:policyLen][policy][2:compressionLen][compression]
+	// [2:partitionerLen][partitioner]
+	extra := make([]byte, 8+2+len(cleanupPolicy)+2+len(compression)+2+len(partitioner))
+	binary.BigEndian.PutUint64(extra, uint64(retentionBytes))
+	binary.BigEndian.PutUint16(extra[8:], uint16(len(cleanupPolicy)))
+	copy(extra[10:], cleanupPolicy)
+	pos := 10 + len(cleanupPolicy)
+	binary.BigEndian.PutUint16(extra[pos:], uint16(len(compression)))
+	copy(extra[pos+2:], compression)
+	pos += 2 + len(compression)
+	binary.BigEndian.PutUint16(extra[pos:], uint16(len(partitioner)))
+	copy(extra[pos+2:], partitioner)
+	return extendFrame(EncodeSCreateTopicRequest(name, partitions, retentionMs), extra)
+}
+
+// EncodeSConsumeOptsRequest encodes a long-poll and/or filtered SCONSUME request
+func EncodeSConsumeOptsRequest(topic, group, consumer string, count, maxWaitMs, minBytes int, filter string) []byte {
+	// Format: SCONSUME payload followed by [4:maxWaitMs][4:minBytes][2:filterLen][filter]
+	extra := make([]byte, 8+2+len(filter))
+	binary.BigEndian.PutUint32(extra, uint32(maxWaitMs))
+	binary.BigEndian.PutUint32(extra[4:], uint32(minBytes))
+	binary.BigEndian.PutUint16(extra[8:], uint16(len(filter)))
+	copy(extra[10:], filter)
+	return extendFrame(EncodeSConsumeRequest(topic, group, consumer, count), extra)
+}
+
+// EncodeSCommitAsRequest encodes a SCOMMIT request on behalf of a group member
+func EncodeSCommitAsRequest(topic, group, consumer string, partition int, offset uint64) []byte {
+	// Format: SCOMMIT payload followed by [2:consumerLen][consumer]
+	extra := make([]byte, 2+len(consumer))
+	binary.BigEndian.PutUint16(extra, uint16(len(consumer)))
+	copy(extra[2:], consumer)
+	return extendFrame(EncodeSCommitRequest(topic, group, partition, offset), extra)
+}
+
+// EncodeSHeartbeatRequest encodes a SHEARTBEAT request
+func EncodeSHeartbeatRequest(topic, group, consumer string) []byte {
+	// Format: same payload as SSUBSCRIBE
+	buf := EncodeSSubscribeRequest(topic, group, consumer)
+	buf[0] = OpSHeartbeat
+	return buf
+}
+
+// EncodeSAssignmentRequest encodes a SASSIGNMENT request
+func EncodeSAssignmentRequest(topic, group, consumer string) []byte {
+	// Format: same payload as SSUBSCRIBE
+	buf := EncodeSSubscribeRequest(topic, group, consumer)
+	buf[0] = OpSAssignment
+	return buf
+}
+
+// EncodeSMPublishRequest encodes a batch SPUBLISH request. keys and values
+// are parallel slices; all records go to the same partition.
+func EncodeSMPublishRequest(topic string, partition int, keys []string, values [][]byte) []byte {
+	topicLen := len(topic)
+
+	// Format: [1:opcode][4:payloadLen][2:topicLen][topic][4:partition][2:count]
+	//         [for each: [2:keyLen][key][4:valueLen][value]]
+	totalSize := 1 + 4 + 2 + topicLen + 4 + 2
+	for i := range values {
+		totalSize += 2 + len(keys[i]) + 4 + len(values[i])
+	}
+
+	buf := make([]byte, totalSize)
+	pos := 0
+
+	buf[pos] = OpSMPublish
+	pos++
+
+	payloadLen := totalSize - 5
+	binary.BigEndian.PutUint32(buf[pos:], uint32(payloadLen))
+	pos += 4
+
+	binary.BigEndian.PutUint16(buf[pos:], uint16(topicLen))
+	pos += 2
+	copy(buf[pos:], topic)
+	pos += topicLen
+
+	binary.BigEndian.PutUint32(buf[pos:], uint32(partition))
+	pos += 4
+
+	binary.BigEndian.PutUint16(buf[pos:], uint16(len(values)))
+	pos += 2
+
+	for i, v := range values {
+		binary.BigEndian.PutUint16(buf[pos:], uint16(len(keys[i])))
+		pos += 2
+		copy(buf[pos:], keys[i])
+		pos += len(keys[i])
+
+		binary.BigEndian.PutUint32(buf[pos:], uint32(len(v)))
+		pos += 4
+		copy(buf[pos:], v)
+		pos += len(v)
+	}
+
+	return buf
+}
+
+// EncodeSSeekRequest encodes a SSEEK request. value is an offset for
+// SeekOffset or a Unix ms timestamp for SeekTimestamp; partition -1 means all.
+func EncodeSSeekRequest(topic, group string, partition int, mode byte, value int64) []byte {
+	topicLen := len(topic)
+	groupLen := len(group)
+
+	// Format: [1:opcode][4:payloadLen][2:topicLen][topic][2:groupLen][group][4:partition][1:mode][8:value]
+	totalSize := 1 + 4 + 2 + topicLen + 2 + groupLen + 4 + 1 + 8
+	buf := make([]byte, totalSize)
+
+	pos := 0
+	buf[pos] = OpSSeek
+	pos++
+
+	payloadLen := totalSize - 5
+	binary.BigEndian.PutUint32(buf[pos:], uint32(payloadLen))
+	pos += 4
+
+	binary.BigEndian.PutUint16(buf[pos:], uint16(topicLen))
+	pos += 2
+	copy(buf[pos:], topic)
+	pos += topicLen
+
+	binary.BigEndian.PutUint16(buf[pos:], uint16(groupLen))
+	pos += 2
+	copy(buf[pos:], group)
+	pos += groupLen
+
+	binary.BigEndian.PutUint32(buf[pos:], uint32(partition))
+	pos += 4
+
+	buf[pos] = mode
+	pos++
+
+	binary.BigEndian.PutUint64(buf[pos:], uint64(value))
+
+	return buf
+}
+
+// EncodeSListTopicsRequest encodes a SLISTTOPICS request
+func EncodeSListTopicsRequest() []byte {
+	return encodeSimpleRequest(OpSListTopics, "")
+}
+
+// EncodeSDescribeRequest encodes a SDESCRIBE request
+func EncodeSDescribeRequest(topic string) []byte {
+	return encodeSimpleRequest(OpSDescribe, topic)
+}
+
+// EncodeSDeleteTopicRequest encodes a SDELETETOPIC request
+func EncodeSDeleteTopicRequest(topic string) []byte {
+	return encodeSimpleRequest(OpSDeleteTopic, topic)
+}
+
+// EncodeSGetOffsetsRequest encodes a SGETOFFSETS request
+func EncodeSGetOffsetsRequest(topic string) []byte {
+	return encodeSimpleRequest(OpSGetOffsets, topic)
+}
 
-	binary.BigEndian.PutUint16(buf[pos:], uint16(collLen))
-	pos += 2
-	copy(buf[pos:], collection)
-	pos += collLen
+// EncodeSListGroupsRequest encodes a SLISTGROUPS request
+func EncodeSListGroupsRequest() []byte {
+	return encodeSimpleRequest(OpSListGroups, "")
+}
 
-	binary.BigEndian.PutUint32(buf[pos:], uint32(queryLen))
-	pos += 4
-	copy(buf[pos:], query)
+// EncodeSGroupLagRequest encodes a SGROUPLAG request
+func EncodeSGroupLagRequest(group string) []byte {
+	return encodeSimpleRequest(OpSGroupLag, group)
+}
 
-	return buf
+// EncodeSInitProducerRequest encodes a SINITPRODUCER request
+func EncodeSInitProducerRequest() []byte {
+	return encodeSimpleRequest(OpSInitProducer, "")
 }
 
-// EncodeDocUpdateRequest encodes a DOCUPDATE request
-func EncodeDocUpdateRequest(collection string, updateOpts []byte) []byte {
-	collLen := len(collection)
-	optsLen := len(updateOpts)
+// EncodeSCopyStartRequest encodes a SCOPYSTART request
+func EncodeSCopyStartRequest(name, source, target, targetAddr string, startOffset, endOffset int64) []byte {
+	// Format: [1:opcode][4:payloadLen][2:nameLen][name][2:sourceLen][source]
+	//         [2:targetLen][target][2:addrLen][addr][8:startOffset][8:endOffset]
+	strs := []string{name, source, target, targetAddr}
+	totalSize := 1 + 4 + 16
+	for _, str := range strs {
+		totalSize += 2 + len(str)
+	}
 
-	// Format: [1:opcode][4:payloadLen][2:collLen][collection][4:optsLen][opts]
-	totalSize := 1 + 4 + 2 + collLen + 4 + optsLen
 	buf := make([]byte, totalSize)
-
 	pos := 0
-	buf[pos] = OpDocUpdate
-	pos++
 
-	payloadLen := totalSize - 5
-	binary.BigEndian.PutUint32(buf[pos:], uint32(payloadLen))
+	buf[pos] = OpSCopyStart
+	pos++
+	binary.BigEndian.PutUint32(buf[pos:], uint32(totalSize-5))
 	pos += 4
 
-	binary.BigEndian.PutUint16(buf[pos:], uint16(collLen))
-	pos += 2
-	copy(buf[pos:], collection)
-	pos += collLen
-
-	binary.BigEndian.PutUint32(buf[pos:], uint32(optsLen))
-	pos += 4
-	copy(buf[pos:], updateOpts)
+	for _, str := range strs {
+		binary.BigEndian.PutUint16(buf[pos:], uint16(len(str)))
+		pos += 2
+		copy(buf[pos:], str)
+		pos += len(str)
+	}
+	binary.BigEndian.PutUint64(buf[pos:], uint64(startOffset))
+	pos += 8
+	binary.BigEndian.PutUint64(buf[pos:], uint64(endOffset))
 
 	return buf
 }
 
-// EncodeDocDeleteRequest encodes a DOCDELETE request
-func EncodeDocDeleteRequest(collection string, deleteOpts []byte) []byte {
-	collLen := len(collection)
-	optsLen := len(deleteOpts)
+// EncodeSCopyStopRequest encodes a SCOPYSTOP request
+func EncodeSCopyStopRequest(name string) []byte {
+	return encodeSimpleRequest(OpSCopyStop, name)
+}
 
-	// Format: [1:opcode][4:payloadLen][2:collLen][collection][4:optsLen][opts]
-	totalSize := 1 + 4 + 2 + collLen + 4 + optsLen
-	buf := make([]byte, totalSize)
+// EncodeSCopyDeleteRequest encodes a SCOPYDELETE request
+func EncodeSCopyDeleteRequest(name string) []byte {
+	return encodeSimpleRequest(OpSCopyDelete, name)
+}
+
+// EncodeSCopyListRequest encodes a SCOPYLIST request
+func EncodeSCopyListRequest() []byte {
+	return encodeSimpleRequest(OpSCopyList, "")
+}
+
+// EncodeSPublishMetaRequest appends producer fields and per-record event
+// time and headers to an encoded SPUBLISH or SMPUBLISH request. producerID
+// is 0 for a non-idempotent publish; metas is nil or has one entry per record.
+func EncodeSPublishMetaRequest(frame []byte, producerID, sequence uint64, metas []RecordMeta) []byte {
+	// Format: publish payload followed by [8:producerID][8:sequence]
+	//         [for each record: [8:eventTime][headers]]
+	extra := make([]byte, 16)
+	binary.BigEndian.PutUint64(extra, producerID)
+	binary.BigEndian.PutUint64(extra[8:], sequence)
+	extra = append(extra, encodeRecordMetas(metas)...)
+	return extendFrame(frame, extra)
+}
+
+// EncodeSTxnCommitRequest encodes a STXNCOMMIT request
+func EncodeSTxnCommitRequest(producerID, sequence uint64, group, consumer string, records []TxnRecord, offsets []TxnOffset) []byte {
+	// Format: [1:opcode][4:payloadLen][8:producerID][8:sequence][2:groupLen][group][2:consumerLen][consumer]
+	//         [4:recordCount][for each: [2:topicLen][topic][4:partition][2:keyLen][key][4:valueLen][value]]
+	//         [4:offsetCount][for each: [2:topicLen][topic][4:partition][8:offset]]
+	//         optionally [for each record: [8:eventTime][headers]]
+	metas := make([]RecordMeta, len(records))
+	for i, r := range records {
+		metas[i] = r.RecordMeta
+	}
+	metaData := encodeRecordMetas(metas)
+
+	totalSize := 1 + 4 + 8 + 8 + 2 + len(group) + 2 + len(consumer) + 4 + 4 + len(metaData)
+	for _, r := range records {
+		totalSize += 2 + len(r.Topic) + 4 + 2 + len(r.Key) + 4 + len(r.Value)
+	}
+	for _, o := range offsets {
+		totalSize += 2 + len(o.Topic) + 4 + 8
+	}
 
+	buf := make([]byte, totalSize)
 	pos := 0
-	buf[pos] = OpDocDelete
-	pos++
 
-	payloadLen := totalSize - 5
-	binary.BigEndian.PutUint32(buf[pos:], uint32(payloadLen))
+	buf[pos] = OpSTxnCommit
+	pos++
+	binary.BigEndian.PutUint32(buf[pos:], uint32(totalSize-5))
 	pos += 4
 
-	binary.BigEndian.PutUint16(buf[pos:], uint16(collLen))
-	pos += 2
-	copy(buf[pos:], collection)
-	pos += collLen
+	binary.BigEndian.PutUint64(buf[pos:], producerID)
+	pos += 8
+	binary.BigEndian.PutUint64(buf[pos:], sequence)
+	pos += 8
 
-	binary.BigEndian.PutUint32(buf[pos:], uint32(optsLen))
+	putString := func(str string) {
+		binary.BigEndian.PutUint16(buf[pos:], uint16(len(str)))
+		pos += 2
+		copy(buf[pos:], str)
+		pos += len(str)
+	}
+	putString(group)
+	putString(consumer)
+
+	binary.BigEndian.PutUint32(buf[pos:], uint32(len(records)))
 	pos += 4
-	copy(buf[pos:], deleteOpts)
+	for _, r := range records {
+		putString(r.Topic)
+		binary.BigEndian.PutUint32(buf[pos:], uint32(r.Partition))
+		pos += 4
+		putString(r.Key)
+		binary.BigEndian.PutUint32(buf[pos:], uint32(len(r.Value)))
+		pos += 4
+		copy(buf[pos:], r.Value)
+		pos += len(r.Value)
+	}
+
+	binary.BigEndian.PutUint32(buf[pos:], uint32(len(offsets)))
+	pos += 4
+	for _, o := range offsets {
+		putString(o.Topic)
+		binary.BigEndian.PutUint32(buf[pos:], uint32(o.Partition))
+		pos += 4
+		binary.BigEndian.PutUint64(buf[pos:], uint64(o.Offset))
+		pos += 8
+	}
+
+	copy(buf[pos:], metaData)
+
+	return buf
+}
+
+// EncodeSAddPartsRequest encodes a SADDPARTS request
+func EncodeSAddPartsRequest(topic string, count int) []byte {
+	// Format: [1:opcode][4:payloadLen][2:topicLen][topic][4:count]
+	extra := make([]byte, 4)
+	binary.BigEndian.PutUint32(extra, uint32(count))
+	return extendFrame(encodeSimpleRequest(OpSAddParts, topic), extra)
+}
 
+// extendFrame appends optional trailing fields to an encoded frame
+func extendFrame(frame, extra []byte) []byte {
+	buf := append(frame, extra...)
+	binary.BigEndian.PutUint32(buf[1:], uint32(len(buf)-5))
 	return buf
 }
 
@@ -1079,6 +2050,121 @@ func decodeSPublishRequest(payload []byte) (*Request, error) {
 		return nil, fmt.Errorf("invalid SPUBLISH payload")
 	}
 	req.Value = payload[pos : pos+valueLen]
+	pos += valueLen
+
+	if err := decodePublishTail(req, payload[pos:], 1); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func decodeSMPublishRequest(payload []byte) (*Request, error) {
+	if len(payload) < 2 {
+		return nil, fmt.Errorf("invalid SMPUBLISH payload")
+	}
+
+	req := &Request{OpCode: OpSMPublish}
+	pos := 0
+
+	// Topic
+	topicLen := int(binary.BigEndian.Uint16(payload[pos:]))
+	pos += 2
+	if len(payload) < pos+topicLen+4+2 {
+		return nil, fmt.Errorf("invalid SMPUBLISH payload")
+	}
+	req.Topic = string(payload[pos : pos+topicLen])
+	pos += topicLen
+
+	// Partition
+	req.Partition = int(int32(binary.BigEndian.Uint32(payload[pos:])))
+	pos += 4
+
+	count := int(binary.BigEndian.Uint16(payload[pos:]))
+	pos += 2
+	if count > MaxBatchSize {
+		return nil, fmt.Errorf("batch too large: %d", count)
+	}
+
+	req.Keys = make([]string, 0, count)
+	req.Values = make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		if len(payload) < pos+2 {
+			return nil, fmt.Errorf("invalid SMPUBLISH payload")
+		}
+		keyLen := int(binary.BigEndian.Uint16(payload[pos:]))
+		pos += 2
+		if len(payload) < pos+keyLen+4 {
+			return nil, fmt.Errorf("invalid SMPUBLISH payload")
+		}
+		req.Keys = append(req.Keys, string(payload[pos:pos+keyLen]))
+		pos += keyLen
+
+		valueLen := int(binary.BigEndian.Uint32(payload[pos:]))
+		pos += 4
+		if len(payload) < pos+valueLen {
+			return nil, fmt.Errorf("invalid SMPUBLISH payload")
+		}
+		req.Values = append(req.Values, payload[pos:pos+valueLen])
+		pos += valueLen
+	}
+
+	if err := decodePublishTail(req, payload[pos:], count); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func decodeSSeekRequest(payload []byte) (*Request, error) {
+	if len(payload) < 2 {
+		return nil, fmt.Errorf("invalid SSEEK payload")
+	}
+
+	req := &Request{OpCode: OpSSeek}
+	pos := 0
+
+	// Topic
+	topicLen := int(binary.BigEndian.Uint16(payload[pos:]))
+	pos += 2
+	if len(payload) < pos+topicLen+2 {
+		return nil, fmt.Errorf("invalid SSEEK payload")
+	}
+	req.Topic = string(payload[pos : pos+topicLen])
+	pos += topicLen
+
+	// Group
+	groupLen := int(binary.BigEndian.Uint16(payload[pos:]))
+	pos += 2
+	if len(payload) < pos+groupLen+4+1+8 {
+		return nil, fmt.Errorf("invalid SSEEK payload")
+	}
+	req.Group = string(payload[pos : pos+groupLen])
+	pos += groupLen
+
+	req.Partition = int(int32(binary.BigEndian.Uint32(payload[pos:])))
+	pos += 4
+
+	req.SeekMode = payload[pos]
+	pos++
+
+	req.Offset = int64(binary.BigEndian.Uint64(payload[pos:]))
+
+	return req, nil
+}
+
+func decodeSAddPartsRequest(payload []byte) (*Request, error) {
+	if len(payload) < 2 {
+		return nil, fmt.Errorf("invalid SADDPARTS payload")
+	}
+
+	req := &Request{OpCode: OpSAddParts}
+	topicLen := int(binary.BigEndian.Uint16(payload))
+	if len(payload) < 2+topicLen+4 {
+		return nil, fmt.Errorf("invalid SADDPARTS payload")
+	}
+	req.Key = string(payload[2 : 2+topicLen])
+	req.Count = int(binary.BigEndian.Uint32(payload[2+topicLen:]))
 
 	return req, nil
 }
@@ -1129,6 +2215,22 @@ func decodeSConsumeRequest(payload []byte) (*Request, error) {
 		return nil, fmt.Errorf("invalid SCONSUME payload")
 	}
 	req.Count = int(binary.BigEndian.Uint32(payload[pos:]))
+	pos += 4
+
+	// Optional long-poll parameters and filter
+	if len(payload) >= pos+8 {
+		req.MaxWaitMs = int(binary.BigEndian.Uint32(payload[pos:]))
+		req.MinBytes = int(binary.BigEndian.Uint32(payload[pos+4:]))
+		pos += 8
+	}
+	if len(payload) >= pos+2 {
+		filterLen := int(binary.BigEndian.Uint16(payload[pos:]))
+		pos += 2
+		if len(payload) < pos+filterLen {
+			return nil, fmt.Errorf("invalid SCONSUME payload")
+		}
+		req.Filter = string(payload[pos : pos+filterLen])
+	}
 
 	return req, nil
 }
@@ -1174,6 +2276,17 @@ func decodeSCommitRequest(payload []byte) (*Request, error) {
 		return nil, fmt.Errorf("invalid SCOMMIT payload")
 	}
 	req.RetentionMs = int64(binary.BigEndian.Uint64(payload[pos:])) // Reusing RetentionMs for Offset
+	pos += 8
+
+	// Optional consumer
+	if len(payload) >= pos+2 {
+		consumerLen := int(binary.BigEndian.Uint16(payload[pos:]))
+		pos += 2
+		if len(payload) < pos+consumerLen {
+			return nil, fmt.Errorf("invalid SCOMMIT payload")
+		}
+		req.Consumer = string(payload[pos : pos+consumerLen])
+	}
 
 	return req, nil
 }
@@ -1207,6 +2320,37 @@ func decodeSCreateTopicRequest(payload []byte) (*Request, error) {
 		return nil, fmt.Errorf("invalid SCREATETOPIC payload")
 	}
 	req.RetentionMs = int64(binary.BigEndian.Uint64(payload[pos:]))
+	pos += 8
+
+	// Optional size retention, cleanup policy and compression
+	if len(payload) >= pos+10 {
+		req.RetentionBytes = int64(binary.BigEndian.Uint64(payload[pos:]))
+		pos += 8
+		policyLen := int(binary.BigEndian.Uint16(payload[pos:]))
+		pos += 2
+		if len(payload) < pos+policyLen {
+			return nil, fmt.Errorf("invalid SCREATETOPIC payload")
+		}
+		req.CleanupPolicy = string(payload[pos : pos+policyLen])
+		pos += policyLen
+	}
+	if len(payload) >= pos+2 {
+		compressionLen := int(binary.BigEndian.Uint16(payload[pos:]))
+		pos += 2
+		if len(payload) < pos+compressionLen {
+			return nil, fmt.Errorf("invalid SCREATETOPIC payload")
+		}
+		req.Compression = string(payload[pos : pos+compressionLen])
+		pos += compressionLen
+	}
+	if len(payload) >= pos+2 {
+		partitionerLen := int(binary.BigEndian.Uint16(payload[pos:]))
+		pos += 2
+		if len(payload) < pos+partitionerLen {
+			return nil, fmt.Errorf("invalid SCREATETOPIC payload")
+		}
+		req.Partitioner = string(payload[pos : pos+partitionerLen])
+	}
 
 	return req, nil
 }
@@ -1250,6 +2394,30 @@ func decodeSSubscribeRequest(payload []byte) (*Request, error) {
 		return nil, fmt.Errorf("invalid SSUBSCRIBE payload")
 	}
 	req.Consumer = string(payload[pos : pos+consumerLen])
+	pos += consumerLen
+
+	// Optional session timeout, strategy and filter
+	if len(payload) >= pos+4 {
+		req.SessionTimeoutMs = int(binary.BigEndian.Uint32(payload[pos:]))
+		pos += 4
+	}
+	if len(payload) >= pos+2 {
+		strategyLen := int(binary.BigEndian.Uint16(payload[pos:]))
+		pos += 2
+		if len(payload) < pos+strategyLen {
+			return nil, fmt.Errorf("invalid SSUBSCRIBE payload")
+		}
+		req.Strategy = string(payload[pos : pos+strategyLen])
+		pos += strategyLen
+	}
+	if len(payload) >= pos+2 {
+		filterLen := int(binary.BigEndian.Uint16(payload[pos:]))
+		pos += 2
+		if len(payload) < pos+filterLen {
+			return nil, fmt.Errorf("invalid SSUBSCRIBE payload")
+		}
+		req.Filter = string(payload[pos : pos+filterLen])
+	}
 
 	return req, nil
 }
@@ -1297,6 +2465,49 @@ func decodeSUnsubscribeRequest(payload []byte) (*Request, error) {
 	return req, nil
 }
 
+func decodeSHeartbeatRequest(payload []byte) (*Request, error) {
+	if len(payload) < 2 {
+		return nil, fmt.Errorf("invalid SHEARTBEAT payload")
+	}
+
+	req := &Request{OpCode: OpSHeartbeat}
+	pos := 0
+
+	// Topic
+	topicLen := int(binary.BigEndian.Uint16(payload[pos:]))
+	pos += 2
+	if len(payload) < pos+topicLen {
+		return nil, fmt.Errorf("invalid SHEARTBEAT payload")
+	}
+	req.Topic = string(payload[pos : pos+topicLen])
+	pos += topicLen
+
+	// Group
+	if len(payload) < pos+2 {
+		return nil, fmt.Errorf("invalid SHEARTBEAT payload")
+	}
+	groupLen := int(binary.BigEndian.Uint16(payload[pos:]))
+	pos += 2
+	if len(payload) < pos+groupLen {
+		return nil, fmt.Errorf("invalid SHEARTBEAT payload")
+	}
+	req.Group = string(payload[pos : pos+groupLen])
+	pos += groupLen
+
+	// Consumer
+	if len(payload) < pos+2 {
+		return nil, fmt.Errorf("invalid SHEARTBEAT payload")
+	}
+	consumerLen := int(binary.BigEndian.Uint16(payload[pos:]))
+	pos += 2
+	if len(payload) < pos+consumerLen {
+		return nil, fmt.Errorf("invalid SHEARTBEAT payload")
+	}
+	req.Consumer = string(payload[pos : pos+consumerLen])
+
+	return req, nil
+}
+
 // Document store decode functions
 
 func decodeDocInsertRequest(payload []byte) (*Request, error) {
@@ -1422,3 +2633,87 @@ func decodeDocDeleteRequest(payload []byte) (*Request, error) {
 
 	return req, nil
 }
+
+// EncodePublishRequest encodes a PUBLISH request
+func EncodePublishRequest(channel string, data []byte) []byte {
+	// Format: same as SET, [2:channelLen][channel][4:dataLen][data]
+	buf := EncodeSetRequest(channel, data)
+	buf[0] = OpPublish
+	return buf
+}
+
+// EncodeSubscribeRequest encodes a SUBSCRIBE request
+func EncodeSubscribeRequest(channels []string) []byte {
+	return encodeNamesRequest(OpSubscribe, channels)
+}
+
+// EncodePSubscribeRequest encodes a PSUBSCRIBE request
+func EncodePSubscribeRequest(patterns []string) []byte {
+	return encodeNamesRequest(OpPSubscribe, patterns)
+}
+
+// EncodeUnsubscribeRequest encodes an UNSUBSCRIBE request; no channels
+// unsubscribes from all of them
+func EncodeUnsubscribeRequest(channels []string) []byte {
+	return encodeNamesRequest(OpUnsubscribe, channels)
+}
+
+// EncodePUnsubscribeRequest encodes a PUNSUBSCRIBE request; no patterns
+// unsubscribes from all of them
+func EncodePUnsubscribeRequest(patterns []string) []byte {
+	return encodeNamesRequest(OpPUnsubscribe, patterns)
+}
+
+// EncodePubSubChannelsRequest encodes a PUBSUBCHANNELS request; an empty
+// pattern lists every channel
+func EncodePubSubChannelsRequest(pattern string) []byte {
+	return encodeSimpleRequest(OpPubSubChannels, pattern)
+}
+
+// encodeNamesRequest encodes names in the MGET layout
+func encodeNamesRequest(opCode byte, names []string) []byte {
+	buf := EncodeMGetRequest(names)
+	buf[0] = opCode
+	return buf
+}
+
+// EncodeMessageFrame encodes a message pushed to a subscriber
+func EncodeMessageFrame(channel, pattern string, data []byte) []byte {
+	// Format: [1:StatusMessage][4:payloadLen][2:channelLen][channel]
+	//         [2:patternLen][pattern][data]
+	totalSize := 5 + 2 + len(channel) + 2 + len(pattern) + len(data)
+	buf := make([]byte, totalSize)
+
+	buf[0] = StatusMessage
+	binary.BigEndian.PutUint32(buf[1:], uint32(totalSize-5))
+	pos := 5
+
+	binary.BigEndian.PutUint16(buf[pos:], uint16(len(channel)))
+	pos += 2
+	pos += copy(buf[pos:], channel)
+
+	binary.BigEndian.PutUint16(buf[pos:], uint16(len(pattern)))
+	pos += 2
+	pos += copy(buf[pos:], pattern)
+
+	copy(buf[pos:], data)
+	return buf
+}
+
+// DecodeMessageFrame parses the payload of a StatusMessage frame
+func DecodeMessageFrame(payload []byte) (channel, pattern string, data []byte, err error) {
+	pos := 0
+	for _, field := range []*string{&channel, &pattern} {
+		if len(payload) < pos+2 {
+			return "", "", nil, fmt.Errorf("invalid message frame")
+		}
+		n := int(binary.BigEndian.Uint16(payload[pos:]))
+		pos += 2
+		if len(payload) < pos+n {
+			return "", "", nil, fmt.Errorf("invalid message frame")
+		}
+		*field = string(payload[pos : pos+n])
+		pos += n
+	}
+	return channel, pattern, payload[pos:], nil
+}
@@ -0,0 +1,101 @@
+package pubsub
+
+// Match reports whether channel matches the glob pattern. "*" matches any
+// run of characters, "?" any single character, "[abc]" one of the listed
+// characters ("[a-z]" a range, "[^a]" a negation) and "\x" the literal x.
+// Unlike path.Match, "*" also crosses "/" and ".", so "orders.*" covers
+// "orders.eu.created".
+func Match(pattern, channel string) bool {
+	p, c := 0, 0
+	// Position to resume from when a later part fails after a "*"
+	starP, starC := -1, 0
+
+	for c < len(channel) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				starP, starC = p, c
+				p++
+				continue
+			case '?':
+				p++
+				c++
+				continue
+			case '[':
+				if n, ok := matchClass(pattern[p:], channel[c]); n > 0 {
+					if ok {
+						p += n
+						c++
+						continue
+					}
+					break
+				}
+				// An unterminated class matches "[" literally
+				if channel[c] == '[' {
+					p++
+					c++
+					continue
+				}
+			case '\\':
+				if p+1 < len(pattern) && pattern[p+1] == channel[c] {
+					p += 2
+					c++
+					continue
+				}
+			default:
+				if pattern[p] == channel[c] {
+					p++
+					c++
+					continue
+				}
+			}
+		}
+
+		if starP < 0 {
+			return false
+		}
+		// Let the last "*" absorb one more character and retry
+		starC++
+		p, c = starP+1, starC
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchClass matches b against the character class at the start of class.
+// It returns the length of the class, or 0 if it is unterminated.
+func matchClass(class string, b byte) (int, bool) {
+	i := 1
+	negate := false
+	if i < len(class) && class[i] == '^' {
+		negate = true
+		i++
+	}
+
+	matched := false
+	first := true
+	for i < len(class) && (class[i] != ']' || first) {
+		first = false
+		lo := class[i]
+		if lo == '\\' && i+1 < len(class) {
+			i++
+			lo = class[i]
+		}
+		hi := lo
+		if i+2 < len(class) && class[i+1] == '-' && class[i+2] != ']' {
+			hi = class[i+2]
+			i += 2
+		}
+		if lo <= b && b <= hi {
+			matched = true
+		}
+		i++
+	}
+	if i >= len(class) {
+		return 0, false
+	}
+	return i + 1, matched != negate
+}
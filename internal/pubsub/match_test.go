@@ -0,0 +1,57 @@
+package pubsub
+
+import (
+	"testing"
+)
+
+// TestMatch tests glob patterns against channel names
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		channel string
+		want    bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"*", "", true},
+		{"news", "news", true},
+		{"news", "new", false},
+		{"orders.*", "orders.eu.created", true},
+		{"orders.*", "orders", false},
+		{"*.created", "orders.eu.created", true},
+		{"a*", "a/b/c", true},
+		{"a*b*c", "axxbyyc", true},
+		{"a*b*c", "axxbyy", false},
+		{"a*b", "a", false},
+		{"*a*a", "aaaba", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"[a-c]x", "bx", true},
+		{"[a-c]x", "dx", false},
+		{"[^a]x", "bx", true},
+		{"[^a]x", "ax", false},
+		{"[^a-c]*", "d.anything", true},
+		{"[]]", "]", true},
+		{`[\]]`, "]", true},
+		{"[a-]", "-", true},
+		{"a[b", "a[b", true},
+		{"a[b", "ab", false},
+		{"a[", "a[", true},
+		{`a\*`, "a*", true},
+		{`a\*`, "ab", false},
+		{`\?`, "?", true},
+		{`\?`, "x", false},
+		{`\[a]`, "[a]", true},
+		{`*\*`, "stars*", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.channel, func(t *testing.T) {
+			if got := Match(tt.pattern, tt.channel); got != tt.want {
+				t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.channel, got, tt.want)
+			}
+		})
+	}
+}
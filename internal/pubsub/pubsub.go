@@ -0,0 +1,370 @@
+package pubsub
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBufferLimit is how many undelivered messages a subscriber may have
+// queued before it is dropped
+const DefaultBufferLimit = 1000
+
+// Message is a published message as delivered to one subscriber. Pattern
+// is the pattern that matched, empty for a direct channel subscription.
+type Message struct {
+	Channel string
+	Pattern string
+	Data    []byte
+}
+
+// Subscriber is a connection receiving published messages
+type Subscriber interface {
+	// Deliver queues msg without blocking and reports whether it fit
+	Deliver(msg *Message) bool
+	// Pending returns how many queued messages are not yet written
+	Pending() int
+	// Drop disconnects a subscriber that fell behind
+	Drop()
+}
+
+// ChannelInfo describes a channel with at least one direct subscriber
+type ChannelInfo struct {
+	Channel     string
+	Subscribers int
+	Published   uint64
+	Delivered   uint64
+}
+
+// Stats is a snapshot of the hub's counters
+type Stats struct {
+	Channels    int
+	Patterns    int
+	Subscribers int
+	Published   uint64
+	Delivered   uint64
+	Dropped     uint64
+}
+
+type subscriptions struct {
+	channels map[string]struct{}
+	patterns map[string]struct{}
+}
+
+func (s *subscriptions) count() int {
+	return len(s.channels) + len(s.patterns)
+}
+
+type channelStats struct {
+	published atomic.Uint64
+	delivered atomic.Uint64
+}
+
+// Hub fans published messages out to the current subscribers of a channel.
+// Nothing is persisted: a message published while nobody is subscribed is
+// discarded, and a subscriber whose buffer exceeds the limit is dropped
+// rather than allowed to slow down publishers.
+type Hub struct {
+	mu       sync.RWMutex
+	channels map[string]map[Subscriber]struct{}
+	patterns map[string]map[Subscriber]struct{}
+	subs     map[Subscriber]*subscriptions
+	stats    map[string]*channelStats
+
+	bufferLimit atomic.Int64
+	published   atomic.Uint64
+	delivered   atomic.Uint64
+	dropped     atomic.Uint64
+}
+
+// New creates an empty hub with DefaultBufferLimit
+func New() *Hub {
+	h := &Hub{
+		channels: make(map[string]map[Subscriber]struct{}),
+		patterns: make(map[string]map[Subscriber]struct{}),
+		subs:     make(map[Subscriber]*subscriptions),
+		stats:    make(map[string]*channelStats),
+	}
+	h.bufferLimit.Store(DefaultBufferLimit)
+	return h
+}
+
+// SetBufferLimit sets how many undelivered messages a subscriber may have
+// queued before it is dropped. Values below 1 restore the default.
+func (h *Hub) SetBufferLimit(n int) {
+	if n < 1 {
+		n = DefaultBufferLimit
+	}
+	h.bufferLimit.Store(int64(n))
+}
+
+// Subscribe adds sub to channels and returns its subscription count
+func (h *Hub) Subscribe(sub Subscriber, channels ...string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.subscriptionsLocked(sub)
+	for _, ch := range channels {
+		if _, ok := s.channels[ch]; ok {
+			continue
+		}
+		s.channels[ch] = struct{}{}
+		if h.channels[ch] == nil {
+			h.channels[ch] = make(map[Subscriber]struct{})
+			h.stats[ch] = &channelStats{}
+		}
+		h.channels[ch][sub] = struct{}{}
+	}
+	return s.count()
+}
+
+// PSubscribe adds sub to every channel matching patterns and returns its
+// subscription count. Patterns use glob syntax, see Match.
+func (h *Hub) PSubscribe(sub Subscriber, patterns ...string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.subscriptionsLocked(sub)
+	for _, p := range patterns {
+		if _, ok := s.patterns[p]; ok {
+			continue
+		}
+		s.patterns[p] = struct{}{}
+		if h.patterns[p] == nil {
+			h.patterns[p] = make(map[Subscriber]struct{})
+		}
+		h.patterns[p][sub] = struct{}{}
+	}
+	return s.count()
+}
+
+// Unsubscribe removes sub from channels, or from all its channels when none
+// are given, and returns its remaining subscription count
+func (h *Hub) Unsubscribe(sub Subscriber, channels ...string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.subs[sub]
+	if s == nil {
+		return 0
+	}
+	if len(channels) == 0 {
+		channels = keys(s.channels)
+	}
+	h.unsubscribeLocked(sub, s, channels)
+	return h.releaseLocked(sub, s)
+}
+
+// PUnsubscribe removes sub from patterns, or from all its patterns when
+// none are given, and returns its remaining subscription count
+func (h *Hub) PUnsubscribe(sub Subscriber, patterns ...string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.subs[sub]
+	if s == nil {
+		return 0
+	}
+	if len(patterns) == 0 {
+		patterns = keys(s.patterns)
+	}
+	h.punsubscribeLocked(sub, s, patterns)
+	return h.releaseLocked(sub, s)
+}
+
+// UnsubscribeAll removes every subscription held by sub
+func (h *Hub) UnsubscribeAll(sub Subscriber) {
+	h.removeAll(sub)
+}
+
+// removeAll removes every subscription held by sub and reports whether it
+// had any, so concurrent publishers drop a slow subscriber only once
+func (h *Hub) removeAll(sub Subscriber) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.subs[sub]
+	if s == nil {
+		return false
+	}
+	h.unsubscribeLocked(sub, s, keys(s.channels))
+	h.punsubscribeLocked(sub, s, keys(s.patterns))
+	h.releaseLocked(sub, s)
+	return true
+}
+
+// Subscriptions returns how many channels and patterns sub is subscribed to
+func (h *Hub) Subscriptions(sub Subscriber) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if s := h.subs[sub]; s != nil {
+		return s.count()
+	}
+	return 0
+}
+
+// Publish delivers data to every subscriber of channel and every pattern
+// subscriber matching it, and returns how many received it. Subscribers
+// with a full buffer are dropped.
+func (h *Hub) Publish(channel string, data []byte) int {
+	type target struct {
+		sub     Subscriber
+		pattern string
+	}
+
+	h.mu.RLock()
+	var targets []target
+	for sub := range h.channels[channel] {
+		targets = append(targets, target{sub: sub})
+	}
+	for p, subs := range h.patterns {
+		if !Match(p, channel) {
+			continue
+		}
+		for sub := range subs {
+			targets = append(targets, target{sub: sub, pattern: p})
+		}
+	}
+	stats := h.stats[channel]
+	h.mu.RUnlock()
+
+	h.published.Add(1)
+	if stats != nil {
+		stats.published.Add(1)
+	}
+
+	limit := int(h.bufferLimit.Load())
+	received := 0
+	var slow []Subscriber
+	for _, t := range targets {
+		msg := &Message{Channel: channel, Pattern: t.pattern, Data: data}
+		if t.sub.Pending() >= limit || !t.sub.Deliver(msg) {
+			slow = append(slow, t.sub)
+			continue
+		}
+		received++
+		if stats != nil && t.pattern == "" {
+			stats.delivered.Add(1)
+		}
+	}
+	h.delivered.Add(uint64(received))
+
+	for _, sub := range slow {
+		// A subscriber matched by several targets, or by a concurrent
+		// publish, is removed only once
+		if !h.removeAll(sub) {
+			continue
+		}
+		h.dropped.Add(1)
+		sub.Drop()
+	}
+	return received
+}
+
+// Channels lists channels with direct subscribers, optionally filtered by
+// a glob pattern, sorted by name
+func (h *Hub) Channels(pattern string) []ChannelInfo {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	infos := make([]ChannelInfo, 0, len(h.channels))
+	for ch, subs := range h.channels {
+		if pattern != "" && !Match(pattern, ch) {
+			continue
+		}
+		info := ChannelInfo{Channel: ch, Subscribers: len(subs)}
+		if st := h.stats[ch]; st != nil {
+			info.Published = st.published.Load()
+			info.Delivered = st.delivered.Load()
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Channel < infos[j].Channel })
+	return infos
+}
+
+// Patterns returns the active pattern subscriptions and their subscriber
+// counts
+func (h *Hub) Patterns() map[string]int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	out := make(map[string]int, len(h.patterns))
+	for p, subs := range h.patterns {
+		out[p] = len(subs)
+	}
+	return out
+}
+
+// Stats returns a snapshot of the hub's counters
+func (h *Hub) Stats() Stats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return Stats{
+		Channels:    len(h.channels),
+		Patterns:    len(h.patterns),
+		Subscribers: len(h.subs),
+		Published:   h.published.Load(),
+		Delivered:   h.delivered.Load(),
+		Dropped:     h.dropped.Load(),
+	}
+}
+
+func (h *Hub) subscriptionsLocked(sub Subscriber) *subscriptions {
+	s := h.subs[sub]
+	if s == nil {
+		s = &subscriptions{
+			channels: make(map[string]struct{}),
+			patterns: make(map[string]struct{}),
+		}
+		h.subs[sub] = s
+	}
+	return s
+}
+
+func (h *Hub) unsubscribeLocked(sub Subscriber, s *subscriptions, channels []string) {
+	for _, ch := range channels {
+		if _, ok := s.channels[ch]; !ok {
+			continue
+		}
+		delete(s.channels, ch)
+		delete(h.channels[ch], sub)
+		if len(h.channels[ch]) == 0 {
+			delete(h.channels, ch)
+			delete(h.stats, ch)
+		}
+	}
+}
+
+func (h *Hub) punsubscribeLocked(sub Subscriber, s *subscriptions, patterns []string) {
+	for _, p := range patterns {
+		if _, ok := s.patterns[p]; !ok {
+			continue
+		}
+		delete(s.patterns, p)
+		delete(h.patterns[p], sub)
+		if len(h.patterns[p]) == 0 {
+			delete(h.patterns, p)
+		}
+	}
+}
+
+// releaseLocked forgets sub once it has no subscriptions left and returns
+// its subscription count
+func (h *Hub) releaseLocked(sub Subscriber, s *subscriptions) int {
+	n := s.count()
+	if n == 0 {
+		delete(h.subs, sub)
+	}
+	return n
+}
+
+func keys(m map[string]struct{}) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
@@ -0,0 +1,199 @@
+package pubsub
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// testSubscriber queues messages up to capacity and counts drops. A
+// draining subscriber reports nothing pending, as if written at once.
+type testSubscriber struct {
+	mu       sync.Mutex
+	capacity int
+	draining bool
+	msgs     []*Message
+	drops    int
+}
+
+func newTestSubscriber(capacity int) *testSubscriber {
+	return &testSubscriber{capacity: capacity}
+}
+
+func (s *testSubscriber) Deliver(msg *Message) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.msgs) >= s.capacity {
+		return false
+	}
+	s.msgs = append(s.msgs, msg)
+	return true
+}
+
+func (s *testSubscriber) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.draining {
+		return 0
+	}
+	return len(s.msgs)
+}
+
+func (s *testSubscriber) Drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drops++
+}
+
+// received returns "channel/pattern" for each delivered message, sorted
+func (s *testSubscriber) received() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var got []string
+	for _, m := range s.msgs {
+		got = append(got, m.Channel+"/"+m.Pattern)
+	}
+	sort.Strings(got)
+	return fmt.Sprint(got)
+}
+
+// TestHubFanOut tests that a publish reaches channel and pattern
+// subscribers, once per matching subscription
+func TestHubFanOut(t *testing.T) {
+	h := New()
+	direct := newTestSubscriber(100)
+	pattern := newTestSubscriber(100)
+	both := newTestSubscriber(100)
+
+	h.Subscribe(direct, "orders.eu")
+	h.PSubscribe(pattern, "orders.*", "*.eu")
+	if n := h.Subscribe(both, "orders.eu"); n != 1 {
+		t.Errorf("Expected 1 subscription, got %d", n)
+	}
+	if n := h.PSubscribe(both, "orders.*"); n != 2 {
+		t.Errorf("Expected 2 subscriptions, got %d", n)
+	}
+
+	tests := []struct {
+		channel  string
+		received int
+	}{
+		{"orders.eu", 5},
+		{"orders.us", 2},
+		{"users.eu", 1},
+		{"users.us", 0},
+	}
+	for _, tt := range tests {
+		if got := h.Publish(tt.channel, []byte("x")); got != tt.received {
+			t.Errorf("%s: expected %d deliveries, got %d", tt.channel, tt.received, got)
+		}
+	}
+
+	if got := direct.received(); got != "[orders.eu/]" {
+		t.Errorf("Expected direct subscriber to get orders.eu, got %s", got)
+	}
+	if got, want := pattern.received(), "[orders.eu/*.eu orders.eu/orders.* orders.us/orders.* users.eu/*.eu]"; got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if got, want := both.received(), "[orders.eu/ orders.eu/orders.* orders.us/orders.*]"; got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	stats := h.Stats()
+	if stats.Published != 4 || stats.Delivered != 8 || stats.Dropped != 0 {
+		t.Errorf("Expected 4 published and 8 delivered, got %+v", stats)
+	}
+	channels := h.Channels("")
+	if len(channels) != 1 || channels[0].Subscribers != 2 || channels[0].Published != 1 || channels[0].Delivered != 2 {
+		t.Errorf("Expected orders.eu with 2 subscribers and 2 direct deliveries, got %+v", channels)
+	}
+}
+
+// TestHubUnsubscribeAll tests that unsubscribing without arguments removes
+// every channel or pattern and forgets the subscriber
+func TestHubUnsubscribeAll(t *testing.T) {
+	h := New()
+	sub := newTestSubscriber(100)
+	other := newTestSubscriber(100)
+
+	h.Subscribe(sub, "a", "b")
+	h.PSubscribe(sub, "c.*", "d.*")
+	h.Subscribe(other, "a")
+
+	if n := h.Unsubscribe(sub); n != 2 {
+		t.Errorf("Expected the 2 patterns left, got %d", n)
+	}
+	if n := h.PUnsubscribe(sub); n != 0 {
+		t.Errorf("Expected no subscriptions left, got %d", n)
+	}
+	if n := h.Subscriptions(sub); n != 0 {
+		t.Errorf("Expected the subscriber forgotten, got %d subscriptions", n)
+	}
+
+	for _, ch := range []string{"a", "b", "c.x", "d.x"} {
+		h.Publish(ch, nil)
+	}
+	if got := sub.received(); got != "[]" {
+		t.Errorf("Expected nothing after unsubscribing, got %s", got)
+	}
+	if got := other.received(); got != "[a/]" {
+		t.Errorf("Expected other subscriber kept on a, got %s", got)
+	}
+
+	stats := h.Stats()
+	if stats.Channels != 1 || stats.Patterns != 0 || stats.Subscribers != 1 {
+		t.Errorf("Expected only a with one subscriber, got %+v", stats)
+	}
+
+	h.Subscribe(sub, "a")
+	h.PSubscribe(sub, "*")
+	h.UnsubscribeAll(sub)
+	if n := h.Subscriptions(sub); n != 0 {
+		t.Errorf("Expected UnsubscribeAll to remove everything, got %d", n)
+	}
+}
+
+// TestHubDropsSlowSubscriber tests that a subscriber over the buffer limit
+// is dropped once, even when several subscriptions or publishers reach it
+func TestHubDropsSlowSubscriber(t *testing.T) {
+	h := New()
+	h.SetBufferLimit(3)
+
+	slow := newTestSubscriber(100)
+	full := newTestSubscriber(1) // refuses deliveries below the limit
+	fast := newTestSubscriber(100)
+	fast.draining = true
+	h.Subscribe(slow, "news")
+	h.PSubscribe(slow, "n*", "*s")
+	h.Subscribe(full, "news")
+	h.Subscribe(fast, "news")
+
+	if got := h.Publish("news", nil); got != 5 {
+		t.Errorf("Expected 5 deliveries, got %d", got)
+	}
+
+	// slow now holds 3 messages, at the limit; full refuses its second
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.Publish("news", nil)
+		}()
+	}
+	wg.Wait()
+
+	if slow.drops != 1 || full.drops != 1 {
+		t.Errorf("Expected each slow subscriber dropped once, got %d and %d", slow.drops, full.drops)
+	}
+	if fast.drops != 0 || len(fast.msgs) != 9 {
+		t.Errorf("Expected the fast subscriber to get every message, got %d (%d drops)", len(fast.msgs), fast.drops)
+	}
+	if n := h.Subscriptions(slow); n != 0 {
+		t.Errorf("Expected the dropped subscriber unsubscribed, got %d", n)
+	}
+	if stats := h.Stats(); stats.Dropped != 2 || stats.Subscribers != 1 {
+		t.Errorf("Expected 2 dropped and 1 subscriber left, got %+v", stats)
+	}
+}
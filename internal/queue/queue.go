@@ -1,6 +1,8 @@
 package queue
 
 import (
+	"time"
+
 	"github.com/skshohagmiah/flin/internal/storage"
 )
 
@@ -26,16 +28,62 @@ func (q *Queue) Push(queueName string, value []byte) error {
 	return q.storage.Push(queueName, value)
 }
 
+// PushDedup adds an item unless dedupID was seen within the dedup window,
+// returning the item's sequence number and whether it was a duplicate
+func (q *Queue) PushDedup(queueName string, value []byte, dedupID string) (uint64, bool, error) {
+	return q.storage.PushDedup(queueName, value, dedupID)
+}
+
+// PushMessage adds an item with optional headers and dedup ID
+func (q *Queue) PushMessage(queueName string, value []byte, opts storage.PushOptions) (uint64, bool, error) {
+	return q.storage.PushMessage(queueName, value, opts)
+}
+
+// SetDedupWindow sets how long dedup IDs are remembered
+func (q *Queue) SetDedupWindow(window time.Duration) {
+	q.storage.SetDedupWindow(window)
+}
+
+// PushBatch adds several items to the end of the queue
+func (q *Queue) PushBatch(queueName string, values [][]byte) error {
+	return q.storage.PushBatch(queueName, values)
+}
+
 // Pop removes and returns the first item from the queue
 func (q *Queue) Pop(queueName string) ([]byte, error) {
 	return q.storage.Pop(queueName)
 }
 
+// PopMessage removes and returns the first item with its envelope
+func (q *Queue) PopMessage(queueName string) (*storage.QueueMessage, error) {
+	return q.storage.PopMessage(queueName)
+}
+
+// PopBatch removes and returns up to n items from the front of the queue
+func (q *Queue) PopBatch(queueName string, n int) ([][]byte, error) {
+	return q.storage.PopBatch(queueName, n)
+}
+
 // Peek returns the first item without removing it
 func (q *Queue) Peek(queueName string) ([]byte, error) {
 	return q.storage.Peek(queueName)
 }
 
+// PeekMessage returns the first item with its envelope without removing it
+func (q *Queue) PeekMessage(queueName string) (*storage.QueueMessage, error) {
+	return q.storage.PeekMessage(queueName)
+}
+
+// Range returns up to limit items starting at fromSeq without consuming them
+func (q *Queue) Range(queueName string, fromSeq uint64, limit int) ([]*storage.QueueMessage, error) {
+	return q.storage.Range(queueName, fromSeq, limit)
+}
+
+// Remove deletes a single item from anywhere in the queue
+func (q *Queue) Remove(queueName string, seq uint64) error {
+	return q.storage.Remove(queueName, seq)
+}
+
 // Len returns the number of items in the queue
 func (q *Queue) Len(queueName string) (uint64, error) {
 	return q.storage.Len(queueName)
@@ -46,6 +94,26 @@ func (q *Queue) Clear(queueName string) error {
 	return q.storage.Clear(queueName)
 }
 
+// Create registers an empty queue
+func (q *Queue) Create(queueName string) error {
+	return q.storage.Create(queueName)
+}
+
+// Delete removes a queue and all of its items
+func (q *Queue) Delete(queueName string) error {
+	return q.storage.Delete(queueName)
+}
+
+// List returns all known queues with their depth
+func (q *Queue) List() ([]storage.QueueInfo, error) {
+	return q.storage.List()
+}
+
+// Stats returns the counters for a queue
+func (q *Queue) Stats(queueName string) (*storage.QueueStats, error) {
+	return q.storage.Stats(queueName)
+}
+
 // Close closes the underlying storage
 func (q *Queue) Close() error {
 	return q.storage.Close()
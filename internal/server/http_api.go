@@ -2,12 +2,18 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/skshohagmiah/flin/internal/queue"
+	"github.com/skshohagmiah/flin/internal/storage"
+	"github.com/skshohagmiah/flin/internal/stream"
 )
 
 // HTTPServer wraps the Flin server to expose HTTP API endpoints
@@ -41,8 +47,18 @@ type KVListResponse struct {
 }
 
 type QueueItem struct {
-	Name  string `json:"name"`
-	Depth int    `json:"depth"`
+	Name      string `json:"name"`
+	Depth     int    `json:"depth"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+type QueueStatsResponse struct {
+	Name        string `json:"name"`
+	Depth       uint64 `json:"depth"`
+	Enqueued    uint64 `json:"enqueued"`
+	Dequeued    uint64 `json:"dequeued"`
+	OldestAgeMs int64  `json:"oldestAgeMs"`
+	CreatedAt   int64  `json:"createdAt"`
 }
 
 type QueueListResponse struct {
@@ -72,14 +88,40 @@ type GetResponse struct {
 }
 
 type PushRequest struct {
-	Queue   string `json:"queue"`
-	Message string `json:"message"`
+	Queue   string            `json:"queue"`
+	Message string            `json:"message"`
+	DedupID string            `json:"dedupId,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+type PushResponse struct {
+	Status    string `json:"status"`
+	Seq       uint64 `json:"seq"`
+	Duplicate bool   `json:"duplicate"`
 }
 
 type PopRequest struct {
 	Queue string `json:"queue"`
 }
 
+type QueueMessageItem struct {
+	ID            uint64            `json:"id"`
+	Message       string            `json:"message"`
+	EnqueuedAt    int64             `json:"enqueuedAt"`
+	DeliveryCount uint32            `json:"deliveryCount"`
+	Headers       map[string]string `json:"headers,omitempty"`
+}
+
+type QueueItemsResponse struct {
+	Items []QueueMessageItem `json:"items"`
+	Next  uint64             `json:"next"`
+}
+
+type RemoveQueueItemRequest struct {
+	Name string `json:"name"`
+	ID   uint64 `json:"id"`
+}
+
 type CreateQueueRequest struct {
 	Name string `json:"name"`
 }
@@ -89,9 +131,137 @@ type DeleteQueueRequest struct {
 }
 
 type PopResponse struct {
+	Message       string            `json:"message"`
+	ID            uint64            `json:"id"`
+	EnqueuedAt    int64             `json:"enqueuedAt"`
+	DeliveryCount uint32            `json:"deliveryCount"`
+	Headers       map[string]string `json:"headers,omitempty"`
+}
+
+type StreamItem struct {
+	Name           string `json:"name"`
+	Partitions     int    `json:"partitions"`
+	RetentionMs    int64  `json:"retentionMs"`
+	RetentionBytes int64  `json:"retentionBytes"`
+	CreatedAt      int64  `json:"createdAt"`
+	CleanupPolicy  string `json:"cleanupPolicy"`
+	Compression    string `json:"compression"`
+	Partitioner    string `json:"partitioner"`
+}
+
+type StreamListResponse struct {
+	Items []StreamItem `json:"items"`
+	Total int          `json:"total"`
+}
+
+type StreamPartitionItem struct {
+	Partition      int   `json:"partition"`
+	EarliestOffset int64 `json:"earliestOffset"`
+	LatestOffset   int64 `json:"latestOffset"`
+	Messages       int64 `json:"messages"`
+	Bytes          int64 `json:"bytes"`
+}
+
+type StreamDescribeResponse struct {
+	StreamItem
+	PartitionStats []StreamPartitionItem `json:"partitionStats"`
+	TotalMessages  int64                 `json:"totalMessages"`
+	TotalBytes     int64                 `json:"totalBytes"`
+}
+
+type StreamGroupItem struct {
+	Name       string   `json:"name"`
+	Topics     []string `json:"topics"`
+	Members    int      `json:"members"`
+	Generation uint64   `json:"generation"`
+	Strategy   string   `json:"strategy"`
+}
+
+type StreamGroupListResponse struct {
+	Items []StreamGroupItem `json:"items"`
+	Total int               `json:"total"`
+}
+
+type StreamLagItem struct {
+	Topic         string `json:"topic"`
+	Partition     int    `json:"partition"`
+	Committed     int64  `json:"committed"`
+	HighWatermark int64  `json:"highWatermark"`
+	Lag           int64  `json:"lag"`
+	LastCommit    int64  `json:"lastCommit"`
+	Consumer      string `json:"consumer"`
+}
+
+type StreamGroupLagResponse struct {
+	Group      string          `json:"group"`
+	Partitions []StreamLagItem `json:"partitions"`
+	TotalLag   int64           `json:"totalLag"`
+}
+
+type StreamCopyItem struct {
+	Name        string `json:"name"`
+	Source      string `json:"source"`
+	Target      string `json:"target"`
+	TargetAddr  string `json:"targetAddr,omitempty"`
+	StartOffset int64  `json:"startOffset"`
+	EndOffset   int64  `json:"endOffset"`
+	State       string `json:"state,omitempty"`
+	Error       string `json:"error,omitempty"`
+	Copied      int64  `json:"copied"`
+	Lag         int64  `json:"lag"`
+}
+
+type StreamCopyListResponse struct {
+	Items []StreamCopyItem `json:"items"`
+	Total int              `json:"total"`
+}
+
+type PubSubChannelItem struct {
+	Channel     string `json:"channel"`
+	Subscribers int    `json:"subscribers"`
+	Published   uint64 `json:"published"`
+	Delivered   uint64 `json:"delivered"`
+}
+
+type PubSubPatternItem struct {
+	Pattern     string `json:"pattern"`
+	Subscribers int    `json:"subscribers"`
+}
+
+type PubSubChannelsResponse struct {
+	Items    []PubSubChannelItem `json:"items"`
+	Patterns []PubSubPatternItem `json:"patterns"`
+	Total    int                 `json:"total"`
+	// Totals since startup across all channels
+	Published          uint64 `json:"published"`
+	Delivered          uint64 `json:"delivered"`
+	DroppedSubscribers uint64 `json:"droppedSubscribers"`
+}
+
+type PublishRequest struct {
+	Channel string `json:"channel"`
 	Message string `json:"message"`
 }
 
+type CreateStreamRequest struct {
+	Name           string `json:"name"`
+	Partitions     int    `json:"partitions"`
+	RetentionMs    int64  `json:"retentionMs"`
+	RetentionBytes int64  `json:"retentionBytes"`
+	CleanupPolicy  string `json:"cleanupPolicy"`
+	Compression    string `json:"compression"`
+	Partitioner    string `json:"partitioner"`
+}
+
+type DeleteStreamRequest struct {
+	Name string `json:"name"`
+}
+
+type AddPartitionsRequest struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
 // NewHTTPServer creates a new HTTP API server for Flin
 func NewHTTPServer(server *Server, q *queue.Queue, addr string) *HTTPServer {
 	hs := &HTTPServer{
@@ -126,6 +296,29 @@ func (hs *HTTPServer) registerRoutes() {
 	hs.router.HandleFunc("/queues/pop", hs.handleQueuePop)
 	hs.router.HandleFunc("/queues/create", hs.handleQueueCreate)
 	hs.router.HandleFunc("/queues/delete", hs.handleQueueDelete)
+	hs.router.HandleFunc("/queues/stats", hs.handleQueueStats)
+	hs.router.HandleFunc("/queues/items", hs.handleQueueItems)
+	hs.router.HandleFunc("/queues/remove", hs.handleQueueRemove)
+
+	// Stream routes
+	hs.router.HandleFunc("/streams", hs.handleStreamsGet)
+	hs.router.HandleFunc("/streams/describe", hs.handleStreamDescribe)
+	hs.router.HandleFunc("/streams/create", hs.handleStreamCreate)
+	hs.router.HandleFunc("/streams/delete", hs.handleStreamDelete)
+	hs.router.HandleFunc("/streams/partitions", hs.handleStreamAddPartitions)
+	hs.router.HandleFunc("/streams/groups", hs.handleStreamGroups)
+	hs.router.HandleFunc("/streams/groups/lag", hs.handleStreamGroupLag)
+	hs.router.HandleFunc("/streams/copy", hs.handleStreamCopyList)
+	hs.router.HandleFunc("/streams/copy/start", hs.handleStreamCopyStart)
+	hs.router.HandleFunc("/streams/copy/stop", hs.handleStreamCopyStop)
+	hs.router.HandleFunc("/streams/copy/delete", hs.handleStreamCopyStop)
+
+	// Pub/Sub routes
+	hs.router.HandleFunc("/pubsub/channels", hs.handlePubSubChannels)
+	hs.router.HandleFunc("/pubsub/publish", hs.handlePubSubPublish)
+
+	// Prometheus metrics
+	hs.router.HandleFunc("/metrics", hs.handleMetrics)
 
 	// CORS middleware wrapper
 	// Removed: hs.router.Handle("/", corsMiddleware(hs.router)) - this caused infinite recursion
@@ -329,12 +522,58 @@ func (hs *HTTPServer) handleQueuesGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// For now, return empty list as we need to implement queue iteration
-	// TODO: Implement queue iteration
+	queues, err := hs.queue.List()
+	if err != nil {
+		writeError(w, "Failed to list queues: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]QueueItem, 0, len(queues))
+	for _, q := range queues {
+		items = append(items, QueueItem{
+			Name:      q.Name,
+			Depth:     int(q.Depth),
+			CreatedAt: q.CreatedAt,
+		})
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(QueueListResponse{
-		Items: []QueueItem{},
-		Total: 0,
+		Items: items,
+		Total: len(items),
+	})
+}
+
+func (hs *HTTPServer) handleQueueStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		writeError(w, "name parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	stats, err := hs.queue.Stats(name)
+	if err != nil {
+		if errors.Is(err, storage.ErrQueueNotFound) {
+			writeError(w, "Queue not found", http.StatusNotFound)
+		} else {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(QueueStatsResponse{
+		Name:        stats.Name,
+		Depth:       stats.Depth,
+		Enqueued:    stats.Enqueued,
+		Dequeued:    stats.Dequeued,
+		OldestAgeMs: stats.OldestAgeMs,
+		CreatedAt:   stats.CreatedAt,
 	})
 }
 
@@ -355,15 +594,24 @@ func (hs *HTTPServer) handleQueuePush(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := hs.queue.Push(req.Queue, []byte(req.Message))
+	opts := storage.PushOptions{DedupID: req.DedupID, Headers: req.Headers}
+	seq, duplicate, err := hs.queue.PushMessage(req.Queue, []byte(req.Message), opts)
 	if err != nil {
 		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	if duplicate {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(PushResponse{
+		Status:    "success",
+		Seq:       seq,
+		Duplicate: duplicate,
+	})
 }
 
 func (hs *HTTPServer) handleQueuePop(w http.ResponseWriter, r *http.Request) {
@@ -383,20 +631,23 @@ func (hs *HTTPServer) handleQueuePop(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	message, err := hs.queue.Pop(req.Queue)
+	msg, err := hs.queue.PopMessage(req.Queue)
 	if err != nil {
-		writeError(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	if message == nil {
-		writeError(w, "Queue is empty", http.StatusNotFound)
+		if errors.Is(err, storage.ErrQueueEmpty) {
+			writeError(w, "Queue is empty", http.StatusNotFound)
+		} else {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(PopResponse{
-		Message: string(message),
+		Message:       string(msg.Value),
+		ID:            msg.ID,
+		EnqueuedAt:    msg.EnqueuedAt,
+		DeliveryCount: msg.DeliveryCount,
+		Headers:       msg.Headers,
 	})
 }
 
@@ -417,22 +668,17 @@ func (hs *HTTPServer) handleQueueCreate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// In Flin, queues are created implicitly on push, but we can have an explicit create
-	// to ensure it shows up in lists immediately if we track metadata.
-	// For now, we'll just return success as "creation" is implicit or handled by the underlying engine.
-	// If the underlying engine supports explicit creation, we should call it.
-	// Assuming hs.queue has a Create method or similar if needed.
-	// Checking queue package... assuming implicit for now based on push.
-	// But wait, the test expects explicit create.
-	// Let's check if queue package has Create.
-
-	// Actually, looking at the code, I don't see hs.queue.Create used anywhere.
-	// But I should check if it exists.
-	// For now, I will assume it's implicit and just return success,
-	// OR if I need to do something, I'll do it.
-	// However, to be safe, I'll just return success.
+	if err := hs.queue.Create(req.Name); err != nil {
+		if errors.Is(err, storage.ErrQueueExists) {
+			writeError(w, "Queue already exists", http.StatusConflict)
+		} else {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 }
 
@@ -453,11 +699,102 @@ func (hs *HTTPServer) handleQueueDelete(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Implement delete logic here.
-	// Assuming hs.queue.Delete(req.Name) exists?
-	// I haven't checked queue package.
-	// I'll assume for now we just return success to pass the test,
-	// but I should really check the queue package.
+	if err := hs.queue.Delete(req.Name); err != nil {
+		if errors.Is(err, storage.ErrQueueNotFound) {
+			writeError(w, "Queue not found", http.StatusNotFound)
+		} else {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+func (hs *HTTPServer) handleQueueItems(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		writeError(w, "name parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	var from uint64
+	if v := r.URL.Query().Get("from"); v != "" {
+		parsed, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			writeError(w, "invalid from parameter", http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed <= 0 {
+			writeError(w, "invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	msgs, err := hs.queue.Range(name, from, limit)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]QueueMessageItem, 0, len(msgs))
+	next := from
+	for _, msg := range msgs {
+		items = append(items, QueueMessageItem{
+			ID:            msg.ID,
+			Message:       string(msg.Value),
+			EnqueuedAt:    msg.EnqueuedAt,
+			DeliveryCount: msg.DeliveryCount,
+			Headers:       msg.Headers,
+		})
+		next = msg.ID + 1
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(QueueItemsResponse{
+		Items: items,
+		Next:  next,
+	})
+}
+
+func (hs *HTTPServer) handleQueueRemove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RemoveQueueItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name == "" {
+		writeError(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := hs.queue.Remove(req.Name, req.ID); err != nil {
+		if errors.Is(err, storage.ErrItemNotFound) {
+			writeError(w, "Item not found", http.StatusNotFound)
+		} else {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
@@ -465,6 +802,413 @@ func (hs *HTTPServer) handleQueueDelete(w http.ResponseWriter, r *http.Request)
 
 // Utility functions
 
+// Stream handlers
+
+func (hs *HTTPServer) handleStreamsGet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	topics, err := hs.server.stream.ListTopics()
+	if err != nil {
+		writeError(w, "Failed to list streams: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]StreamItem, 0, len(topics))
+	for _, t := range topics {
+		items = append(items, streamItem(t))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(StreamListResponse{
+		Items: items,
+		Total: len(items),
+	})
+}
+
+func (hs *HTTPServer) handleStreamDescribe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		writeError(w, "name parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	desc, err := hs.server.stream.DescribeTopic(name)
+	if err != nil {
+		if errors.Is(err, storage.ErrTopicNotFound) {
+			writeError(w, "Stream not found", http.StatusNotFound)
+		} else {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	resp := StreamDescribeResponse{
+		StreamItem:     streamItem(desc.Metadata),
+		PartitionStats: make([]StreamPartitionItem, 0, len(desc.Partitions)),
+	}
+	for _, p := range desc.Partitions {
+		resp.PartitionStats = append(resp.PartitionStats, StreamPartitionItem{
+			Partition:      p.Partition,
+			EarliestOffset: p.EarliestOffset,
+			LatestOffset:   p.LatestOffset,
+			Messages:       p.Messages,
+			Bytes:          p.Bytes,
+		})
+		resp.TotalMessages += p.Messages
+		resp.TotalBytes += p.Bytes
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (hs *HTTPServer) handleStreamGroups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	groups, err := hs.server.stream.ListGroups()
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]StreamGroupItem, 0, len(groups))
+	for _, g := range groups {
+		items = append(items, StreamGroupItem{
+			Name:       g.Name,
+			Topics:     g.Topics,
+			Members:    g.Members,
+			Generation: g.Generation,
+			Strategy:   g.Strategy,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(StreamGroupListResponse{Items: items, Total: len(items)})
+}
+
+func (hs *HTTPServer) handleStreamGroupLag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	group := r.URL.Query().Get("group")
+	if group == "" {
+		writeError(w, "group parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	lags, err := hs.server.stream.GroupLag(group)
+	if err != nil {
+		if errors.Is(err, stream.ErrGroupNotFound) {
+			writeError(w, "Group not found", http.StatusNotFound)
+		} else {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	resp := StreamGroupLagResponse{
+		Group:      group,
+		Partitions: make([]StreamLagItem, 0, len(lags)),
+	}
+	for _, l := range lags {
+		resp.Partitions = append(resp.Partitions, StreamLagItem{
+			Topic:         l.Topic,
+			Partition:     l.Partition,
+			Committed:     l.Committed,
+			HighWatermark: l.HighWatermark,
+			Lag:           l.Lag,
+			LastCommit:    l.LastCommit,
+			Consumer:      l.Consumer,
+		})
+		resp.TotalLag += l.Lag
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleMetrics exposes server counters and consumer group lag in the
+// Prometheus text format
+func (hs *HTTPServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	lags, err := hs.server.stream.AllGroupLag()
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var b strings.Builder
+
+	stats := hs.server.Stats()
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "# TYPE flin_%s gauge\nflin_%s %v\n", name, name, stats[name])
+	}
+
+	gauges := []struct {
+		name, help string
+		value      func(stream.PartitionLag) int64
+	}{
+		{"flin_stream_consumer_lag", "Messages between the group's committed offset and the high-water mark",
+			func(l stream.PartitionLag) int64 { return l.Lag }},
+		{"flin_stream_consumer_committed_offset", "Next offset the group will read",
+			func(l stream.PartitionLag) int64 { return l.Committed }},
+		{"flin_stream_high_watermark", "Next offset to be written to the partition",
+			func(l stream.PartitionLag) int64 { return l.HighWatermark }},
+	}
+	for _, g := range gauges {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+		for _, l := range lags {
+			fmt.Fprintf(&b, "%s{group=%q,topic=%q,partition=\"%d\"} %d\n",
+				g.name, l.Group, l.Topic, l.Partition, g.value(l))
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(b.String()))
+}
+
+func (hs *HTTPServer) handleStreamCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req CreateStreamRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name == "" {
+		writeError(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := hs.server.stream.GetTopicMetadata(req.Name); err == nil {
+		writeError(w, "Stream already exists", http.StatusConflict)
+		return
+	}
+
+	err := hs.server.stream.CreateTopicWithConfig(req.Name, stream.TopicConfig{
+		Partitions:     req.Partitions,
+		RetentionMs:    req.RetentionMs,
+		RetentionBytes: req.RetentionBytes,
+		CleanupPolicy:  req.CleanupPolicy,
+		Compression:    req.Compression,
+		Partitioner:    req.Partitioner,
+	})
+	if errors.Is(err, stream.ErrInvalidCleanupPolicy) || errors.Is(err, stream.ErrInvalidCompression) ||
+		errors.Is(err, stream.ErrInvalidPartitioner) {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+func (hs *HTTPServer) handleStreamDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req DeleteStreamRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name == "" {
+		writeError(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := hs.server.stream.DeleteTopic(req.Name); err != nil {
+		if errors.Is(err, storage.ErrTopicNotFound) {
+			writeError(w, "Stream not found", http.StatusNotFound)
+		} else {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+func (hs *HTTPServer) handleStreamCopyList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jobs, err := hs.server.stream.ListCopyJobs()
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]StreamCopyItem, 0, len(jobs))
+	for _, j := range jobs {
+		items = append(items, StreamCopyItem{
+			Name:        j.Name,
+			Source:      j.Source,
+			Target:      j.Target,
+			TargetAddr:  j.TargetAddr,
+			StartOffset: j.StartOffset,
+			EndOffset:   j.EndOffset,
+			State:       j.State,
+			Error:       j.Error,
+			Copied:      j.Copied,
+			Lag:         j.Lag,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(StreamCopyListResponse{Items: items, Total: len(items)})
+}
+
+func (hs *HTTPServer) handleStreamCopyStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req StreamCopyItem
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := hs.server.stream.StartCopy(stream.CopyConfig{
+		Name:        req.Name,
+		Source:      req.Source,
+		Target:      req.Target,
+		TargetAddr:  req.TargetAddr,
+		StartOffset: req.StartOffset,
+		EndOffset:   req.EndOffset,
+	})
+	switch {
+	case errors.Is(err, storage.ErrTopicNotFound):
+		writeError(w, "Stream not found", http.StatusNotFound)
+		return
+	case errors.Is(err, stream.ErrCopyJobRunning):
+		writeError(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+// handleStreamCopyStop serves both /streams/copy/stop and /streams/copy/delete
+func (hs *HTTPServer) handleStreamCopyStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req DeleteStreamRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if strings.HasSuffix(r.URL.Path, "/delete") {
+		err = hs.server.stream.DeleteCopy(req.Name)
+	} else {
+		err = hs.server.stream.StopCopy(req.Name)
+	}
+	if err != nil {
+		if errors.Is(err, stream.ErrCopyJobNotFound) {
+			writeError(w, err.Error(), http.StatusNotFound)
+		} else {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+func (hs *HTTPServer) handleStreamAddPartitions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req AddPartitionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name == "" || req.Count <= 0 {
+		writeError(w, "name and a positive count are required", http.StatusBadRequest)
+		return
+	}
+
+	total, err := hs.server.stream.AddPartitions(req.Name, req.Count)
+	if err != nil {
+		if errors.Is(err, storage.ErrTopicNotFound) {
+			writeError(w, "Stream not found", http.StatusNotFound)
+		} else {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"partitions": total})
+}
+
+func streamItem(meta *storage.TopicMetadata) StreamItem {
+	return StreamItem{
+		Name:           meta.Name,
+		Partitions:     meta.Partitions,
+		RetentionMs:    meta.RetentionMs,
+		RetentionBytes: meta.RetentionBytes,
+		CreatedAt:      meta.CreatedAt,
+		CleanupPolicy:  meta.CleanupPolicy,
+		Compression:    meta.Compression,
+		Partitioner:    meta.Partitioner,
+	}
+}
+
 func writeError(w http.ResponseWriter, message string, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
@@ -488,3 +1232,63 @@ func corsMiddleware(next http.Handler) http.HandlerFunc {
 		next.ServeHTTP(w, r)
 	}
 }
+
+func (hs *HTTPServer) handlePubSubChannels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	hub := hs.server.pubsub
+	channels := hub.Channels(r.URL.Query().Get("pattern"))
+
+	items := make([]PubSubChannelItem, 0, len(channels))
+	for _, ch := range channels {
+		items = append(items, PubSubChannelItem{
+			Channel:     ch.Channel,
+			Subscribers: ch.Subscribers,
+			Published:   ch.Published,
+			Delivered:   ch.Delivered,
+		})
+	}
+
+	patterns := make([]PubSubPatternItem, 0)
+	for p, n := range hub.Patterns() {
+		patterns = append(patterns, PubSubPatternItem{Pattern: p, Subscribers: n})
+	}
+	sort.Slice(patterns, func(i, j int) bool { return patterns[i].Pattern < patterns[j].Pattern })
+
+	stats := hub.Stats()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PubSubChannelsResponse{
+		Items:              items,
+		Patterns:           patterns,
+		Total:              len(items),
+		Published:          stats.Published,
+		Delivered:          stats.Delivered,
+		DroppedSubscribers: stats.Dropped,
+	})
+}
+
+func (hs *HTTPServer) handlePubSubPublish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PublishRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Channel == "" {
+		writeError(w, "channel is required", http.StatusBadRequest)
+		return
+	}
+
+	receivers := hs.server.pubsub.Publish(req.Channel, []byte(req.Message))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"receivers": receivers})
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/skshohagmiah/flin/internal/protocol"
+	"github.com/skshohagmiah/flin/internal/pubsub"
+)
+
+// Deliver queues a published message on the connection without blocking
+func (c *Connection) Deliver(msg *pubsub.Message) bool {
+	select {
+	case c.outQueue <- protocol.EncodeMessageFrame(msg.Channel, msg.Pattern, msg.Data):
+		return true
+	default:
+		return false
+	}
+}
+
+// Pending returns how many frames are queued for the write loop
+func (c *Connection) Pending() int {
+	return len(c.outQueue)
+}
+
+// Drop closes a subscriber connection that fell behind
+func (c *Connection) Drop() {
+	c.cancel()
+	c.conn.Close()
+}
+
+func (c *Connection) processBinaryPublish(req *protocol.Request, startTime time.Time) {
+	receivers := c.server.pubsub.Publish(req.Key, req.Value)
+
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(receivers))
+
+	c.sendBinaryResponse(protocol.EncodeValueResponse(buf), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
+
+// processBinarySubscribe handles SUBSCRIBE, PSUBSCRIBE, UNSUBSCRIBE and
+// PUNSUBSCRIBE, replying with the connection's subscription count
+func (c *Connection) processBinarySubscribe(req *protocol.Request, startTime time.Time) {
+	var count int
+	switch req.OpCode {
+	case protocol.OpSubscribe, protocol.OpPSubscribe:
+		if len(req.Keys) == 0 {
+			c.sendBinaryError(fmt.Errorf("no channels given"))
+			c.server.opsErrors.Add(1)
+			return
+		}
+		if req.OpCode == protocol.OpSubscribe {
+			count = c.server.pubsub.Subscribe(c, req.Keys...)
+		} else {
+			count = c.server.pubsub.PSubscribe(c, req.Keys...)
+		}
+	case protocol.OpUnsubscribe:
+		count = c.server.pubsub.Unsubscribe(c, req.Keys...)
+	case protocol.OpPUnsubscribe:
+		count = c.server.pubsub.PUnsubscribe(c, req.Keys...)
+	}
+
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, uint32(count))
+
+	c.sendBinaryResponse(protocol.EncodeValueResponse(buf), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
+
+func (c *Connection) processBinaryPubSubChannels(req *protocol.Request, startTime time.Time) {
+	channels := c.server.pubsub.Channels(req.Key)
+
+	values := make([][]byte, len(channels))
+	for i, ch := range channels {
+		// Encode channel: [2:nameLen][name][4:subscribers][8:published][8:delivered]
+		nameLen := len(ch.Channel)
+		buf := make([]byte, 2+nameLen+4+8+8)
+
+		pos := 0
+		binary.BigEndian.PutUint16(buf[pos:], uint16(nameLen))
+		pos += 2
+		copy(buf[pos:], ch.Channel)
+		pos += nameLen
+		binary.BigEndian.PutUint32(buf[pos:], uint32(ch.Subscribers))
+		pos += 4
+		binary.BigEndian.PutUint64(buf[pos:], ch.Published)
+		pos += 8
+		binary.BigEndian.PutUint64(buf[pos:], ch.Delivered)
+
+		values[i] = buf
+	}
+
+	c.sendBinaryResponse(protocol.EncodeMultiValueResponse(values), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
@@ -4,7 +4,9 @@ import (
 	"encoding/binary"
 	"time"
 
+	"github.com/skshohagmiah/flin/internal/headercodec"
 	"github.com/skshohagmiah/flin/internal/protocol"
+	"github.com/skshohagmiah/flin/internal/storage"
 )
 
 // Queue operation handlers
@@ -23,6 +25,30 @@ func (c *Connection) processBinaryQPush(req *protocol.Request, startTime time.Ti
 	c.server.opsFastPath.Add(1)
 }
 
+// processBinaryQPushMsg serves OpQPushID and OpQPushMsg, whose requests
+// differ only in carrying headers
+func (c *Connection) processBinaryQPushMsg(req *protocol.Request, startTime time.Time) {
+	opts := storage.PushOptions{DedupID: req.DedupID, Headers: req.Headers}
+	seq, duplicate, err := c.server.queue.PushMessage(req.Key, req.Value, opts)
+
+	if err != nil {
+		c.sendBinaryError(err)
+		c.server.opsErrors.Add(1)
+		return
+	}
+
+	// Encode result: [8:seq][1:duplicate]
+	buf := make([]byte, 9)
+	binary.BigEndian.PutUint64(buf, seq)
+	if duplicate {
+		buf[8] = 1
+	}
+
+	c.sendBinaryResponse(protocol.EncodeValueResponse(buf), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
+
 func (c *Connection) processBinaryQPop(req *protocol.Request, startTime time.Time) {
 	value, err := c.server.queue.Pop(req.Key)
 
@@ -51,6 +77,54 @@ func (c *Connection) processBinaryQPeek(req *protocol.Request, startTime time.Ti
 	c.server.opsFastPath.Add(1)
 }
 
+func (c *Connection) processBinaryQPopMsg(req *protocol.Request, startTime time.Time) {
+	msg, err := c.server.queue.PopMessage(req.Key)
+
+	if err != nil {
+		c.sendBinaryError(err)
+		c.server.opsErrors.Add(1)
+		return
+	}
+
+	c.sendBinaryResponse(protocol.EncodeValueResponse(encodeQueueMessage(msg)), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
+
+func (c *Connection) processBinaryQPeekMsg(req *protocol.Request, startTime time.Time) {
+	msg, err := c.server.queue.PeekMessage(req.Key)
+
+	if err != nil {
+		c.sendBinaryError(err)
+		c.server.opsErrors.Add(1)
+		return
+	}
+
+	c.sendBinaryResponse(protocol.EncodeValueResponse(encodeQueueMessage(msg)), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
+
+// encodeQueueMessage encodes a message as [8:id][8:enqueuedAt][4:deliveryCount][headers][4:valueLen][value]
+func encodeQueueMessage(msg *storage.QueueMessage) []byte {
+	headers := headercodec.Encode(msg.Headers)
+	buf := make([]byte, 8+8+4+len(headers)+4+len(msg.Value))
+
+	pos := 0
+	binary.BigEndian.PutUint64(buf[pos:], msg.ID)
+	pos += 8
+	binary.BigEndian.PutUint64(buf[pos:], uint64(msg.EnqueuedAt))
+	pos += 8
+	binary.BigEndian.PutUint32(buf[pos:], msg.DeliveryCount)
+	pos += 4
+	pos += copy(buf[pos:], headers)
+	binary.BigEndian.PutUint32(buf[pos:], uint32(len(msg.Value)))
+	pos += 4
+	copy(buf[pos:], msg.Value)
+
+	return buf
+}
+
 func (c *Connection) processBinaryQLen(req *protocol.Request, startTime time.Time) {
 	length, err := c.server.queue.Len(req.Key)
 
@@ -82,3 +156,113 @@ func (c *Connection) processBinaryQClear(req *protocol.Request, startTime time.T
 	c.server.opsProcessed.Add(1)
 	c.server.opsFastPath.Add(1)
 }
+
+func (c *Connection) processBinaryQCreate(req *protocol.Request, startTime time.Time) {
+	err := c.server.queue.Create(req.Key)
+
+	if err != nil {
+		c.sendBinaryError(err)
+		c.server.opsErrors.Add(1)
+		return
+	}
+
+	c.sendBinaryResponse(protocol.EncodeOKResponse(), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
+
+func (c *Connection) processBinaryQDelete(req *protocol.Request, startTime time.Time) {
+	err := c.server.queue.Delete(req.Key)
+
+	if err != nil {
+		c.sendBinaryError(err)
+		c.server.opsErrors.Add(1)
+		return
+	}
+
+	c.sendBinaryResponse(protocol.EncodeOKResponse(), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
+
+func (c *Connection) processBinaryQList(req *protocol.Request, startTime time.Time) {
+	queues, err := c.server.queue.List()
+
+	if err != nil {
+		c.sendBinaryError(err)
+		c.server.opsErrors.Add(1)
+		return
+	}
+
+	values := make([][]byte, len(queues))
+	for i, q := range queues {
+		// Encode queue: [2:nameLen][name][8:depth][8:createdAt]
+		nameLen := len(q.Name)
+		buf := make([]byte, 2+nameLen+8+8)
+
+		pos := 0
+		binary.BigEndian.PutUint16(buf[pos:], uint16(nameLen))
+		pos += 2
+		copy(buf[pos:], q.Name)
+		pos += nameLen
+		binary.BigEndian.PutUint64(buf[pos:], q.Depth)
+		pos += 8
+		binary.BigEndian.PutUint64(buf[pos:], uint64(q.CreatedAt))
+
+		values[i] = buf
+	}
+
+	c.sendBinaryResponse(protocol.EncodeMultiValueResponse(values), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
+
+func (c *Connection) processBinaryQStats(req *protocol.Request, startTime time.Time) {
+	stats, err := c.server.queue.Stats(req.Key)
+
+	if err != nil {
+		c.sendBinaryError(err)
+		c.server.opsErrors.Add(1)
+		return
+	}
+
+	// Encode stats: [8:depth][8:enqueued][8:dequeued][8:oldestAgeMs][8:createdAt]
+	buf := make([]byte, 40)
+	binary.BigEndian.PutUint64(buf[0:], stats.Depth)
+	binary.BigEndian.PutUint64(buf[8:], stats.Enqueued)
+	binary.BigEndian.PutUint64(buf[16:], stats.Dequeued)
+	binary.BigEndian.PutUint64(buf[24:], uint64(stats.OldestAgeMs))
+	binary.BigEndian.PutUint64(buf[32:], uint64(stats.CreatedAt))
+
+	c.sendBinaryResponse(protocol.EncodeValueResponse(buf), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
+
+func (c *Connection) processBinaryQMPush(req *protocol.Request, startTime time.Time) {
+	err := c.server.queue.PushBatch(req.Key, req.Values)
+
+	if err != nil {
+		c.sendBinaryError(err)
+		c.server.opsErrors.Add(1)
+		return
+	}
+
+	c.sendBinaryResponse(protocol.EncodeOKResponse(), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
+
+func (c *Connection) processBinaryQMPop(req *protocol.Request, startTime time.Time) {
+	values, err := c.server.queue.PopBatch(req.Key, req.Count)
+
+	if err != nil {
+		c.sendBinaryError(err)
+		c.server.opsErrors.Add(1)
+		return
+	}
+
+	c.sendBinaryResponse(protocol.EncodeMultiValueResponse(values), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
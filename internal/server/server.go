@@ -14,6 +14,7 @@ import (
 	"github.com/skshohagmiah/flin/internal/db"
 	"github.com/skshohagmiah/flin/internal/kv"
 	"github.com/skshohagmiah/flin/internal/protocol"
+	"github.com/skshohagmiah/flin/internal/pubsub"
 	"github.com/skshohagmiah/flin/internal/queue"
 	"github.com/skshohagmiah/flin/internal/stream"
 )
@@ -32,6 +33,7 @@ type Server struct {
 	queue       *queue.Queue
 	stream      *stream.Stream
 	db          *db.DocStore
+	pubsub      *pubsub.Hub
 	ck          *clusterkit.ClusterKit
 	listener    net.Listener
 	connections sync.Map
@@ -134,6 +136,7 @@ func NewServerWithWorkers(store *kv.KVStore, q *queue.Queue, stream *stream.Stre
 		queue:    q,
 		stream:   stream,   // Initialize the new stream field
 		db:       docStore, // Initialize the document store field
+		pubsub:   pubsub.New(),
 		ck:       ck,
 		listener: listener,
 		nodeID:   nodeID,
@@ -412,6 +415,7 @@ func (s *Server) handleConnection(netConn net.Conn) {
 	s.connections.Store(connID, conn)
 	defer s.connections.Delete(connID)
 	defer netConn.Close()
+	defer s.pubsub.UnsubscribeAll(conn)
 
 	// Return buffers to pool when done
 	defer func() {
@@ -452,6 +456,10 @@ func (c *Connection) readLoop() {
 
 		n, err := c.conn.Read(c.readBuf)
 		if err != nil {
+			// Pub/Sub subscribers may sit idle while waiting for messages
+			if ne, ok := err.(net.Error); ok && ne.Timeout() && c.server.pubsub.Subscriptions(c) > 0 {
+				continue
+			}
 			return
 		}
 
@@ -485,8 +493,8 @@ func (c *Connection) writeLoop() {
 func (c *Connection) processRequestHybrid(data []byte) {
 	startTime := time.Now()
 
-	// Detect protocol: binary starts with opcode 0x01-0x12 (KV) or 0x20-0x24 (Queue) or 0x30-0x36 (Stream) or 0x40-0x44 (Document), text starts with ASCII letters
-	isBinary := len(data) > 0 && ((data[0] >= 0x01 && data[0] <= 0x12) || (data[0] >= 0x20 && data[0] <= 0x24) || (data[0] >= 0x30 && data[0] <= 0x36) || (data[0] >= 0x40 && data[0] <= 0x44))
+	// Detect protocol: binary starts with opcode 0x01-0x12 (KV) or 0x20-0x2E (Queue) or 0x30-0x3F, 0x80-0x86 (Stream) or 0x40-0x44 (Document) or 0x90-0x95 (Pub/Sub), text starts with ASCII letters
+	isBinary := len(data) > 0 && ((data[0] >= 0x01 && data[0] <= 0x12) || (data[0] >= 0x20 && data[0] <= 0x2E) || (data[0] >= 0x30 && data[0] <= 0x3F) || (data[0] >= 0x40 && data[0] <= 0x44) || (data[0] >= 0x80 && data[0] <= 0x86) || (data[0] >= 0x90 && data[0] <= 0x95))
 
 	if len(data) > 0 && (data[0] == 0x40 || data[0] == 0x41 || data[0] == 0x42 || data[0] == 0x43) {
 		log.Printf("[DEBUG] Got document opcode: 0x%02x, isBinary=%v", data[0], isBinary)
@@ -556,14 +564,32 @@ func (c *Connection) processRequestBinary(data []byte, startTime time.Time) {
 		c.processBinaryMDel(req, startTime)
 	case protocol.OpQPush:
 		c.processBinaryQPush(req, startTime)
+	case protocol.OpQPushID, protocol.OpQPushMsg:
+		c.processBinaryQPushMsg(req, startTime)
 	case protocol.OpQPop:
 		c.processBinaryQPop(req, startTime)
+	case protocol.OpQPopMsg:
+		c.processBinaryQPopMsg(req, startTime)
+	case protocol.OpQPeekMsg:
+		c.processBinaryQPeekMsg(req, startTime)
 	case protocol.OpQPeek:
 		c.processBinaryQPeek(req, startTime)
 	case protocol.OpQLen:
 		c.processBinaryQLen(req, startTime)
 	case protocol.OpQClear:
 		c.processBinaryQClear(req, startTime)
+	case protocol.OpQCreate:
+		c.processBinaryQCreate(req, startTime)
+	case protocol.OpQDelete:
+		c.processBinaryQDelete(req, startTime)
+	case protocol.OpQList:
+		c.processBinaryQList(req, startTime)
+	case protocol.OpQStats:
+		c.processBinaryQStats(req, startTime)
+	case protocol.OpQMPush:
+		c.processBinaryQMPush(req, startTime)
+	case protocol.OpQMPop:
+		c.processBinaryQMPop(req, startTime)
 	case protocol.OpSPublish:
 		c.processBinarySPublish(req, startTime)
 	case protocol.OpSConsume:
@@ -576,6 +602,46 @@ func (c *Connection) processRequestBinary(data []byte, startTime time.Time) {
 		c.processBinarySSubscribe(req, startTime)
 	case protocol.OpSUnsubscribe:
 		c.processBinarySUnsubscribe(req, startTime)
+	case protocol.OpSMPublish:
+		c.processBinarySMPublish(req, startTime)
+	case protocol.OpSSeek:
+		c.processBinarySSeek(req, startTime)
+	case protocol.OpSListTopics:
+		c.processBinarySListTopics(req, startTime)
+	case protocol.OpSDescribe:
+		c.processBinarySDescribe(req, startTime)
+	case protocol.OpSDeleteTopic:
+		c.processBinarySDeleteTopic(req, startTime)
+	case protocol.OpSAddParts:
+		c.processBinarySAddParts(req, startTime)
+	case protocol.OpSGetOffsets:
+		c.processBinarySGetOffsets(req, startTime)
+	case protocol.OpSListGroups:
+		c.processBinarySListGroups(req, startTime)
+	case protocol.OpSGroupLag:
+		c.processBinarySGroupLag(req, startTime)
+	case protocol.OpSInitProducer:
+		c.processBinarySInitProducer(req, startTime)
+	case protocol.OpSTxnCommit:
+		c.processBinarySTxnCommit(req, startTime)
+	case protocol.OpSCopyStart:
+		c.processBinarySCopyStart(req, startTime)
+	case protocol.OpSCopyStop:
+		c.processBinarySCopyStop(req, startTime)
+	case protocol.OpSCopyDelete:
+		c.processBinarySCopyDelete(req, startTime)
+	case protocol.OpSCopyList:
+		c.processBinarySCopyList(req, startTime)
+	case protocol.OpSHeartbeat:
+		c.processBinarySHeartbeat(req, startTime)
+	case protocol.OpSAssignment:
+		c.processBinarySAssignment(req, startTime)
+	case protocol.OpPublish:
+		c.processBinaryPublish(req, startTime)
+	case protocol.OpSubscribe, protocol.OpPSubscribe, protocol.OpUnsubscribe, protocol.OpPUnsubscribe:
+		c.processBinarySubscribe(req, startTime)
+	case protocol.OpPubSubChannels:
+		c.processBinaryPubSubChannels(req, startTime)
 	case protocol.OpDocInsert:
 		log.Printf("[BINARY] Routing to DocInsert handler")
 		c.processBinaryDocInsert(req, startTime)
@@ -717,6 +783,7 @@ func (s *Server) Stop() error {
 
 // Stats returns server statistics
 func (s *Server) Stats() map[string]interface{} {
+	ps := s.pubsub.Stats()
 	return map[string]interface{}{
 		"active_connections": s.activeConns.Load(),
 		"ops_processed":      s.opsProcessed.Load(),
@@ -728,6 +795,12 @@ func (s *Server) Stats() map[string]interface{} {
 		"jobs_processed":     s.workerPool.jobsProcessed.Load(),
 		"job_queue_len":      len(s.jobQueue),
 		"job_queue_cap":      cap(s.jobQueue),
+		"pubsub_channels":    ps.Channels,
+		"pubsub_patterns":    ps.Patterns,
+		"pubsub_subscribers": ps.Subscribers,
+		"pubsub_published":   ps.Published,
+		"pubsub_delivered":   ps.Delivered,
+		"pubsub_dropped":     ps.Dropped,
 	}
 }
 
@@ -740,3 +813,8 @@ func (s *Server) GetKVStore() *kv.KVStore {
 func (s *Server) GetQueue() *queue.Queue {
 	return s.queue
 }
+
+// GetPubSub returns the Pub/Sub hub
+func (s *Server) GetPubSub() *pubsub.Hub {
+	return s.pubsub
+}
@@ -2,29 +2,247 @@ package server
 
 import (
 	"encoding/binary"
+	"fmt"
 	"time"
 
+	"github.com/skshohagmiah/flin/internal/headercodec"
 	"github.com/skshohagmiah/flin/internal/protocol"
+	"github.com/skshohagmiah/flin/internal/storage"
+	"github.com/skshohagmiah/flin/internal/stream"
 )
 
 // Stream operation handlers
 
 func (c *Connection) processBinarySPublish(req *protocol.Request, startTime time.Time) {
-	_, err := c.server.stream.Publish(req.Topic, req.Partition, req.Key, req.Value)
+	records := publishRecords([]string{req.Key}, [][]byte{req.Value}, req.RecordMetas)
+	partition, offsets, err := c.server.stream.PublishIdempotent(req.Topic, req.Partition, records, req.ProducerID, req.Sequence)
 	if err != nil {
 		c.sendBinaryError(err)
 		c.server.opsErrors.Add(1)
 		return
 	}
 
-	// For now, just return OK. Ideally we return the offset.
+	// Encode: [4:partition][8:offset]
+	buf := make([]byte, 12)
+	binary.BigEndian.PutUint32(buf, uint32(partition))
+	binary.BigEndian.PutUint64(buf[4:], uint64(offsets[0]))
+
+	c.sendBinaryResponse(protocol.EncodeValueResponse(buf), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
+
+func (c *Connection) processBinarySMPublish(req *protocol.Request, startTime time.Time) {
+	records := publishRecords(req.Keys, req.Values, req.RecordMetas)
+
+	partition, offsets, err := c.server.stream.PublishIdempotent(req.Topic, req.Partition, records, req.ProducerID, req.Sequence)
+	if err != nil {
+		c.sendBinaryError(err)
+		c.server.opsErrors.Add(1)
+		return
+	}
+
+	// Encode: [4:partition][2:count][8:offset]...
+	buf := make([]byte, 4+2+8*len(offsets))
+	binary.BigEndian.PutUint32(buf, uint32(partition))
+	binary.BigEndian.PutUint16(buf[4:], uint16(len(offsets)))
+	pos := 6
+	for _, offset := range offsets {
+		binary.BigEndian.PutUint64(buf[pos:], uint64(offset))
+		pos += 8
+	}
+
+	c.sendBinaryResponse(protocol.EncodeValueResponse(buf), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
+
+func (c *Connection) processBinarySInitProducer(req *protocol.Request, startTime time.Time) {
+	id, err := c.server.stream.InitProducer()
+	if err != nil {
+		c.sendBinaryError(err)
+		c.server.opsErrors.Add(1)
+		return
+	}
+
+	// Encode: [8:producerID]
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, id)
+
+	c.sendBinaryResponse(protocol.EncodeValueResponse(buf), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
+
+func (c *Connection) processBinarySTxnCommit(req *protocol.Request, startTime time.Time) {
+	txn := &stream.Transaction{
+		ProducerID: req.ProducerID,
+		Sequence:   req.Sequence,
+		Group:      req.Group,
+		ConsumerID: req.Consumer,
+		Records:    make([]stream.TxnRecord, len(req.TxnRecords)),
+		Offsets:    make([]stream.TxnOffset, len(req.TxnOffsets)),
+	}
+	for i, r := range req.TxnRecords {
+		txn.Records[i] = stream.TxnRecord{
+			Topic:     r.Topic,
+			Partition: r.Partition,
+			Key:       r.Key,
+			Value:     r.Value,
+			EventTime: r.EventTime,
+			Headers:   r.Headers,
+		}
+	}
+	for i, o := range req.TxnOffsets {
+		txn.Offsets[i] = stream.TxnOffset{Topic: o.Topic, Partition: o.Partition, Offset: o.Offset}
+	}
+
+	results, err := c.server.stream.CommitTransaction(txn)
+	if err != nil {
+		c.sendBinaryError(err)
+		c.server.opsErrors.Add(1)
+		return
+	}
+
+	// Encode: [4:count][for each record: [4:partition][8:offset]]
+	buf := make([]byte, 4+12*len(results))
+	binary.BigEndian.PutUint32(buf, uint32(len(results)))
+	pos := 4
+	for _, r := range results {
+		binary.BigEndian.PutUint32(buf[pos:], uint32(r.Partition))
+		binary.BigEndian.PutUint64(buf[pos+4:], uint64(r.Offset))
+		pos += 12
+	}
+
+	c.sendBinaryResponse(protocol.EncodeValueResponse(buf), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
+
+func (c *Connection) processBinarySCopyStart(req *protocol.Request, startTime time.Time) {
+	err := c.server.stream.StartCopy(stream.CopyConfig{
+		Name:        req.Key,
+		Source:      req.Topic,
+		Target:      req.Target,
+		TargetAddr:  req.TargetAddr,
+		StartOffset: req.Offset,
+		EndOffset:   req.EndOffset,
+	})
+	if err != nil {
+		c.sendBinaryError(err)
+		c.server.opsErrors.Add(1)
+		return
+	}
+
+	c.sendBinaryResponse(protocol.EncodeOKResponse(), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
+
+func (c *Connection) processBinarySCopyStop(req *protocol.Request, startTime time.Time) {
+	if err := c.server.stream.StopCopy(req.Key); err != nil {
+		c.sendBinaryError(err)
+		c.server.opsErrors.Add(1)
+		return
+	}
+
+	c.sendBinaryResponse(protocol.EncodeOKResponse(), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
+
+func (c *Connection) processBinarySCopyDelete(req *protocol.Request, startTime time.Time) {
+	if err := c.server.stream.DeleteCopy(req.Key); err != nil {
+		c.sendBinaryError(err)
+		c.server.opsErrors.Add(1)
+		return
+	}
+
 	c.sendBinaryResponse(protocol.EncodeOKResponse(), startTime)
 	c.server.opsProcessed.Add(1)
 	c.server.opsFastPath.Add(1)
 }
 
+func (c *Connection) processBinarySCopyList(req *protocol.Request, startTime time.Time) {
+	jobs, err := c.server.stream.ListCopyJobs()
+	if err != nil {
+		c.sendBinaryError(err)
+		c.server.opsErrors.Add(1)
+		return
+	}
+
+	// Each value: [2:name][2:source][2:target][2:addr][8:start][8:end]
+	// [2:state][2:error][8:copied][8:lag], strings length-prefixed
+	values := make([][]byte, len(jobs))
+	for i, j := range jobs {
+		head := []string{j.Name, j.Source, j.Target, j.TargetAddr}
+		tail := []string{j.State, j.Error}
+		size := 16 + 16
+		for _, str := range append(head, tail...) {
+			size += 2 + len(str)
+		}
+
+		buf := make([]byte, size)
+		pos := 0
+		putString := func(str string) {
+			binary.BigEndian.PutUint16(buf[pos:], uint16(len(str)))
+			pos += 2
+			copy(buf[pos:], str)
+			pos += len(str)
+		}
+		for _, str := range head {
+			putString(str)
+		}
+		binary.BigEndian.PutUint64(buf[pos:], uint64(j.StartOffset))
+		binary.BigEndian.PutUint64(buf[pos+8:], uint64(j.EndOffset))
+		pos += 16
+		for _, str := range tail {
+			putString(str)
+		}
+		binary.BigEndian.PutUint64(buf[pos:], uint64(j.Copied))
+		binary.BigEndian.PutUint64(buf[pos+8:], uint64(j.Lag))
+		values[i] = buf
+	}
+
+	c.sendBinaryResponse(protocol.EncodeMultiValueResponse(values), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
+
+// publishRecords builds storage records from a publish request's parallel
+// keys, values and optional metadata
+func publishRecords(keys []string, values [][]byte, metas []protocol.RecordMeta) []storage.Record {
+	records := make([]storage.Record, len(values))
+	for i := range values {
+		records[i] = storage.Record{Key: keys[i], Value: values[i]}
+		if i < len(metas) {
+			records[i].EventTime = metas[i].EventTime
+			records[i].Headers = metas[i].Headers
+		}
+	}
+	return records
+}
+
 func (c *Connection) processBinarySConsume(req *protocol.Request, startTime time.Time) {
+	if req.MaxWaitMs > 0 || req.Filter != "" {
+		// Long-poll: the response is sent from whichever append or timer
+		// completes the request, so the read loop is not blocked
+		opts := stream.ConsumeOptions{
+			MaxWait:  time.Duration(req.MaxWaitMs) * time.Millisecond,
+			MinBytes: req.MinBytes,
+			Filter:   req.Filter,
+		}
+		c.server.stream.ConsumeAsync(req.Topic, req.Group, req.Consumer, req.Count, opts, func(msgs []*storage.Message, err error) {
+			c.sendConsumeResult(msgs, err, startTime)
+		})
+		return
+	}
+
 	msgs, err := c.server.stream.Consume(req.Topic, req.Group, req.Consumer, req.Count)
+	c.sendConsumeResult(msgs, err, startTime)
+}
+
+func (c *Connection) sendConsumeResult(msgs []*storage.Message, err error, startTime time.Time) {
 	if err != nil {
 		c.sendBinaryError(err)
 		c.server.opsErrors.Add(1)
@@ -33,26 +251,7 @@ func (c *Connection) processBinarySConsume(req *protocol.Request, startTime time
 
 	values := make([][]byte, len(msgs))
 	for i, msg := range msgs {
-		// Encode message: [8:offset][8:timestamp][2:keyLen][key][4:valueLen][value]
-		keyLen := len(msg.Key)
-		valLen := len(msg.Value)
-		size := 8 + 8 + 2 + keyLen + 4 + valLen
-		buf := make([]byte, size)
-
-		pos := 0
-		binary.BigEndian.PutUint64(buf[pos:], uint64(msg.Offset))
-		pos += 8
-		binary.BigEndian.PutUint64(buf[pos:], uint64(msg.Timestamp))
-		pos += 8
-		binary.BigEndian.PutUint16(buf[pos:], uint16(keyLen))
-		pos += 2
-		copy(buf[pos:], msg.Key)
-		pos += keyLen
-		binary.BigEndian.PutUint32(buf[pos:], uint32(valLen))
-		pos += 4
-		copy(buf[pos:], msg.Value)
-
-		values[i] = buf
+		values[i] = encodeStreamMessage(msg)
 	}
 
 	c.sendBinaryResponse(protocol.EncodeMultiValueResponse(values), startTime)
@@ -60,9 +259,40 @@ func (c *Connection) processBinarySConsume(req *protocol.Request, startTime time
 	c.server.opsFastPath.Add(1)
 }
 
+// encodeStreamMessage encodes [8:offset][8:timestamp][2:keyLen][key][4:valueLen][value][4:partition]
+// [8:eventTime][headers]
+func encodeStreamMessage(msg *storage.Message) []byte {
+	keyLen := len(msg.Key)
+	valLen := len(msg.Value)
+	headers := headercodec.Encode(msg.Headers)
+	size := 8 + 8 + 2 + keyLen + 4 + valLen + 4 + 8 + len(headers)
+	buf := make([]byte, size)
+
+	pos := 0
+	binary.BigEndian.PutUint64(buf[pos:], uint64(msg.Offset))
+	pos += 8
+	binary.BigEndian.PutUint64(buf[pos:], uint64(msg.Timestamp))
+	pos += 8
+	binary.BigEndian.PutUint16(buf[pos:], uint16(keyLen))
+	pos += 2
+	copy(buf[pos:], msg.Key)
+	pos += keyLen
+	binary.BigEndian.PutUint32(buf[pos:], uint32(valLen))
+	pos += 4
+	copy(buf[pos:], msg.Value)
+	pos += valLen
+	binary.BigEndian.PutUint32(buf[pos:], uint32(msg.Partition))
+	pos += 4
+	binary.BigEndian.PutUint64(buf[pos:], uint64(msg.EventTime))
+	pos += 8
+	copy(buf[pos:], headers)
+
+	return buf
+}
+
 func (c *Connection) processBinarySCommit(req *protocol.Request, startTime time.Time) {
 	// req.RetentionMs holds the offset (hack from decoder)
-	err := c.server.stream.Commit(req.Topic, req.Group, req.Partition, req.RetentionMs)
+	err := c.server.stream.CommitAs(req.Topic, req.Group, req.Consumer, req.Partition, req.RetentionMs)
 	if err != nil {
 		c.sendBinaryError(err)
 		c.server.opsErrors.Add(1)
@@ -75,7 +305,14 @@ func (c *Connection) processBinarySCommit(req *protocol.Request, startTime time.
 }
 
 func (c *Connection) processBinarySCreateTopic(req *protocol.Request, startTime time.Time) {
-	err := c.server.stream.CreateTopic(req.Topic, req.Partition, req.RetentionMs)
+	err := c.server.stream.CreateTopicWithConfig(req.Topic, stream.TopicConfig{
+		Partitions:     req.Partition,
+		RetentionMs:    req.RetentionMs,
+		RetentionBytes: req.RetentionBytes,
+		CleanupPolicy:  req.CleanupPolicy,
+		Compression:    req.Compression,
+		Partitioner:    req.Partitioner,
+	})
 	if err != nil {
 		c.sendBinaryError(err)
 		c.server.opsErrors.Add(1)
@@ -88,7 +325,12 @@ func (c *Connection) processBinarySCreateTopic(req *protocol.Request, startTime
 }
 
 func (c *Connection) processBinarySSubscribe(req *protocol.Request, startTime time.Time) {
-	err := c.server.stream.Subscribe(req.Topic, req.Group, req.Consumer)
+	opts := stream.SubscribeOptions{
+		SessionTimeout: time.Duration(req.SessionTimeoutMs) * time.Millisecond,
+		Strategy:       req.Strategy,
+		Filter:         req.Filter,
+	}
+	err := c.server.stream.SubscribeWithOptions(req.Topic, req.Group, req.Consumer, opts)
 	if err != nil {
 		c.sendBinaryError(err)
 		c.server.opsErrors.Add(1)
@@ -112,3 +354,291 @@ func (c *Connection) processBinarySUnsubscribe(req *protocol.Request, startTime
 	c.server.opsProcessed.Add(1)
 	c.server.opsFastPath.Add(1)
 }
+
+func (c *Connection) processBinarySHeartbeat(req *protocol.Request, startTime time.Time) {
+	generation, err := c.server.stream.Heartbeat(req.Topic, req.Group, req.Consumer)
+	if err != nil {
+		c.sendBinaryError(err)
+		c.server.opsErrors.Add(1)
+		return
+	}
+
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, generation)
+
+	c.sendBinaryResponse(protocol.EncodeValueResponse(buf), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
+
+func (c *Connection) processBinarySAssignment(req *protocol.Request, startTime time.Time) {
+	assignment, err := c.server.stream.Assignment(req.Topic, req.Group, req.Consumer)
+	if err != nil {
+		c.sendBinaryError(err)
+		c.server.opsErrors.Add(1)
+		return
+	}
+
+	// Encode: [8:generation][2:strategyLen][strategy][2:count][4:partition]...
+	strategyLen := len(assignment.Strategy)
+	buf := make([]byte, 8+2+strategyLen+2+4*len(assignment.Partitions))
+
+	pos := 0
+	binary.BigEndian.PutUint64(buf[pos:], assignment.Generation)
+	pos += 8
+	binary.BigEndian.PutUint16(buf[pos:], uint16(strategyLen))
+	pos += 2
+	copy(buf[pos:], assignment.Strategy)
+	pos += strategyLen
+	binary.BigEndian.PutUint16(buf[pos:], uint16(len(assignment.Partitions)))
+	pos += 2
+	for _, p := range assignment.Partitions {
+		binary.BigEndian.PutUint32(buf[pos:], uint32(p))
+		pos += 4
+	}
+
+	c.sendBinaryResponse(protocol.EncodeValueResponse(buf), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
+
+func (c *Connection) processBinarySSeek(req *protocol.Request, startTime time.Time) {
+	var err error
+	switch req.SeekMode {
+	case protocol.SeekOffset:
+		err = c.server.stream.Seek(req.Group, req.Topic, req.Partition, req.Offset)
+	case protocol.SeekBeginning:
+		err = c.server.stream.SeekToBeginning(req.Group, req.Topic, req.Partition)
+	case protocol.SeekEnd:
+		err = c.server.stream.SeekToEnd(req.Group, req.Topic, req.Partition)
+	case protocol.SeekTimestamp:
+		err = c.server.stream.SeekToTimestamp(req.Group, req.Topic, req.Partition, req.Offset)
+	default:
+		err = fmt.Errorf("unknown seek mode: %d", req.SeekMode)
+	}
+	if err != nil {
+		c.sendBinaryError(err)
+		c.server.opsErrors.Add(1)
+		return
+	}
+
+	c.sendBinaryResponse(protocol.EncodeOKResponse(), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
+
+func (c *Connection) processBinarySListTopics(req *protocol.Request, startTime time.Time) {
+	topics, err := c.server.stream.ListTopics()
+	if err != nil {
+		c.sendBinaryError(err)
+		c.server.opsErrors.Add(1)
+		return
+	}
+
+	values := make([][]byte, len(topics))
+	for i, meta := range topics {
+		values[i] = encodeTopicInfo(meta)
+	}
+
+	c.sendBinaryResponse(protocol.EncodeMultiValueResponse(values), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
+
+func (c *Connection) processBinarySDescribe(req *protocol.Request, startTime time.Time) {
+	desc, err := c.server.stream.DescribeTopic(req.Key)
+	if err != nil {
+		c.sendBinaryError(err)
+		c.server.opsErrors.Add(1)
+		return
+	}
+
+	// First value is the topic, then one value per partition:
+	// [4:partition][8:earliest][8:latest][8:messages][8:bytes]
+	values := make([][]byte, 0, 1+len(desc.Partitions))
+	values = append(values, encodeTopicInfo(desc.Metadata))
+	for _, p := range desc.Partitions {
+		buf := make([]byte, 4+8+8+8+8)
+		binary.BigEndian.PutUint32(buf, uint32(p.Partition))
+		binary.BigEndian.PutUint64(buf[4:], uint64(p.EarliestOffset))
+		binary.BigEndian.PutUint64(buf[12:], uint64(p.LatestOffset))
+		binary.BigEndian.PutUint64(buf[20:], uint64(p.Messages))
+		binary.BigEndian.PutUint64(buf[28:], uint64(p.Bytes))
+		values = append(values, buf)
+	}
+
+	c.sendBinaryResponse(protocol.EncodeMultiValueResponse(values), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
+
+func (c *Connection) processBinarySDeleteTopic(req *protocol.Request, startTime time.Time) {
+	err := c.server.stream.DeleteTopic(req.Key)
+	if err != nil {
+		c.sendBinaryError(err)
+		c.server.opsErrors.Add(1)
+		return
+	}
+
+	c.sendBinaryResponse(protocol.EncodeOKResponse(), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
+
+func (c *Connection) processBinarySAddParts(req *protocol.Request, startTime time.Time) {
+	total, err := c.server.stream.AddPartitions(req.Key, req.Count)
+	if err != nil {
+		c.sendBinaryError(err)
+		c.server.opsErrors.Add(1)
+		return
+	}
+
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, uint32(total))
+
+	c.sendBinaryResponse(protocol.EncodeValueResponse(buf), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
+
+func (c *Connection) processBinarySGetOffsets(req *protocol.Request, startTime time.Time) {
+	offsets, err := c.server.stream.GetOffsets(req.Key)
+	if err != nil {
+		c.sendBinaryError(err)
+		c.server.opsErrors.Add(1)
+		return
+	}
+
+	values := make([][]byte, len(offsets))
+	for i, o := range offsets {
+		// Encode: [4:partition][8:earliest][8:latest]
+		buf := make([]byte, 4+8+8)
+		binary.BigEndian.PutUint32(buf, uint32(o.Partition))
+		binary.BigEndian.PutUint64(buf[4:], uint64(o.Earliest))
+		binary.BigEndian.PutUint64(buf[12:], uint64(o.Latest))
+		values[i] = buf
+	}
+
+	c.sendBinaryResponse(protocol.EncodeMultiValueResponse(values), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
+
+func (c *Connection) processBinarySListGroups(req *protocol.Request, startTime time.Time) {
+	groups, err := c.server.stream.ListGroups()
+	if err != nil {
+		c.sendBinaryError(err)
+		c.server.opsErrors.Add(1)
+		return
+	}
+
+	values := make([][]byte, len(groups))
+	for i, g := range groups {
+		// Encode: [2:nameLen][name][4:members][8:generation][2:strategyLen][strategy][2:topicCount]([2:topicLen][topic])...
+		size := 2 + len(g.Name) + 4 + 8 + 2 + len(g.Strategy) + 2
+		for _, t := range g.Topics {
+			size += 2 + len(t)
+		}
+		buf := make([]byte, size)
+
+		pos := 0
+		binary.BigEndian.PutUint16(buf[pos:], uint16(len(g.Name)))
+		pos += 2
+		copy(buf[pos:], g.Name)
+		pos += len(g.Name)
+		binary.BigEndian.PutUint32(buf[pos:], uint32(g.Members))
+		pos += 4
+		binary.BigEndian.PutUint64(buf[pos:], g.Generation)
+		pos += 8
+		binary.BigEndian.PutUint16(buf[pos:], uint16(len(g.Strategy)))
+		pos += 2
+		copy(buf[pos:], g.Strategy)
+		pos += len(g.Strategy)
+		binary.BigEndian.PutUint16(buf[pos:], uint16(len(g.Topics)))
+		pos += 2
+		for _, t := range g.Topics {
+			binary.BigEndian.PutUint16(buf[pos:], uint16(len(t)))
+			pos += 2
+			copy(buf[pos:], t)
+			pos += len(t)
+		}
+		values[i] = buf
+	}
+
+	c.sendBinaryResponse(protocol.EncodeMultiValueResponse(values), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
+
+func (c *Connection) processBinarySGroupLag(req *protocol.Request, startTime time.Time) {
+	lags, err := c.server.stream.GroupLag(req.Key)
+	if err != nil {
+		c.sendBinaryError(err)
+		c.server.opsErrors.Add(1)
+		return
+	}
+
+	values := make([][]byte, len(lags))
+	for i, l := range lags {
+		// Encode: [2:topicLen][topic][4:partition][8:committed][8:highWatermark][8:lag][8:lastCommit][2:consumerLen][consumer]
+		buf := make([]byte, 2+len(l.Topic)+4+8+8+8+8+2+len(l.Consumer))
+
+		pos := 0
+		binary.BigEndian.PutUint16(buf[pos:], uint16(len(l.Topic)))
+		pos += 2
+		copy(buf[pos:], l.Topic)
+		pos += len(l.Topic)
+		binary.BigEndian.PutUint32(buf[pos:], uint32(l.Partition))
+		pos += 4
+		binary.BigEndian.PutUint64(buf[pos:], uint64(l.Committed))
+		pos += 8
+		binary.BigEndian.PutUint64(buf[pos:], uint64(l.HighWatermark))
+		pos += 8
+		binary.BigEndian.PutUint64(buf[pos:], uint64(l.Lag))
+		pos += 8
+		binary.BigEndian.PutUint64(buf[pos:], uint64(l.LastCommit))
+		pos += 8
+		binary.BigEndian.PutUint16(buf[pos:], uint16(len(l.Consumer)))
+		pos += 2
+		copy(buf[pos:], l.Consumer)
+		values[i] = buf
+	}
+
+	c.sendBinaryResponse(protocol.EncodeMultiValueResponse(values), startTime)
+	c.server.opsProcessed.Add(1)
+	c.server.opsFastPath.Add(1)
+}
+
+// encodeTopicInfo encodes [2:nameLen][name][4:partitions][8:retentionMs][8:retentionBytes][8:createdAt]
+// [2:policyLen][policy][2:compressionLen][compression][2:partitionerLen][partitioner]
+func encodeTopicInfo(meta *storage.TopicMetadata) []byte {
+	nameLen := len(meta.Name)
+	buf := make([]byte, 2+nameLen+4+8+8+8+2+len(meta.CleanupPolicy)+2+len(meta.Compression)+2+len(meta.Partitioner))
+
+	pos := 0
+	binary.BigEndian.PutUint16(buf[pos:], uint16(nameLen))
+	pos += 2
+	copy(buf[pos:], meta.Name)
+	pos += nameLen
+	binary.BigEndian.PutUint32(buf[pos:], uint32(meta.Partitions))
+	pos += 4
+	binary.BigEndian.PutUint64(buf[pos:], uint64(meta.RetentionMs))
+	pos += 8
+	binary.BigEndian.PutUint64(buf[pos:], uint64(meta.RetentionBytes))
+	pos += 8
+	binary.BigEndian.PutUint64(buf[pos:], uint64(meta.CreatedAt))
+	pos += 8
+	binary.BigEndian.PutUint16(buf[pos:], uint16(len(meta.CleanupPolicy)))
+	pos += 2
+	copy(buf[pos:], meta.CleanupPolicy)
+	pos += len(meta.CleanupPolicy)
+	binary.BigEndian.PutUint16(buf[pos:], uint16(len(meta.Compression)))
+	pos += 2
+	copy(buf[pos:], meta.Compression)
+	pos += len(meta.Compression)
+	binary.BigEndian.PutUint16(buf[pos:], uint16(len(meta.Partitioner)))
+	pos += 2
+	copy(buf[pos:], meta.Partitioner)
+
+	return buf
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression codecs for stream topics
+const (
+	CompressionNone   = "none"
+	CompressionSnappy = "snappy"
+	CompressionZstd   = "zstd"
+	CompressionGzip   = "gzip"
+)
+
+// Codec IDs stored with each message; codecNone must stay 0 so messages
+// written before compression existed decode unchanged
+const (
+	codecNone byte = iota
+	codecSnappy
+	codecZstd
+	codecGzip
+)
+
+var (
+	// zstd encoders and decoders are safe for concurrent EncodeAll/DecodeAll
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// ValidCompression reports whether name is a supported codec
+func ValidCompression(name string) bool {
+	_, ok := codecID(name)
+	return ok
+}
+
+func codecID(name string) (byte, bool) {
+	switch name {
+	case "", CompressionNone:
+		return codecNone, true
+	case CompressionSnappy:
+		return codecSnappy, true
+	case CompressionZstd:
+		return codecZstd, true
+	case CompressionGzip:
+		return codecGzip, true
+	}
+	return 0, false
+}
+
+// compressValue compresses value with codec. It returns codecNone and the
+// original value when compression would not make it smaller.
+func compressValue(codec byte, value []byte) (byte, []byte) {
+	if codec == codecNone || len(value) == 0 {
+		return codecNone, value
+	}
+
+	var out []byte
+	switch codec {
+	case codecSnappy:
+		out = snappy.Encode(nil, value)
+	case codecZstd:
+		out = zstdEncoder.EncodeAll(value, nil)
+	case codecGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(value); err != nil {
+			return codecNone, value
+		}
+		if err := w.Close(); err != nil {
+			return codecNone, value
+		}
+		out = buf.Bytes()
+	}
+
+	if len(out) >= len(value) {
+		return codecNone, value
+	}
+	return codec, out
+}
+
+func decompressValue(codec byte, data []byte) ([]byte, error) {
+	switch codec {
+	case codecNone:
+		return data, nil
+	case codecSnappy:
+		return snappy.Decode(nil, data)
+	case codecZstd:
+		return zstdDecoder.DecodeAll(data, nil)
+	case codecGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	}
+	return nil, fmt.Errorf("unknown compression codec %d", codec)
+}
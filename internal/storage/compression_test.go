@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestMessageCompressionRoundTrip tests that messages encoded with each
+// codec decode to the original message, and that compressed values are
+// stored smaller
+func TestMessageCompressionRoundTrip(t *testing.T) {
+	compressible := bytes.Repeat([]byte("flin stream "), 100)
+
+	values := []struct {
+		name       string
+		value      []byte
+		compressed bool
+	}{
+		{"compressible", compressible, true},
+		{"short", []byte("x"), false},
+		{"empty", nil, false},
+	}
+
+	for _, name := range []string{CompressionNone, CompressionSnappy, CompressionZstd, CompressionGzip} {
+		codec, ok := codecID(name)
+		if !ok {
+			t.Fatalf("Expected %s to be a valid codec", name)
+		}
+
+		for _, v := range values {
+			for _, headers := range []map[string]string{nil, {"trace": "abc"}} {
+				msg := &Message{Offset: 7, Timestamp: 1000, Key: "k", Value: v.value, Headers: headers}
+				label := name + "/" + v.name
+				if headers != nil {
+					label += "/headers"
+				}
+
+				t.Run(label, func(t *testing.T) {
+					data := encodeMessage(msg, codec)
+					if want := v.compressed && codec != codecNone; (len(data) < len(v.value)) != want {
+						t.Errorf("Expected compressed %v, stored %d bytes for %d", want, len(data), len(v.value))
+					}
+
+					got, err := decodeMessage(data)
+					if err != nil {
+						t.Fatalf("Failed to decode: %v", err)
+					}
+					if got.Offset != msg.Offset || got.Timestamp != msg.Timestamp || got.Key != msg.Key {
+						t.Errorf("Expected %d/%d/%q, got %d/%d/%q", msg.Offset, msg.Timestamp, msg.Key, got.Offset, got.Timestamp, got.Key)
+					}
+					if !bytes.Equal(got.Value, msg.Value) {
+						t.Errorf("Expected value of %d bytes back, got %d", len(msg.Value), len(got.Value))
+					}
+					if len(got.Headers) != len(headers) || got.Headers["trace"] != headers["trace"] {
+						t.Errorf("Expected headers %v, got %v", headers, got.Headers)
+					}
+				})
+			}
+		}
+	}
+
+	// A compressed value with an unknown codec is an error, not garbage
+	data := encodeMessage(&Message{Value: compressible}, codecZstd)
+	data[len(data)-1] = 99
+	if _, err := decodeMessage(data); err == nil {
+		t.Error("Expected an unknown codec to fail to decode")
+	}
+}
+
+// TestCompressedTopic tests that messages appended to a compressed topic
+// are fetched decompressed
+func TestCompressedTopic(t *testing.T) {
+	s := createTestStreamStorage(t)
+	value := bytes.Repeat([]byte("abc"), 200)
+
+	for _, name := range []string{CompressionSnappy, CompressionZstd, CompressionGzip} {
+		t.Run(name, func(t *testing.T) {
+			if err := s.CreateTopic(&TopicMetadata{Name: name, Partitions: 1, Compression: name}); err != nil {
+				t.Fatalf("Failed to create topic: %v", err)
+			}
+			if _, err := s.AppendMessages(name, 0, []Record{{Key: "k", Value: value}, {Key: "t"}}); err != nil {
+				t.Fatalf("Failed to append: %v", err)
+			}
+
+			msgs, err := s.FetchMessages(name, 0, 0, 10)
+			if err != nil {
+				t.Fatalf("Failed to fetch: %v", err)
+			}
+			if len(msgs) != 2 || !bytes.Equal(msgs[0].Value, value) || len(msgs[1].Value) != 0 {
+				t.Errorf("Expected the value and a tombstone back, got %d messages", len(msgs))
+			}
+		})
+	}
+}
@@ -94,26 +94,30 @@ func (ds *DocStorage) Exists(key string) (bool, error) {
 // Scan iterates over all keys with the given prefix
 func (ds *DocStorage) Scan(prefix string, fn func(key string, value []byte) error) error {
 	return ds.db.View(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions
-		opts.Prefix = []byte(prefix)
-		it := txn.NewIterator(opts)
-		defer it.Close()
+		return scanPrefix(txn, prefix, fn)
+	})
+}
 
-		for it.Seek([]byte(prefix)); it.Valid(); it.Next() {
-			item := it.Item()
-			key := string(item.Key())
+func scanPrefix(txn *badger.Txn, prefix string, fn func(key string, value []byte) error) error {
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = []byte(prefix)
+	it := txn.NewIterator(opts)
+	defer it.Close()
 
-			data, err := item.ValueCopy(nil)
-			if err != nil {
-				return err
-			}
+	for it.Seek([]byte(prefix)); it.Valid(); it.Next() {
+		item := it.Item()
+		key := string(item.Key())
 
-			if err := fn(key, data); err != nil {
-				return err
-			}
+		data, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
 		}
-		return nil
-	})
+
+		if err := fn(key, data); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Count returns the number of keys with the given prefix
@@ -177,3 +181,69 @@ func (ds *DocStorage) GetJSON(key string, dest interface{}) error {
 
 	return json.Unmarshal(data, dest)
 }
+
+// DocTxn reads and writes several keys in one transaction, so a document
+// and the keys derived from it never disagree
+type DocTxn struct {
+	txn *badger.Txn
+}
+
+// View runs fn in a read-only transaction
+func (ds *DocStorage) View(fn func(tx *DocTxn) error) error {
+	return ds.db.View(func(txn *badger.Txn) error {
+		return fn(&DocTxn{txn: txn})
+	})
+}
+
+// Update runs fn in a read-write transaction, committing its writes only
+// if fn returns nil
+func (ds *DocStorage) Update(fn func(tx *DocTxn) error) error {
+	return ds.db.Update(func(txn *badger.Txn) error {
+		return fn(&DocTxn{txn: txn})
+	})
+}
+
+// Get retrieves a value by key, returning badger.ErrKeyNotFound if absent
+func (tx *DocTxn) Get(key string) ([]byte, error) {
+	item, err := tx.txn.Get([]byte(key))
+	if err != nil {
+		return nil, err
+	}
+	return item.ValueCopy(nil)
+}
+
+// Set stores a value with the given key
+func (tx *DocTxn) Set(key string, data []byte) error {
+	return tx.txn.Set([]byte(key), data)
+}
+
+// Delete removes a key
+func (tx *DocTxn) Delete(key string) error {
+	return tx.txn.Delete([]byte(key))
+}
+
+// Scan iterates over all keys with the given prefix
+func (tx *DocTxn) Scan(prefix string, fn func(key string, value []byte) error) error {
+	return scanPrefix(tx.txn, prefix, fn)
+}
+
+// Keys visits the keys with the given prefix in order, starting at the
+// first key not less than start, until fn returns false. Values are not
+// read.
+func (tx *DocTxn) Keys(prefix, start string, fn func(key string) bool) error {
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = []byte(prefix)
+	opts.PrefetchValues = false
+	it := tx.txn.NewIterator(opts)
+	defer it.Close()
+
+	if start < prefix {
+		start = prefix
+	}
+	for it.Seek([]byte(start)); it.Valid(); it.Next() {
+		if !fn(string(it.Item().Key())) {
+			break
+		}
+	}
+	return nil
+}
@@ -1,29 +1,88 @@
 package storage
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/dgraph-io/badger/v4"
+	"github.com/skshohagmiah/flin/internal/headercodec"
 )
 
 var (
-	ErrQueueEmpty   = errors.New("queue is empty")
-	ErrInvalidQueue = errors.New("invalid queue name")
+	ErrQueueEmpty    = errors.New("queue is empty")
+	ErrItemNotFound  = errors.New("queue item not found")
+	ErrInvalidQueue  = errors.New("invalid queue name")
+	ErrQueueExists   = errors.New("queue already exists")
+	ErrQueueNotFound = errors.New("queue not found")
 )
 
+// DefaultDedupWindow is how long a dedup ID is remembered after a push
+const DefaultDedupWindow = 5 * time.Minute
+
 // QueueStorage implements BadgerDB-backed queue storage
 type QueueStorage struct {
-	db *badger.DB
+	db          *badger.DB
+	dedupWindow time.Duration
+	// mu is held for reading by every write and exclusively while Delete
+	// removes a queue's last keys, so no push lands after the sweep
+	mu sync.RWMutex
 }
 
-// QueueMetadata stores head and tail pointers for a queue
+// QueueMetadata stores head and tail pointers and counters for a queue
 type QueueMetadata struct {
-	Head uint64 // Next item to dequeue
-	Tail uint64 // Next position to enqueue
+	Head      uint64 // Next item to dequeue
+	Tail      uint64 // Next position to enqueue
+	Enqueued  uint64 // Total items ever pushed
+	Dequeued  uint64 // Total items ever popped
+	Removed   uint64 // Items removed between Head and Tail
+	CreatedAt int64  // Unix milliseconds
+}
+
+// QueueMessage is a queue item together with its envelope
+type QueueMessage struct {
+	ID            uint64 // Sequence number within the queue
+	EnqueuedAt    int64  // Unix milliseconds, 0 for items stored before envelopes
+	DeliveryCount uint32 // Times the item was handed out, counting this one
+	Headers       map[string]string
+	Value         []byte
+}
+
+// PushOptions holds optional settings for PushMessage
+type PushOptions struct {
+	DedupID string
+	Headers map[string]string
 }
 
+// QueueInfo describes a queue in the registry
+type QueueInfo struct {
+	Name      string
+	Depth     uint64
+	CreatedAt int64
+}
+
+// QueueStats holds per-queue counters
+type QueueStats struct {
+	Name        string
+	Depth       uint64
+	Enqueued    uint64
+	Dequeued    uint64
+	OldestAgeMs int64 // Age of the head item, 0 when empty
+	CreatedAt   int64
+}
+
+const (
+	legacyMetadataSize = 16
+	metadataSize       = 48
+	metadataPrefix     = "queue:meta:"
+)
+
 // NewQueueStorage creates a new BadgerDB-backed queue storage
 func NewQueueStorage(path string) (*QueueStorage, error) {
 	opts := badger.DefaultOptions(path)
@@ -48,7 +107,14 @@ func NewQueueStorage(path string) (*QueueStorage, error) {
 		return nil, err
 	}
 
-	return &QueueStorage{db: db}, nil
+	return &QueueStorage{db: db, dedupWindow: DefaultDedupWindow}, nil
+}
+
+// SetDedupWindow sets how long dedup IDs are remembered
+func (q *QueueStorage) SetDedupWindow(window time.Duration) {
+	if window > 0 {
+		q.dedupWindow = window
+	}
 }
 
 // Close closes the BadgerDB connection
@@ -58,7 +124,7 @@ func (q *QueueStorage) Close() error {
 
 // metadataKey returns the key for storing queue metadata
 func metadataKey(queueName string) []byte {
-	return []byte(fmt.Sprintf("queue:meta:%s", queueName))
+	return []byte(metadataPrefix + queueName)
 }
 
 // dataKey returns the key for storing a queue item
@@ -66,6 +132,37 @@ func dataKey(queueName string, seqID uint64) []byte {
 	return []byte(fmt.Sprintf("queue:data:%s:%020d", queueName, seqID))
 }
 
+// dataPrefix returns the key prefix for all items of a queue
+func dataPrefix(queueName string) []byte {
+	return []byte(fmt.Sprintf("queue:data:%s:", queueName))
+}
+
+// isItemKey reports whether key under a queue's dataPrefix is one of its
+// items rather than an item of a queue whose name extends it, such as
+// "jobs:high" for "jobs"
+func isItemKey(prefix, key []byte) bool {
+	if len(key) != len(prefix)+20 {
+		return false
+	}
+	for _, c := range key[len(prefix):] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// dedupKey returns the key remembering a dedup ID. The NUL after the queue
+// name keeps the IDs of "jobs" apart from those of "jobs:high".
+func dedupKey(queueName, dedupID string) []byte {
+	return []byte(fmt.Sprintf("queue:dedup:%s\x00%s", queueName, dedupID))
+}
+
+// dedupPrefix returns the key prefix for all dedup IDs of a queue
+func dedupPrefix(queueName string) []byte {
+	return []byte(fmt.Sprintf("queue:dedup:%s\x00", queueName))
+}
+
 // getMetadata retrieves the metadata for a queue
 func (q *QueueStorage) getMetadata(txn *badger.Txn, queueName string) (*QueueMetadata, error) {
 	key := metadataKey(queueName)
@@ -81,15 +178,7 @@ func (q *QueueStorage) getMetadata(txn *badger.Txn, queueName string) (*QueueMet
 
 	var meta *QueueMetadata
 	err = item.Value(func(val []byte) error {
-		if len(val) != 16 {
-			meta = &QueueMetadata{Head: 0, Tail: 0}
-			return nil
-		}
-
-		meta = &QueueMetadata{
-			Head: binary.BigEndian.Uint64(val[0:8]),
-			Tail: binary.BigEndian.Uint64(val[8:16]),
-		}
+		meta = decodeMetadata(val)
 		return nil
 	})
 
@@ -100,23 +189,99 @@ func (q *QueueStorage) getMetadata(txn *badger.Txn, queueName string) (*QueueMet
 	return meta, nil
 }
 
+// decodeMetadata parses a metadata value, accepting the legacy head/tail-only layout
+func decodeMetadata(val []byte) *QueueMetadata {
+	switch len(val) {
+	case metadataSize:
+		return &QueueMetadata{
+			Head:      binary.BigEndian.Uint64(val[0:8]),
+			Tail:      binary.BigEndian.Uint64(val[8:16]),
+			Enqueued:  binary.BigEndian.Uint64(val[16:24]),
+			Dequeued:  binary.BigEndian.Uint64(val[24:32]),
+			Removed:   binary.BigEndian.Uint64(val[32:40]),
+			CreatedAt: int64(binary.BigEndian.Uint64(val[40:48])),
+		}
+	case legacyMetadataSize:
+		head := binary.BigEndian.Uint64(val[0:8])
+		tail := binary.BigEndian.Uint64(val[8:16])
+		return &QueueMetadata{Head: head, Tail: tail, Enqueued: tail, Dequeued: head}
+	default:
+		return &QueueMetadata{Head: 0, Tail: 0}
+	}
+}
+
 // setMetadata stores the metadata for a queue
 func (q *QueueStorage) setMetadata(txn *badger.Txn, queueName string, meta *QueueMetadata) error {
 	key := metadataKey(queueName)
-	data := make([]byte, 16)
+	if meta.CreatedAt == 0 {
+		meta.CreatedAt = time.Now().UnixMilli()
+	}
+
+	data := make([]byte, metadataSize)
 	binary.BigEndian.PutUint64(data[0:8], meta.Head)
 	binary.BigEndian.PutUint64(data[8:16], meta.Tail)
+	binary.BigEndian.PutUint64(data[16:24], meta.Enqueued)
+	binary.BigEndian.PutUint64(data[24:32], meta.Dequeued)
+	binary.BigEndian.PutUint64(data[32:40], meta.Removed)
+	binary.BigEndian.PutUint64(data[40:48], uint64(meta.CreatedAt))
 
 	return txn.Set(key, data)
 }
 
+// exists reports whether a queue has a metadata entry
+func (q *QueueStorage) exists(txn *badger.Txn, queueName string) (bool, error) {
+	_, err := txn.Get(metadataKey(queueName))
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // Push adds an item to the end of the queue
 func (q *QueueStorage) Push(queueName string, value []byte) error {
+	_, _, err := q.PushMessage(queueName, value, PushOptions{})
+	return err
+}
+
+// PushDedup adds an item unless dedupID was already pushed within the dedup window.
+// It returns the item's sequence number and whether the push was a duplicate;
+// for duplicates the sequence number is the one assigned to the original item.
+func (q *QueueStorage) PushDedup(queueName string, value []byte, dedupID string) (uint64, bool, error) {
+	return q.PushMessage(queueName, value, PushOptions{DedupID: dedupID})
+}
+
+// PushMessage adds an item with optional headers and dedup ID to the end of the queue.
+// It returns the item's sequence number and whether the push was a duplicate.
+func (q *QueueStorage) PushMessage(queueName string, value []byte, opts PushOptions) (uint64, bool, error) {
 	if queueName == "" {
-		return ErrInvalidQueue
+		return 0, false, ErrInvalidQueue
 	}
 
-	return q.db.Update(func(txn *badger.Txn) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	var seq uint64
+	var duplicate bool
+	err := q.db.Update(func(txn *badger.Txn) error {
+		if opts.DedupID != "" {
+			item, err := txn.Get(dedupKey(queueName, opts.DedupID))
+			if err == nil {
+				duplicate = true
+				return item.Value(func(val []byte) error {
+					if len(val) == 8 {
+						seq = binary.BigEndian.Uint64(val)
+					}
+					return nil
+				})
+			}
+			if err != badger.ErrKeyNotFound {
+				return err
+			}
+		}
+
 		// Get current metadata
 		meta, err := q.getMetadata(txn, queueName)
 		if err != nil {
@@ -124,24 +289,179 @@ func (q *QueueStorage) Push(queueName string, value []byte) error {
 		}
 
 		// Store the item
-		itemKey := dataKey(queueName, meta.Tail)
-		if err := txn.Set(itemKey, value); err != nil {
+		seq = meta.Tail
+		if err := q.setItem(txn, queueName, seq, value, opts.Headers); err != nil {
 			return err
 		}
 
+		if opts.DedupID != "" {
+			data := make([]byte, 8)
+			binary.BigEndian.PutUint64(data, seq)
+			entry := badger.NewEntry(dedupKey(queueName, opts.DedupID), data).WithTTL(q.dedupWindow)
+			if err := txn.SetEntry(entry); err != nil {
+				return err
+			}
+		}
+
 		// Update metadata
 		meta.Tail++
+		meta.Enqueued++
+		return q.setMetadata(txn, queueName, meta)
+	})
+
+	return seq, duplicate, err
+}
+
+// PushBatch adds several items to the end of the queue with a single metadata update
+func (q *QueueStorage) PushBatch(queueName string, values [][]byte) error {
+	if queueName == "" {
+		return ErrInvalidQueue
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	return q.db.Update(func(txn *badger.Txn) error {
+		meta, err := q.getMetadata(txn, queueName)
+		if err != nil {
+			return err
+		}
+
+		for _, value := range values {
+			if err := q.setItem(txn, queueName, meta.Tail, value, nil); err != nil {
+				return err
+			}
+			meta.Tail++
+		}
+
+		meta.Enqueued += uint64(len(values))
 		return q.setMetadata(txn, queueName, meta)
 	})
 }
 
+// setItem stores a value wrapped in a message envelope at seqID
+func (q *QueueStorage) setItem(txn *badger.Txn, queueName string, seqID uint64, value []byte, headers map[string]string) error {
+	msg := &QueueMessage{
+		ID:         seqID,
+		EnqueuedAt: time.Now().UnixMilli(),
+		Headers:    headers,
+		Value:      value,
+	}
+	return txn.Set(dataKey(queueName, seqID), encodeQueueMessage(msg))
+}
+
+// getItem loads the item stored at seqID
+func (q *QueueStorage) getItem(txn *badger.Txn, queueName string, seqID uint64) (*QueueMessage, error) {
+	item, err := txn.Get(dataKey(queueName, seqID))
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeQueueMessage(seqID, data), nil
+}
+
+// firstItem returns the oldest item still in the queue, skipping removed ones
+func (q *QueueStorage) firstItem(txn *badger.Txn, queueName string, meta *QueueMetadata) (*QueueMessage, error) {
+	msgs, err := q.scanItems(txn, queueName, meta, meta.Head, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, ErrQueueEmpty
+	}
+	return msgs[0], nil
+}
+
+// scanItems returns up to limit items with sequence numbers in [fromSeq, Tail)
+func (q *QueueStorage) scanItems(txn *badger.Txn, queueName string, meta *QueueMetadata, fromSeq uint64, limit int) ([]*QueueMessage, error) {
+	if fromSeq < meta.Head {
+		fromSeq = meta.Head
+	}
+
+	prefix := dataPrefix(queueName)
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = prefix
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	msgs := make([]*QueueMessage, 0, limit)
+	endKey := dataKey(queueName, meta.Tail)
+
+	for it.Seek(dataKey(queueName, fromSeq)); it.ValidForPrefix(prefix) && len(msgs) < limit; it.Next() {
+		item := it.Item()
+		if string(item.Key()) >= string(endKey) {
+			break
+		}
+
+		seq, err := strconv.ParseUint(string(item.Key()[len(prefix):]), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		data, err := item.ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, decodeQueueMessage(seq, data))
+	}
+
+	return msgs, nil
+}
+
 // Pop removes and returns the first item from the queue
 func (q *QueueStorage) Pop(queueName string) ([]byte, error) {
+	msg, err := q.PopMessage(queueName)
+	if err != nil {
+		return nil, err
+	}
+	return msg.Value, nil
+}
+
+// PopMessage removes and returns the first item from the queue with its envelope
+func (q *QueueStorage) PopMessage(queueName string) (*QueueMessage, error) {
+	msgs, err := q.popMessages(queueName, 1)
+	if err != nil {
+		return nil, err
+	}
+	return msgs[0], nil
+}
+
+// PopBatch removes and returns up to n items from the front of the queue
+// with a single metadata update. It returns ErrQueueEmpty if no items are available.
+func (q *QueueStorage) PopBatch(queueName string, n int) ([][]byte, error) {
+	msgs, err := q.popMessages(queueName, n)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([][]byte, len(msgs))
+	for i, msg := range msgs {
+		values[i] = msg.Value
+	}
+	return values, nil
+}
+
+// popMessages removes up to n items from the front of the queue in one transaction
+func (q *QueueStorage) popMessages(queueName string, n int) ([]*QueueMessage, error) {
 	if queueName == "" {
 		return nil, ErrInvalidQueue
 	}
+	if n <= 0 {
+		n = 1
+	}
 
-	var value []byte
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	var msgs []*QueueMessage
 	err := q.db.Update(func(txn *badger.Txn) error {
 		// Get current metadata
 		meta, err := q.getMetadata(txn, queueName)
@@ -150,42 +470,61 @@ func (q *QueueStorage) Pop(queueName string) ([]byte, error) {
 		}
 
 		// Check if queue is empty
-		if meta.Head >= meta.Tail {
+		count := meta.depth()
+		if count == 0 {
 			return ErrQueueEmpty
 		}
 
-		// Get the item
-		itemKey := dataKey(queueName, meta.Head)
-		item, err := txn.Get(itemKey)
-		if err != nil {
-			return err
+		if uint64(n) < count {
+			count = uint64(n)
 		}
 
-		value, err = item.ValueCopy(nil)
-		if err != nil {
-			return err
-		}
+		msgs = make([]*QueueMessage, 0, count)
+		for uint64(len(msgs)) < count && meta.Head < meta.Tail {
+			msg, err := q.getItem(txn, queueName, meta.Head)
+			if err == badger.ErrKeyNotFound && meta.Removed > 0 {
+				// Skip over an item deleted by Remove
+				meta.Head++
+				meta.Removed--
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			msg.DeliveryCount++
+			msgs = append(msgs, msg)
 
-		// Delete the item
-		if err := txn.Delete(itemKey); err != nil {
-			return err
+			// Delete the item
+			if err := txn.Delete(dataKey(queueName, meta.Head)); err != nil {
+				return err
+			}
+			meta.Head++
 		}
 
 		// Update metadata
-		meta.Head++
+		meta.Dequeued += uint64(len(msgs))
 		return q.setMetadata(txn, queueName, meta)
 	})
 
-	return value, err
+	return msgs, err
 }
 
 // Peek returns the first item without removing it
 func (q *QueueStorage) Peek(queueName string) ([]byte, error) {
+	msg, err := q.PeekMessage(queueName)
+	if err != nil {
+		return nil, err
+	}
+	return msg.Value, nil
+}
+
+// PeekMessage returns the first item with its envelope without removing it
+func (q *QueueStorage) PeekMessage(queueName string) (*QueueMessage, error) {
 	if queueName == "" {
 		return nil, ErrInvalidQueue
 	}
 
-	var value []byte
+	var msg *QueueMessage
 	err := q.db.View(func(txn *badger.Txn) error {
 		// Get current metadata
 		meta, err := q.getMetadata(txn, queueName)
@@ -194,22 +533,15 @@ func (q *QueueStorage) Peek(queueName string) ([]byte, error) {
 		}
 
 		// Check if queue is empty
-		if meta.Head >= meta.Tail {
+		if meta.depth() == 0 {
 			return ErrQueueEmpty
 		}
 
-		// Get the item
-		itemKey := dataKey(queueName, meta.Head)
-		item, err := txn.Get(itemKey)
-		if err != nil {
-			return err
-		}
-
-		value, err = item.ValueCopy(nil)
+		msg, err = q.firstItem(txn, queueName, meta)
 		return err
 	})
 
-	return value, err
+	return msg, err
 }
 
 // Len returns the number of items in the queue
@@ -225,21 +557,22 @@ func (q *QueueStorage) Len(queueName string) (uint64, error) {
 			return err
 		}
 
-		if meta.Tail > meta.Head {
-			length = meta.Tail - meta.Head
-		}
+		length = meta.depth()
 		return nil
 	})
 
 	return length, err
 }
 
-// Clear removes all items from the queue
+// Clear removes all items and remembered dedup IDs from the queue
 func (q *QueueStorage) Clear(queueName string) error {
 	if queueName == "" {
 		return ErrInvalidQueue
 	}
 
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
 	return q.db.Update(func(txn *badger.Txn) error {
 		// Get current metadata
 		meta, err := q.getMetadata(txn, queueName)
@@ -256,9 +589,372 @@ func (q *QueueStorage) Clear(queueName string) error {
 			}
 		}
 
+		// Forget dedup IDs, so items pushed again after a clear are kept
+		if err := deleteDedupKeys(txn, queueName); err != nil {
+			return err
+		}
+
 		// Reset metadata
 		meta.Head = 0
 		meta.Tail = 0
+		meta.Removed = 0
+		return q.setMetadata(txn, queueName, meta)
+	})
+}
+
+// deleteDedupKeys removes every dedup ID remembered for a queue
+func deleteDedupKeys(txn *badger.Txn, queueName string) error {
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = dedupPrefix(queueName)
+	opts.PrefetchValues = false
+	it := txn.NewIterator(opts)
+
+	var keys [][]byte
+	for it.Rewind(); it.Valid(); it.Next() {
+		keys = append(keys, it.Item().KeyCopy(nil))
+	}
+	it.Close()
+
+	for _, key := range keys {
+		if err := txn.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Create registers an empty queue. Queues are also created implicitly on Push.
+func (q *QueueStorage) Create(queueName string) error {
+	if queueName == "" {
+		return ErrInvalidQueue
+	}
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	return q.db.Update(func(txn *badger.Txn) error {
+		exists, err := q.exists(txn, queueName)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrQueueExists
+		}
+
+		return q.setMetadata(txn, queueName, &QueueMetadata{})
+	})
+}
+
+// Delete removes a queue from the registry with its items and dedup IDs.
+// Keys are deleted in bounded transactions and the metadata last, so a
+// failed delete can be retried.
+func (q *QueueStorage) Delete(queueName string) error {
+	if queueName == "" {
+		return ErrInvalidQueue
+	}
+
+	err := q.db.View(func(txn *badger.Txn) error {
+		exists, err := q.exists(txn, queueName)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrQueueNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	more := true
+	for more {
+		err = q.db.Update(func(txn *badger.Txn) error {
+			var err error
+			more, err = deleteQueueKeys(txn, queueName)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Sweep anything pushed meanwhile and drop the metadata with writes held
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		err = q.db.Update(func(txn *badger.Txn) error {
+			var err error
+			more, err = deleteQueueKeys(txn, queueName)
+			if err != nil || more {
+				return err
+			}
+			return txn.Delete(metadataKey(queueName))
+		})
+		if err != nil || !more {
+			return err
+		}
+	}
+}
+
+// deleteQueueKeys deletes up to deleteBatchSize item and dedup keys of a
+// queue and reports whether the batch filled, so more may remain
+func deleteQueueKeys(txn *badger.Txn, queueName string) (bool, error) {
+	var keys [][]byte
+
+	collect := func(prefix, last []byte, match func(key []byte) bool) {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid() && len(keys) < deleteBatchSize; it.Next() {
+			key := it.Item().Key()
+			if last != nil && bytes.Compare(key, last) > 0 {
+				break
+			}
+			if match == nil || match(key) {
+				keys = append(keys, it.Item().KeyCopy(nil))
+			}
+		}
+	}
+
+	// Item keys end in a 20-digit sequence number, so those of this queue
+	// lie between the prefix and the largest sequence number
+	prefix := dataPrefix(queueName)
+	collect(prefix, dataKey(queueName, math.MaxUint64), func(key []byte) bool {
+		return isItemKey(prefix, key)
+	})
+	collect(dedupPrefix(queueName), nil, nil)
+
+	for _, key := range keys {
+		if err := txn.Delete(key); err != nil {
+			return false, err
+		}
+	}
+	return len(keys) == deleteBatchSize, nil
+}
+
+// List returns every registered queue with its current depth
+func (q *QueueStorage) List() ([]QueueInfo, error) {
+	queues := make([]QueueInfo, 0)
+
+	err := q.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(metadataPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			name := strings.TrimPrefix(string(item.Key()), metadataPrefix)
+
+			err := item.Value(func(val []byte) error {
+				meta := decodeMetadata(val)
+				queues = append(queues, QueueInfo{
+					Name:      name,
+					Depth:     meta.depth(),
+					CreatedAt: meta.CreatedAt,
+				})
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return queues, err
+}
+
+// Stats returns the counters for a queue
+func (q *QueueStorage) Stats(queueName string) (*QueueStats, error) {
+	if queueName == "" {
+		return nil, ErrInvalidQueue
+	}
+
+	var stats *QueueStats
+	err := q.db.View(func(txn *badger.Txn) error {
+		exists, err := q.exists(txn, queueName)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrQueueNotFound
+		}
+
+		meta, err := q.getMetadata(txn, queueName)
+		if err != nil {
+			return err
+		}
+
+		stats = &QueueStats{
+			Name:      queueName,
+			Depth:     meta.depth(),
+			Enqueued:  meta.Enqueued,
+			Dequeued:  meta.Dequeued,
+			CreatedAt: meta.CreatedAt,
+		}
+
+		if meta.depth() == 0 {
+			return nil
+		}
+
+		// Age of the head item
+		msg, err := q.firstItem(txn, queueName, meta)
+		if err != nil {
+			return err
+		}
+		if msg.EnqueuedAt > 0 {
+			stats.OldestAgeMs = time.Now().UnixMilli() - msg.EnqueuedAt
+		}
+		return nil
+	})
+
+	return stats, err
+}
+
+// Range returns up to limit items starting at fromSeq without consuming them.
+// Sequence numbers below the head are clamped to the head; pass the last
+// returned ID plus one to fetch the next page.
+func (q *QueueStorage) Range(queueName string, fromSeq uint64, limit int) ([]*QueueMessage, error) {
+	if queueName == "" {
+		return nil, ErrInvalidQueue
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+
+	var msgs []*QueueMessage
+	err := q.db.View(func(txn *badger.Txn) error {
+		meta, err := q.getMetadata(txn, queueName)
+		if err != nil {
+			return err
+		}
+
+		msgs, err = q.scanItems(txn, queueName, meta, fromSeq, limit)
+		return err
+	})
+
+	return msgs, err
+}
+
+// Remove deletes the item with the given sequence number from anywhere in the queue
+func (q *QueueStorage) Remove(queueName string, seq uint64) error {
+	if queueName == "" {
+		return ErrInvalidQueue
+	}
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	return q.db.Update(func(txn *badger.Txn) error {
+		meta, err := q.getMetadata(txn, queueName)
+		if err != nil {
+			return err
+		}
+
+		if seq < meta.Head || seq >= meta.Tail {
+			return ErrItemNotFound
+		}
+
+		itemKey := dataKey(queueName, seq)
+		if _, err := txn.Get(itemKey); err != nil {
+			if err == badger.ErrKeyNotFound {
+				return ErrItemNotFound
+			}
+			return err
+		}
+
+		if err := txn.Delete(itemKey); err != nil {
+			return err
+		}
+
+		// Removing the head just advances it; anything else leaves a hole
+		// that Pop skips later
+		if seq == meta.Head {
+			meta.Head++
+		} else {
+			meta.Removed++
+		}
 		return q.setMetadata(txn, queueName, meta)
 	})
 }
+
+// depth returns the number of items between head and tail, excluding removed ones
+func (m *QueueMetadata) depth() uint64 {
+	if m.Tail > m.Head+m.Removed {
+		return m.Tail - m.Head - m.Removed
+	}
+	return 0
+}
+
+// Encoding/Decoding helpers
+
+// queueMessageMagic marks values stored in a message envelope; values without
+// it are raw items written before envelopes existed
+var queueMessageMagic = []byte{0xF1, 0x1E, 0x01}
+
+func encodeQueueMessage(msg *QueueMessage) []byte {
+	headers := headercodec.Encode(msg.Headers)
+
+	// Format: [3:magic][8:id][8:enqueuedAt][4:deliveryCount][headers][4:valueLen][value]
+	size := len(queueMessageMagic) + 8 + 8 + 4 + len(headers) + 4 + len(msg.Value)
+	data := make([]byte, size)
+	pos := copy(data, queueMessageMagic)
+
+	binary.BigEndian.PutUint64(data[pos:], msg.ID)
+	pos += 8
+	binary.BigEndian.PutUint64(data[pos:], uint64(msg.EnqueuedAt))
+	pos += 8
+	binary.BigEndian.PutUint32(data[pos:], msg.DeliveryCount)
+	pos += 4
+	pos += copy(data[pos:], headers)
+	binary.BigEndian.PutUint32(data[pos:], uint32(len(msg.Value)))
+	pos += 4
+	copy(data[pos:], msg.Value)
+
+	return data
+}
+
+// decodeQueueMessage parses an envelope, treating anything else as a raw legacy value
+func decodeQueueMessage(seqID uint64, data []byte) *QueueMessage {
+	legacy := &QueueMessage{ID: seqID, Value: data}
+
+	magicLen := len(queueMessageMagic)
+	if len(data) < magicLen+20 || string(data[:magicLen]) != string(queueMessageMagic) {
+		return legacy
+	}
+
+	msg := &QueueMessage{}
+	pos := magicLen
+
+	msg.ID = binary.BigEndian.Uint64(data[pos:])
+	pos += 8
+	msg.EnqueuedAt = int64(binary.BigEndian.Uint64(data[pos:]))
+	pos += 8
+	msg.DeliveryCount = binary.BigEndian.Uint32(data[pos:])
+	pos += 4
+
+	headers, n, err := headercodec.Decode(data[pos:])
+	if err != nil {
+		return legacy
+	}
+	msg.Headers = headers
+	pos += n
+
+	if len(data) < pos+4 {
+		return legacy
+	}
+	valueLen := int(binary.BigEndian.Uint32(data[pos:]))
+	pos += 4
+	if len(data) != pos+valueLen {
+		return legacy
+	}
+	msg.Value = data[pos : pos+valueLen]
+
+	return msg
+}
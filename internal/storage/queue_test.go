@@ -0,0 +1,459 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Helper function to create a test queue storage
+func createTestQueueStorage(t *testing.T) *QueueStorage {
+	q, err := NewQueueStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create queue storage: %v", err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+// TestQueueDeleteKeepsPrefixedQueues tests that deleting a queue leaves
+// queues whose names extend it untouched
+func TestQueueDeleteKeepsPrefixedQueues(t *testing.T) {
+	q := createTestQueueStorage(t)
+
+	for _, name := range []string{"jobs", "jobs:high", "jobs1"} {
+		if err := q.Create(name); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	// More items than one delete batch
+	for i := 0; i < deleteBatchSize+500; i++ {
+		if err := q.Push("jobs", []byte("job")); err != nil {
+			t.Fatalf("Failed to push: %v", err)
+		}
+	}
+	q.PushDedup("jobs", []byte("job"), "same")
+	q.PushDedup("jobs:high", []byte("high"), "same")
+	q.Push("jobs:high", []byte("high"))
+	q.Push("jobs1", []byte("one"))
+
+	if err := q.Delete("jobs"); err != nil {
+		t.Fatalf("Failed to delete queue: %v", err)
+	}
+
+	if _, err := q.Stats("jobs"); err != ErrQueueNotFound {
+		t.Errorf("Expected deleted queue to be gone, got %v", err)
+	}
+	msgs, _ := q.Range("jobs", 0, 10)
+	if len(msgs) != 0 {
+		t.Errorf("Expected no items left in deleted queue, got %d", len(msgs))
+	}
+
+	if n, _ := q.Len("jobs:high"); n != 2 {
+		t.Errorf("Expected jobs:high to keep 2 items, got %d", n)
+	}
+	if n, _ := q.Len("jobs1"); n != 1 {
+		t.Errorf("Expected jobs1 to keep 1 item, got %d", n)
+	}
+	if _, dup, _ := q.PushDedup("jobs:high", []byte("high"), "same"); !dup {
+		t.Error("Expected jobs:high to keep its dedup IDs")
+	}
+
+	// The deleted queue's dedup IDs are gone too
+	if _, dup, _ := q.PushDedup("jobs", []byte("job"), "same"); dup {
+		t.Error("Expected recreated queue to accept a previously seen dedup ID")
+	}
+}
+
+// TestQueueClearForgetsDedupIDs tests that an ID pushed before a clear is
+// accepted again after it
+func TestQueueClearForgetsDedupIDs(t *testing.T) {
+	q := createTestQueueStorage(t)
+
+	q.PushDedup("jobs", []byte("a"), "id-1")
+	if err := q.Clear("jobs"); err != nil {
+		t.Fatalf("Failed to clear: %v", err)
+	}
+
+	_, dup, err := q.PushDedup("jobs", []byte("a"), "id-1")
+	if err != nil {
+		t.Fatalf("Failed to push: %v", err)
+	}
+	if dup {
+		t.Error("Expected push after clear not to be a duplicate")
+	}
+	if n, _ := q.Len("jobs"); n != 1 {
+		t.Errorf("Expected 1 item after clear and push, got %d", n)
+	}
+}
+
+// TestQueueDedupWindow tests that a dedup ID pushed again within the
+// window returns the original item, and is accepted once the window ends
+func TestQueueDedupWindow(t *testing.T) {
+	q := createTestQueueStorage(t)
+	q.SetDedupWindow(time.Second)
+
+	tests := []struct {
+		name      string
+		queue     string
+		dedupID   string
+		wantSeq   uint64
+		duplicate bool
+	}{
+		{"first push", "jobs", "a", 0, false},
+		{"other id", "jobs", "b", 1, false},
+		{"repeated id", "jobs", "a", 0, true},
+		{"repeated other id", "jobs", "b", 1, true},
+		{"same id on another queue", "jobs:high", "a", 0, false},
+		{"no id", "jobs", "", 2, false},
+		{"no id again", "jobs", "", 3, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seq, dup, err := q.PushDedup(tt.queue, []byte(tt.name), tt.dedupID)
+			if err != nil {
+				t.Fatalf("Failed to push: %v", err)
+			}
+			if seq != tt.wantSeq || dup != tt.duplicate {
+				t.Errorf("Expected seq %d duplicate %v, got seq %d duplicate %v", tt.wantSeq, tt.duplicate, seq, dup)
+			}
+		})
+	}
+
+	if n, _ := q.Len("jobs"); n != 4 {
+		t.Errorf("Expected duplicates not to be stored, got %d items", n)
+	}
+
+	// Badger expires entries on whole seconds
+	time.Sleep(2 * time.Second)
+
+	seq, dup, err := q.PushDedup("jobs", []byte("again"), "a")
+	if err != nil {
+		t.Fatalf("Failed to push: %v", err)
+	}
+	if dup || seq != 4 {
+		t.Errorf("Expected an expired ID to push a new item, got seq %d duplicate %v", seq, dup)
+	}
+}
+
+// TestQueueMessageEnvelope tests decoding stored item values, both
+// envelopes and raw values written before envelopes existed
+func TestQueueMessageEnvelope(t *testing.T) {
+	envelope := encodeQueueMessage(&QueueMessage{
+		ID:            7,
+		EnqueuedAt:    1700000000000,
+		DeliveryCount: 2,
+		Headers:       map[string]string{"trace": "abc"},
+		Value:         []byte("payload"),
+	})
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    QueueMessage
+		headers int
+	}{
+		{"envelope", envelope, QueueMessage{ID: 7, EnqueuedAt: 1700000000000, DeliveryCount: 2, Value: []byte("payload")}, 1},
+		{"empty envelope", encodeQueueMessage(&QueueMessage{ID: 3}), QueueMessage{ID: 3, Value: []byte{}}, 0},
+		{"legacy value", []byte("plain"), QueueMessage{ID: 42, Value: []byte("plain")}, 0},
+		{"legacy empty value", []byte{}, QueueMessage{ID: 42, Value: []byte{}}, 0},
+		{"truncated envelope", envelope[:len(envelope)-1], QueueMessage{ID: 42, Value: envelope[:len(envelope)-1]}, 0},
+		{"magic only", queueMessageMagic, QueueMessage{ID: 42, Value: queueMessageMagic}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := decodeQueueMessage(42, tt.data)
+			if msg.ID != tt.want.ID || msg.EnqueuedAt != tt.want.EnqueuedAt || msg.DeliveryCount != tt.want.DeliveryCount {
+				t.Errorf("Expected ID %d enqueued %d delivered %d, got %d enqueued %d delivered %d",
+					tt.want.ID, tt.want.EnqueuedAt, tt.want.DeliveryCount, msg.ID, msg.EnqueuedAt, msg.DeliveryCount)
+			}
+			if string(msg.Value) != string(tt.want.Value) {
+				t.Errorf("Expected value %q, got %q", tt.want.Value, msg.Value)
+			}
+			if len(msg.Headers) != tt.headers {
+				t.Errorf("Expected %d headers, got %d", tt.headers, len(msg.Headers))
+			}
+		})
+	}
+
+	if msg := decodeQueueMessage(0, envelope); msg.Headers["trace"] != "abc" {
+		t.Errorf("Expected header trace=abc, got %v", msg.Headers)
+	}
+}
+
+// TestDecodeMetadata tests decoding queue metadata in the current layout
+// and in the legacy head/tail-only layout
+func TestDecodeMetadata(t *testing.T) {
+	legacy := make([]byte, legacyMetadataSize)
+	binary.BigEndian.PutUint64(legacy[0:8], 3)
+	binary.BigEndian.PutUint64(legacy[8:16], 10)
+
+	current := make([]byte, metadataSize)
+	for i, v := range []uint64{4, 12, 15, 6, 2, 1700000000000} {
+		binary.BigEndian.PutUint64(current[i*8:], v)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want QueueMetadata
+	}{
+		{"current", current, QueueMetadata{Head: 4, Tail: 12, Enqueued: 15, Dequeued: 6, Removed: 2, CreatedAt: 1700000000000}},
+		{"legacy", legacy, QueueMetadata{Head: 3, Tail: 10, Enqueued: 10, Dequeued: 3}},
+		{"empty", []byte{}, QueueMetadata{}},
+		{"unknown size", current[:24], QueueMetadata{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeMetadata(tt.data); *got != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, *got)
+			}
+		})
+	}
+}
+
+// TestQueueLegacyMetadata tests that a queue written before the registry
+// existed is listed, counted and consumed, and upgraded on its next write
+func TestQueueLegacyMetadata(t *testing.T) {
+	q := createTestQueueStorage(t)
+
+	err := q.db.Update(func(txn *badger.Txn) error {
+		meta := make([]byte, legacyMetadataSize)
+		binary.BigEndian.PutUint64(meta[0:8], 1)
+		binary.BigEndian.PutUint64(meta[8:16], 3)
+		if err := txn.Set(metadataKey("old"), meta); err != nil {
+			return err
+		}
+		for seq, value := range []string{"popped", "b", "c"} {
+			if err := txn.Set(dataKey("old", uint64(seq)), []byte(value)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to write legacy queue: %v", err)
+	}
+
+	queues, err := q.List()
+	if err != nil {
+		t.Fatalf("Failed to list: %v", err)
+	}
+	if len(queues) != 1 || queues[0].Name != "old" || queues[0].Depth != 2 {
+		t.Errorf("Expected old with depth 2, got %+v", queues)
+	}
+
+	stats, err := q.Stats("old")
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.Depth != 2 || stats.Enqueued != 3 || stats.Dequeued != 1 || stats.OldestAgeMs != 0 {
+		t.Errorf("Expected depth 2, 3 enqueued, 1 dequeued and no age, got %+v", stats)
+	}
+
+	if err := q.Create("old"); err != ErrQueueExists {
+		t.Errorf("Expected legacy queue to be registered, got %v", err)
+	}
+
+	value, err := q.Pop("old")
+	if err != nil || string(value) != "b" {
+		t.Fatalf("Expected to pop b, got %q (%v)", value, err)
+	}
+
+	stats, _ = q.Stats("old")
+	if stats.Depth != 1 || stats.Enqueued != 3 || stats.Dequeued != 2 || stats.CreatedAt == 0 {
+		t.Errorf("Expected upgraded counters after pop, got %+v", stats)
+	}
+}
+
+// TestQueueDeliveryCount tests that popping an item counts a delivery and
+// that browsing it does not
+func TestQueueDeliveryCount(t *testing.T) {
+	q := createTestQueueStorage(t)
+
+	if _, _, err := q.PushMessage("jobs", []byte("a"), PushOptions{Headers: map[string]string{"trace": "abc"}}); err != nil {
+		t.Fatalf("Failed to push: %v", err)
+	}
+
+	peeked, err := q.PeekMessage("jobs")
+	if err != nil {
+		t.Fatalf("Failed to peek: %v", err)
+	}
+	msgs, err := q.Range("jobs", 0, 10)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("Failed to range: %d items (%v)", len(msgs), err)
+	}
+	if peeked.DeliveryCount != 0 || msgs[0].DeliveryCount != 0 {
+		t.Errorf("Expected no deliveries before a pop, got %d and %d", peeked.DeliveryCount, msgs[0].DeliveryCount)
+	}
+
+	popped, err := q.PopMessage("jobs")
+	if err != nil {
+		t.Fatalf("Failed to pop: %v", err)
+	}
+	if popped.DeliveryCount != 1 || popped.Headers["trace"] != "abc" || popped.EnqueuedAt == 0 {
+		t.Errorf("Expected one delivery with its envelope, got %+v", popped)
+	}
+}
+
+// queueValues returns the values of a queue's items in order
+func queueValues(msgs []*QueueMessage) []string {
+	values := make([]string, len(msgs))
+	for i, m := range msgs {
+		values[i] = string(m.Value)
+	}
+	return values
+}
+
+// TestQueueRemove tests that removing the head, a middle item or the tail
+// keeps Len, Range and Pop consistent
+func TestQueueRemove(t *testing.T) {
+	tests := []struct {
+		name   string
+		remove []uint64
+		want   []string
+	}{
+		{"head", []uint64{0}, []string{"b", "c", "d", "e"}},
+		{"middle", []uint64{2}, []string{"a", "b", "d", "e"}},
+		{"tail", []uint64{4}, []string{"a", "b", "c", "d"}},
+		{"head after a hole", []uint64{1, 0}, []string{"c", "d", "e"}},
+		{"adjacent holes", []uint64{2, 3}, []string{"a", "b", "e"}},
+		{"all", []uint64{0, 1, 2, 3, 4}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := createTestQueueStorage(t)
+			for _, v := range []string{"a", "b", "c", "d", "e"} {
+				if err := q.Push("jobs", []byte(v)); err != nil {
+					t.Fatalf("Failed to push: %v", err)
+				}
+			}
+
+			for _, seq := range tt.remove {
+				if err := q.Remove("jobs", seq); err != nil {
+					t.Fatalf("Failed to remove %d: %v", seq, err)
+				}
+			}
+			if err := q.Remove("jobs", tt.remove[0]); err != ErrItemNotFound {
+				t.Errorf("Expected ErrItemNotFound removing %d twice, got %v", tt.remove[0], err)
+			}
+
+			if n, _ := q.Len("jobs"); n != uint64(len(tt.want)) {
+				t.Errorf("Expected length %d, got %d", len(tt.want), n)
+			}
+			msgs, err := q.Range("jobs", 0, 10)
+			if err != nil {
+				t.Fatalf("Failed to range: %v", err)
+			}
+			if got := queueValues(msgs); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Expected range %v, got %v", tt.want, got)
+			}
+
+			var popped []string
+			for {
+				value, err := q.Pop("jobs")
+				if err == ErrQueueEmpty {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Failed to pop: %v", err)
+				}
+				popped = append(popped, string(value))
+			}
+			if fmt.Sprint(popped) != fmt.Sprint(tt.want) {
+				t.Errorf("Expected pops %v, got %v", tt.want, popped)
+			}
+			if n, _ := q.Len("jobs"); n != 0 {
+				t.Errorf("Expected an empty queue, got length %d", n)
+			}
+
+			// Holes left behind must not hide later items
+			q.Push("jobs", []byte("f"))
+			if n, _ := q.Len("jobs"); n != 1 {
+				t.Errorf("Expected length 1 after a push, got %d", n)
+			}
+			if value, err := q.Pop("jobs"); err != nil || string(value) != "f" {
+				t.Errorf("Expected to pop f, got %q (%v)", value, err)
+			}
+		})
+	}
+}
+
+// TestQueueBatch tests that PushBatch and PopBatch keep FIFO order and
+// count items the same as single pushes and pops
+func TestQueueBatch(t *testing.T) {
+	q := createTestQueueStorage(t)
+
+	if err := q.Push("jobs", []byte("a")); err != nil {
+		t.Fatalf("Failed to push: %v", err)
+	}
+	if err := q.PushBatch("jobs", [][]byte{[]byte("b"), []byte("c"), []byte("d")}); err != nil {
+		t.Fatalf("Failed to push batch: %v", err)
+	}
+	if err := q.Push("jobs", []byte("e")); err != nil {
+		t.Fatalf("Failed to push: %v", err)
+	}
+
+	values, err := q.PopBatch("jobs", 2)
+	if err != nil {
+		t.Fatalf("Failed to pop batch: %v", err)
+	}
+	if got := fmt.Sprintf("%s", values); got != "[a b]" {
+		t.Errorf("Expected [a b], got %s", got)
+	}
+	if value, _ := q.Pop("jobs"); string(value) != "c" {
+		t.Errorf("Expected c, got %s", value)
+	}
+
+	// Asking for more than the depth returns what is there
+	values, err = q.PopBatch("jobs", 10)
+	if err != nil {
+		t.Fatalf("Failed to pop batch: %v", err)
+	}
+	if got := fmt.Sprintf("%s", values); got != "[d e]" {
+		t.Errorf("Expected [d e], got %s", got)
+	}
+	if _, err := q.PopBatch("jobs", 10); err != ErrQueueEmpty {
+		t.Errorf("Expected ErrQueueEmpty, got %v", err)
+	}
+
+	// The same items pushed and popped one at a time
+	single := createTestQueueStorage(t)
+	for _, v := range []string{"a", "b", "c", "d", "e"} {
+		single.Push("jobs", []byte(v))
+	}
+	for i := 0; i < 5; i++ {
+		single.Pop("jobs")
+	}
+
+	batched, err := q.Stats("jobs")
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	want, err := single.Stats("jobs")
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if batched.Depth != want.Depth || batched.Enqueued != want.Enqueued || batched.Dequeued != want.Dequeued {
+		t.Errorf("Expected counters %+v, got %+v", want, batched)
+	}
+	if batched.Enqueued != 5 || batched.Dequeued != 5 {
+		t.Errorf("Expected 5 enqueued and 5 dequeued, got %d and %d", batched.Enqueued, batched.Dequeued)
+	}
+
+	// An empty batch is a no-op
+	if err := q.PushBatch("jobs", nil); err != nil {
+		t.Errorf("Expected an empty batch to succeed, got %v", err)
+	}
+	if n, _ := q.Len("jobs"); n != 0 {
+		t.Errorf("Expected an empty queue, got length %d", n)
+	}
+}
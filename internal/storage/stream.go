@@ -1,23 +1,51 @@
 package storage
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/dgraph-io/badger/v4"
+	"github.com/skshohagmiah/flin/internal/headercodec"
 )
 
+var (
+	ErrTopicNotFound      = errors.New("topic not found")
+	ErrDuplicateSequence  = errors.New("duplicate sequence number")
+	ErrOutOfOrderSequence = errors.New("out of order sequence number")
+)
+
+// deleteBatchSize bounds the number of keys removed per transaction
+const deleteBatchSize = 1000
+
 // StreamStorage provides persistent storage for stream messages using BadgerDB
 // Key format:
 //   - Messages: stream:msg:{topic}:{partition}:{offset}
 //   - Offsets: stream:offset:{topic}:{partition}
-//   - Consumer offsets: stream:consumer:{group}:{topic}:{partition}
+//   - Consumer offsets: stream:committed:{len(topic)}:{topic}:{group}:{partition}
 //   - Topic metadata: stream:meta:{topic}
+//   - Consumer groups: stream:group:{group}
+//   - Producer state: stream:producer:{id}:{topic},
+//     stream:partproducer:{id}:{partition}:{topic}, stream:txnseq:{id}
 type StreamStorage struct {
 	db *badger.DB
 	mu sync.RWMutex
+
+	// Append watchers keyed by partition message prefix
+	watchers map[string]map[*watcher]struct{}
+	watchMu  sync.Mutex
+}
+
+// watcher is a one-shot callback for new messages on one or more partitions
+type watcher struct {
+	fn   func()
+	once sync.Once
 }
 
 // Message represents a stream message
@@ -28,6 +56,9 @@ type Message struct {
 	Key       string
 	Value     []byte
 	Timestamp int64
+	// EventTime is the producer-supplied time in Unix milliseconds, 0 if unset
+	EventTime int64
+	Headers   map[string]string
 }
 
 // TopicMetadata stores topic configuration
@@ -37,6 +68,46 @@ type TopicMetadata struct {
 	RetentionMs    int64 // Retention time in milliseconds
 	RetentionBytes int64 // Max bytes per partition
 	CreatedAt      int64
+	CleanupPolicy  string
+	// Compression is the codec for message values written to the topic;
+	// existing messages keep the codec they were written with
+	Compression string
+	// Partitioner picks the partition for records published without one
+	Partitioner string
+}
+
+// Cleanup policies
+const (
+	// CleanupDelete drops messages past RetentionMs or RetentionBytes
+	CleanupDelete = "delete"
+	// CleanupCompact keeps only the latest message per key
+	CleanupCompact = "compact"
+	// CleanupCompactDelete compacts and also applies retention limits
+	CleanupCompactDelete = "compact,delete"
+)
+
+// Partitioners
+const (
+	// PartitionerFNV hashes keys with FNV-1a; keyless records go round-robin
+	PartitionerFNV = "fnv"
+	// PartitionerMurmur2 hashes keys like Kafka's default partitioner;
+	// keyless records go round-robin
+	PartitionerMurmur2 = "murmur2"
+	// PartitionerRoundRobin spreads records evenly, ignoring keys
+	PartitionerRoundRobin = "roundrobin"
+	// PartitionerSticky hashes keys with murmur2 and sends keyless records
+	// to one partition until a batch fills, then moves to the next
+	PartitionerSticky = "sticky"
+)
+
+// Compacts reports whether the topic's policy includes compaction
+func (m *TopicMetadata) Compacts() bool {
+	return m.CleanupPolicy == CleanupCompact || m.CleanupPolicy == CleanupCompactDelete
+}
+
+// Deletes reports whether the topic's policy includes retention deletes
+func (m *TopicMetadata) Deletes() bool {
+	return m.CleanupPolicy != CleanupCompact
 }
 
 // ConsumerOffset tracks consumer group progress
@@ -48,6 +119,85 @@ type ConsumerOffset struct {
 	UpdatedAt int64
 }
 
+// PartitionStats describes the retained log of one partition
+type PartitionStats struct {
+	Partition int
+	// EarliestOffset is the oldest retained message
+	EarliestOffset int64
+	// LatestOffset is the next offset to be written
+	LatestOffset int64
+	Messages     int64
+	Bytes        int64
+}
+
+// TopicDescription is a topic's metadata with per-partition stats
+type TopicDescription struct {
+	Metadata   *TopicMetadata
+	Partitions []PartitionStats
+}
+
+// Record is a message to append to a partition
+type Record struct {
+	Key       string
+	Value     []byte
+	EventTime int64
+	Headers   map[string]string
+}
+
+// GroupState is the persisted form of a consumer group
+type GroupState struct {
+	Name             string
+	Topic            string
+	Members          []GroupMember
+	Generation       uint64
+	SessionTimeoutMs int64
+	Strategy         string
+}
+
+// TxnRecord is a record bound for a resolved partition inside a transaction
+type TxnRecord struct {
+	Topic     string
+	Partition int
+	Record
+}
+
+// TxnResult is where a transaction's record was written
+type TxnResult struct {
+	Partition int
+	Offset    int64
+}
+
+// Transaction atomically appends records and commits consumer offsets.
+// A non-zero ProducerID makes it idempotent: Sequence must be one more
+// than the producer's last committed transaction, or equal to it for a
+// retry of that transaction.
+type Transaction struct {
+	ProducerID uint64
+	Sequence   uint64
+	Records    []TxnRecord
+	Offsets    []ConsumerOffset
+}
+
+// GroupMember is a consumer and its assigned partitions
+type GroupMember struct {
+	ID         string
+	Partitions []int
+	Filter     string // Subscription filter expression, empty for none
+}
+
+// CopyJobState is the persisted form of a topic copy job. Its progress is
+// kept separately as consumer offsets.
+type CopyJobState struct {
+	Name        string
+	Source      string
+	Target      string
+	TargetAddr  string
+	StartOffset int64
+	EndOffset   int64
+	State       string
+	Error       string
+}
+
 // NewStreamStorage creates a new stream storage instance
 func NewStreamStorage(path string) (*StreamStorage, error) {
 	opts := badger.DefaultOptions(path)
@@ -58,65 +208,497 @@ func NewStreamStorage(path string) (*StreamStorage, error) {
 		return nil, fmt.Errorf("failed to open badger: %w", err)
 	}
 
-	return &StreamStorage{
-		db: db,
-	}, nil
+	s := &StreamStorage{
+		db:       db,
+		watchers: make(map[string]map[*watcher]struct{}),
+	}
+	if err := s.migrateConsumerOffsets(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate consumer offsets: %w", err)
+	}
+	return s, nil
+}
+
+// migrateConsumerOffsets moves committed offsets stored under the legacy
+// stream:consumer:{group}:{topic}:{partition} keys, where a ':' in the
+// group or topic leaves the split ambiguous. Each key goes to the longest
+// existing topic it ends with; keys of deleted topics are dropped.
+func (s *StreamStorage) migrateConsumerOffsets() error {
+	topics, err := s.ListTopics()
+	if err != nil {
+		return err
+	}
+	sort.Slice(topics, func(i, j int) bool { return len(topics[i].Name) > len(topics[j].Name) })
+
+	prefix := []byte(legacyConsumerOffsetPrefix)
+	for {
+		var keys, values [][]byte
+		err := s.db.View(func(txn *badger.Txn) error {
+			opts := badger.DefaultIteratorOptions
+			opts.Prefix = prefix
+			it := txn.NewIterator(opts)
+			defer it.Close()
+
+			for it.Rewind(); it.ValidForPrefix(prefix) && len(keys) < deleteBatchSize; it.Next() {
+				val, err := it.Item().ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				keys = append(keys, it.Item().KeyCopy(nil))
+				values = append(values, val)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+
+		err = s.db.Update(func(txn *badger.Txn) error {
+			for i, key := range keys {
+				if newKey, ok := migrateConsumerOffsetKey(string(key[len(prefix):]), topics); ok {
+					if err := txn.Set([]byte(newKey), values[i]); err != nil {
+						return err
+					}
+				}
+				if err := txn.Delete(key); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// migrateConsumerOffsetKey returns the key for a legacy
+// {group}:{topic}:{partition} key, trying topics longest first
+func migrateConsumerOffsetKey(rest string, topics []*TopicMetadata) (string, bool) {
+	head, partition, ok := parseGroupPartition(rest)
+	if !ok {
+		return "", false
+	}
+	for _, t := range topics {
+		if strings.HasSuffix(head, ":"+t.Name) {
+			group := strings.TrimSuffix(head, ":"+t.Name)
+			return makeConsumerOffsetKey(group, t.Name, partition), true
+		}
+	}
+	return "", false
 }
 
-// AppendMessage appends a message to a topic partition and returns the assigned offset
+// AppendMessage appends a message to a partition and returns its offset
 func (s *StreamStorage) AppendMessage(topic string, partition int, key string, value []byte) (int64, error) {
+	offsets, err := s.AppendMessages(topic, partition, []Record{{Key: key, Value: value}})
+	if err != nil {
+		return 0, err
+	}
+	return offsets[0], nil
+}
+
+// AppendMessages appends records to a partition in a single transaction
+// and returns their offsets
+func (s *StreamStorage) AppendMessages(topic string, partition int, records []Record) ([]int64, error) {
+	if len(records) == 0 {
+		return []int64{}, nil
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	var offset int64
+	var offsets []int64
 	err := s.db.Update(func(txn *badger.Txn) error {
-		// Get current offset for this partition
-		offsetKey := makeOffsetKey(topic, partition)
-		item, err := txn.Get([]byte(offsetKey))
-		if err == badger.ErrKeyNotFound {
-			offset = 0
-		} else if err != nil {
+		var err error
+		offsets, err = appendInTxn(txn, topic, partition, records, time.Now().UnixMilli())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.notify(topic, partition)
+	return offsets, nil
+}
+
+// AppendMessagesIdempotent appends records on behalf of a producer.
+// sequence numbers the batch's first record; a producer's batches for a
+// topic must be consecutive. Resending the producer's last batch returns
+// its original partition and offsets without appending again.
+func (s *StreamStorage) AppendMessagesIdempotent(topic string, partition int, records []Record, producerID, sequence uint64) (int, []int64, error) {
+	return s.appendIdempotent([]byte(makeProducerKey(producerID, topic)), topic, partition, records, sequence)
+}
+
+// AppendPartitionIdempotent is AppendMessagesIdempotent with the
+// producer's batches numbered per partition rather than per topic, as
+// Kafka producers number them
+func (s *StreamStorage) AppendPartitionIdempotent(topic string, partition int, records []Record, producerID, sequence uint64) ([]int64, error) {
+	_, offsets, err := s.appendIdempotent([]byte(makePartitionProducerKey(producerID, topic, partition)), topic, partition, records, sequence)
+	return offsets, err
+}
+
+// appendIdempotent appends records unless they repeat the last batch
+// recorded under stateKey
+func (s *StreamStorage) appendIdempotent(stateKey []byte, topic string, partition int, records []Record, sequence uint64) (int, []int64, error) {
+	if len(records) == 0 {
+		return partition, []int64{}, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var offsets []int64
+	duplicate := false
+	err := s.db.Update(func(txn *badger.Txn) error {
+		// State: [8:baseSeq][4:count][4:partition][8:firstOffset]
+		item, err := txn.Get(stateKey)
+		if err != nil && err != badger.ErrKeyNotFound {
+			return err
+		}
+		if err == nil {
+			var state []byte
+			if state, err = item.ValueCopy(nil); err != nil {
+				return err
+			}
+			if len(state) < 24 {
+				return fmt.Errorf("invalid producer state")
+			}
+			lastSeq := binary.BigEndian.Uint64(state[0:8])
+			lastCount := uint64(binary.BigEndian.Uint32(state[8:12]))
+
+			switch {
+			case sequence == lastSeq && uint64(len(records)) == lastCount:
+				duplicate = true
+				partition = int(binary.BigEndian.Uint32(state[12:16]))
+				first := int64(binary.BigEndian.Uint64(state[16:24]))
+				offsets = make([]int64, len(records))
+				for i := range offsets {
+					offsets[i] = first + int64(i)
+				}
+				return nil
+			case sequence < lastSeq+lastCount:
+				return ErrDuplicateSequence
+			case sequence > lastSeq+lastCount:
+				return ErrOutOfOrderSequence
+			}
+		}
+
+		offsets, err = appendInTxn(txn, topic, partition, records, time.Now().UnixMilli())
+		if err != nil {
+			return err
+		}
+
+		state := make([]byte, 24)
+		binary.BigEndian.PutUint64(state[0:8], sequence)
+		binary.BigEndian.PutUint32(state[8:12], uint32(len(records)))
+		binary.BigEndian.PutUint32(state[12:16], uint32(partition))
+		binary.BigEndian.PutUint64(state[16:24], uint64(offsets[0]))
+		return txn.Set(stateKey, state)
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if !duplicate {
+		s.notify(topic, partition)
+	}
+	return partition, offsets, nil
+}
+
+// CommitTransaction appends the transaction's records and commits its
+// consumer offsets in a single Badger transaction, returning where each
+// record was written. Retrying the producer's last transaction returns the
+// original results without applying it again. It fails with
+// badger.ErrTxnTooBig if the transaction exceeds Badger's limits.
+func (s *StreamStorage) CommitTransaction(t *Transaction) ([]TxnResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make([]TxnResult, 0, len(t.Records))
+	duplicate := false
+	err := s.db.Update(func(txn *badger.Txn) error {
+		var seqKey []byte
+		if t.ProducerID != 0 {
+			seqKey = []byte(makeTxnSeqKey(t.ProducerID))
+			item, err := txn.Get(seqKey)
+			if err != nil && err != badger.ErrKeyNotFound {
+				return err
+			}
+			if err == nil {
+				var state []byte
+				if state, err = item.ValueCopy(nil); err != nil {
+					return err
+				}
+				if len(state) < 8 {
+					return fmt.Errorf("invalid transaction state")
+				}
+				lastSeq := binary.BigEndian.Uint64(state[0:8])
+
+				switch {
+				case t.Sequence == lastSeq:
+					// State written before results were kept has none to return
+					last, ok := decodeTxnResults(state)
+					if !ok || len(last) != len(t.Records) {
+						return ErrDuplicateSequence
+					}
+					results = last
+					duplicate = true
+					return nil
+				case t.Sequence < lastSeq:
+					return ErrDuplicateSequence
+				case t.Sequence > lastSeq+1:
+					return ErrOutOfOrderSequence
+				}
+			}
+		}
+
+		now := time.Now().UnixMilli()
+		for _, rec := range t.Records {
+			// Pending writes are visible, so offsets stay contiguous when
+			// several records target one partition
+			recOffsets, err := appendInTxn(txn, rec.Topic, rec.Partition, []Record{rec.Record}, now)
+			if err != nil {
+				return err
+			}
+			results = append(results, TxnResult{Partition: rec.Partition, Offset: recOffsets[0]})
+		}
+
+		for _, co := range t.Offsets {
+			data := make([]byte, 16) // 8 bytes offset + 8 bytes timestamp
+			binary.BigEndian.PutUint64(data[0:8], uint64(co.Offset))
+			binary.BigEndian.PutUint64(data[8:16], uint64(now))
+			if err := txn.Set([]byte(makeConsumerOffsetKey(co.Group, co.Topic, co.Partition)), data); err != nil {
+				return err
+			}
+		}
+
+		if seqKey != nil {
+			return txn.Set(seqKey, encodeTxnResults(t.Sequence, results))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !duplicate {
+		for _, rec := range t.Records {
+			s.notify(rec.Topic, rec.Partition)
+		}
+	}
+	return results, nil
+}
+
+// encodeTxnResults encodes a producer's transaction state:
+// [8:sequence][4:count][for each record: [4:partition][8:offset]]
+func encodeTxnResults(sequence uint64, results []TxnResult) []byte {
+	buf := make([]byte, 12+12*len(results))
+	binary.BigEndian.PutUint64(buf[0:8], sequence)
+	binary.BigEndian.PutUint32(buf[8:12], uint32(len(results)))
+	pos := 12
+	for _, r := range results {
+		binary.BigEndian.PutUint32(buf[pos:], uint32(r.Partition))
+		binary.BigEndian.PutUint64(buf[pos+4:], uint64(r.Offset))
+		pos += 12
+	}
+	return buf
+}
+
+// decodeTxnResults returns the results kept in a transaction state; ok is
+// false for the sequence-only state of older versions
+func decodeTxnResults(state []byte) ([]TxnResult, bool) {
+	if len(state) < 12 {
+		return nil, false
+	}
+	count := int(binary.BigEndian.Uint32(state[8:12]))
+	if len(state) != 12+12*count {
+		return nil, false
+	}
+	results := make([]TxnResult, count)
+	pos := 12
+	for i := range results {
+		results[i] = TxnResult{
+			Partition: int(binary.BigEndian.Uint32(state[pos:])),
+			Offset:    int64(binary.BigEndian.Uint64(state[pos+4:])),
+		}
+		pos += 12
+	}
+	return results, true
+}
+
+// InitProducer allocates a new producer ID for idempotent publishing
+func (s *StreamStorage) InitProducer() (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var id uint64
+	err := s.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(producerIDKey))
+		if err != nil && err != badger.ErrKeyNotFound {
 			return err
-		} else {
+		}
+		if err == nil {
 			err = item.Value(func(val []byte) error {
-				offset = int64(binary.BigEndian.Uint64(val)) + 1
+				id = binary.BigEndian.Uint64(val)
 				return nil
 			})
 			if err != nil {
 				return err
 			}
 		}
+		id++
+
+		data := make([]byte, 8)
+		binary.BigEndian.PutUint64(data, id)
+		return txn.Set([]byte(producerIDKey), data)
+	})
+	return id, err
+}
+
+// appendInTxn writes records after the partition's current offset and
+// returns their offsets
+func appendInTxn(txn *badger.Txn, topic string, partition int, records []Record, now int64) ([]int64, error) {
+	codec, err := topicCodec(txn, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get current offset for this partition
+	var offset int64
+	offsetKey := makeOffsetKey(topic, partition)
+	item, err := txn.Get([]byte(offsetKey))
+	if err == badger.ErrKeyNotFound {
+		offset = 0
+	} else if err != nil {
+		return nil, err
+	} else {
+		err = item.Value(func(val []byte) error {
+			offset = int64(binary.BigEndian.Uint64(val)) + 1
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
 
+	offsets := make([]int64, 0, len(records))
+	for _, rec := range records {
 		// Store the message
 		msgKey := makeMessageKey(topic, partition, offset)
 		msg := &Message{
 			Topic:     topic,
 			Partition: partition,
 			Offset:    offset,
-			Key:       key,
-			Value:     value,
-			Timestamp: time.Now().UnixMilli(),
+			Key:       rec.Key,
+			Value:     rec.Value,
+			Timestamp: now,
+			EventTime: rec.EventTime,
+			Headers:   rec.Headers,
 		}
-		msgData := encodeMessage(msg)
-		if err := txn.Set([]byte(msgKey), msgData); err != nil {
-			return err
+		if err := txn.Set([]byte(msgKey), encodeMessage(msg, codec)); err != nil {
+			return nil, err
 		}
+		offsets = append(offsets, offset)
+		offset++
+	}
 
-		// Update offset
-		offsetData := make([]byte, 8)
-		binary.BigEndian.PutUint64(offsetData, uint64(offset))
-		return txn.Set([]byte(offsetKey), offsetData)
+	// Update offset
+	offsetData := make([]byte, 8)
+	binary.BigEndian.PutUint64(offsetData, uint64(offset-1))
+	if err := txn.Set([]byte(offsetKey), offsetData); err != nil {
+		return nil, err
+	}
+	return offsets, nil
+}
+
+// topicCodec returns the compression codec configured for topic, or
+// codecNone if the topic has no metadata
+func topicCodec(txn *badger.Txn, topic string) (byte, error) {
+	item, err := txn.Get([]byte(makeTopicMetaKey(topic)))
+	if err == badger.ErrKeyNotFound {
+		return codecNone, nil
+	}
+	if err != nil {
+		return codecNone, err
+	}
+
+	var codec byte
+	err = item.Value(func(val []byte) error {
+		meta, err := decodeTopicMetadata(val)
+		if err != nil {
+			return err
+		}
+		codec, _ = codecID(meta.Compression)
+		return nil
 	})
+	return codec, err
+}
 
-	return offset, err
+// Watch registers fn to run once, on its own goroutine, the next time a
+// message is appended to any of the given partitions. The returned func
+// cancels the watch.
+func (s *StreamStorage) Watch(topic string, partitions []int, fn func()) func() {
+	w := &watcher{fn: fn}
+	keys := make([]string, len(partitions))
+
+	s.watchMu.Lock()
+	for i, p := range partitions {
+		keys[i] = makeMessagePrefix(topic, p)
+		set, ok := s.watchers[keys[i]]
+		if !ok {
+			set = make(map[*watcher]struct{})
+			s.watchers[keys[i]] = set
+		}
+		set[w] = struct{}{}
+	}
+	s.watchMu.Unlock()
+
+	return func() {
+		s.watchMu.Lock()
+		defer s.watchMu.Unlock()
+		for _, key := range keys {
+			if set, ok := s.watchers[key]; ok {
+				delete(set, w)
+				if len(set) == 0 {
+					delete(s.watchers, key)
+				}
+			}
+		}
+	}
+}
+
+// notify fires and clears the watchers of a partition
+func (s *StreamStorage) notify(topic string, partition int) {
+	key := makeMessagePrefix(topic, partition)
+
+	s.watchMu.Lock()
+	set := s.watchers[key]
+	delete(s.watchers, key)
+	s.watchMu.Unlock()
+
+	for w := range set {
+		w.once.Do(func() { go w.fn() })
+	}
 }
 
-// FetchMessages retrieves messages from a topic partition starting at the given offset
 func (s *StreamStorage) FetchMessages(topic string, partition int, startOffset int64, maxCount int) ([]*Message, error) {
+	messages, _, err := s.FetchMessagesFiltered(topic, partition, startOffset, maxCount, maxCount, nil)
+	return messages, err
+}
+
+// FetchMessagesFiltered reads up to maxCount messages accepted by match,
+// examining at most maxScan messages from startOffset. A nil match accepts
+// everything. next is the offset after the last message examined, so callers
+// can advance past rejected messages; it equals startOffset if none were read.
+func (s *StreamStorage) FetchMessagesFiltered(topic string, partition int, startOffset int64, maxCount, maxScan int, match func(*Message) bool) ([]*Message, int64, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	messages := make([]*Message, 0, maxCount)
+	next := startOffset
 
 	err := s.db.View(func(txn *badger.Txn) error {
 		// Create iterator with prefix for this topic/partition
@@ -128,17 +710,25 @@ func (s *StreamStorage) FetchMessages(topic string, partition int, startOffset i
 
 		// Seek to start offset
 		seekKey := makeMessageKey(topic, partition, startOffset)
-		count := 0
+		scanned := 0
 
-		for it.Seek([]byte(seekKey)); it.ValidForPrefix([]byte(prefix)) && count < maxCount; it.Next() {
+		for it.Seek([]byte(seekKey)); it.ValidForPrefix([]byte(prefix)) && len(messages) < maxCount && scanned < maxScan; it.Next() {
 			item := it.Item()
+			if !isMessageKey([]byte(prefix), item.Key()) {
+				break
+			}
 			err := item.Value(func(val []byte) error {
 				msg, err := decodeMessage(val)
 				if err != nil {
 					return err
 				}
-				messages = append(messages, msg)
-				count++
+				msg.Topic = topic
+				msg.Partition = partition
+				scanned++
+				next = msg.Offset + 1
+				if match == nil || match(msg) {
+					messages = append(messages, msg)
+				}
 				return nil
 			})
 			if err != nil {
@@ -148,7 +738,7 @@ func (s *StreamStorage) FetchMessages(topic string, partition int, startOffset i
 		return nil
 	})
 
-	return messages, err
+	return messages, next, err
 }
 
 // GetOffset returns the current offset for a topic partition
@@ -174,6 +764,70 @@ func (s *StreamStorage) GetOffset(topic string, partition int) (int64, error) {
 	return offset, err
 }
 
+// GetStartOffset returns the offset of the oldest retained message in a
+// partition, or the next offset to be written if the partition is empty
+func (s *StreamStorage) GetStartOffset(topic string, partition int) (int64, error) {
+	return s.findOffset(topic, partition, func(*Message) bool { return true })
+}
+
+// OffsetForTimestamp returns the offset of the first message in a partition
+// with a timestamp at or after ts (Unix ms), or the next offset to be
+// written if there is none
+func (s *StreamStorage) OffsetForTimestamp(topic string, partition int, ts int64) (int64, error) {
+	return s.findOffset(topic, partition, func(msg *Message) bool { return msg.Timestamp >= ts })
+}
+
+// findOffset scans a partition in offset order for the first message
+// matching fn, falling back to the log end offset
+func (s *StreamStorage) findOffset(topic string, partition int, fn func(*Message) bool) (int64, error) {
+	s.mu.RLock()
+
+	offset := int64(-1)
+	err := s.db.View(func(txn *badger.Txn) error {
+		prefix := []byte(makeMessagePrefix(topic, partition))
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.ValidForPrefix(prefix); it.Next() {
+			if !isMessageKey(prefix, it.Item().Key()) {
+				break
+			}
+			var found bool
+			err := it.Item().Value(func(val []byte) error {
+				msg, err := decodeMessage(val)
+				if err != nil {
+					return err
+				}
+				if fn(msg) {
+					offset = msg.Offset
+					found = true
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if found {
+				return nil
+			}
+		}
+		return nil
+	})
+	s.mu.RUnlock()
+
+	if err != nil || offset >= 0 {
+		return offset, err
+	}
+
+	last, err := s.GetOffset(topic, partition)
+	if err != nil {
+		return 0, err
+	}
+	return last + 1, nil
+}
+
 // CommitOffset stores the consumer group's offset for a topic partition
 func (s *StreamStorage) CommitOffset(group, topic string, partition int, offset int64) error {
 	s.mu.Lock()
@@ -190,10 +844,18 @@ func (s *StreamStorage) CommitOffset(group, topic string, partition int, offset
 
 // GetConsumerOffset retrieves the consumer group's offset for a topic partition
 func (s *StreamStorage) GetConsumerOffset(group, topic string, partition int) (int64, error) {
+	offset, _, err := s.LookupConsumerOffset(group, topic, partition)
+	return offset, err
+}
+
+// LookupConsumerOffset retrieves the consumer group's offset for a topic
+// partition and reports whether one was ever committed
+func (s *StreamStorage) LookupConsumerOffset(group, topic string, partition int) (int64, bool, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	var offset int64 = 0
+	found := false
 	err := s.db.View(func(txn *badger.Txn) error {
 		key := makeConsumerOffsetKey(group, topic, partition)
 		item, err := txn.Get([]byte(key))
@@ -205,14 +867,60 @@ func (s *StreamStorage) GetConsumerOffset(group, topic string, partition int) (i
 		}
 		return item.Value(func(val []byte) error {
 			offset = int64(binary.BigEndian.Uint64(val[0:8]))
+			found = true
 			return nil
 		})
 	})
-	return offset, err
+	return offset, found, err
 }
 
-// CreateTopic stores topic metadata
-func (s *StreamStorage) CreateTopic(meta *TopicMetadata) error {
+// ListConsumerOffsets returns every group's committed offsets for a topic
+func (s *StreamStorage) ListConsumerOffsets(topic string) ([]*ConsumerOffset, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	offsets := make([]*ConsumerOffset, 0)
+	err := s.db.View(func(txn *badger.Txn) error {
+		prefix := []byte(makeTopicConsumerPrefix(topic))
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			group, partition, ok := parseGroupPartition(string(item.Key()[len(prefix):]))
+			if !ok {
+				continue
+			}
+
+			co := &ConsumerOffset{
+				Group:     group,
+				Topic:     topic,
+				Partition: partition,
+			}
+			err := item.Value(func(val []byte) error {
+				if len(val) < 8 {
+					return fmt.Errorf("invalid consumer offset")
+				}
+				co.Offset = int64(binary.BigEndian.Uint64(val[0:8]))
+				if len(val) >= 16 {
+					co.UpdatedAt = int64(binary.BigEndian.Uint64(val[8:16]))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			offsets = append(offsets, co)
+		}
+		return nil
+	})
+	return offsets, err
+}
+
+// CreateTopic stores topic metadata
+func (s *StreamStorage) CreateTopic(meta *TopicMetadata) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -232,6 +940,9 @@ func (s *StreamStorage) GetTopicMetadata(topic string) (*TopicMetadata, error) {
 	err := s.db.View(func(txn *badger.Txn) error {
 		key := makeTopicMetaKey(topic)
 		item, err := txn.Get([]byte(key))
+		if err == badger.ErrKeyNotFound {
+			return ErrTopicNotFound
+		}
 		if err != nil {
 			return err
 		}
@@ -243,51 +954,511 @@ func (s *StreamStorage) GetTopicMetadata(topic string) (*TopicMetadata, error) {
 	return meta, err
 }
 
-// DeleteOldMessages removes messages older than retention policy
-func (s *StreamStorage) DeleteOldMessages(topic string, partition int, retentionMs int64) (int, error) {
+// DescribeTopic returns a topic's metadata and per-partition offsets,
+// message counts and value bytes
+func (s *StreamStorage) DescribeTopic(topic string) (*TopicDescription, error) {
+	meta, err := s.GetTopicMetadata(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	desc := &TopicDescription{
+		Metadata:   meta,
+		Partitions: make([]PartitionStats, 0, meta.Partitions),
+	}
+	for p := 0; p < meta.Partitions; p++ {
+		stats, err := s.describePartition(topic, p)
+		if err != nil {
+			return nil, err
+		}
+		desc.Partitions = append(desc.Partitions, *stats)
+	}
+	return desc, nil
+}
+
+func (s *StreamStorage) describePartition(topic string, partition int) (*PartitionStats, error) {
+	last, err := s.GetOffset(topic, partition)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &PartitionStats{
+		Partition:      partition,
+		EarliestOffset: last + 1,
+		LatestOffset:   last + 1,
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	err = s.db.View(func(txn *badger.Txn) error {
+		prefix := []byte(makeMessagePrefix(topic, partition))
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			if !isMessageKey(prefix, item.Key()) {
+				break
+			}
+			if stats.Messages == 0 {
+				if offset, ok := parseMessageOffset(item.Key()); ok {
+					stats.EarliestOffset = offset
+				}
+			}
+			stats.Messages++
+			stats.Bytes += item.ValueSize()
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// GetPartitionOffsets returns the earliest retained offset and the next
+// offset to be written for a partition
+func (s *StreamStorage) GetPartitionOffsets(topic string, partition int) (int64, int64, error) {
+	earliest, err := s.GetStartOffset(topic, partition)
+	if err != nil {
+		return 0, 0, err
+	}
+	last, err := s.GetOffset(topic, partition)
+	if err != nil {
+		return 0, 0, err
+	}
+	return earliest, last + 1, nil
+}
+
+// AddPartitions grows a topic by count partitions and returns the new metadata
+func (s *StreamStorage) AddPartitions(topic string, count int) (*TopicMetadata, error) {
+	if count <= 0 {
+		return nil, fmt.Errorf("partition count must be positive")
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	cutoffTime := time.Now().UnixMilli() - retentionMs
+	var meta *TopicMetadata
+	err := s.db.Update(func(txn *badger.Txn) error {
+		key := []byte(makeTopicMetaKey(topic))
+		item, err := txn.Get(key)
+		if err == badger.ErrKeyNotFound {
+			return ErrTopicNotFound
+		}
+		if err != nil {
+			return err
+		}
+		err = item.Value(func(val []byte) error {
+			meta, err = decodeTopicMetadata(val)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		meta.Partitions += count
+		return txn.Set(key, encodeTopicMetadata(meta))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// DeleteTopic removes a topic's messages, offsets, committed consumer
+// offsets and metadata. Deletes are batched so large topics never exceed
+// Badger's transaction limits; the metadata goes last so an interrupted
+// delete can be retried.
+func (s *StreamStorage) DeleteTopic(topic string) error {
+	meta, err := s.GetTopicMetadata(topic)
+	if err != nil {
+		return err
+	}
+
+	for p := 0; p < meta.Partitions; p++ {
+		prefix := []byte(makeMessagePrefix(topic, p))
+		// Skip the messages of a topic whose name extends this one, such
+		// as "orders:1" for partition 1 of "orders"
+		_, err := s.deleteKeys(prefix, func(key []byte) bool {
+			return isMessageKey(prefix, key)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.deleteKeys([]byte(makeTopicConsumerPrefix(topic)), nil); err != nil {
+		return err
+	}
+
+	// Producer state is keyed stream:producer:{id}:{topic} and
+	// stream:partproducer:{id}:{partition}:{topic}
+	_, err = s.deleteKeys([]byte(producerPrefix), func(key []byte) bool {
+		rest := key[len(producerPrefix):]
+		sep := bytes.IndexByte(rest, ':')
+		return sep >= 0 && string(rest[sep+1:]) == topic
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.deleteKeys([]byte(partitionProducerPrefix), func(key []byte) bool {
+		rest := key[len(partitionProducerPrefix):]
+		for i := 0; i < 2; i++ {
+			sep := bytes.IndexByte(rest, ':')
+			if sep < 0 {
+				return false
+			}
+			rest = rest[sep+1:]
+		}
+		return string(rest) == topic
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.db.Update(func(txn *badger.Txn) error {
+		for p := 0; p < meta.Partitions; p++ {
+			if err := txn.Delete([]byte(makeOffsetKey(topic, p))); err != nil {
+				return err
+			}
+		}
+		return txn.Delete([]byte(makeTopicMetaKey(topic)))
+	})
+}
+
+// deleteKeys removes keys under prefix, optionally filtered by match, in
+// transactions of at most deleteBatchSize keys
+func (s *StreamStorage) deleteKeys(prefix []byte, match func(key []byte) bool) (int, error) {
+	return s.scanDelete(prefix, func(item *badger.Item) (bool, bool, error) {
+		return match == nil || match(item.Key()), false, nil
+	})
+}
+
+// scanDelete walks keys under prefix in order and deletes those visit
+// selects. Each page of at most deleteBatchSize keys is read and deleted
+// in its own transactions, so large partitions neither stall writers nor
+// exceed Badger's transaction limits. visit returns stop to end the walk
+// early.
+func (s *StreamStorage) scanDelete(prefix []byte, visit func(item *badger.Item) (del, stop bool, err error)) (int, error) {
 	deleted := 0
+	start := prefix
 
-	err := s.db.Update(func(txn *badger.Txn) error {
-		prefix := makeMessagePrefix(topic, partition)
+	for {
+		keys := make([][]byte, 0, deleteBatchSize)
+		done := false
+		err := s.db.View(func(txn *badger.Txn) error {
+			opts := badger.DefaultIteratorOptions
+			opts.Prefix = prefix
+			opts.PrefetchValues = false
+			it := txn.NewIterator(opts)
+			defer it.Close()
+
+			visited := 0
+			for it.Seek(start); it.ValidForPrefix(prefix); it.Next() {
+				if visited == deleteBatchSize {
+					return nil
+				}
+				visited++
+				item := it.Item()
+				del, stop, err := visit(item)
+				if err != nil {
+					return err
+				}
+				if stop {
+					done = true
+					return nil
+				}
+				key := item.KeyCopy(nil)
+				start = append(key[:len(key):len(key)], 0)
+				if del {
+					keys = append(keys, key)
+				}
+			}
+			done = true
+			return nil
+		})
+		if err != nil {
+			return deleted, err
+		}
+
+		if len(keys) > 0 {
+			s.mu.Lock()
+			err = s.db.Update(func(txn *badger.Txn) error {
+				for _, key := range keys {
+					if err := txn.Delete(key); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			s.mu.Unlock()
+			if err != nil {
+				return deleted, err
+			}
+			deleted += len(keys)
+		}
+
+		if done {
+			return deleted, nil
+		}
+	}
+}
+
+// ListTopics returns metadata for every topic
+func (s *StreamStorage) ListTopics() ([]*TopicMetadata, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	topics := make([]*TopicMetadata, 0)
+	err := s.db.View(func(txn *badger.Txn) error {
+		prefix := []byte(topicMetaPrefix)
 		opts := badger.DefaultIteratorOptions
-		opts.Prefix = []byte(prefix)
+		opts.Prefix = prefix
 		it := txn.NewIterator(opts)
 		defer it.Close()
 
-		keysToDelete := make([][]byte, 0)
-
-		for it.Seek([]byte(prefix)); it.ValidForPrefix([]byte(prefix)); it.Next() {
-			item := it.Item()
-			err := item.Value(func(val []byte) error {
-				msg, err := decodeMessage(val)
+		for it.Rewind(); it.ValidForPrefix(prefix); it.Next() {
+			err := it.Item().Value(func(val []byte) error {
+				meta, err := decodeTopicMetadata(val)
 				if err != nil {
 					return err
 				}
-				if msg.Timestamp < cutoffTime {
-					keysToDelete = append(keysToDelete, item.KeyCopy(nil))
+				topics = append(topics, meta)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return topics, err
+}
+
+// SaveGroup persists a consumer group's members and assignments
+func (s *StreamStorage) SaveGroup(group *GroupState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(makeGroupKey(group.Name)), encodeGroupState(group))
+	})
+}
+
+// DeleteGroup removes a persisted consumer group
+func (s *StreamStorage) DeleteGroup(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(makeGroupKey(name)))
+	})
+}
+
+// ListGroups returns every persisted consumer group
+func (s *StreamStorage) ListGroups() ([]*GroupState, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	groups := make([]*GroupState, 0)
+	err := s.db.View(func(txn *badger.Txn) error {
+		prefix := []byte(groupPrefix)
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.ValidForPrefix(prefix); it.Next() {
+			err := it.Item().Value(func(val []byte) error {
+				group, err := decodeGroupState(val)
+				if err != nil {
+					return err
 				}
+				groups = append(groups, group)
 				return nil
 			})
 			if err != nil {
 				return err
 			}
 		}
+		return nil
+	})
+	return groups, err
+}
+
+// SaveCopyJob persists a copy job
+func (s *StreamStorage) SaveCopyJob(job *CopyJobState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(copyJobPrefix+job.Name), encodeCopyJob(job))
+	})
+}
+
+// DeleteCopyJob removes a persisted copy job
+func (s *StreamStorage) DeleteCopyJob(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-		// Delete old messages
-		for _, key := range keysToDelete {
-			if err := txn.Delete(key); err != nil {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(copyJobPrefix + name))
+	})
+}
+
+// ListCopyJobs returns every persisted copy job
+func (s *StreamStorage) ListCopyJobs() ([]*CopyJobState, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jobs := make([]*CopyJobState, 0)
+	err := s.db.View(func(txn *badger.Txn) error {
+		prefix := []byte(copyJobPrefix)
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.ValidForPrefix(prefix); it.Next() {
+			err := it.Item().Value(func(val []byte) error {
+				job, err := decodeCopyJob(val)
+				if err != nil {
+					return err
+				}
+				jobs = append(jobs, job)
+				return nil
+			})
+			if err != nil {
 				return err
 			}
-			deleted++
 		}
 		return nil
 	})
+	return jobs, err
+}
+
+// DeleteConsumerOffsets removes a group's committed offsets for a topic
+func (s *StreamStorage) DeleteConsumerOffsets(group, topic string) error {
+	prefix := []byte(makeTopicConsumerPrefix(topic))
+	// Skip the offsets of groups whose names extend this one
+	_, err := s.deleteKeys(append(prefix, group+":"...), func(key []byte) bool {
+		g, _, ok := parseGroupPartition(string(key[len(prefix):]))
+		return ok && g == group
+	})
+	return err
+}
+
+// scanMessages is scanDelete over a partition's messages. It stops at the
+// first key of a topic whose name extends this one, which sort after the
+// partition's own messages.
+func (s *StreamStorage) scanMessages(topic string, partition int, visit func(item *badger.Item) (del, stop bool, err error)) (int, error) {
+	prefix := []byte(makeMessagePrefix(topic, partition))
+	return s.scanDelete(prefix, func(item *badger.Item) (bool, bool, error) {
+		if !isMessageKey(prefix, item.Key()) {
+			return false, true, nil
+		}
+		return visit(item)
+	})
+}
+
+// DeleteOldMessages removes messages older than retentionMs from the head
+// of a partition, in bounded transactions
+func (s *StreamStorage) DeleteOldMessages(topic string, partition int, retentionMs int64) (int, error) {
+	cutoffTime := time.Now().UnixMilli() - retentionMs
+
+	return s.scanMessages(topic, partition, func(item *badger.Item) (bool, bool, error) {
+		var old bool
+		err := item.Value(func(val []byte) error {
+			msg, err := decodeMessage(val)
+			if err != nil {
+				return err
+			}
+			old = msg.Timestamp < cutoffTime
+			return nil
+		})
+		// Messages are in append order, so stop at the first one to keep
+		return old, !old, err
+	})
+}
+
+// DeleteExcessBytes removes the oldest messages of a partition until its
+// stored size is at most maxBytes
+func (s *StreamStorage) DeleteExcessBytes(topic string, partition int, maxBytes int64) (int, error) {
+	stats, err := s.describePartition(topic, partition)
+	if err != nil {
+		return 0, err
+	}
+
+	excess := stats.Bytes - maxBytes
+	if excess <= 0 {
+		return 0, nil
+	}
+
+	return s.scanMessages(topic, partition, func(item *badger.Item) (bool, bool, error) {
+		if excess <= 0 {
+			return false, true, nil
+		}
+		excess -= item.ValueSize()
+		return true, false, nil
+	})
+}
+
+// CompactPartition keeps only the latest message per key in a partition.
+// A message with an empty value is a tombstone: it removes earlier messages
+// for its key and is itself dropped once older than tombstoneRetentionMs.
+// Messages without a key are never compacted.
+func (s *StreamStorage) CompactPartition(topic string, partition int, tombstoneRetentionMs int64) (int, error) {
+	// First pass: find the latest offset of each key. Only offsets are
+	// kept, and each page is read in its own transaction.
+	latest := make(map[string]int64)
+	_, err := s.scanMessages(topic, partition, func(item *badger.Item) (bool, bool, error) {
+		err := item.Value(func(val []byte) error {
+			offset, key, err := decodeMessageKey(val)
+			if err == nil && key != "" {
+				latest[key] = offset
+			}
+			return err
+		})
+		return false, false, err
+	})
+	if err != nil {
+		return 0, err
+	}
 
-	return deleted, err
+	// Second pass: drop messages superseded by a later one for their key
+	// and latest messages that are expired tombstones. Messages appended
+	// since the first pass are newer than any offset it found, so they stay.
+	cutoff := time.Now().UnixMilli() - tombstoneRetentionMs
+	return s.scanMessages(topic, partition, func(item *badger.Item) (bool, bool, error) {
+		var del bool
+		err := item.Value(func(val []byte) error {
+			offset, key, err := decodeMessageKey(val)
+			if err != nil {
+				return err
+			}
+			last, ok := latest[key]
+			if !ok || offset > last {
+				return nil
+			}
+			if offset < last {
+				del = true
+				return nil
+			}
+
+			msg, err := decodeMessage(val)
+			if err != nil {
+				return err
+			}
+			del = len(msg.Value) == 0 && msg.Timestamp < cutoff
+			return nil
+		})
+		return del, false, err
+	})
 }
 
 // Close closes the storage
@@ -308,21 +1479,106 @@ func makeOffsetKey(topic string, partition int) string {
 	return fmt.Sprintf("stream:offset:%s:%d", topic, partition)
 }
 
+// parseMessageOffset extracts the zero-padded offset from a message key
+func parseMessageOffset(key []byte) (int64, bool) {
+	if len(key) < 20 {
+		return 0, false
+	}
+	offset, err := strconv.ParseInt(string(key[len(key)-20:]), 10, 64)
+	return offset, err == nil
+}
+
+// isMessageKey reports whether key under a partition's message prefix is
+// one of its messages. Keys of a topic whose name extends the partition's,
+// such as "orders:1" partition 0 under "orders" partition 1, share the
+// prefix but sort after every offset, so scans stop at the first of them.
+func isMessageKey(prefix, key []byte) bool {
+	if len(key) != len(prefix)+20 {
+		return false
+	}
+	_, ok := parseMessageOffset(key)
+	return ok
+}
+
+// makeTopicConsumerPrefix returns the prefix of a topic's committed
+// offsets. The length in front of the topic keeps the offsets of "a" apart
+// from those of "a:b".
+func makeTopicConsumerPrefix(topic string) string {
+	return fmt.Sprintf("%s%d:%s:", consumerOffsetPrefix, len(topic), topic)
+}
+
 func makeConsumerOffsetKey(group, topic string, partition int) string {
-	return fmt.Sprintf("stream:consumer:%s:%s:%d", group, topic, partition)
+	return fmt.Sprintf("%s%s:%d", makeTopicConsumerPrefix(topic), group, partition)
 }
 
+// parseGroupPartition splits the part of a committed offset key after its
+// topic prefix into the group and partition. Partitions hold no ':', so
+// the last one ends the group.
+func parseGroupPartition(rest string) (string, int, bool) {
+	sep := strings.LastIndexByte(rest, ':')
+	if sep < 0 {
+		return "", 0, false
+	}
+	partition, err := strconv.ParseUint(rest[sep+1:], 10, 31)
+	if err != nil {
+		return "", 0, false
+	}
+	return rest[:sep], int(partition), true
+}
+
+func makeProducerKey(producerID uint64, topic string) string {
+	return fmt.Sprintf("%s%d:%s", producerPrefix, producerID, topic)
+}
+
+func makePartitionProducerKey(producerID uint64, topic string, partition int) string {
+	return fmt.Sprintf("%s%d:%d:%s", partitionProducerPrefix, producerID, partition, topic)
+}
+
+func makeTxnSeqKey(producerID uint64) string {
+	return fmt.Sprintf("%s%d", txnSeqPrefix, producerID)
+}
+
+const (
+	producerIDKey  = "stream:producerid"
+	producerPrefix = "stream:producer:"
+	// partitionProducerPrefix keys producer state kept per partition
+	partitionProducerPrefix = "stream:partproducer:"
+	txnSeqPrefix            = "stream:txnseq:"
+	topicMetaPrefix         = "stream:meta:"
+	groupPrefix             = "stream:group:"
+	consumerOffsetPrefix    = "stream:committed:"
+	// legacyConsumerOffsetPrefix keyed offsets {group}:{topic}:{partition}
+	legacyConsumerOffsetPrefix = "stream:consumer:"
+	copyJobPrefix              = "stream:copyjob:"
+)
+
 func makeTopicMetaKey(topic string) string {
-	return fmt.Sprintf("stream:meta:%s", topic)
+	return topicMetaPrefix + topic
+}
+
+func makeGroupKey(group string) string {
+	return groupPrefix + group
 }
 
 // Encoding/Decoding helpers
-func encodeMessage(msg *Message) []byte {
+// encodeMessage encodes msg, compressing its value with codec
+func encodeMessage(msg *Message, codec byte) []byte {
+	codec, value := compressValue(codec, msg.Value)
 	keyLen := len(msg.Key)
-	valueLen := len(msg.Value)
+	valueLen := len(value)
 
 	// Format: [8:offset][8:timestamp][2:keyLen][key][4:valueLen][value]
+	//         [8:eventTime][headers][1:codec], the tail only when any of
+	//         them is set and the codec only for compressed values
+	var headers []byte
 	size := 8 + 8 + 2 + keyLen + 4 + valueLen
+	if msg.EventTime != 0 || len(msg.Headers) > 0 || codec != codecNone {
+		headers = headercodec.Encode(msg.Headers)
+		size += 8 + len(headers)
+	}
+	if codec != codecNone {
+		size++
+	}
 	data := make([]byte, size)
 	pos := 0
 
@@ -336,11 +1592,35 @@ func encodeMessage(msg *Message) []byte {
 	pos += keyLen
 	binary.BigEndian.PutUint32(data[pos:], uint32(valueLen))
 	pos += 4
-	copy(data[pos:], msg.Value)
+	copy(data[pos:], value)
+	pos += valueLen
+
+	if headers != nil {
+		binary.BigEndian.PutUint64(data[pos:], uint64(msg.EventTime))
+		pos += 8
+		copy(data[pos:], headers)
+		pos += len(headers)
+	}
+	if codec != codecNone {
+		data[pos] = codec
+	}
 
 	return data
 }
 
+// decodeMessageKey returns a message's offset and key without decoding
+// its value
+func decodeMessageKey(data []byte) (int64, string, error) {
+	if len(data) < 18 {
+		return 0, "", fmt.Errorf("invalid message data")
+	}
+	keyLen := int(binary.BigEndian.Uint16(data[16:]))
+	if len(data) < 18+keyLen {
+		return 0, "", fmt.Errorf("invalid message data")
+	}
+	return int64(binary.BigEndian.Uint64(data)), string(data[18 : 18+keyLen]), nil
+}
+
 func decodeMessage(data []byte) (*Message, error) {
 	if len(data) < 18 {
 		return nil, fmt.Errorf("invalid message data")
@@ -368,6 +1648,26 @@ func decodeMessage(data []byte) (*Message, error) {
 		return nil, fmt.Errorf("invalid message data")
 	}
 	msg.Value = data[pos : pos+valueLen]
+	pos += valueLen
+
+	// Event time and headers were added later; older messages end here
+	if len(data) >= pos+8+2 {
+		msg.EventTime = int64(binary.BigEndian.Uint64(data[pos:]))
+		pos += 8
+		headers, n, err := headercodec.Decode(data[pos:])
+		if err != nil {
+			return nil, err
+		}
+		msg.Headers = headers
+		pos += n
+
+		// Compressed values end with their codec
+		if len(data) > pos {
+			if msg.Value, err = decompressValue(data[pos], msg.Value); err != nil {
+				return nil, fmt.Errorf("invalid message data: %w", err)
+			}
+		}
+	}
 
 	return msg, nil
 }
@@ -375,7 +1675,10 @@ func decodeMessage(data []byte) (*Message, error) {
 func encodeTopicMetadata(meta *TopicMetadata) []byte {
 	nameLen := len(meta.Name)
 	// Format: [2:nameLen][name][4:partitions][8:retentionMs][8:retentionBytes][8:createdAt]
-	size := 2 + nameLen + 4 + 8 + 8 + 8
+	//         [2:policyLen][policy][2:compressionLen][compression]
+	//         [2:partitionerLen][partitioner]
+	size := 2 + nameLen + 4 + 8 + 8 + 8 + 2 + len(meta.CleanupPolicy) + 2 + len(meta.Compression) +
+		2 + len(meta.Partitioner)
 	data := make([]byte, size)
 	pos := 0
 
@@ -390,6 +1693,18 @@ func encodeTopicMetadata(meta *TopicMetadata) []byte {
 	binary.BigEndian.PutUint64(data[pos:], uint64(meta.RetentionBytes))
 	pos += 8
 	binary.BigEndian.PutUint64(data[pos:], uint64(meta.CreatedAt))
+	pos += 8
+	binary.BigEndian.PutUint16(data[pos:], uint16(len(meta.CleanupPolicy)))
+	pos += 2
+	copy(data[pos:], meta.CleanupPolicy)
+	pos += len(meta.CleanupPolicy)
+	binary.BigEndian.PutUint16(data[pos:], uint16(len(meta.Compression)))
+	pos += 2
+	copy(data[pos:], meta.Compression)
+	pos += len(meta.Compression)
+	binary.BigEndian.PutUint16(data[pos:], uint16(len(meta.Partitioner)))
+	pos += 2
+	copy(data[pos:], meta.Partitioner)
 
 	return data
 }
@@ -416,6 +1731,245 @@ func decodeTopicMetadata(data []byte) (*TopicMetadata, error) {
 	meta.RetentionBytes = int64(binary.BigEndian.Uint64(data[pos:]))
 	pos += 8
 	meta.CreatedAt = int64(binary.BigEndian.Uint64(data[pos:]))
+	pos += 8
+
+	// Cleanup policy was added later; older topics use delete
+	meta.CleanupPolicy = CleanupDelete
+	if len(data) >= pos+2 {
+		policyLen := int(binary.BigEndian.Uint16(data[pos:]))
+		pos += 2
+		if len(data) >= pos+policyLen && policyLen > 0 {
+			meta.CleanupPolicy = string(data[pos : pos+policyLen])
+		}
+		pos += policyLen
+	}
+
+	// Compression was added later; older topics are uncompressed
+	meta.Compression = CompressionNone
+	if len(data) >= pos+2 {
+		compressionLen := int(binary.BigEndian.Uint16(data[pos:]))
+		pos += 2
+		if len(data) >= pos+compressionLen && compressionLen > 0 {
+			meta.Compression = string(data[pos : pos+compressionLen])
+		}
+		pos += compressionLen
+	}
+
+	// Partitioner was added later; older topics hashed keys with FNV
+	meta.Partitioner = PartitionerFNV
+	if len(data) >= pos+2 {
+		partitionerLen := int(binary.BigEndian.Uint16(data[pos:]))
+		pos += 2
+		if len(data) >= pos+partitionerLen && partitionerLen > 0 {
+			meta.Partitioner = string(data[pos : pos+partitionerLen])
+		}
+	}
 
 	return meta, nil
 }
+
+func encodeGroupState(group *GroupState) []byte {
+	// Format: [2:nameLen][name][2:topicLen][topic][2:memberCount]
+	//         [for each: [2:idLen][id][2:partitionCount][4:partition]...]
+	//         [8:generation][8:sessionTimeoutMs][2:strategyLen][strategy]
+	//         [for each member: [2:filterLen][filter]]
+	size := 2 + len(group.Name) + 2 + len(group.Topic) + 2 + 16 + 2 + len(group.Strategy)
+	for _, m := range group.Members {
+		size += 2 + len(m.ID) + 2 + 4*len(m.Partitions) + 2 + len(m.Filter)
+	}
+
+	data := make([]byte, size)
+	pos := 0
+
+	binary.BigEndian.PutUint16(data[pos:], uint16(len(group.Name)))
+	pos += 2
+	pos += copy(data[pos:], group.Name)
+	binary.BigEndian.PutUint16(data[pos:], uint16(len(group.Topic)))
+	pos += 2
+	pos += copy(data[pos:], group.Topic)
+	binary.BigEndian.PutUint16(data[pos:], uint16(len(group.Members)))
+	pos += 2
+
+	for _, m := range group.Members {
+		binary.BigEndian.PutUint16(data[pos:], uint16(len(m.ID)))
+		pos += 2
+		pos += copy(data[pos:], m.ID)
+		binary.BigEndian.PutUint16(data[pos:], uint16(len(m.Partitions)))
+		pos += 2
+		for _, p := range m.Partitions {
+			binary.BigEndian.PutUint32(data[pos:], uint32(p))
+			pos += 4
+		}
+	}
+
+	binary.BigEndian.PutUint64(data[pos:], group.Generation)
+	pos += 8
+	binary.BigEndian.PutUint64(data[pos:], uint64(group.SessionTimeoutMs))
+	pos += 8
+	binary.BigEndian.PutUint16(data[pos:], uint16(len(group.Strategy)))
+	pos += 2
+	pos += copy(data[pos:], group.Strategy)
+
+	for _, m := range group.Members {
+		binary.BigEndian.PutUint16(data[pos:], uint16(len(m.Filter)))
+		pos += 2
+		pos += copy(data[pos:], m.Filter)
+	}
+
+	return data
+}
+
+func encodeCopyJob(job *CopyJobState) []byte {
+	// Format: [2:len][name][2:len][source][2:len][target][2:len][targetAddr]
+	//         [8:startOffset][8:endOffset][2:len][state][2:len][error]
+	strs := []string{job.Name, job.Source, job.Target, job.TargetAddr}
+	size := 16 + 2 + len(job.State) + 2 + len(job.Error)
+	for _, str := range strs {
+		size += 2 + len(str)
+	}
+
+	data := make([]byte, size)
+	pos := 0
+	putString := func(str string) {
+		binary.BigEndian.PutUint16(data[pos:], uint16(len(str)))
+		pos += 2
+		copy(data[pos:], str)
+		pos += len(str)
+	}
+
+	for _, str := range strs {
+		putString(str)
+	}
+	binary.BigEndian.PutUint64(data[pos:], uint64(job.StartOffset))
+	pos += 8
+	binary.BigEndian.PutUint64(data[pos:], uint64(job.EndOffset))
+	pos += 8
+	putString(job.State)
+	putString(job.Error)
+
+	return data
+}
+
+func decodeCopyJob(data []byte) (*CopyJobState, error) {
+	job := &CopyJobState{}
+	pos := 0
+
+	readString := func() (string, error) {
+		if len(data) < pos+2 {
+			return "", fmt.Errorf("invalid copy job")
+		}
+		n := int(binary.BigEndian.Uint16(data[pos:]))
+		pos += 2
+		if len(data) < pos+n {
+			return "", fmt.Errorf("invalid copy job")
+		}
+		str := string(data[pos : pos+n])
+		pos += n
+		return str, nil
+	}
+
+	var err error
+	for _, field := range []*string{&job.Name, &job.Source, &job.Target, &job.TargetAddr} {
+		if *field, err = readString(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(data) < pos+16 {
+		return nil, fmt.Errorf("invalid copy job")
+	}
+	job.StartOffset = int64(binary.BigEndian.Uint64(data[pos:]))
+	job.EndOffset = int64(binary.BigEndian.Uint64(data[pos+8:]))
+	pos += 16
+
+	if job.State, err = readString(); err != nil {
+		return nil, err
+	}
+	if job.Error, err = readString(); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func decodeGroupState(data []byte) (*GroupState, error) {
+	group := &GroupState{}
+	pos := 0
+
+	readString := func() (string, error) {
+		if len(data) < pos+2 {
+			return "", fmt.Errorf("invalid group state")
+		}
+		n := int(binary.BigEndian.Uint16(data[pos:]))
+		pos += 2
+		if len(data) < pos+n {
+			return "", fmt.Errorf("invalid group state")
+		}
+		str := string(data[pos : pos+n])
+		pos += n
+		return str, nil
+	}
+
+	var err error
+	if group.Name, err = readString(); err != nil {
+		return nil, err
+	}
+	if group.Topic, err = readString(); err != nil {
+		return nil, err
+	}
+
+	if len(data) < pos+2 {
+		return nil, fmt.Errorf("invalid group state")
+	}
+	count := int(binary.BigEndian.Uint16(data[pos:]))
+	pos += 2
+
+	group.Members = make([]GroupMember, 0, count)
+	for i := 0; i < count; i++ {
+		id, err := readString()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(data) < pos+2 {
+			return nil, fmt.Errorf("invalid group state")
+		}
+		partCount := int(binary.BigEndian.Uint16(data[pos:]))
+		pos += 2
+		if len(data) < pos+4*partCount {
+			return nil, fmt.Errorf("invalid group state")
+		}
+
+		partitions := make([]int, partCount)
+		for j := range partitions {
+			partitions[j] = int(binary.BigEndian.Uint32(data[pos:]))
+			pos += 4
+		}
+
+		group.Members = append(group.Members, GroupMember{ID: id, Partitions: partitions})
+	}
+
+	// Generation and session timeout were added later
+	if len(data) >= pos+16 {
+		group.Generation = binary.BigEndian.Uint64(data[pos:])
+		pos += 8
+		group.SessionTimeoutMs = int64(binary.BigEndian.Uint64(data[pos:]))
+		pos += 8
+	}
+
+	if len(data) >= pos+2 {
+		if group.Strategy, err = readString(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Member filters were added after the strategy
+	if len(data) > pos {
+		for i := range group.Members {
+			if group.Members[i].Filter, err = readString(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return group, nil
+}
@@ -0,0 +1,520 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Helper function to create a test stream storage
+func createTestStreamStorage(t *testing.T) *StreamStorage {
+	s, err := NewStreamStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create stream storage: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func createTestTopic(t *testing.T, s *StreamStorage, name string, partitions int) {
+	if err := s.CreateTopic(&TopicMetadata{Name: name, Partitions: partitions}); err != nil {
+		t.Fatalf("Failed to create topic %s: %v", name, err)
+	}
+}
+
+// consumerOffsets returns a topic's committed offsets keyed "group/partition"
+func consumerOffsets(t *testing.T, s *StreamStorage, topic string) map[string]int64 {
+	offsets, err := s.ListConsumerOffsets(topic)
+	if err != nil {
+		t.Fatalf("Failed to list offsets of %s: %v", topic, err)
+	}
+	m := make(map[string]int64, len(offsets))
+	for _, co := range offsets {
+		m[fmt.Sprintf("%s/%d", co.Group, co.Partition)] = co.Offset
+	}
+	return m
+}
+
+// TestDeleteTopicKeepsPrefixedTopics tests that deleting a topic leaves the
+// messages and committed offsets of topics whose names contain it untouched
+func TestDeleteTopicKeepsPrefixedTopics(t *testing.T) {
+	s := createTestStreamStorage(t)
+
+	createTestTopic(t, s, "b", 2)
+	createTestTopic(t, s, "a:b", 1)
+	createTestTopic(t, s, "b:1", 1)
+
+	for _, topic := range []string{"b", "a:b", "b:1"} {
+		if _, err := s.AppendMessage(topic, 0, "k", []byte(topic)); err != nil {
+			t.Fatalf("Failed to append to %s: %v", topic, err)
+		}
+	}
+	s.AppendMessage("b", 1, "k", []byte("b"))
+
+	commits := []struct {
+		group, topic string
+		partition    int
+		offset       int64
+	}{
+		{"x", "b", 0, 1},
+		{"x", "b", 1, 2},
+		{"x", "a:b", 0, 3},
+		{"x:a", "b", 0, 4},
+		{"x", "b:1", 0, 5},
+	}
+	for _, c := range commits {
+		if err := s.CommitOffset(c.group, c.topic, c.partition, c.offset); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+	}
+
+	// Group x on a:b and group x:a on b are different offsets
+	if got := consumerOffsets(t, s, "a:b"); len(got) != 1 || got["x/0"] != 3 {
+		t.Errorf("Expected only x/0=3 on a:b, got %v", got)
+	}
+	if got := consumerOffsets(t, s, "b"); len(got) != 3 || got["x:a/0"] != 4 {
+		t.Errorf("Expected x/0, x/1 and x:a/0=4 on b, got %v", got)
+	}
+
+	if err := s.DeleteTopic("b"); err != nil {
+		t.Fatalf("Failed to delete topic: %v", err)
+	}
+
+	if got := consumerOffsets(t, s, "b"); len(got) != 0 {
+		t.Errorf("Expected no offsets left on b, got %v", got)
+	}
+	if got := consumerOffsets(t, s, "a:b"); got["x/0"] != 3 {
+		t.Errorf("Expected x to keep its offset on a:b, got %v", got)
+	}
+	if offset, _ := s.GetConsumerOffset("x", "b:1", 0); offset != 5 {
+		t.Errorf("Expected x to keep offset 5 on b:1, got %d", offset)
+	}
+
+	for _, topic := range []string{"a:b", "b:1"} {
+		msgs, err := s.FetchMessages(topic, 0, 0, 10)
+		if err != nil || len(msgs) != 1 {
+			t.Errorf("Expected %s to keep its message, got %d (%v)", topic, len(msgs), err)
+		}
+	}
+}
+
+// TestReadsSkipPrefixedTopics tests that fetches, offset lookups and
+// describe only see a partition's own messages, not those of a topic whose
+// name extends it
+func TestReadsSkipPrefixedTopics(t *testing.T) {
+	s := createTestStreamStorage(t)
+	createTestTopic(t, s, "orders", 2)
+	createTestTopic(t, s, "orders:1", 1)
+
+	s.AppendMessages("orders:1", 0, []Record{{Value: []byte("x")}, {Value: []byte("y")}})
+
+	// Partition 1 of orders is empty
+	if msgs, err := s.FetchMessages("orders", 1, 0, 10); err != nil || len(msgs) != 0 {
+		t.Errorf("Expected no messages in an empty partition, got %d (%v)", len(msgs), err)
+	}
+	if offset, err := s.GetStartOffset("orders", 1); err != nil || offset != 0 {
+		t.Errorf("Expected start offset 0 of an empty partition, got %d (%v)", offset, err)
+	}
+	if offset, _ := s.OffsetForTimestamp("orders", 1, 0); offset != 0 {
+		t.Errorf("Expected offset 0 for a timestamp in an empty partition, got %d", offset)
+	}
+
+	s.AppendMessage("orders", 1, "k", []byte("a"))
+
+	// Fetching at the log end finds nothing
+	msgs, next, err := s.FetchMessagesFiltered("orders", 1, 1, 10, 10, nil)
+	if err != nil || len(msgs) != 0 || next != 1 {
+		t.Errorf("Expected nothing past the log end, got %d messages, next %d (%v)", len(msgs), next, err)
+	}
+	if msgs, _ := s.FetchMessages("orders", 1, 0, 10); len(msgs) != 1 || string(msgs[0].Value) != "a" {
+		t.Errorf("Expected only the partition's own message, got %d", len(msgs))
+	}
+
+	desc, err := s.DescribeTopic("orders")
+	if err != nil {
+		t.Fatalf("Failed to describe: %v", err)
+	}
+	stats := desc.Partitions[1]
+	if stats.Messages != 1 || stats.EarliestOffset != 0 || stats.LatestOffset != 1 {
+		t.Errorf("Expected 1 message at offset 0, got %+v", stats)
+	}
+	if _, err := s.DescribeTopic("orders:1"); err != nil {
+		t.Errorf("Failed to describe orders:1: %v", err)
+	}
+}
+
+// TestDeleteConsumerOffsetsKeepsPrefixedGroups tests that deleting a
+// group's offsets leaves groups whose names extend it untouched
+func TestDeleteConsumerOffsetsKeepsPrefixedGroups(t *testing.T) {
+	s := createTestStreamStorage(t)
+	createTestTopic(t, s, "orders", 1)
+
+	s.CommitOffset("copy", "orders", 0, 1)
+	s.CommitOffset("copy:1", "orders", 0, 2)
+
+	if err := s.DeleteConsumerOffsets("copy", "orders"); err != nil {
+		t.Fatalf("Failed to delete offsets: %v", err)
+	}
+
+	if got := consumerOffsets(t, s, "orders"); len(got) != 1 || got["copy:1/0"] != 2 {
+		t.Errorf("Expected only copy:1/0=2 left, got %v", got)
+	}
+}
+
+// TestMigrateLegacyConsumerOffsets tests that offsets stored under the
+// group-first keys are moved to their topics on open
+func TestMigrateLegacyConsumerOffsets(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStreamStorage(dir)
+	if err != nil {
+		t.Fatalf("Failed to create stream storage: %v", err)
+	}
+	createTestTopic(t, s, "b", 1)
+	createTestTopic(t, s, "a:b", 1)
+
+	legacy := map[string]int64{
+		"g1:b:0":        1,
+		"g2:a:b:0":      2, // the longer topic wins
+		"g3:gone:0":     3, // topic deleted
+		"not-an-offset": 4,
+	}
+	err = s.db.Update(func(txn *badger.Txn) error {
+		for rest, offset := range legacy {
+			data := make([]byte, 16)
+			binary.BigEndian.PutUint64(data, uint64(offset))
+			if err := txn.Set([]byte(legacyConsumerOffsetPrefix+rest), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to write legacy offsets: %v", err)
+	}
+	s.Close()
+
+	s, err = NewStreamStorage(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen stream storage: %v", err)
+	}
+	defer s.Close()
+
+	if got := consumerOffsets(t, s, "b"); len(got) != 1 || got["g1/0"] != 1 {
+		t.Errorf("Expected g1/0=1 on b, got %v", got)
+	}
+	if got := consumerOffsets(t, s, "a:b"); len(got) != 1 || got["g2/0"] != 2 {
+		t.Errorf("Expected g2/0=2 on a:b, got %v", got)
+	}
+
+	left := 0
+	s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(legacyConsumerOffsetPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			left++
+		}
+		return nil
+	})
+	if left != 0 {
+		t.Errorf("Expected no legacy offsets left, got %d", left)
+	}
+}
+
+// TestCompactPartition tests that compaction keeps the latest message per
+// key and drops tombstones once they expire
+func TestCompactPartition(t *testing.T) {
+	s := createTestStreamStorage(t)
+	createTestTopic(t, s, "users", 1)
+
+	records := []Record{
+		{Key: "a", Value: []byte("a1")},
+		{Key: "b", Value: []byte("b1")},
+		{Key: "", Value: []byte("keyless1")},
+		{Key: "a", Value: []byte("a2")},
+		{Key: "c", Value: []byte("c1")},
+		{Key: "b", Value: nil}, // tombstone
+		{Key: "", Value: []byte("keyless2")},
+		{Key: "a", Value: []byte("a3")},
+	}
+	if _, err := s.AppendMessages("users", 0, records); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+
+	deleted, err := s.CompactPartition("users", 0, time.Hour.Milliseconds())
+	if err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	if deleted != 3 {
+		t.Errorf("Expected 3 superseded messages deleted, got %d", deleted)
+	}
+
+	values := func() []string {
+		msgs, err := s.FetchMessages("users", 0, 0, 100)
+		if err != nil {
+			t.Fatalf("Failed to fetch: %v", err)
+		}
+		var got []string
+		for _, m := range msgs {
+			got = append(got, m.Key+"="+string(m.Value))
+		}
+		return got
+	}
+	want := "[=keyless1 c=c1 b= =keyless2 a=a3]"
+	if got := fmt.Sprint(values()); got != want {
+		t.Errorf("Expected %s after compaction, got %s", want, got)
+	}
+
+	// The tombstone goes once it is older than the retention
+	time.Sleep(5 * time.Millisecond)
+	deleted, err = s.CompactPartition("users", 0, 1)
+	if err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("Expected the expired tombstone deleted, got %d", deleted)
+	}
+	want = "[=keyless1 c=c1 =keyless2 a=a3]"
+	if got := fmt.Sprint(values()); got != want {
+		t.Errorf("Expected %s after tombstone expiry, got %s", want, got)
+	}
+}
+
+// TestRetentionKeepsPrefixedTopics tests that time and size retention and
+// compaction of a partition leave the messages of a topic whose name
+// extends it untouched
+func TestRetentionKeepsPrefixedTopics(t *testing.T) {
+	tests := []struct {
+		name    string
+		cleanup func(s *StreamStorage) (int, error)
+		deleted int
+	}{
+		{"time", func(s *StreamStorage) (int, error) { return s.DeleteOldMessages("orders", 1, 1) }, 3},
+		{"size", func(s *StreamStorage) (int, error) { return s.DeleteExcessBytes("orders", 1, 0) }, 3},
+		{"compaction", func(s *StreamStorage) (int, error) { return s.CompactPartition("orders", 1, time.Hour.Milliseconds()) }, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := createTestStreamStorage(t)
+			createTestTopic(t, s, "orders", 2)
+			createTestTopic(t, s, "orders:1", 1)
+
+			records := []Record{{Key: "a", Value: []byte("1")}, {Key: "a", Value: []byte("2")}, {Key: "a", Value: []byte("3")}}
+			s.AppendMessages("orders", 1, records)
+			s.AppendMessages("orders:1", 0, records)
+			time.Sleep(5 * time.Millisecond)
+
+			deleted, err := tt.cleanup(s)
+			if err != nil {
+				t.Fatalf("Failed to clean up: %v", err)
+			}
+			if deleted != tt.deleted {
+				t.Errorf("Expected %d messages deleted, got %d", tt.deleted, deleted)
+			}
+
+			msgs, err := s.FetchMessages("orders:1", 0, 0, 10)
+			if err != nil || len(msgs) != 3 {
+				t.Errorf("Expected orders:1 to keep 3 messages, got %d (%v)", len(msgs), err)
+			}
+		})
+	}
+}
+
+// TestCompactPartitionPages tests compaction of a partition larger than
+// one page
+func TestCompactPartitionPages(t *testing.T) {
+	s := createTestStreamStorage(t)
+	createTestTopic(t, s, "users", 1)
+
+	n := deleteBatchSize*2 + 500
+	records := make([]Record, n)
+	for i := range records {
+		records[i] = Record{Key: fmt.Sprintf("k%d", i%10), Value: []byte(fmt.Sprint(i))}
+	}
+	if _, err := s.AppendMessages("users", 0, records); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+
+	deleted, err := s.CompactPartition("users", 0, time.Hour.Milliseconds())
+	if err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	if deleted != n-10 {
+		t.Errorf("Expected %d messages deleted, got %d", n-10, deleted)
+	}
+
+	msgs, err := s.FetchMessages("users", 0, 0, n)
+	if err != nil {
+		t.Fatalf("Failed to fetch: %v", err)
+	}
+	if len(msgs) != 10 {
+		t.Fatalf("Expected 10 messages left, got %d", len(msgs))
+	}
+	for _, m := range msgs {
+		if m.Offset < int64(n-10) {
+			t.Errorf("Expected only the last message per key, got offset %d", m.Offset)
+		}
+	}
+}
+
+// TestAppendMessagesIdempotent tests that a producer's last batch is
+// deduplicated and that older or skipped sequences are rejected
+func TestAppendMessagesIdempotent(t *testing.T) {
+	s := createTestStreamStorage(t)
+	createTestTopic(t, s, "orders", 2)
+
+	batch := []Record{{Value: []byte("a")}, {Value: []byte("b")}}
+
+	tests := []struct {
+		name        string
+		partition   int
+		producerID  uint64
+		sequence    uint64
+		wantOffsets []int64
+		wantErr     error
+	}{
+		{"first batch", 0, 1, 0, []int64{0, 1}, nil},
+		{"retry returns original offsets", 1, 1, 0, []int64{0, 1}, nil},
+		{"next batch", 0, 1, 2, []int64{2, 3}, nil},
+		{"older batch", 0, 1, 0, nil, ErrDuplicateSequence},
+		{"inside last batch", 0, 1, 3, nil, ErrDuplicateSequence},
+		{"gap", 0, 1, 5, nil, ErrOutOfOrderSequence},
+		{"own sequence per producer", 0, 2, 0, []int64{4, 5}, nil},
+		{"continues after rejections", 1, 1, 4, []int64{0, 1}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, offsets, err := s.AppendMessagesIdempotent("orders", tt.partition, batch, tt.producerID, tt.sequence)
+			if err != tt.wantErr {
+				t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+			}
+			if fmt.Sprint(offsets) != fmt.Sprint(tt.wantOffsets) {
+				t.Errorf("Expected offsets %v, got %v", tt.wantOffsets, offsets)
+			}
+		})
+	}
+
+	// The retry went to the original partition, not the one requested
+	for partition, want := range []int{6, 2} {
+		msgs, _ := s.FetchMessages("orders", partition, 0, 100)
+		if len(msgs) != want {
+			t.Errorf("Expected %d messages in partition %d, got %d", want, partition, len(msgs))
+		}
+	}
+}
+
+// TestCommitTransaction tests sequence checks for transactions, that a
+// retry returns the original results and that a failed transaction writes
+// neither records nor offsets
+func TestCommitTransaction(t *testing.T) {
+	s := createTestStreamStorage(t)
+	createTestTopic(t, s, "in", 1)
+	createTestTopic(t, s, "out", 1)
+	createTestTopic(t, s, "broken", 1)
+
+	// Records for broken fail to append once the others are written
+	s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(makeTopicMetaKey("broken")), []byte("garbage"))
+	})
+
+	txn := func(sequence uint64, topics ...string) *Transaction {
+		t := &Transaction{
+			ProducerID: 1,
+			Sequence:   sequence,
+			Offsets:    []ConsumerOffset{{Group: "g", Topic: "in", Partition: 0, Offset: int64(sequence)}},
+		}
+		for _, topic := range topics {
+			t.Records = append(t.Records, TxnRecord{Topic: topic, Record: Record{Value: []byte(topic)}})
+		}
+		return t
+	}
+
+	tests := []struct {
+		name        string
+		txn         *Transaction
+		wantOffsets []int64
+		wantErr     bool
+	}{
+		{"first", txn(1, "out", "out"), []int64{0, 1}, false},
+		{"failed append", txn(2, "out", "broken"), nil, true},
+		{"retry after failure", txn(2, "out"), []int64{2}, false},
+		{"retry", txn(2, "out"), []int64{2}, false},
+		{"gap", txn(4, "out"), nil, true},
+		{"next", txn(3, "out", "out"), []int64{3, 4}, false},
+		{"retry of next", txn(3, "out", "out"), []int64{3, 4}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := s.CommitTransaction(tt.txn)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			var offsets []int64
+			for _, r := range results {
+				offsets = append(offsets, r.Offset)
+			}
+			if fmt.Sprint(offsets) != fmt.Sprint(tt.wantOffsets) {
+				t.Errorf("Expected offsets %v, got %v", tt.wantOffsets, offsets)
+			}
+		})
+	}
+
+	// A retry keeps the partitions first written to, even if the records
+	// would now be sent elsewhere
+	moved := txn(3, "out", "out")
+	moved.Records[1].Partition = 1
+	if results, err := s.CommitTransaction(moved); err != nil || results[1].Partition != 0 || results[1].Offset != 4 {
+		t.Errorf("Expected the original partition 0 and offset 4, got %v (%v)", results, err)
+	}
+
+	if _, err := s.CommitTransaction(txn(2, "out")); err != ErrDuplicateSequence {
+		t.Errorf("Expected ErrDuplicateSequence for an older transaction, got %v", err)
+	}
+	if _, err := s.CommitTransaction(txn(3, "out")); err != ErrDuplicateSequence {
+		t.Errorf("Expected ErrDuplicateSequence for a different transaction, got %v", err)
+	}
+	if _, err := s.CommitTransaction(txn(5, "out")); err != ErrOutOfOrderSequence {
+		t.Errorf("Expected ErrOutOfOrderSequence, got %v", err)
+	}
+
+	msgs, err := s.FetchMessages("out", 0, 0, 100)
+	if err != nil {
+		t.Fatalf("Failed to fetch: %v", err)
+	}
+	if len(msgs) != 5 {
+		t.Errorf("Expected only committed records, got %d", len(msgs))
+	}
+	if offset, _ := s.GetConsumerOffset("g", "in", 0); offset != 3 {
+		t.Errorf("Expected offset 3 from the last commit, got %d", offset)
+	}
+
+	// A zero producer ID skips the sequence check
+	plain := txn(1, "out")
+	plain.ProducerID = 0
+	if results, err := s.CommitTransaction(plain); err != nil || results[0].Offset != 5 {
+		t.Errorf("Expected a non-idempotent transaction at offset 5, got %v (%v)", results, err)
+	}
+
+	// State from before results were kept holds only the sequence
+	legacy := make([]byte, 8)
+	binary.BigEndian.PutUint64(legacy, 7)
+	s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(makeTxnSeqKey(2)), legacy)
+	})
+	old := txn(7, "out")
+	old.ProducerID = 2
+	if _, err := s.CommitTransaction(old); err != ErrDuplicateSequence {
+		t.Errorf("Expected ErrDuplicateSequence without stored results, got %v", err)
+	}
+	old.Sequence = 8
+	if results, err := s.CommitTransaction(old); err != nil || results[0].Offset != 6 {
+		t.Errorf("Expected the next transaction at offset 6, got %v (%v)", results, err)
+	}
+}
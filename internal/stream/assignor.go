@@ -0,0 +1,159 @@
+package stream
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Assignment strategies
+const (
+	StrategyRange      = "range"
+	StrategyRoundRobin = "roundrobin"
+	StrategySticky     = "sticky"
+
+	DefaultStrategy = StrategyRange
+)
+
+// Assignor distributes a topic's partitions across the members of a group.
+// consumers is sorted by ID and current holds the previous assignment, so
+// every strategy is deterministic for the same membership.
+type Assignor interface {
+	Name() string
+	Assign(partitions int, consumers []string, current map[string][]int) map[string][]int
+}
+
+var assignors = map[string]Assignor{
+	StrategyRange:      rangeAssignor{},
+	StrategyRoundRobin: roundRobinAssignor{},
+	StrategySticky:     stickyAssignor{},
+}
+
+// GetAssignor returns the assignor for a strategy name.
+// An empty name selects DefaultStrategy.
+func GetAssignor(name string) (Assignor, error) {
+	if name == "" {
+		name = DefaultStrategy
+	}
+	a, ok := assignors[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown assignment strategy: %s", name)
+	}
+	return a, nil
+}
+
+// rangeAssignor gives each consumer a contiguous block of partitions
+type rangeAssignor struct{}
+
+func (rangeAssignor) Name() string { return StrategyRange }
+
+func (rangeAssignor) Assign(partitions int, consumers []string, _ map[string][]int) map[string][]int {
+	result := make(map[string][]int, len(consumers))
+	if len(consumers) == 0 {
+		return result
+	}
+
+	perConsumer := partitions / len(consumers)
+	extra := partitions % len(consumers)
+
+	next := 0
+	for i, id := range consumers {
+		n := perConsumer
+		if i < extra {
+			n++
+		}
+		parts := make([]int, 0, n)
+		for j := 0; j < n; j++ {
+			parts = append(parts, next)
+			next++
+		}
+		result[id] = parts
+	}
+	return result
+}
+
+// roundRobinAssignor deals partitions out one at a time
+type roundRobinAssignor struct{}
+
+func (roundRobinAssignor) Name() string { return StrategyRoundRobin }
+
+func (roundRobinAssignor) Assign(partitions int, consumers []string, _ map[string][]int) map[string][]int {
+	result := make(map[string][]int, len(consumers))
+	if len(consumers) == 0 {
+		return result
+	}
+
+	for _, id := range consumers {
+		result[id] = []int{}
+	}
+	for p := 0; p < partitions; p++ {
+		id := consumers[p%len(consumers)]
+		result[id] = append(result[id], p)
+	}
+	return result
+}
+
+// stickyAssignor keeps the balance of range/round-robin while moving as
+// few partitions as possible away from their previous owner
+type stickyAssignor struct{}
+
+func (stickyAssignor) Name() string { return StrategySticky }
+
+func (stickyAssignor) Assign(partitions int, consumers []string, current map[string][]int) map[string][]int {
+	result := make(map[string][]int, len(consumers))
+	if len(consumers) == 0 {
+		return result
+	}
+
+	// Consumers already holding the most partitions get the extra slots
+	order := make([]string, len(consumers))
+	copy(order, consumers)
+	sort.SliceStable(order, func(i, j int) bool {
+		return len(current[order[i]]) > len(current[order[j]])
+	})
+
+	base := partitions / len(consumers)
+	extra := partitions % len(consumers)
+	quota := make(map[string]int, len(consumers))
+	for i, id := range order {
+		quota[id] = base
+		if i < extra {
+			quota[id]++
+		}
+	}
+
+	// Keep previous partitions up to each consumer's quota
+	taken := make([]bool, partitions)
+	for _, id := range order {
+		kept := make([]int, 0, quota[id])
+		prev := append([]int(nil), current[id]...)
+		sort.Ints(prev)
+		for _, p := range prev {
+			if len(kept) == quota[id] {
+				break
+			}
+			if p < 0 || p >= partitions || taken[p] {
+				continue
+			}
+			taken[p] = true
+			kept = append(kept, p)
+		}
+		result[id] = kept
+	}
+
+	// Hand the remaining partitions to consumers below quota
+	i := 0
+	for p := 0; p < partitions; p++ {
+		if taken[p] {
+			continue
+		}
+		for len(result[consumers[i]]) >= quota[consumers[i]] {
+			i++
+		}
+		result[consumers[i]] = append(result[consumers[i]], p)
+	}
+
+	for _, parts := range result {
+		sort.Ints(parts)
+	}
+	return result
+}
@@ -0,0 +1,55 @@
+package stream
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestAssignors tests the partitions each strategy gives each consumer
+func TestAssignors(t *testing.T) {
+	tests := []struct {
+		name       string
+		strategy   string
+		partitions int
+		consumers  []string
+		current    map[string][]int
+		want       string
+	}{
+		{"range uneven", StrategyRange, 5, []string{"a", "b"}, nil, "map[a:[0 1 2] b:[3 4]]"},
+		{"range more consumers", StrategyRange, 2, []string{"a", "b", "c"}, nil, "map[a:[0] b:[1] c:[]]"},
+		{"range no consumers", StrategyRange, 3, nil, nil, "map[]"},
+		{"roundrobin uneven", StrategyRoundRobin, 5, []string{"a", "b"}, nil, "map[a:[0 2 4] b:[1 3]]"},
+		{"roundrobin more consumers", StrategyRoundRobin, 2, []string{"a", "b", "c"}, nil, "map[a:[0] b:[1] c:[]]"},
+		{"sticky fresh", StrategySticky, 5, []string{"a", "b"}, nil, "map[a:[0 1 2] b:[3 4]]"},
+		{"sticky join", StrategySticky, 5, []string{"a", "b", "c"},
+			map[string][]int{"a": {0, 1, 2}, "b": {3, 4}}, "map[a:[0 1] b:[3 4] c:[2]]"},
+		{"sticky leave", StrategySticky, 5, []string{"a", "c"},
+			map[string][]int{"a": {0, 1}, "b": {3, 4}, "c": {2}}, "map[a:[0 1 3] c:[2 4]]"},
+		{"sticky keeps larger owner's extra slot", StrategySticky, 3, []string{"a", "b"},
+			map[string][]int{"b": {0, 1}, "a": {2}}, "map[a:[2] b:[0 1]]"},
+		{"sticky drops stale partitions", StrategySticky, 2, []string{"a", "b"},
+			map[string][]int{"a": {0, 7}, "b": {0, 1}}, "map[a:[0] b:[1]]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := GetAssignor(tt.strategy)
+			if err != nil {
+				t.Fatalf("Failed to get assignor: %v", err)
+			}
+			if a.Name() != tt.strategy {
+				t.Errorf("Expected assignor %s, got %s", tt.strategy, a.Name())
+			}
+			if got := fmt.Sprint(a.Assign(tt.partitions, tt.consumers, tt.current)); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	if a, err := GetAssignor(""); err != nil || a.Name() != DefaultStrategy {
+		t.Errorf("Expected the default strategy for an empty name, got %v", err)
+	}
+	if _, err := GetAssignor("unknown"); err == nil {
+		t.Error("Expected an unknown strategy to fail")
+	}
+}
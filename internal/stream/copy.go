@@ -0,0 +1,670 @@
+package stream
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/skshohagmiah/flin/internal/net"
+	"github.com/skshohagmiah/flin/internal/protocol"
+	"github.com/skshohagmiah/flin/internal/storage"
+)
+
+var (
+	ErrCopyJobRunning  = errors.New("copy job already running")
+	ErrCopyJobNotFound = errors.New("copy job not found")
+)
+
+// Copy job states
+const (
+	CopyRunning   = "running"
+	CopyCompleted = "completed"
+	CopyStopped   = "stopped"
+	CopyFailed    = "failed"
+)
+
+// CopyGroupPrefix prefixes the consumer group that holds a copy job's
+// checkpoints, so its progress shows up in group lag
+const CopyGroupPrefix = "__copy."
+
+const (
+	copyBatchSize     = 500
+	copyPollInterval  = time.Second
+	copyRetryInterval = 5 * time.Second
+)
+
+// errCopyInterrupted ends a copy loop on StopCopy or server shutdown
+var errCopyInterrupted = errors.New("copy interrupted")
+
+// CopyConfig describes a job that copies a source topic into a target
+// topic, on this node or on another Flin node
+type CopyConfig struct {
+	Name   string
+	Source string
+	Target string
+	// TargetAddr is the binary protocol address of a remote node; empty
+	// copies into this node
+	TargetAddr string
+	// StartOffset is the first offset copied from each partition
+	StartOffset int64
+	// EndOffset stops each partition before this offset; 0 keeps
+	// following the source, mirroring new messages as they arrive
+	EndOffset int64
+}
+
+// CopyStatus reports a copy job's state and progress
+type CopyStatus struct {
+	CopyConfig
+	State string
+	// Error is why the job failed, or the last remote error it is retrying
+	Error string
+	// Copied counts messages copied since the job last started
+	Copied int64
+	// Lag is how many source messages remain to be copied
+	Lag int64
+}
+
+// copyJob is a running or finished copy
+type copyJob struct {
+	cfg  CopyConfig
+	stop chan struct{}
+	done chan struct{}
+
+	mu     sync.Mutex
+	state  string
+	err    string
+	copied int64
+}
+
+// copySink writes copied messages to the target together with the
+// checkpoint that records them as copied
+type copySink interface {
+	write(partition int, msgs []*storage.Message, checkpoint storage.ConsumerOffset) error
+	close()
+}
+
+// StartCopy starts a copy job, creating the target topic with the source's
+// configuration if needed. Starting a stopped, failed or completed job
+// again resumes it from its checkpoints under the new config.
+//
+// Local copies write each batch and its checkpoint atomically, so every
+// message is copied exactly once. Remote copies checkpoint after the batch
+// is acknowledged, so a crash in between may copy that batch twice.
+func (s *Stream) StartCopy(cfg CopyConfig) error {
+	if cfg.Name == "" || cfg.Source == "" || cfg.Target == "" {
+		return fmt.Errorf("copy job needs a name, source and target")
+	}
+	if cfg.TargetAddr == "" && cfg.Target == cfg.Source {
+		return fmt.Errorf("copy job target must differ from source")
+	}
+	if cfg.StartOffset < 0 {
+		cfg.StartOffset = 0
+	}
+	if _, err := s.GetTopicMetadata(cfg.Source); err != nil {
+		return err
+	}
+
+	s.copyMu.Lock()
+	defer s.copyMu.Unlock()
+
+	if j, ok := s.copyJobs[cfg.Name]; ok && j.status().State == CopyRunning {
+		return ErrCopyJobRunning
+	}
+
+	j := &copyJob{cfg: cfg, state: CopyRunning}
+	if err := s.storage.SaveCopyJob(j.persisted()); err != nil {
+		return err
+	}
+	s.runCopyJob(j)
+	return nil
+}
+
+// StopCopy stops a running copy job, keeping its checkpoints so that
+// StartCopy can resume it
+func (s *Stream) StopCopy(name string) error {
+	s.copyMu.Lock()
+	defer s.copyMu.Unlock()
+
+	j, ok := s.copyJobs[name]
+	if !ok {
+		return ErrCopyJobNotFound
+	}
+	s.haltCopyJob(j)
+
+	if j.status().State != CopyRunning {
+		return nil
+	}
+	j.setState(CopyStopped, "")
+	return s.storage.SaveCopyJob(j.persisted())
+}
+
+// DeleteCopy stops a copy job and removes it with its checkpoints
+func (s *Stream) DeleteCopy(name string) error {
+	s.copyMu.Lock()
+	defer s.copyMu.Unlock()
+
+	j, ok := s.copyJobs[name]
+	if !ok {
+		return ErrCopyJobNotFound
+	}
+	s.haltCopyJob(j)
+	delete(s.copyJobs, name)
+
+	if err := s.storage.DeleteCopyJob(name); err != nil {
+		return err
+	}
+	return s.storage.DeleteConsumerOffsets(CopyGroupPrefix+name, j.cfg.Source)
+}
+
+// ListCopyJobs returns every copy job, sorted by name
+func (s *Stream) ListCopyJobs() ([]CopyStatus, error) {
+	s.copyMu.Lock()
+	jobs := make([]*copyJob, 0, len(s.copyJobs))
+	for _, j := range s.copyJobs {
+		jobs = append(jobs, j)
+	}
+	s.copyMu.Unlock()
+
+	statuses := make([]CopyStatus, 0, len(jobs))
+	for _, j := range jobs {
+		st := j.status()
+		if lag, err := s.copyLag(j.cfg); err == nil {
+			st.Lag = lag
+		}
+		statuses = append(statuses, st)
+	}
+	sort.Slice(statuses, func(i, k int) bool { return statuses[i].Name < statuses[k].Name })
+	return statuses, nil
+}
+
+// loadCopyJobs restores persisted copy jobs and resumes the running ones
+func (s *Stream) loadCopyJobs() error {
+	states, err := s.storage.ListCopyJobs()
+	if err != nil {
+		return err
+	}
+
+	s.copyMu.Lock()
+	defer s.copyMu.Unlock()
+	for _, st := range states {
+		j := &copyJob{
+			cfg: CopyConfig{
+				Name:        st.Name,
+				Source:      st.Source,
+				Target:      st.Target,
+				TargetAddr:  st.TargetAddr,
+				StartOffset: st.StartOffset,
+				EndOffset:   st.EndOffset,
+			},
+			state: st.State,
+			err:   st.Error,
+		}
+		if st.State == CopyRunning {
+			s.runCopyJob(j)
+			continue
+		}
+		j.done = make(chan struct{})
+		close(j.done)
+		s.copyJobs[st.Name] = j
+	}
+	return nil
+}
+
+// runCopyJob registers j and starts its goroutine; caller holds copyMu
+func (s *Stream) runCopyJob(j *copyJob) {
+	j.stop = make(chan struct{})
+	j.done = make(chan struct{})
+	s.copyJobs[j.cfg.Name] = j
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer close(j.done)
+
+		err := s.copyLoop(j)
+		switch {
+		case errors.Is(err, errCopyInterrupted):
+			return // StopCopy or shutdown decides the persisted state
+		case err != nil:
+			j.setState(CopyFailed, err.Error())
+		default:
+			j.setState(CopyCompleted, "")
+		}
+		s.storage.SaveCopyJob(j.persisted())
+	}()
+}
+
+// haltCopyJob stops j's goroutine and waits for it; caller holds copyMu
+func (s *Stream) haltCopyJob(j *copyJob) {
+	select {
+	case <-j.done:
+		return
+	default:
+	}
+	close(j.stop)
+	<-j.done
+}
+
+// copyLoop copies batches until every partition reaches EndOffset, the
+// job is interrupted, or an unrecoverable error occurs
+func (s *Stream) copyLoop(j *copyJob) error {
+	cfg := j.cfg
+	group := CopyGroupPrefix + cfg.Name
+
+	positions, err := s.copyPositions(cfg)
+	if err != nil {
+		return err
+	}
+
+	var sink copySink
+	defer func() {
+		if sink != nil {
+			sink.close()
+		}
+	}()
+
+	for {
+		if err := j.interrupted(s.stopChan); err != nil {
+			return err
+		}
+
+		meta, err := s.GetTopicMetadata(cfg.Source)
+		if err != nil {
+			return err
+		}
+
+		if sink == nil {
+			opened, err := s.newCopySink(cfg, meta)
+			if err != nil {
+				if cfg.TargetAddr == "" {
+					return err
+				}
+				// The remote node may be down; keep trying
+				j.setState(CopyRunning, err.Error())
+				if err := j.wait(s.stopChan, nil, copyRetryInterval); err != nil {
+					return err
+				}
+				continue
+			}
+			sink = opened
+			j.setState(CopyRunning, "")
+		}
+
+		partitions := make([]int, meta.Partitions)
+		for p := range partitions {
+			partitions[p] = p
+		}
+		wake := make(chan struct{}, 1)
+		cancel := s.storage.Watch(cfg.Source, partitions, func() {
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		})
+
+		progressed, finished := false, true
+		for _, p := range partitions {
+			pos := positions[p]
+			if pos < cfg.StartOffset {
+				pos = cfg.StartOffset
+			}
+			if cfg.EndOffset > 0 && pos >= cfg.EndOffset {
+				continue
+			}
+
+			msgs, err := s.storage.FetchMessages(cfg.Source, p, pos, copyBatchSize)
+			if err != nil {
+				cancel()
+				return err
+			}
+			for i, msg := range msgs {
+				if cfg.EndOffset > 0 && msg.Offset >= cfg.EndOffset {
+					msgs = msgs[:i]
+					break
+				}
+			}
+
+			if len(msgs) == 0 {
+				if cfg.EndOffset == 0 {
+					finished = false
+					continue
+				}
+				// Done once the source has been written past EndOffset
+				last, err := s.storage.GetOffset(cfg.Source, p)
+				if err != nil {
+					cancel()
+					return err
+				}
+				if last+1 < cfg.EndOffset {
+					finished = false
+				}
+				continue
+			}
+
+			next := msgs[len(msgs)-1].Offset + 1
+			checkpoint := storage.ConsumerOffset{Group: group, Topic: cfg.Source, Partition: p, Offset: next}
+			if err := sink.write(p, msgs, checkpoint); err != nil {
+				cancel()
+				if cfg.TargetAddr == "" {
+					return err
+				}
+				sink.close()
+				sink = nil
+				j.setState(CopyRunning, err.Error())
+				if err := j.wait(s.stopChan, nil, copyRetryInterval); err != nil {
+					return err
+				}
+				progressed, finished = true, false
+				break
+			}
+
+			positions[p] = next
+			j.addCopied(len(msgs))
+			progressed, finished = true, false
+		}
+
+		if finished {
+			cancel()
+			return nil
+		}
+		if progressed {
+			cancel()
+			continue
+		}
+
+		// Caught up: wait for new messages, re-reading metadata now and
+		// then in case partitions were added
+		err = j.wait(s.stopChan, wake, copyPollInterval)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// copyPositions loads the job's checkpoints per source partition
+func (s *Stream) copyPositions(cfg CopyConfig) (map[int]int64, error) {
+	offsets, err := s.storage.ListConsumerOffsets(cfg.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	positions := make(map[int]int64)
+	for _, co := range offsets {
+		if co.Group == CopyGroupPrefix+cfg.Name {
+			positions[co.Partition] = co.Offset
+		}
+	}
+	return positions, nil
+}
+
+// copyLag counts the source messages a job has yet to copy
+func (s *Stream) copyLag(cfg CopyConfig) (int64, error) {
+	meta, err := s.GetTopicMetadata(cfg.Source)
+	if err != nil {
+		return 0, err
+	}
+	positions, err := s.copyPositions(cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	var lag int64
+	for p := 0; p < meta.Partitions; p++ {
+		last, err := s.storage.GetOffset(cfg.Source, p)
+		if err != nil {
+			return 0, err
+		}
+		end := last + 1
+		if cfg.EndOffset > 0 && cfg.EndOffset < end {
+			end = cfg.EndOffset
+		}
+		pos := positions[p]
+		if pos < cfg.StartOffset {
+			pos = cfg.StartOffset
+		}
+		if end > pos {
+			lag += end - pos
+		}
+	}
+	return lag, nil
+}
+
+// newCopySink opens the job's target, creating the topic with the
+// source's configuration if it does not exist
+func (s *Stream) newCopySink(cfg CopyConfig, source *storage.TopicMetadata) (copySink, error) {
+	if cfg.TargetAddr != "" {
+		return newRemoteCopySink(s, cfg.TargetAddr, cfg.Target, source)
+	}
+
+	meta, err := s.GetTopicMetadata(cfg.Target)
+	if err == storage.ErrTopicNotFound {
+		err = s.CreateTopicWithConfig(cfg.Target, topicConfigOf(source))
+		if err == nil {
+			meta, err = s.GetTopicMetadata(cfg.Target)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &localCopySink{s: s, target: cfg.Target, partitions: meta.Partitions}, nil
+}
+
+func topicConfigOf(meta *storage.TopicMetadata) TopicConfig {
+	return TopicConfig{
+		Partitions:     meta.Partitions,
+		RetentionMs:    meta.RetentionMs,
+		RetentionBytes: meta.RetentionBytes,
+		CleanupPolicy:  meta.CleanupPolicy,
+		Compression:    meta.Compression,
+		Partitioner:    meta.Partitioner,
+	}
+}
+
+// localCopySink appends to a topic on this node in the same transaction
+// as the checkpoint
+type localCopySink struct {
+	s          *Stream
+	target     string
+	partitions int
+}
+
+func (l *localCopySink) write(partition int, msgs []*storage.Message, checkpoint storage.ConsumerOffset) error {
+	t := &storage.Transaction{
+		Records: make([]storage.TxnRecord, len(msgs)),
+		Offsets: []storage.ConsumerOffset{checkpoint},
+	}
+	for i, msg := range msgs {
+		t.Records[i] = storage.TxnRecord{
+			Topic:     l.target,
+			Partition: partition % l.partitions,
+			Record:    recordOf(msg),
+		}
+	}
+	_, err := l.s.storage.CommitTransaction(t)
+	return err
+}
+
+func (l *localCopySink) close() {}
+
+// remoteCopySink publishes to a topic on another node over the binary
+// protocol and checkpoints locally once the node acknowledges
+type remoteCopySink struct {
+	s          *Stream
+	conn       *net.Connection
+	target     string
+	partitions int
+}
+
+func newRemoteCopySink(s *Stream, addr, target string, source *storage.TopicMetadata) (*remoteCopySink, error) {
+	conn, err := net.NewConnection(net.DefaultConnectionOptions(addr))
+	if err != nil {
+		return nil, err
+	}
+	r := &remoteCopySink{s: s, conn: conn, target: target}
+
+	resp, err := r.roundTrip(protocol.EncodeSDescribeRequest(target))
+	if errors.Is(err, storage.ErrTopicNotFound) {
+		_, err = r.roundTrip(protocol.EncodeSCreateTopicConfigRequest(target, source.Partitions,
+			source.RetentionMs, source.RetentionBytes, source.CleanupPolicy, source.Compression, source.Partitioner))
+		if err == nil {
+			resp, err = r.roundTrip(protocol.EncodeSDescribeRequest(target))
+		}
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// The first value is the topic: [2:nameLen][name][4:partitions]...
+	if len(resp.Values) == 0 || len(resp.Values[0]) < 2 {
+		conn.Close()
+		return nil, fmt.Errorf("invalid describe response from %s", addr)
+	}
+	info := resp.Values[0]
+	nameLen := int(binary.BigEndian.Uint16(info))
+	if len(info) < 2+nameLen+4 {
+		conn.Close()
+		return nil, fmt.Errorf("invalid describe response from %s", addr)
+	}
+	r.partitions = int(binary.BigEndian.Uint32(info[2+nameLen:]))
+	if r.partitions <= 0 {
+		conn.Close()
+		return nil, fmt.Errorf("remote topic %s has no partitions", target)
+	}
+	return r, nil
+}
+
+func (r *remoteCopySink) write(partition int, msgs []*storage.Message, checkpoint storage.ConsumerOffset) error {
+	keys := make([]string, len(msgs))
+	values := make([][]byte, len(msgs))
+	metas := make([]protocol.RecordMeta, len(msgs))
+	for i, msg := range msgs {
+		keys[i] = msg.Key
+		values[i] = msg.Value
+		metas[i] = protocol.RecordMeta{EventTime: msg.EventTime, Headers: msg.Headers}
+	}
+
+	frame := protocol.EncodeSMPublishRequest(r.target, partition%r.partitions, keys, values)
+	if _, err := r.roundTrip(protocol.EncodeSPublishMetaRequest(frame, 0, 0, metas)); err != nil {
+		return err
+	}
+	return r.s.storage.CommitOffset(checkpoint.Group, checkpoint.Topic, checkpoint.Partition, checkpoint.Offset)
+}
+
+func (r *remoteCopySink) roundTrip(request []byte) (*protocol.Response, error) {
+	if err := r.conn.Write(request); err != nil {
+		return nil, err
+	}
+	status, payloadLen, err := r.conn.ReadHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	frame := make([]byte, 5, 5+payloadLen)
+	frame[0] = status
+	binary.BigEndian.PutUint32(frame[1:], payloadLen)
+	if payloadLen > 0 {
+		payload, err := r.conn.Read(int(payloadLen))
+		if err != nil {
+			return nil, err
+		}
+		frame = append(frame, payload...)
+	}
+
+	resp, err := protocol.DecodeResponse(frame)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status == protocol.StatusError {
+		return nil, remoteError(resp.Error)
+	}
+	return resp, nil
+}
+
+// remoteError maps an error reply back to the storage sentinel it carries,
+// as the Go client does, so callers can match it with errors.Is
+func remoteError(msg string) error {
+	for _, sentinel := range []error{storage.ErrTopicNotFound} {
+		if msg == sentinel.Error() {
+			return sentinel
+		}
+	}
+	return errors.New(msg)
+}
+
+func (r *remoteCopySink) close() {
+	r.conn.Close()
+}
+
+func recordOf(msg *storage.Message) storage.Record {
+	return storage.Record{
+		Key:       msg.Key,
+		Value:     msg.Value,
+		EventTime: msg.EventTime,
+		Headers:   msg.Headers,
+	}
+}
+
+// interrupted returns errCopyInterrupted once the job or server is stopping
+func (j *copyJob) interrupted(shutdown <-chan struct{}) error {
+	select {
+	case <-j.stop:
+		return errCopyInterrupted
+	case <-shutdown:
+		return errCopyInterrupted
+	default:
+		return nil
+	}
+}
+
+// wait blocks until wake fires, d elapses, or the job is interrupted
+func (j *copyJob) wait(shutdown <-chan struct{}, wake <-chan struct{}, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-j.stop:
+		return errCopyInterrupted
+	case <-shutdown:
+		return errCopyInterrupted
+	case <-wake:
+	case <-timer.C:
+	}
+	return nil
+}
+
+func (j *copyJob) setState(state, err string) {
+	j.mu.Lock()
+	j.state, j.err = state, err
+	j.mu.Unlock()
+}
+
+func (j *copyJob) addCopied(n int) {
+	j.mu.Lock()
+	j.copied += int64(n)
+	j.mu.Unlock()
+}
+
+func (j *copyJob) status() CopyStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return CopyStatus{CopyConfig: j.cfg, State: j.state, Error: j.err, Copied: j.copied}
+}
+
+func (j *copyJob) persisted() *storage.CopyJobState {
+	st := j.status()
+	return &storage.CopyJobState{
+		Name:        st.Name,
+		Source:      st.Source,
+		Target:      st.Target,
+		TargetAddr:  st.TargetAddr,
+		StartOffset: st.StartOffset,
+		EndOffset:   st.EndOffset,
+		State:       st.State,
+		Error:       st.Error,
+	}
+}
@@ -0,0 +1,243 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/skshohagmiah/flin/internal/storage"
+)
+
+// TestRemoteError tests that error replies from a remote node map back to
+// the storage sentinels
+func TestRemoteError(t *testing.T) {
+	tests := []struct {
+		msg          string
+		wantNotFound bool
+	}{
+		{storage.ErrTopicNotFound.Error(), true},
+		{"topic not found: orders", false},
+		{"permission denied", false},
+	}
+
+	for _, tt := range tests {
+		err := remoteError(tt.msg)
+		if errors.Is(err, storage.ErrTopicNotFound) != tt.wantNotFound {
+			t.Errorf("remoteError(%q): expected topic not found %v, got %v", tt.msg, tt.wantNotFound, err)
+		}
+		if err.Error() != tt.msg {
+			t.Errorf("remoteError(%q): expected message kept, got %q", tt.msg, err.Error())
+		}
+	}
+}
+
+// waitFor polls cond until it holds or fails the test after a few seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// copyState returns a copy job's status
+func copyState(t *testing.T, s *Stream, name string) CopyStatus {
+	t.Helper()
+	jobs, err := s.ListCopyJobs()
+	if err != nil {
+		t.Fatalf("Failed to list copy jobs: %v", err)
+	}
+	for _, j := range jobs {
+		if j.Name == name {
+			return j
+		}
+	}
+	t.Fatalf("Copy job %s not found", name)
+	return CopyStatus{}
+}
+
+// partitionValues returns a partition's message values in offset order
+func partitionValues(t *testing.T, s *Stream, topic string, partition int) []string {
+	t.Helper()
+	msgs, err := s.Fetch(topic, partition, 0, 1000)
+	if err != nil {
+		t.Fatalf("Failed to fetch %s/%d: %v", topic, partition, err)
+	}
+	values := make([]string, len(msgs))
+	for i, m := range msgs {
+		values[i] = string(m.Value)
+	}
+	return values
+}
+
+func publishValues(t *testing.T, s *Stream, topic string, partition int, values ...string) {
+	t.Helper()
+	for _, v := range values {
+		if _, _, err := s.Publish(topic, partition, "", []byte(v)); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+	}
+}
+
+// TestCopyToEndOffset tests that a local copy with an end offset copies
+// each partition up to it and completes
+func TestCopyToEndOffset(t *testing.T) {
+	s := createTestStream(t)
+	if err := s.CreateTopic("src", 2, 0); err != nil {
+		t.Fatalf("Failed to create topic: %v", err)
+	}
+	publishValues(t, s, "src", 0, "a0", "a1", "a2", "a3")
+	publishValues(t, s, "src", 1, "b0", "b1")
+
+	err := s.StartCopy(CopyConfig{Name: "job", Source: "src", Target: "dst", StartOffset: 1, EndOffset: 3})
+	if err != nil {
+		t.Fatalf("Failed to start copy: %v", err)
+	}
+	if err := s.StartCopy(CopyConfig{Name: "job", Source: "src", Target: "dst"}); err != ErrCopyJobRunning {
+		t.Errorf("Expected a second start to fail while running, got %v", err)
+	}
+
+	// Partition 1 ends at offset 2, so the job waits for offset 2 there
+	time.Sleep(50 * time.Millisecond)
+	if st := copyState(t, s, "job"); st.State != CopyRunning {
+		t.Errorf("Expected the job to wait for partition 1 to reach its end, got %s", st.State)
+	}
+	publishValues(t, s, "src", 1, "b2", "b3")
+	waitFor(t, "the copy to complete", func() bool { return copyState(t, s, "job").State == CopyCompleted })
+
+	if got := fmt.Sprint(partitionValues(t, s, "dst", 0)); got != "[a1 a2]" {
+		t.Errorf("Expected [a1 a2] in partition 0, got %s", got)
+	}
+	if got := fmt.Sprint(partitionValues(t, s, "dst", 1)); got != "[b1 b2]" {
+		t.Errorf("Expected [b1 b2] in partition 1, got %s", got)
+	}
+	if st := copyState(t, s, "job"); st.Copied != 4 || st.Lag != 0 {
+		t.Errorf("Expected 4 copied and no lag, got %d and %d", st.Copied, st.Lag)
+	}
+}
+
+// TestCopyResumesFromCheckpoints tests that a stopped copy started again
+// continues from its checkpoints without copying anything twice
+func TestCopyResumesFromCheckpoints(t *testing.T) {
+	s := createTestStream(t)
+	if err := s.CreateTopic("src", 1, 0); err != nil {
+		t.Fatalf("Failed to create topic: %v", err)
+	}
+	publishValues(t, s, "src", 0, "m0", "m1", "m2")
+
+	cfg := CopyConfig{Name: "mirror", Source: "src", Target: "dst"}
+	if err := s.StartCopy(cfg); err != nil {
+		t.Fatalf("Failed to start copy: %v", err)
+	}
+	waitFor(t, "the first messages", func() bool { return len(partitionValues(t, s, "dst", 0)) == 3 })
+
+	// A mirror follows new messages
+	publishValues(t, s, "src", 0, "m3")
+	waitFor(t, "the mirrored message", func() bool { return len(partitionValues(t, s, "dst", 0)) == 4 })
+
+	if err := s.StopCopy("mirror"); err != nil {
+		t.Fatalf("Failed to stop copy: %v", err)
+	}
+	if st := copyState(t, s, "mirror"); st.State != CopyStopped {
+		t.Errorf("Expected the job stopped, got %s", st.State)
+	}
+	if offset, ok, _ := s.CommittedOffset(CopyGroupPrefix+"mirror", "src", 0); !ok || offset != 4 {
+		t.Errorf("Expected checkpoint 4, got %d (%v)", offset, ok)
+	}
+
+	publishValues(t, s, "src", 0, "m4", "m5")
+	time.Sleep(50 * time.Millisecond)
+	if n := len(partitionValues(t, s, "dst", 0)); n != 4 {
+		t.Errorf("Expected nothing copied while stopped, got %d messages", n)
+	}
+	if st := copyState(t, s, "mirror"); st.Lag != 2 {
+		t.Errorf("Expected lag 2 while stopped, got %d", st.Lag)
+	}
+
+	if err := s.StartCopy(cfg); err != nil {
+		t.Fatalf("Failed to restart copy: %v", err)
+	}
+	waitFor(t, "the resumed copy", func() bool { return len(partitionValues(t, s, "dst", 0)) >= 6 })
+	time.Sleep(50 * time.Millisecond)
+
+	if got := fmt.Sprint(partitionValues(t, s, "dst", 0)); got != "[m0 m1 m2 m3 m4 m5]" {
+		t.Errorf("Expected each message copied once, got %s", got)
+	}
+	if st := copyState(t, s, "mirror"); st.Copied != 2 {
+		t.Errorf("Expected 2 copied since the restart, got %d", st.Copied)
+	}
+}
+
+// TestCopyIntoFewerPartitions tests that source partitions wrap around a
+// target with fewer partitions
+func TestCopyIntoFewerPartitions(t *testing.T) {
+	s := createTestStream(t)
+	if err := s.CreateTopic("src", 4, 0); err != nil {
+		t.Fatalf("Failed to create topic: %v", err)
+	}
+	if err := s.CreateTopic("dst", 2, 0); err != nil {
+		t.Fatalf("Failed to create topic: %v", err)
+	}
+	for p := 0; p < 4; p++ {
+		publishValues(t, s, "src", p, fmt.Sprintf("p%d", p))
+	}
+
+	if err := s.StartCopy(CopyConfig{Name: "job", Source: "src", Target: "dst", EndOffset: 1}); err != nil {
+		t.Fatalf("Failed to start copy: %v", err)
+	}
+	waitFor(t, "the copy to complete", func() bool { return copyState(t, s, "job").State == CopyCompleted })
+
+	for p, want := range []string{"[p0 p2]", "[p1 p3]"} {
+		values := partitionValues(t, s, "dst", p)
+		sort.Strings(values)
+		if got := fmt.Sprint(values); got != want {
+			t.Errorf("Expected %s in partition %d, got %s", want, p, got)
+		}
+	}
+}
+
+// TestDeleteCopyRemovesCheckpoints tests that deleting a job forgets it
+// and its checkpoints, so a new job of the same name starts over
+func TestDeleteCopyRemovesCheckpoints(t *testing.T) {
+	s := createTestStream(t)
+	if err := s.CreateTopic("src", 2, 0); err != nil {
+		t.Fatalf("Failed to create topic: %v", err)
+	}
+	publishValues(t, s, "src", 0, "a")
+	publishValues(t, s, "src", 1, "b")
+
+	cfg := CopyConfig{Name: "job", Source: "src", Target: "dst", EndOffset: 1}
+	if err := s.StartCopy(cfg); err != nil {
+		t.Fatalf("Failed to start copy: %v", err)
+	}
+	waitFor(t, "the copy to complete", func() bool { return copyState(t, s, "job").State == CopyCompleted })
+
+	if err := s.DeleteCopy("job"); err != nil {
+		t.Fatalf("Failed to delete copy: %v", err)
+	}
+	if err := s.DeleteCopy("job"); err != ErrCopyJobNotFound {
+		t.Errorf("Expected ErrCopyJobNotFound for a deleted job, got %v", err)
+	}
+	for p := 0; p < 2; p++ {
+		if _, ok, _ := s.CommittedOffset(CopyGroupPrefix+"job", "src", p); ok {
+			t.Errorf("Expected the checkpoint of partition %d removed", p)
+		}
+	}
+	if jobs, _ := s.ListCopyJobs(); len(jobs) != 0 {
+		t.Errorf("Expected no jobs left, got %d", len(jobs))
+	}
+
+	// A new job of the same name copies from the start again
+	if err := s.StartCopy(cfg); err != nil {
+		t.Fatalf("Failed to start copy: %v", err)
+	}
+	waitFor(t, "the copy to complete", func() bool { return copyState(t, s, "job").State == CopyCompleted })
+	if got := fmt.Sprint(partitionValues(t, s, "dst", 0)); got != "[a a]" {
+		t.Errorf("Expected partition 0 copied again, got %s", got)
+	}
+}
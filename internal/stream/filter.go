@@ -0,0 +1,154 @@
+package stream
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/skshohagmiah/flin/internal/storage"
+)
+
+// maxFilterScan bounds how many messages one filtered fetch examines per
+// partition, so a selective filter cannot stall a consume request
+const maxFilterScan = 10000
+
+// Filter selects messages on the server during consumption. It is parsed
+// from an expression of clauses joined by "&&", all of which must match:
+//
+//	key = "orders-42"        key equals
+//	key ^= "orders-"         key has prefix
+//	key != "internal"        key differs
+//	header.region = "eu"     header equals (also ^= and !=)
+//	header.trace-id          header is present
+//
+// Values may be double-quoted, which allows spaces and "&&".
+type Filter struct {
+	expr    string
+	clauses []filterClause
+}
+
+type filterClause struct {
+	field  string // "key" or a header name
+	header bool
+	op     string // "=", "!=", "^=" or "" for presence
+	value  string
+}
+
+// ParseFilter compiles a filter expression. An empty expression returns a
+// nil Filter, which matches every message.
+func ParseFilter(expr string) (*Filter, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, nil
+	}
+
+	f := &Filter{expr: expr}
+	for _, part := range splitClauses(expr) {
+		clause, err := parseClause(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter %q: %w", expr, err)
+		}
+		f.clauses = append(f.clauses, clause)
+	}
+	return f, nil
+}
+
+// String returns the filter's source expression
+func (f *Filter) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.expr
+}
+
+// Match reports whether msg satisfies every clause
+func (f *Filter) Match(msg *storage.Message) bool {
+	if f == nil {
+		return true
+	}
+
+	for _, c := range f.clauses {
+		var actual string
+		present := true
+		if c.header {
+			actual, present = msg.Headers[c.field]
+		} else {
+			actual = msg.Key
+		}
+
+		var ok bool
+		switch c.op {
+		case "":
+			ok = present
+		case "=":
+			ok = present && actual == c.value
+		case "!=":
+			ok = !present || actual != c.value
+		case "^=":
+			ok = present && strings.HasPrefix(actual, c.value)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// splitClauses splits expr on "&&" outside double quotes
+func splitClauses(expr string) []string {
+	var parts []string
+	inQuote := false
+	start := 0
+	for i := 0; i < len(expr); i++ {
+		switch {
+		case expr[i] == '\\' && inQuote:
+			i++
+		case expr[i] == '"':
+			inQuote = !inQuote
+		case !inQuote && strings.HasPrefix(expr[i:], "&&"):
+			parts = append(parts, expr[start:i])
+			start = i + 2
+			i++
+		}
+	}
+	return append(parts, expr[start:])
+}
+
+func parseClause(s string) (filterClause, error) {
+	var c filterClause
+
+	field := s
+	if i := strings.IndexByte(s, '='); i >= 0 {
+		c.op = "="
+		field = s[:i]
+		if i > 0 && (s[i-1] == '!' || s[i-1] == '^') {
+			c.op = s[i-1 : i+1]
+			field = s[:i-1]
+		}
+
+		value := strings.TrimSpace(s[i+1:])
+		if strings.HasPrefix(value, `"`) {
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return c, fmt.Errorf("bad quoted value %s", value)
+			}
+			value = unquoted
+		}
+		c.value = value
+	}
+
+	field = strings.TrimSpace(field)
+	switch {
+	case field == "key":
+		if c.op == "" {
+			return c, fmt.Errorf("key needs an operator")
+		}
+		c.field = field
+	case strings.HasPrefix(field, "header.") && len(field) > len("header."):
+		c.field = strings.TrimPrefix(field, "header.")
+		c.header = true
+	default:
+		return c, fmt.Errorf("unknown field %q", field)
+	}
+	return c, nil
+}
@@ -0,0 +1,61 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/skshohagmiah/flin/internal/storage"
+)
+
+// TestParseFilter tests filter expressions against messages and the
+// expressions that fail to parse
+func TestParseFilter(t *testing.T) {
+	msg := &storage.Message{Key: "orders-42", Headers: map[string]string{"region": "eu", "note": "a && b"}}
+
+	tests := []struct {
+		expr    string
+		match   bool
+		wantErr bool
+	}{
+		{"", true, false},
+		{`key = "orders-42"`, true, false},
+		{"key = orders-42", true, false},
+		{`key = "orders-4"`, false, false},
+		{`key ^= "orders-"`, true, false},
+		{`key ^= "users-"`, false, false},
+		{`key != "internal"`, true, false},
+		{`key != "orders-42"`, false, false},
+		{`header.region = "eu"`, true, false},
+		{`header.region ^= "u"`, false, false},
+		{`header.region != "us"`, true, false},
+		{`header.missing != "us"`, true, false},
+		{`header.missing = ""`, false, false},
+		{"header.region", true, false},
+		{"header.missing", false, false},
+		{`header.note = "a && b"`, true, false},
+		{`key ^= "orders-" && header.region = "eu"`, true, false},
+		{`key ^= "orders-" && header.region = "us"`, false, false},
+		{"key", false, true},
+		{`value = "x"`, false, true},
+		{"header.", false, true},
+		{`key = "unterminated`, false, true},
+		{`key = "a" && `, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := ParseFilter(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if got := f.Match(msg); got != tt.match {
+				t.Errorf("Expected match %v, got %v", tt.match, got)
+			}
+			if f.String() != tt.expr {
+				t.Errorf("Expected expression %q back, got %q", tt.expr, f.String())
+			}
+		})
+	}
+}
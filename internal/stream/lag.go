@@ -0,0 +1,226 @@
+package stream
+
+import (
+	"sort"
+
+	"github.com/skshohagmiah/flin/internal/storage"
+)
+
+// GroupInfo summarizes a consumer group. Groups with committed offsets but
+// no live members are reported with Members == 0.
+type GroupInfo struct {
+	Name       string
+	Topics     []string
+	Members    int
+	Generation uint64
+	Strategy   string
+}
+
+// PartitionLag is a group's progress on one partition
+type PartitionLag struct {
+	Group     string
+	Topic     string
+	Partition int
+	// Committed is the next offset the group will read
+	Committed int64
+	// HighWatermark is the next offset to be written
+	HighWatermark int64
+	Lag           int64
+	// LastCommit is the commit time in Unix milliseconds, 0 if never committed
+	LastCommit int64
+	// Consumer is the member assigned the partition, empty if unassigned
+	Consumer string
+}
+
+// ListGroups returns every active group and every group with committed
+// offsets, sorted by name
+func (s *Stream) ListGroups() ([]GroupInfo, error) {
+	commits, err := s.committedOffsets()
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make(map[string]*GroupInfo)
+	info := func(name string) *GroupInfo {
+		gi, ok := infos[name]
+		if !ok {
+			gi = &GroupInfo{Name: name}
+			infos[name] = gi
+		}
+		return gi
+	}
+
+	for name, topics := range commits {
+		gi := info(name)
+		for topic := range topics {
+			gi.Topics = append(gi.Topics, topic)
+		}
+	}
+
+	s.groupsMu.RLock()
+	for name, g := range s.groups {
+		gi := info(name)
+		g.mu.RLock()
+		if _, ok := commits[name][g.Topic]; !ok {
+			gi.Topics = append(gi.Topics, g.Topic)
+		}
+		gi.Members = len(g.Consumers)
+		gi.Generation = g.Generation
+		gi.Strategy = g.Strategy
+		g.mu.RUnlock()
+	}
+	s.groupsMu.RUnlock()
+
+	groups := make([]GroupInfo, 0, len(infos))
+	for _, gi := range infos {
+		sort.Strings(gi.Topics)
+		groups = append(groups, *gi)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups, nil
+}
+
+// GroupLag returns the group's lag on every partition of each topic it
+// consumes or has committed offsets for
+func (s *Stream) GroupLag(group string) ([]PartitionLag, error) {
+	commits, err := s.committedOffsets()
+	if err != nil {
+		return nil, err
+	}
+
+	topics := commits[group]
+	s.groupsMu.RLock()
+	g, active := s.groups[group]
+	s.groupsMu.RUnlock()
+
+	if topics == nil && !active {
+		return nil, ErrGroupNotFound
+	}
+	if topics == nil {
+		topics = make(map[string]map[int]*storage.ConsumerOffset)
+	}
+	if active {
+		g.mu.RLock()
+		if _, ok := topics[g.Topic]; !ok {
+			topics[g.Topic] = nil
+		}
+		g.mu.RUnlock()
+	}
+
+	names := make([]string, 0, len(topics))
+	for topic := range topics {
+		names = append(names, topic)
+	}
+	sort.Strings(names)
+
+	lags := make([]PartitionLag, 0)
+	for _, topic := range names {
+		topicLags, err := s.topicLag(group, topic, topics[topic], g)
+		if err != nil {
+			return nil, err
+		}
+		lags = append(lags, topicLags...)
+	}
+	return lags, nil
+}
+
+// AllGroupLag returns the lag of every group, ordered by group name
+func (s *Stream) AllGroupLag() ([]PartitionLag, error) {
+	groups, err := s.ListGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	lags := make([]PartitionLag, 0)
+	for _, gi := range groups {
+		groupLags, err := s.GroupLag(gi.Name)
+		if err == ErrGroupNotFound {
+			continue // Left between listing and lookup
+		}
+		if err != nil {
+			return nil, err
+		}
+		lags = append(lags, groupLags...)
+	}
+	return lags, nil
+}
+
+// topicLag computes lag per partition of topic. g, when non-nil, supplies
+// the assigned consumers if it consumes topic.
+func (s *Stream) topicLag(group, topic string, commits map[int]*storage.ConsumerOffset, g *ConsumerGroup) ([]PartitionLag, error) {
+	meta, err := s.GetTopicMetadata(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	owners := make(map[int]string)
+	if g != nil {
+		g.mu.RLock()
+		if g.Topic == topic {
+			for id, c := range g.Consumers {
+				for _, p := range c.Partitions {
+					owners[p] = id
+				}
+			}
+		}
+		g.mu.RUnlock()
+	}
+
+	lags := make([]PartitionLag, 0, meta.Partitions)
+	for p := 0; p < meta.Partitions; p++ {
+		last, err := s.storage.GetOffset(topic, p)
+		if err != nil {
+			return nil, err
+		}
+
+		pl := PartitionLag{
+			Group:         group,
+			Topic:         topic,
+			Partition:     p,
+			HighWatermark: last + 1,
+			Consumer:      owners[p],
+		}
+		if co, ok := commits[p]; ok {
+			pl.Committed = co.Offset
+			pl.LastCommit = co.UpdatedAt
+		}
+		if pl.HighWatermark > pl.Committed {
+			pl.Lag = pl.HighWatermark - pl.Committed
+		}
+		lags = append(lags, pl)
+	}
+	return lags, nil
+}
+
+// committedOffsets loads committed offsets for all topics, keyed by group,
+// topic and partition
+func (s *Stream) committedOffsets() (map[string]map[string]map[int]*storage.ConsumerOffset, error) {
+	s.topicsMu.RLock()
+	topics := make([]string, 0, len(s.topics))
+	for name := range s.topics {
+		topics = append(topics, name)
+	}
+	s.topicsMu.RUnlock()
+
+	commits := make(map[string]map[string]map[int]*storage.ConsumerOffset)
+	for _, topic := range topics {
+		offsets, err := s.storage.ListConsumerOffsets(topic)
+		if err != nil {
+			return nil, err
+		}
+		for _, co := range offsets {
+			byTopic, ok := commits[co.Group]
+			if !ok {
+				byTopic = make(map[string]map[int]*storage.ConsumerOffset)
+				commits[co.Group] = byTopic
+			}
+			byPartition, ok := byTopic[topic]
+			if !ok {
+				byPartition = make(map[int]*storage.ConsumerOffset)
+				byTopic[topic] = byPartition
+			}
+			byPartition[co.Partition] = co
+		}
+	}
+	return commits, nil
+}
@@ -0,0 +1,214 @@
+package stream
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/skshohagmiah/flin/internal/storage"
+)
+
+// DefaultPartitioner is used when a topic is created without one
+const DefaultPartitioner = storage.PartitionerFNV
+
+// StickyBatchBytes is how many bytes of keyless records the sticky
+// partitioner sends to one partition before moving on, matching Kafka's
+// default batch.size
+const StickyBatchBytes = 16384
+
+// Partitioner picks the partition for records published without an
+// explicit one. Partition is called once per batch with the first record
+// key in it and the total value size of the batch. Implementations keep
+// state per topic and must be safe for concurrent use.
+type Partitioner interface {
+	Name() string
+	Partition(key string, size, partitions int) int
+}
+
+var partitioners = map[string]func() Partitioner{
+	storage.PartitionerFNV:        func() Partitioner { return &hashPartitioner{name: storage.PartitionerFNV, hash: fnv32a} },
+	storage.PartitionerMurmur2:    func() Partitioner { return &hashPartitioner{name: storage.PartitionerMurmur2, hash: murmur2} },
+	storage.PartitionerRoundRobin: func() Partitioner { return &roundRobinPartitioner{} },
+	storage.PartitionerSticky:     func() Partitioner { return &stickyPartitioner{current: -1} },
+}
+
+// NewPartitioner returns a fresh partitioner by name.
+// An empty name selects DefaultPartitioner.
+func NewPartitioner(name string) (Partitioner, error) {
+	if name == "" {
+		name = DefaultPartitioner
+	}
+	newFn, ok := partitioners[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPartitioner, name)
+	}
+	return newFn(), nil
+}
+
+// topicPartitioner returns the partitioner state for a topic, replacing it
+// if the topic was recreated with a different partitioner
+func (s *Stream) topicPartitioner(meta *storage.TopicMetadata) Partitioner {
+	s.partitionersMu.Lock()
+	defer s.partitionersMu.Unlock()
+
+	p, ok := s.partitioners[meta.Name]
+	if ok && (p.Name() == meta.Partitioner || meta.Partitioner == "" && p.Name() == DefaultPartitioner) {
+		return p
+	}
+	p, err := NewPartitioner(meta.Partitioner)
+	if err != nil {
+		// Unknown names can only come from a newer server; fall back
+		// rather than refuse to publish
+		p, _ = NewPartitioner(DefaultPartitioner)
+	}
+	s.partitioners[meta.Name] = p
+	return p
+}
+
+// keyPartitioner is implemented by partitioners that place keyed records
+// by their key alone
+type keyPartitioner interface {
+	keyPartition(key string, partitions int) int
+}
+
+// selectPartition validates an explicit partition or asks the topic's
+// partitioner for one. A batch is written to one partition, so when the
+// partitioner places keys it refuses a batch whose keys belong to
+// different partitions; keyless records go wherever the keyed ones do.
+func (s *Stream) selectPartition(meta *storage.TopicMetadata, partition int, records []storage.Record) (int, error) {
+	if partition >= 0 && partition < meta.Partitions {
+		return partition, nil
+	}
+
+	size := 0
+	key := ""
+	for _, rec := range records {
+		size += len(rec.Value)
+		if key == "" {
+			key = rec.Key
+		}
+	}
+
+	p := s.topicPartitioner(meta)
+	partition = p.Partition(key, size, meta.Partitions)
+
+	if kp, ok := p.(keyPartitioner); ok {
+		for _, rec := range records {
+			if rec.Key != "" && kp.keyPartition(rec.Key, meta.Partitions) != partition {
+				return 0, fmt.Errorf("%w: keys %q and %q", ErrMixedPartitionBatch, key, rec.Key)
+			}
+		}
+	}
+	return partition, nil
+}
+
+// hashPartitioner sends records with the same key to the same partition
+// and spreads keyless records round-robin
+type hashPartitioner struct {
+	name string
+	hash func([]byte) uint32
+	rr   roundRobinPartitioner
+}
+
+func (p *hashPartitioner) Name() string { return p.name }
+
+func (p *hashPartitioner) Partition(key string, size, partitions int) int {
+	if key == "" {
+		return p.rr.Partition(key, size, partitions)
+	}
+	return p.keyPartition(key, partitions)
+}
+
+func (p *hashPartitioner) keyPartition(key string, partitions int) int {
+	return int(p.hash([]byte(key)) % uint32(partitions))
+}
+
+// roundRobinPartitioner cycles through partitions, ignoring keys
+type roundRobinPartitioner struct {
+	next atomic.Uint64
+}
+
+func (p *roundRobinPartitioner) Name() string { return storage.PartitionerRoundRobin }
+
+func (p *roundRobinPartitioner) Partition(_ string, _, partitions int) int {
+	return int((p.next.Add(1) - 1) % uint64(partitions))
+}
+
+// stickyPartitioner hashes keyed records with murmur2 and keeps keyless
+// records on one partition until StickyBatchBytes have been written to it,
+// which produces fewer, larger batches than round-robin
+type stickyPartitioner struct {
+	mu      sync.Mutex
+	current int
+	written int
+}
+
+func (p *stickyPartitioner) Name() string { return storage.PartitionerSticky }
+
+func (p *stickyPartitioner) Partition(key string, size, partitions int) int {
+	if key != "" {
+		return p.keyPartition(key, partitions)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.current < 0 || p.current >= partitions || p.written >= StickyBatchBytes {
+		p.current = (p.current + 1) % partitions
+		p.written = 0
+	}
+	p.written += size
+	return p.current
+}
+
+func (p *stickyPartitioner) keyPartition(key string, partitions int) int {
+	return int(murmur2([]byte(key)) % uint32(partitions))
+}
+
+func fnv32a(data []byte) uint32 {
+	h := fnv.New32a()
+	h.Write(data)
+	return h.Sum32()
+}
+
+// murmur2 is the hash Kafka's default partitioner applies to record keys,
+// with the sign bit cleared as Kafka does before taking the modulus
+func murmur2(data []byte) uint32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+
+	length := len(data)
+	h := seed ^ uint32(length)
+
+	for i := 0; i+4 <= length; i += 4 {
+		k := uint32(data[i]) | uint32(data[i+1])<<8 | uint32(data[i+2])<<16 | uint32(data[i+3])<<24
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	tail := data[length&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+
+	return h & 0x7fffffff
+}
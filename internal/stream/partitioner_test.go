@@ -0,0 +1,105 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/skshohagmiah/flin/internal/storage"
+)
+
+// TestMurmur2 tests murmur2 against the vectors in Kafka's own tests, so
+// keyed records land on the partitions Kafka clients pick
+func TestMurmur2(t *testing.T) {
+	tests := []struct {
+		key  string
+		want int32 // Kafka's signed result, before toPositive
+	}{
+		{"21", -973932308},
+		{"foobar", -790332482},
+		{"a-little-bit-long-string", -985981536},
+		{"a-little-bit-longer-string", -1486304829},
+		{"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8", -58897971},
+		{"abc", 479470107},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			want := uint32(tt.want) & 0x7fffffff
+			if got := murmur2([]byte(tt.key)); got != want {
+				t.Errorf("Expected %d, got %d", want, got)
+			}
+
+			for _, name := range []string{storage.PartitionerMurmur2, storage.PartitionerSticky} {
+				p, err := NewPartitioner(name)
+				if err != nil {
+					t.Fatalf("Failed to create partitioner: %v", err)
+				}
+				if got := p.Partition(tt.key, 0, 12); got != int(want%12) {
+					t.Errorf("%s: expected partition %d, got %d", name, want%12, got)
+				}
+			}
+		})
+	}
+}
+
+// TestPublishBatchMixedKeys tests that a batch without a partition goes
+// whole to its keys' partition and is refused if the keys disagree
+func TestPublishBatchMixedKeys(t *testing.T) {
+	s := createTestStream(t)
+	if err := s.CreateTopic("orders", 4, 0); err != nil {
+		t.Fatalf("Failed to create topic: %v", err)
+	}
+	if err := s.CreateTopicWithConfig("rr", TopicConfig{Partitions: 4, Partitioner: storage.PartitionerRoundRobin}); err != nil {
+		t.Fatalf("Failed to create topic: %v", err)
+	}
+
+	// Two keys on different partitions
+	keyA, keyB := "a", ""
+	for i := 0; keyB == ""; i++ {
+		if k := fmt.Sprintf("b%d", i); fnv32a([]byte(k))%4 != fnv32a([]byte(keyA))%4 {
+			keyB = k
+		}
+	}
+	partA := int(fnv32a([]byte(keyA)) % 4)
+
+	partition, offsets, err := s.PublishBatch("orders", -1, []storage.Record{
+		{Value: []byte("keyless")},
+		{Key: keyA, Value: []byte("1")},
+		{Key: keyA, Value: []byte("2")},
+	})
+	if err != nil {
+		t.Fatalf("Failed to publish batch: %v", err)
+	}
+	if partition != partA || len(offsets) != 3 {
+		t.Errorf("Expected 3 records on partition %d, got %d on %d", partA, len(offsets), partition)
+	}
+
+	mixed := []storage.Record{{Key: keyA, Value: []byte("1")}, {Key: keyB, Value: []byte("2")}}
+	if _, _, err := s.PublishBatch("orders", -1, mixed); !errors.Is(err, ErrMixedPartitionBatch) {
+		t.Errorf("Expected ErrMixedPartitionBatch, got %v", err)
+	}
+	id, err := s.InitProducer()
+	if err != nil {
+		t.Fatalf("Failed to init producer: %v", err)
+	}
+	if _, _, err := s.PublishIdempotent("orders", -1, mixed, id, 0); !errors.Is(err, ErrMixedPartitionBatch) {
+		t.Errorf("Expected ErrMixedPartitionBatch from an idempotent batch, got %v", err)
+	}
+	offs, _ := s.GetOffsets("orders")
+	total := int64(0)
+	for _, o := range offs {
+		total += o.Latest
+	}
+	if total != 3 {
+		t.Errorf("Expected refused batches to write nothing, got %d messages", total)
+	}
+
+	// An explicit partition or a partitioner that ignores keys takes any batch
+	if partition, _, err := s.PublishBatch("orders", 2, mixed); err != nil || partition != 2 {
+		t.Errorf("Expected the batch on partition 2, got %d (%v)", partition, err)
+	}
+	if _, _, err := s.PublishBatch("rr", -1, mixed); err != nil {
+		t.Errorf("Expected round-robin to take a mixed batch, got %v", err)
+	}
+}
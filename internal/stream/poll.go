@@ -0,0 +1,142 @@
+package stream
+
+import (
+	"sync"
+	"time"
+
+	"github.com/skshohagmiah/flin/internal/storage"
+)
+
+// MaxConsumeWait caps how long a consume request may be parked. It stays
+// below the server's 30s connection read deadline.
+const MaxConsumeWait = 20 * time.Second
+
+// ConsumeOptions configures a long-poll consume
+type ConsumeOptions struct {
+	// MaxWait is how long to wait for messages when none are available;
+	// zero returns immediately like Consume
+	MaxWait time.Duration
+	// MinBytes keeps waiting until at least this many value bytes are
+	// collected; zero returns as soon as any message arrives
+	MinBytes int
+	// Filter is a filter expression (see ParseFilter) that overrides the
+	// subscription filter for this request
+	Filter string
+}
+
+// ConsumeAsync consumes like Consume but, when nothing (or less than
+// MinBytes) is available, waits up to MaxWait for new messages on the
+// consumer's partitions. callback is invoked exactly once, either inline
+// or from the publisher/timer that completed the request; no goroutine is
+// parked while waiting.
+func (s *Stream) ConsumeAsync(topic, group, consumerID string, count int, opts ConsumeOptions, callback func([]*storage.Message, error)) {
+	if opts.MaxWait > MaxConsumeWait {
+		opts.MaxWait = MaxConsumeWait
+	}
+	filter, err := ParseFilter(opts.Filter)
+	if err != nil {
+		callback(nil, err)
+		return
+	}
+
+	p := &consumePoll{
+		s:          s,
+		topic:      topic,
+		group:      group,
+		consumerID: consumerID,
+		count:      count,
+		minBytes:   opts.MinBytes,
+		filter:     filter,
+		callback:   callback,
+	}
+
+	if opts.MaxWait <= 0 {
+		p.attempt(true)
+		return
+	}
+
+	p.mu.Lock()
+	p.timer = time.AfterFunc(opts.MaxWait, func() { p.attempt(true) })
+	p.mu.Unlock()
+
+	p.attempt(false)
+}
+
+// consumePoll is a parked consume request
+type consumePoll struct {
+	s          *Stream
+	topic      string
+	group      string
+	consumerID string
+	count      int
+	minBytes   int
+	filter     *Filter
+	callback   func([]*storage.Message, error)
+
+	mu          sync.Mutex
+	result      []*storage.Message
+	bytes       int
+	done        bool
+	timer       *time.Timer
+	cancelWatch func()
+}
+
+// attempt consumes whatever is available and either completes the request
+// or re-arms the watch on the consumer's partitions
+func (p *consumePoll) attempt(expired bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.done {
+		return
+	}
+	if p.cancelWatch != nil {
+		p.cancelWatch()
+		p.cancelWatch = nil
+	}
+
+	// Watch before reading so an append in between is not missed
+	if !expired {
+		assignment, err := p.s.Assignment(p.topic, p.group, p.consumerID)
+		if err != nil {
+			p.finish(err)
+			return
+		}
+		p.cancelWatch = p.s.storage.Watch(p.topic, assignment.Partitions, func() {
+			p.attempt(false)
+		})
+	}
+
+	msgs, err := p.s.consume(p.topic, p.group, p.consumerID, p.count-len(p.result), p.filter)
+	if err != nil {
+		p.finish(err)
+		return
+	}
+
+	p.result = append(p.result, msgs...)
+	for _, msg := range msgs {
+		p.bytes += len(msg.Value)
+	}
+
+	if expired || len(p.result) >= p.count || (len(p.result) > 0 && p.bytes >= p.minBytes) {
+		p.finish(nil)
+	}
+}
+
+// finish releases the timer and watch and delivers the result; caller holds p.mu
+func (p *consumePoll) finish(err error) {
+	p.done = true
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	if p.cancelWatch != nil {
+		p.cancelWatch()
+		p.cancelWatch = nil
+	}
+
+	if err != nil && len(p.result) == 0 {
+		p.callback(nil, err)
+		return
+	}
+	p.callback(p.result, nil)
+}
@@ -0,0 +1,171 @@
+package stream
+
+import (
+	"fmt"
+
+	"github.com/skshohagmiah/flin/internal/storage"
+)
+
+// TxnRecord is a message to publish within a transaction. A Partition of
+// -1 is selected from the key, as with Publish.
+type TxnRecord struct {
+	Topic     string
+	Partition int
+	Key       string
+	Value     []byte
+	EventTime int64
+	Headers   map[string]string
+}
+
+// TxnOffset is a consumer offset to commit within a transaction
+type TxnOffset struct {
+	Topic     string
+	Partition int
+	Offset    int64
+}
+
+// Transaction publishes output records and commits input offsets
+// atomically, giving read-process-write pipelines exactly-once results
+type Transaction struct {
+	// ProducerID and Sequence make retries safe: retrying the producer's
+	// last transaction returns its original results without applying it
+	// again, and an older sequence fails with ErrDuplicateSequence.
+	// A zero ProducerID disables the check.
+	ProducerID uint64
+	Sequence   uint64
+
+	// Group receives the offsets; a non-empty ConsumerID must be a member
+	// of the group's current generation, fencing out zombie consumers
+	Group      string
+	ConsumerID string
+
+	Records []TxnRecord
+	Offsets []TxnOffset
+}
+
+// PublishResult is where a transactional record was written
+type PublishResult struct {
+	Topic     string
+	Partition int
+	Offset    int64
+}
+
+// InitProducer allocates a producer ID for idempotent publishing
+func (s *Stream) InitProducer() (uint64, error) {
+	return s.storage.InitProducer()
+}
+
+// PublishIdempotent appends records like PublishBatch, deduplicating
+// retries. sequence numbers the first record and must follow on from the
+// producer's previous batch for the topic; resending the previous batch
+// returns its original partition and offsets.
+func (s *Stream) PublishIdempotent(topic string, partition int, records []storage.Record, producerID, sequence uint64) (int, []int64, error) {
+	if len(records) == 0 {
+		return 0, nil, fmt.Errorf("empty batch")
+	}
+	if producerID == 0 {
+		return s.PublishBatch(topic, partition, records)
+	}
+
+	meta, err := s.publishTopic(topic)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	partition, err = s.selectPartition(meta, partition, records)
+	if err != nil {
+		return 0, nil, err
+	}
+	return s.storage.AppendMessagesIdempotent(topic, partition, records, producerID, sequence)
+}
+
+// PublishPartitionIdempotent appends records to one partition like
+// PublishIdempotent, but the producer numbers its batches per partition,
+// as Kafka producers do
+func (s *Stream) PublishPartitionIdempotent(topic string, partition int, records []storage.Record, producerID, sequence uint64) ([]int64, error) {
+	if len(records) == 0 {
+		return nil, fmt.Errorf("empty batch")
+	}
+
+	meta, err := s.GetTopicMetadata(topic)
+	if err != nil {
+		return nil, err
+	}
+	if partition < 0 || partition >= meta.Partitions {
+		return nil, fmt.Errorf("invalid partition %d for topic %s", partition, topic)
+	}
+	return s.storage.AppendPartitionIdempotent(topic, partition, records, producerID, sequence)
+}
+
+// CommitTransaction applies a transaction in a single storage transaction
+// and returns where each record was written
+func (s *Stream) CommitTransaction(t *Transaction) ([]PublishResult, error) {
+	if len(t.Offsets) > 0 && t.Group == "" {
+		return nil, fmt.Errorf("group is required to commit offsets")
+	}
+	if t.ConsumerID != "" {
+		if err := s.checkMember(t.Group, t.ConsumerID); err != nil {
+			return nil, err
+		}
+	}
+
+	st := &storage.Transaction{
+		ProducerID: t.ProducerID,
+		Sequence:   t.Sequence,
+		Records:    make([]storage.TxnRecord, 0, len(t.Records)),
+		Offsets:    make([]storage.ConsumerOffset, 0, len(t.Offsets)),
+	}
+
+	for _, rec := range t.Records {
+		meta, err := s.publishTopic(rec.Topic)
+		if err != nil {
+			return nil, err
+		}
+		record := storage.Record{
+			Key:       rec.Key,
+			Value:     rec.Value,
+			EventTime: rec.EventTime,
+			Headers:   rec.Headers,
+		}
+		partition, err := s.selectPartition(meta, rec.Partition, []storage.Record{record})
+		if err != nil {
+			return nil, err
+		}
+		st.Records = append(st.Records, storage.TxnRecord{
+			Topic:     rec.Topic,
+			Partition: partition,
+			Record:    record,
+		})
+	}
+
+	for _, o := range t.Offsets {
+		meta, err := s.GetTopicMetadata(o.Topic)
+		if err != nil {
+			return nil, err
+		}
+		if o.Partition < 0 || o.Partition >= meta.Partitions {
+			return nil, fmt.Errorf("invalid partition %d for topic %s", o.Partition, o.Topic)
+		}
+		st.Offsets = append(st.Offsets, storage.ConsumerOffset{
+			Group:     t.Group,
+			Topic:     o.Topic,
+			Partition: o.Partition,
+			Offset:    o.Offset,
+		})
+	}
+
+	written, err := s.storage.CommitTransaction(st)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]PublishResult, len(written))
+	for i, w := range written {
+		results[i] = PublishResult{
+			Topic:     st.Records[i].Topic,
+			Partition: w.Partition,
+			Offset:    w.Offset,
+		}
+	}
+	return results, nil
+}
@@ -1,14 +1,49 @@
 package stream
 
 import (
+	"errors"
 	"fmt"
-	"hash/fnv"
+	"log"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/skshohagmiah/flin/internal/storage"
 )
 
+var (
+	ErrGroupNotFound        = errors.New("consumer group not found")
+	ErrConsumerNotFound     = errors.New("consumer not registered")
+	ErrRebalanceInProgress  = errors.New("rebalance in progress")
+	ErrInvalidCleanupPolicy = errors.New("invalid cleanup policy")
+	ErrInvalidCompression   = errors.New("invalid compression codec")
+	ErrInvalidPartitioner   = errors.New("invalid partitioner")
+	ErrMixedPartitionBatch  = errors.New("batch keys belong to different partitions")
+)
+
+const (
+	// DefaultSessionTimeout is how long a consumer may go without a
+	// heartbeat before it is evicted from its group
+	DefaultSessionTimeout = 30 * time.Second
+
+	// DefaultTombstoneRetention is how long a tombstone survives compaction,
+	// giving consumers time to observe the delete
+	DefaultTombstoneRetention = 24 * time.Hour
+
+	sessionCheckInterval   = time.Second
+	retentionCheckInterval = time.Minute
+)
+
+// TopicConfig holds the settings for a new topic
+type TopicConfig struct {
+	Partitions     int
+	RetentionMs    int64
+	RetentionBytes int64  // Max bytes per partition; 0 means unlimited
+	CleanupPolicy  string // delete (default), compact or compact,delete
+	Compression    string // none (default), snappy, zstd or gzip
+	Partitioner    string // fnv (default), murmur2, roundrobin or sticky
+}
+
 // Stream manages the stream processing system
 type Stream struct {
 	storage *storage.StreamStorage
@@ -21,6 +56,14 @@ type Stream struct {
 	groups   map[string]*ConsumerGroup
 	groupsMu sync.RWMutex
 
+	// Partitioner state by topic
+	partitioners   map[string]Partitioner
+	partitionersMu sync.Mutex
+
+	// Topic copy jobs by name
+	copyJobs map[string]*copyJob
+	copyMu   sync.Mutex
+
 	// Background tasks
 	stopChan  chan struct{}
 	wg        sync.WaitGroup
@@ -29,10 +72,15 @@ type Stream struct {
 
 // ConsumerGroup manages consumers and partition assignments
 type ConsumerGroup struct {
-	Name      string
-	Topic     string
-	Consumers map[string]*Consumer
-	mu        sync.RWMutex
+	Name           string
+	Topic          string
+	Consumers      map[string]*Consumer
+	SessionTimeout time.Duration
+	// Strategy names the Assignor used on rebalance
+	Strategy string
+	// Generation is bumped on every rebalance
+	Generation uint64
+	mu         sync.RWMutex
 }
 
 // Consumer represents a member of a consumer group
@@ -40,6 +88,34 @@ type Consumer struct {
 	ID         string
 	LastSeen   time.Time
 	Partitions []int
+	// Generation is the group generation this consumer last joined
+	Generation uint64
+
+	// positions holds the next offset to fetch per partition; partitions
+	// without an entry start from the group's committed offset
+	positions map[int]int64
+	// filter is applied to every Consume; nil delivers all messages
+	filter *Filter
+}
+
+// SubscribeOptions configures a group membership
+type SubscribeOptions struct {
+	// SessionTimeout applies to the whole group; zero keeps the current
+	// value (or DefaultSessionTimeout for a new group)
+	SessionTimeout time.Duration
+	// Strategy selects the assignor for a new group; empty means
+	// DefaultStrategy, or the current strategy for an existing group
+	Strategy string
+	// Filter is a server-side filter expression (see ParseFilter) applied
+	// to this consumer's reads; re-subscribing replaces it
+	Filter string
+}
+
+// Assignment is a consumer's view of its group
+type Assignment struct {
+	Generation uint64
+	Strategy   string
+	Partitions []int
 }
 
 // New creates a new Stream instance
@@ -51,36 +127,138 @@ func New(path string) (*Stream, error) {
 	}
 
 	s := &Stream{
-		storage:  store,
-		topics:   make(map[string]*storage.TopicMetadata),
-		groups:   make(map[string]*ConsumerGroup),
-		stopChan: make(chan struct{}),
+		storage:      store,
+		topics:       make(map[string]*storage.TopicMetadata),
+		groups:       make(map[string]*ConsumerGroup),
+		partitioners: make(map[string]Partitioner),
+		copyJobs:     make(map[string]*copyJob),
+		stopChan:     make(chan struct{}),
 	}
 
-	// Load existing topics (TODO: Implement listing/loading from storage if needed)
-	// For now, we rely on lazy loading or explicit creation
+	if err := s.load(); err != nil {
+		store.Close()
+		return nil, err
+	}
+	if err := s.loadCopyJobs(); err != nil {
+		store.Close()
+		return nil, err
+	}
 
 	// Start background tasks
-	s.wg.Add(1)
+	s.wg.Add(2)
 	go s.retentionLoop()
+	go s.sessionLoop()
 
 	return s, nil
 }
 
+// load restores topic metadata and consumer groups from storage.
+// Consumers are treated as freshly seen and the group is rebalanced, so
+// a restart looks like a rebalance to clients rather than an unknown group.
+func (s *Stream) load() error {
+	topics, err := s.storage.ListTopics()
+	if err != nil {
+		return err
+	}
+	for _, meta := range topics {
+		s.topics[meta.Name] = meta
+	}
+
+	groups, err := s.storage.ListGroups()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, state := range groups {
+		g := &ConsumerGroup{
+			Name:           state.Name,
+			Topic:          state.Topic,
+			Consumers:      make(map[string]*Consumer, len(state.Members)),
+			SessionTimeout: time.Duration(state.SessionTimeoutMs) * time.Millisecond,
+			Strategy:       state.Strategy,
+			Generation:     state.Generation,
+		}
+		if g.Strategy == "" {
+			g.Strategy = DefaultStrategy
+		}
+		if g.SessionTimeout <= 0 {
+			g.SessionTimeout = DefaultSessionTimeout
+		}
+		for _, m := range state.Members {
+			// The filter was valid when the member subscribed
+			filter, err := ParseFilter(m.Filter)
+			if err != nil {
+				return err
+			}
+			g.Consumers[m.ID] = &Consumer{
+				ID:         m.ID,
+				LastSeen:   now,
+				Partitions: m.Partitions,
+				filter:     filter,
+			}
+		}
+		s.groups[state.Name] = g
+
+		// Bumping the generation makes every member rejoin, and the topic
+		// may have gained partitions since the group was saved
+		if err := s.rebalanceGroup(g); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // CreateTopic creates a new topic
 func (s *Stream) CreateTopic(name string, partitions int, retentionMs int64) error {
-	if partitions <= 0 {
-		partitions = 4 // Default
+	return s.CreateTopicWithConfig(name, TopicConfig{
+		Partitions:  partitions,
+		RetentionMs: retentionMs,
+	})
+}
+
+// CreateTopicWithConfig creates a new topic with size retention, cleanup
+// policy and compression settings
+func (s *Stream) CreateTopicWithConfig(name string, cfg TopicConfig) error {
+	if cfg.Partitions <= 0 {
+		cfg.Partitions = 4 // Default
+	}
+	if cfg.RetentionMs <= 0 {
+		cfg.RetentionMs = 7 * 24 * 60 * 60 * 1000 // 7 days default
+	}
+	if cfg.RetentionBytes < 0 {
+		cfg.RetentionBytes = 0
+	}
+	switch cfg.CleanupPolicy {
+	case "":
+		cfg.CleanupPolicy = storage.CleanupDelete
+	case storage.CleanupDelete, storage.CleanupCompact, storage.CleanupCompactDelete:
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidCleanupPolicy, cfg.CleanupPolicy)
+	}
+	if !storage.ValidCompression(cfg.Compression) {
+		return fmt.Errorf("%w: %s", ErrInvalidCompression, cfg.Compression)
 	}
-	if retentionMs <= 0 {
-		retentionMs = 7 * 24 * 60 * 60 * 1000 // 7 days default
+	if cfg.Compression == "" {
+		cfg.Compression = storage.CompressionNone
+	}
+	if _, err := NewPartitioner(cfg.Partitioner); err != nil {
+		return err
+	}
+	if cfg.Partitioner == "" {
+		cfg.Partitioner = DefaultPartitioner
 	}
 
 	meta := &storage.TopicMetadata{
-		Name:        name,
-		Partitions:  partitions,
-		RetentionMs: retentionMs,
-		CreatedAt:   time.Now().UnixMilli(),
+		Name:           name,
+		Partitions:     cfg.Partitions,
+		RetentionMs:    cfg.RetentionMs,
+		RetentionBytes: cfg.RetentionBytes,
+		CleanupPolicy:  cfg.CleanupPolicy,
+		Compression:    cfg.Compression,
+		Partitioner:    cfg.Partitioner,
+		CreatedAt:      time.Now().UnixMilli(),
 	}
 
 	if err := s.storage.CreateTopic(meta); err != nil {
@@ -122,48 +300,215 @@ func (s *Stream) GetTopicMetadata(name string) (*storage.TopicMetadata, error) {
 	return meta, nil
 }
 
-// Publish appends a message to a topic
-// If partition is -1, it is selected based on key hash or round-robin
-func (s *Stream) Publish(topic string, partition int, key string, value []byte) (int64, error) {
-	// Ensure topic exists or get metadata
-	meta, err := s.GetTopicMetadata(topic)
+// ListTopics returns metadata for every topic
+func (s *Stream) ListTopics() ([]*storage.TopicMetadata, error) {
+	return s.storage.ListTopics()
+}
+
+// DescribeTopic returns a topic's metadata with per-partition offsets,
+// message counts and sizes
+func (s *Stream) DescribeTopic(name string) (*storage.TopicDescription, error) {
+	return s.storage.DescribeTopic(name)
+}
+
+// PartitionOffsets is the retained offset range of a partition
+type PartitionOffsets struct {
+	Partition int
+	// Earliest is the oldest retained message
+	Earliest int64
+	// Latest is the next offset to be written
+	Latest int64
+}
+
+// GetOffsets returns the offset range of every partition of a topic
+func (s *Stream) GetOffsets(name string) ([]PartitionOffsets, error) {
+	meta, err := s.GetTopicMetadata(name)
 	if err != nil {
-		// Auto-create topic on publish?
-		// Let's create with defaults
-		err = s.CreateTopic(topic, 4, 0)
+		return nil, err
+	}
+
+	offsets := make([]PartitionOffsets, 0, meta.Partitions)
+	for p := 0; p < meta.Partitions; p++ {
+		earliest, latest, err := s.storage.GetPartitionOffsets(name, p)
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
-		meta, _ = s.GetTopicMetadata(topic)
+		offsets = append(offsets, PartitionOffsets{Partition: p, Earliest: earliest, Latest: latest})
+	}
+	return offsets, nil
+}
+
+// Fetch reads up to count messages from a partition starting at offset,
+// outside of any consumer group
+func (s *Stream) Fetch(topic string, partition int, offset int64, count int) ([]*storage.Message, error) {
+	return s.storage.FetchMessages(topic, partition, offset, count)
+}
+
+// Watch runs fn once, on its own goroutine, after the next append to any of
+// the given partitions. The returned func cancels the watch.
+func (s *Stream) Watch(topic string, partitions []int, fn func()) func() {
+	return s.storage.Watch(topic, partitions, fn)
+}
+
+// OffsetForTimestamp returns the first offset in a partition with a
+// timestamp at or after ts (Unix ms), or the next offset to be written if
+// there is none
+func (s *Stream) OffsetForTimestamp(topic string, partition int, ts int64) (int64, error) {
+	return s.storage.OffsetForTimestamp(topic, partition, ts)
+}
+
+// CommittedOffset returns a group's committed offset for a partition and
+// whether the group ever committed one
+func (s *Stream) CommittedOffset(group, topic string, partition int) (int64, bool, error) {
+	return s.storage.LookupConsumerOffset(group, topic, partition)
+}
+
+// DeleteTopic removes a topic, its messages, and the consumer groups and
+// committed offsets that reference it
+func (s *Stream) DeleteTopic(name string) error {
+	if _, err := s.GetTopicMetadata(name); err != nil {
+		return err
 	}
 
-	// Select partition
-	if partition < 0 || partition >= meta.Partitions {
-		if key != "" {
-			// Hash partition
-			h := fnv.New32a()
-			h.Write([]byte(key))
-			partition = int(h.Sum32()) % meta.Partitions
-		} else {
-			// Round-robin (simplified: random or time-based for now)
-			partition = int(time.Now().UnixNano()) % meta.Partitions
+	s.groupsMu.Lock()
+	for groupName, g := range s.groups {
+		if g.Topic != name {
+			continue
+		}
+		delete(s.groups, groupName)
+		if err := s.storage.DeleteGroup(groupName); err != nil {
+			s.groupsMu.Unlock()
+			return err
 		}
 	}
+	s.groupsMu.Unlock()
+
+	s.topicsMu.Lock()
+	delete(s.topics, name)
+	s.topicsMu.Unlock()
+
+	s.partitionersMu.Lock()
+	delete(s.partitioners, name)
+	s.partitionersMu.Unlock()
+
+	return s.storage.DeleteTopic(name)
+}
+
+// AddPartitions grows a topic by count partitions, rebalances the groups
+// consuming it and returns the new partition count
+func (s *Stream) AddPartitions(name string, count int) (int, error) {
+	meta, err := s.storage.AddPartitions(name, count)
+	if err != nil {
+		return 0, err
+	}
+
+	s.topicsMu.Lock()
+	s.topics[name] = meta
+	s.topicsMu.Unlock()
+
+	s.groupsMu.Lock()
+	defer s.groupsMu.Unlock()
+
+	for _, g := range s.groups {
+		if g.Topic != name {
+			continue
+		}
+		if err := s.rebalanceGroup(g); err != nil {
+			return 0, err
+		}
+	}
+
+	return meta.Partitions, nil
+}
+
+// Publish appends a message to a topic and returns its partition and offset
+// If partition is -1, it is selected by the topic's partitioner
+func (s *Stream) Publish(topic string, partition int, key string, value []byte) (int, int64, error) {
+	partition, offsets, err := s.PublishBatch(topic, partition, []storage.Record{{Key: key, Value: value}})
+	if err != nil {
+		return 0, 0, err
+	}
+	return partition, offsets[0], nil
+}
+
+// PublishBatch appends records to a single partition atomically and returns
+// the partition and each record's offset. If partition is -1, the topic's
+// partitioner selects it from the first record key in the batch. Batches
+// are not split: with a key-hashing partitioner, a batch whose keys hash to
+// different partitions fails with ErrMixedPartitionBatch, and keyless
+// records follow the keyed ones.
+func (s *Stream) PublishBatch(topic string, partition int, records []storage.Record) (int, []int64, error) {
+	if len(records) == 0 {
+		return 0, nil, fmt.Errorf("empty batch")
+	}
+
+	meta, err := s.publishTopic(topic)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	partition, err = s.selectPartition(meta, partition, records)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	offsets, err := s.storage.AppendMessages(topic, partition, records)
+	if err != nil {
+		return 0, nil, err
+	}
+	return partition, offsets, nil
+}
+
+// publishTopic returns a topic's metadata, creating it with defaults if it
+// does not exist
+func (s *Stream) publishTopic(topic string) (*storage.TopicMetadata, error) {
+	meta, err := s.GetTopicMetadata(topic)
+	if err == nil {
+		return meta, nil
+	}
 
-	return s.storage.AppendMessage(topic, partition, key, value)
+	if err := s.CreateTopic(topic, 4, 0); err != nil {
+		return nil, err
+	}
+	return s.GetTopicMetadata(topic)
 }
 
 // Subscribe registers a consumer in a group
 func (s *Stream) Subscribe(topic, group, consumerID string) error {
+	return s.SubscribeWithOptions(topic, group, consumerID, SubscribeOptions{})
+}
+
+// SubscribeWithOptions registers a consumer in a group. A new consumer
+// triggers a rebalance; an existing one rejoins the current generation.
+func (s *Stream) SubscribeWithOptions(topic, group, consumerID string, opts SubscribeOptions) error {
+	if _, err := GetAssignor(opts.Strategy); err != nil {
+		return err
+	}
+	filter, err := ParseFilter(opts.Filter)
+	if err != nil {
+		return err
+	}
+
 	s.groupsMu.Lock()
 	defer s.groupsMu.Unlock()
 
-	g, exists := s.groups[group]
-	if !exists {
+	g, groupExists := s.groups[group]
+	if !groupExists {
+		// Check the topic before the group exists, so a failed subscribe
+		// leaves nothing behind
+		if _, err := s.GetTopicMetadata(topic); err != nil {
+			return err
+		}
+		strategy := opts.Strategy
+		if strategy == "" {
+			strategy = DefaultStrategy
+		}
 		g = &ConsumerGroup{
-			Name:      group,
-			Topic:     topic,
-			Consumers: make(map[string]*Consumer),
+			Name:           group,
+			Topic:          topic,
+			Consumers:      make(map[string]*Consumer),
+			SessionTimeout: DefaultSessionTimeout,
+			Strategy:       strategy,
 		}
 		s.groups[group] = g
 	}
@@ -171,9 +516,15 @@ func (s *Stream) Subscribe(topic, group, consumerID string) error {
 	if g.Topic != topic {
 		return fmt.Errorf("group %s already subscribed to %s", group, g.Topic)
 	}
+	if opts.Strategy != "" && opts.Strategy != g.Strategy {
+		return fmt.Errorf("group %s uses %s assignment", group, g.Strategy)
+	}
 
 	// Register/Update consumer
 	g.mu.Lock()
+	if opts.SessionTimeout > 0 {
+		g.SessionTimeout = opts.SessionTimeout
+	}
 	c, exists := g.Consumers[consumerID]
 	if !exists {
 		c = &Consumer{
@@ -182,10 +533,91 @@ func (s *Stream) Subscribe(topic, group, consumerID string) error {
 		g.Consumers[consumerID] = c
 	}
 	c.LastSeen = time.Now()
+	filterChanged := c.filter.String() != filter.String()
+	c.filter = filter
+
+	if exists {
+		// Rejoin: pick up the assignment of the current generation
+		c.Generation = g.Generation
+		if opts.SessionTimeout > 0 || filterChanged {
+			err = s.storage.SaveGroup(g.state())
+		}
+		g.mu.Unlock()
+		return err
+	}
 	g.mu.Unlock()
 
-	// Rebalance partitions
-	return s.rebalanceGroup(g)
+	// Rebalance partitions, undoing the join if that fails
+	if err := s.rebalanceGroup(g); err != nil {
+		g.mu.Lock()
+		delete(g.Consumers, consumerID)
+		g.mu.Unlock()
+		if !groupExists {
+			delete(s.groups, group)
+		}
+		return err
+	}
+
+	g.mu.Lock()
+	c.Generation = g.Generation
+	g.mu.Unlock()
+
+	return nil
+}
+
+// Heartbeat keeps a consumer's session alive and returns the group
+// generation. ErrRebalanceInProgress means the consumer must Subscribe
+// again to pick up its new assignment.
+func (s *Stream) Heartbeat(topic, group, consumerID string) (uint64, error) {
+	s.groupsMu.RLock()
+	g, exists := s.groups[group]
+	s.groupsMu.RUnlock()
+
+	if !exists || g.Topic != topic {
+		return 0, ErrGroupNotFound
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	c, exists := g.Consumers[consumerID]
+	if !exists {
+		return 0, ErrConsumerNotFound
+	}
+	c.LastSeen = time.Now()
+
+	if c.Generation != g.Generation {
+		return g.Generation, ErrRebalanceInProgress
+	}
+	return g.Generation, nil
+}
+
+// Assignment returns the partitions currently assigned to a consumer
+func (s *Stream) Assignment(topic, group, consumerID string) (*Assignment, error) {
+	s.groupsMu.RLock()
+	g, exists := s.groups[group]
+	s.groupsMu.RUnlock()
+
+	if !exists || g.Topic != topic {
+		return nil, ErrGroupNotFound
+	}
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	c, exists := g.Consumers[consumerID]
+	if !exists {
+		return nil, ErrConsumerNotFound
+	}
+
+	partitions := make([]int, len(c.Partitions))
+	copy(partitions, c.Partitions)
+
+	return &Assignment{
+		Generation: g.Generation,
+		Strategy:   g.Strategy,
+		Partitions: partitions,
+	}, nil
 }
 
 // Unsubscribe removes a consumer from a group
@@ -205,92 +637,123 @@ func (s *Stream) Unsubscribe(topic, group, consumerID string) error {
 
 	if empty {
 		delete(s.groups, group)
-		return nil
+		return s.storage.DeleteGroup(group)
 	}
 
 	return s.rebalanceGroup(g)
 }
 
-// rebalanceGroup assigns partitions to consumers
-// Simple strategy: Range assignment
+// rebalanceGroup assigns partitions to consumers using the group's strategy
 func (s *Stream) rebalanceGroup(g *ConsumerGroup) error {
 	meta, err := s.GetTopicMetadata(g.Topic)
 	if err != nil {
 		return err
 	}
 
+	assignor, err := GetAssignor(g.Strategy)
+	if err != nil {
+		return err
+	}
+
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
+	g.Generation++
+
 	consumers := make([]string, 0, len(g.Consumers))
-	for id := range g.Consumers {
+	current := make(map[string][]int, len(g.Consumers))
+	for id, c := range g.Consumers {
 		consumers = append(consumers, id)
+		current[id] = c.Partitions
 	}
 
 	if len(consumers) == 0 {
 		return nil
 	}
+	sort.Strings(consumers)
 
-	// Sort consumers for deterministic assignment?
-	// Map iteration is random, so assignments might jump around.
-	// For MVP, we just iterate.
-
-	partitionsPerConsumer := meta.Partitions / len(consumers)
-	extraPartitions := meta.Partitions % len(consumers)
-
-	currentPart := 0
+	assignment := assignor.Assign(meta.Partitions, consumers, current)
 	for _, id := range consumers {
-		c := g.Consumers[id]
-		numParts := partitionsPerConsumer
-		if extraPartitions > 0 {
-			numParts++
-			extraPartitions--
-		}
-
-		c.Partitions = make([]int, 0, numParts)
-		for i := 0; i < numParts; i++ {
-			c.Partitions = append(c.Partitions, currentPart)
-			currentPart++
-		}
+		g.Consumers[id].Partitions = assignment[id]
+		g.Consumers[id].positions = nil
 	}
 
-	return nil
+	return s.storage.SaveGroup(g.state())
+}
+
+// state snapshots the group for persistence; caller must hold g.mu
+func (g *ConsumerGroup) state() *storage.GroupState {
+	state := &storage.GroupState{
+		Name:             g.Name,
+		Topic:            g.Topic,
+		Members:          make([]storage.GroupMember, 0, len(g.Consumers)),
+		Generation:       g.Generation,
+		SessionTimeoutMs: g.SessionTimeout.Milliseconds(),
+		Strategy:         g.Strategy,
+	}
+	for _, c := range g.Consumers {
+		state.Members = append(state.Members, storage.GroupMember{
+			ID:         c.ID,
+			Partitions: c.Partitions,
+			Filter:     c.filter.String(),
+		})
+	}
+	return state
 }
 
-// Consume fetches messages for a consumer in a group
+// Consume fetches messages for a consumer in a group. Each partition is
+// read from the consumer's fetch position, which starts at the group's
+// committed offset (the next message to read) and advances with every
+// call. Commit to make progress survive rebalances and restarts.
+// Messages rejected by the consumer's filter are skipped: the position
+// moves past them but they are not returned.
 func (s *Stream) Consume(topic, group, consumerID string, count int) ([]*storage.Message, error) {
+	return s.consume(topic, group, consumerID, count, nil)
+}
+
+// consume implements Consume; a non-nil filter replaces the consumer's
+// subscription filter for this call
+func (s *Stream) consume(topic, group, consumerID string, count int, filter *Filter) ([]*storage.Message, error) {
 	// Ensure subscription and get assigned partitions
 	s.groupsMu.RLock()
 	g, exists := s.groups[group]
 	s.groupsMu.RUnlock()
 
 	if !exists {
-		return nil, fmt.Errorf("consumer group not found")
+		return nil, ErrGroupNotFound
 	}
 
-	g.mu.RLock()
+	g.mu.Lock()
 	c, exists := g.Consumers[consumerID]
 	var partitions []int
+	positions := make(map[int]int64)
+	stale := false
+	generation := g.Generation
 	if exists {
 		partitions = make([]int, len(c.Partitions))
 		copy(partitions, c.Partitions)
+		for p, offset := range c.positions {
+			positions[p] = offset
+		}
 		c.LastSeen = time.Now() // Heartbeat
+		stale = c.Generation != g.Generation
+		if filter == nil {
+			filter = c.filter
+		}
 	}
-	g.mu.RUnlock()
+	g.mu.Unlock()
 
 	if !exists {
-		return nil, fmt.Errorf("consumer not registered")
+		return nil, ErrConsumerNotFound
+	}
+	if stale {
+		return nil, ErrRebalanceInProgress
 	}
 
 	if len(partitions) == 0 {
 		return []*storage.Message{}, nil
 	}
 
-	// Fetch messages from assigned partitions
-	// For simplicity, we'll fetch from the first partition that has messages,
-	// or round-robin.
-	// Let's try to fetch a few from each.
-
 	result := make([]*storage.Message, 0, count)
 
 	// Simple strategy: Iterate partitions and fetch
@@ -304,29 +767,161 @@ func (s *Stream) Consume(topic, group, consumerID string, count int) ([]*storage
 			break
 		}
 
-		// Get current offset
-		offset, err := s.storage.GetConsumerOffset(group, topic, p)
-		if err != nil {
-			return nil, err
+		offset, ok := positions[p]
+		if !ok {
+			var err error
+			offset, err = s.storage.GetConsumerOffset(group, topic, p)
+			if err != nil {
+				return nil, err
+			}
 		}
 
-		// Fetch
-		msgs, err := s.storage.FetchMessages(topic, p, offset, perPart)
+		var match func(*storage.Message) bool
+		maxScan := perPart
+		if filter != nil {
+			match = filter.Match
+			maxScan = maxFilterScan
+		}
+		msgs, next, err := s.storage.FetchMessagesFiltered(topic, p, offset, perPart, maxScan, match)
 		if err != nil {
 			return nil, err
 		}
 
+		positions[p] = next
 		result = append(result, msgs...)
 	}
 
+	// Advance fetch positions unless the group rebalanced meanwhile
+	g.mu.Lock()
+	if g.Consumers[consumerID] == c && g.Generation == generation {
+		c.positions = positions
+	}
+	g.mu.Unlock()
+
 	return result, nil
 }
 
+// Seek moves a group's position in a partition to offset, the next message
+// to read. A partition of -1 applies to every partition of the topic.
+func (s *Stream) Seek(group, topic string, partition int, offset int64) error {
+	return s.seek(group, topic, partition, func(int) (int64, error) {
+		return offset, nil
+	})
+}
+
+// SeekToBeginning moves a group to the oldest retained message
+func (s *Stream) SeekToBeginning(group, topic string, partition int) error {
+	return s.seek(group, topic, partition, func(p int) (int64, error) {
+		return s.storage.GetStartOffset(topic, p)
+	})
+}
+
+// SeekToEnd moves a group past the newest message so it only sees new ones
+func (s *Stream) SeekToEnd(group, topic string, partition int) error {
+	return s.seek(group, topic, partition, func(p int) (int64, error) {
+		last, err := s.storage.GetOffset(topic, p)
+		return last + 1, err
+	})
+}
+
+// SeekToTimestamp moves a group to the first message at or after ts (Unix ms)
+func (s *Stream) SeekToTimestamp(group, topic string, partition int, ts int64) error {
+	return s.seek(group, topic, partition, func(p int) (int64, error) {
+		return s.storage.OffsetForTimestamp(topic, p, ts)
+	})
+}
+
+// seek commits the resolved offset for each partition and drops the
+// owning consumer's fetch position so its next Consume starts there
+func (s *Stream) seek(group, topic string, partition int, resolve func(int) (int64, error)) error {
+	meta, err := s.GetTopicMetadata(topic)
+	if err != nil {
+		return err
+	}
+
+	var partitions []int
+	if partition < 0 {
+		for p := 0; p < meta.Partitions; p++ {
+			partitions = append(partitions, p)
+		}
+	} else if partition < meta.Partitions {
+		partitions = []int{partition}
+	} else {
+		return fmt.Errorf("invalid partition %d for topic %s", partition, topic)
+	}
+
+	for _, p := range partitions {
+		offset, err := resolve(p)
+		if err != nil {
+			return err
+		}
+		if offset < 0 {
+			offset = 0
+		}
+		if err := s.storage.CommitOffset(group, topic, p, offset); err != nil {
+			return err
+		}
+	}
+
+	s.groupsMu.RLock()
+	g, exists := s.groups[group]
+	s.groupsMu.RUnlock()
+
+	if exists && g.Topic == topic {
+		g.mu.Lock()
+		for _, c := range g.Consumers {
+			for _, p := range partitions {
+				delete(c.positions, p)
+			}
+		}
+		g.mu.Unlock()
+	}
+
+	return nil
+}
+
 // Commit commits an offset for a consumer group
 func (s *Stream) Commit(topic, group string, partition int, offset int64) error {
+	return s.CommitAs(topic, group, "", partition, offset)
+}
+
+// CommitAs commits an offset on behalf of a group member. Commits from a
+// consumer that has not rejoined since the last rebalance are rejected.
+// An empty consumerID skips the membership check.
+func (s *Stream) CommitAs(topic, group, consumerID string, partition int, offset int64) error {
+	if consumerID != "" {
+		if err := s.checkMember(group, consumerID); err != nil {
+			return err
+		}
+	}
+
 	return s.storage.CommitOffset(group, topic, partition, offset)
 }
 
+// checkMember verifies the consumer belongs to the group's current generation
+func (s *Stream) checkMember(group, consumerID string) error {
+	s.groupsMu.RLock()
+	g, exists := s.groups[group]
+	s.groupsMu.RUnlock()
+
+	if !exists {
+		return ErrGroupNotFound
+	}
+
+	g.mu.RLock()
+	c, exists := g.Consumers[consumerID]
+	stale := exists && c.Generation != g.Generation
+	g.mu.RUnlock()
+
+	if !exists {
+		return ErrConsumerNotFound
+	}
+	if stale {
+		return ErrRebalanceInProgress
+	}
+	return nil
+}
+
 // Close closes the stream system
 func (s *Stream) Close() error {
 	s.closeOnce.Do(func() {
@@ -339,7 +934,7 @@ func (s *Stream) Close() error {
 // retentionLoop periodically cleans up old messages
 func (s *Stream) retentionLoop() {
 	defer s.wg.Done()
-	ticker := time.NewTicker(10 * time.Minute)
+	ticker := time.NewTicker(retentionCheckInterval)
 	defer ticker.Stop()
 
 	for {
@@ -352,6 +947,56 @@ func (s *Stream) retentionLoop() {
 	}
 }
 
+// sessionLoop evicts consumers whose session has expired
+func (s *Stream) sessionLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(sessionCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			s.evictExpired()
+		}
+	}
+}
+
+func (s *Stream) evictExpired() {
+	s.groupsMu.Lock()
+	defer s.groupsMu.Unlock()
+
+	now := time.Now()
+	for name, g := range s.groups {
+		g.mu.Lock()
+		evicted := 0
+		for id, c := range g.Consumers {
+			if now.Sub(c.LastSeen) > g.SessionTimeout {
+				delete(g.Consumers, id)
+				evicted++
+			}
+		}
+		empty := len(g.Consumers) == 0
+		g.mu.Unlock()
+
+		if evicted == 0 {
+			continue
+		}
+
+		if empty {
+			delete(s.groups, name)
+			if err := s.storage.DeleteGroup(name); err != nil {
+				log.Printf("[Stream] Failed to delete expired group %s: %v", name, err)
+			}
+			continue
+		}
+		if err := s.rebalanceGroup(g); err != nil {
+			log.Printf("[Stream] Failed to rebalance group %s after evicting %d consumers: %v", name, evicted, err)
+		}
+	}
+}
+
 func (s *Stream) enforceRetention() {
 	s.topicsMu.RLock()
 	topics := make([]*storage.TopicMetadata, 0, len(s.topics))
@@ -361,10 +1006,30 @@ func (s *Stream) enforceRetention() {
 	s.topicsMu.RUnlock()
 
 	for _, t := range topics {
-		if t.RetentionMs > 0 {
-			for p := 0; p < t.Partitions; p++ {
-				s.storage.DeleteOldMessages(t.Name, p, t.RetentionMs)
+		for p := 0; p < t.Partitions; p++ {
+			select {
+			case <-s.stopChan:
+				return
+			default:
 			}
+			s.cleanupPartition(t, p)
 		}
 	}
 }
+
+// cleanupPartition applies the topic's cleanup policy to one partition.
+// Each storage call works in bounded transactions, so writers interleave.
+func (s *Stream) cleanupPartition(t *storage.TopicMetadata, partition int) {
+	if t.Compacts() {
+		s.storage.CompactPartition(t.Name, partition, DefaultTombstoneRetention.Milliseconds())
+	}
+	if !t.Deletes() {
+		return
+	}
+	if t.RetentionMs > 0 {
+		s.storage.DeleteOldMessages(t.Name, partition, t.RetentionMs)
+	}
+	if t.RetentionBytes > 0 {
+		s.storage.DeleteExcessBytes(t.Name, partition, t.RetentionBytes)
+	}
+}
@@ -0,0 +1,578 @@
+package stream
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/skshohagmiah/flin/internal/storage"
+)
+
+// Helper function to create a test stream
+func createTestStream(t *testing.T) *Stream {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create stream: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// TestSubscribeMissingTopicLeavesNoGroup tests that a subscribe to a
+// missing topic does not keep the group from subscribing elsewhere
+func TestSubscribeMissingTopicLeavesNoGroup(t *testing.T) {
+	s := createTestStream(t)
+
+	if err := s.Subscribe("missing", "g1", "c1"); err == nil {
+		t.Fatal("Expected subscribe to a missing topic to fail")
+	}
+
+	if err := s.CreateTopic("orders", 2, 0); err != nil {
+		t.Fatalf("Failed to create topic: %v", err)
+	}
+	if err := s.Subscribe("orders", "g1", "c1"); err != nil {
+		t.Fatalf("Expected group to subscribe after a failed subscribe, got %v", err)
+	}
+
+	a, err := s.Assignment("orders", "g1", "c1")
+	if err != nil {
+		t.Fatalf("Failed to get assignment: %v", err)
+	}
+	if len(a.Partitions) != 2 {
+		t.Errorf("Expected 2 partitions assigned, got %v", a.Partitions)
+	}
+}
+
+// TestCommitRejectsStaleGeneration tests that a member must rejoin after a
+// rebalance before its commits are accepted
+func TestCommitRejectsStaleGeneration(t *testing.T) {
+	s := createTestStream(t)
+
+	if err := s.CreateTopic("orders", 2, 0); err != nil {
+		t.Fatalf("Failed to create topic: %v", err)
+	}
+	if err := s.Subscribe("orders", "g1", "c1"); err != nil {
+		t.Fatalf("Failed to subscribe c1: %v", err)
+	}
+	if err := s.CommitAs("orders", "g1", "c1", 0, 1); err != nil {
+		t.Fatalf("Expected commit from current member to succeed, got %v", err)
+	}
+
+	// c2 joining moves the group to a new generation
+	if err := s.Subscribe("orders", "g1", "c2"); err != nil {
+		t.Fatalf("Failed to subscribe c2: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		consumerID string
+		wantErr    error
+	}{
+		{"stale member", "c1", ErrRebalanceInProgress},
+		{"current member", "c2", nil},
+		{"unknown member", "c3", ErrConsumerNotFound},
+		{"no membership check", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.CommitAs("orders", "g1", tt.consumerID, 1, 5); err != tt.wantErr {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	if _, err := s.Heartbeat("orders", "g1", "c1"); err != ErrRebalanceInProgress {
+		t.Errorf("Expected stale heartbeat to report a rebalance, got %v", err)
+	}
+
+	// Rejoining picks up the current generation
+	if err := s.Subscribe("orders", "g1", "c1"); err != nil {
+		t.Fatalf("Failed to rejoin: %v", err)
+	}
+	if err := s.CommitAs("orders", "g1", "c1", 0, 2); err != nil {
+		t.Errorf("Expected commit after rejoin to succeed, got %v", err)
+	}
+
+	if err := s.CommitAs("orders", "g2", "c1", 0, 2); err != ErrGroupNotFound {
+		t.Errorf("Expected commit to an unknown group to fail, got %v", err)
+	}
+}
+
+// TestConsumeSkipsFilteredMessages tests that a filtered consumer's
+// position moves past the messages its filter rejects
+func TestConsumeSkipsFilteredMessages(t *testing.T) {
+	s := createTestStream(t)
+	if err := s.CreateTopic("orders", 1, 0); err != nil {
+		t.Fatalf("Failed to create topic: %v", err)
+	}
+	if err := s.SubscribeWithOptions("orders", "g1", "c1", SubscribeOptions{Filter: `key ^= "eu-"`}); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	for _, key := range []string{"eu-1", "us-1", "us-2", "eu-2", "us-3"} {
+		s.Publish("orders", 0, key, []byte(key))
+	}
+
+	keys := func() []string {
+		msgs, err := s.Consume("orders", "g1", "c1", 10)
+		if err != nil {
+			t.Fatalf("Failed to consume: %v", err)
+		}
+		var got []string
+		for _, m := range msgs {
+			got = append(got, m.Key)
+		}
+		return got
+	}
+
+	if got := fmt.Sprint(keys()); got != "[eu-1 eu-2]" {
+		t.Errorf("Expected only eu messages, got %s", got)
+	}
+	if pos := s.groups["g1"].Consumers["c1"].positions[0]; pos != 5 {
+		t.Errorf("Expected the position past the rejected tail at 5, got %d", pos)
+	}
+
+	// Nothing is read twice and the rejected tail is not scanned again
+	if got := keys(); len(got) != 0 {
+		t.Errorf("Expected nothing new, got %v", got)
+	}
+	s.Publish("orders", 0, "us-4", nil)
+	s.Publish("orders", 0, "eu-3", nil)
+	if got := fmt.Sprint(keys()); got != "[eu-3]" {
+		t.Errorf("Expected only the new eu message, got %s", got)
+	}
+}
+
+// TestFilterSurvivesRestart tests that a member's subscription filter is
+// restored with its group
+func TestFilterSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(dir)
+	if err != nil {
+		t.Fatalf("Failed to create stream: %v", err)
+	}
+	if err := s.CreateTopic("orders", 1, 0); err != nil {
+		t.Fatalf("Failed to create topic: %v", err)
+	}
+	filter := `header.region = "eu"`
+	s.SubscribeWithOptions("orders", "g1", "c1", SubscribeOptions{Filter: filter})
+	s.Subscribe("orders", "g1", "c2")
+	// Changing the filter on rejoin is saved too
+	s.SubscribeWithOptions("orders", "g1", "c2", SubscribeOptions{Filter: "key = a"})
+	s.Close()
+
+	s, err = New(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen stream: %v", err)
+	}
+	defer s.Close()
+
+	g := s.groups["g1"]
+	if g == nil {
+		t.Fatal("Expected the group to be restored")
+	}
+	if got := g.Consumers["c1"].filter.String(); got != filter {
+		t.Errorf("Expected c1 filter %q, got %q", filter, got)
+	}
+	if got := g.Consumers["c2"].filter.String(); got != "key = a" {
+		t.Errorf("Expected c2 filter %q, got %q", "key = a", got)
+	}
+}
+
+// TestGroupRestoredAfterRestart tests that a group keeps its members,
+// settings and assignments across a restart, and that members rejoin
+// and resume from the committed offsets
+func TestGroupRestoredAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(dir)
+	if err != nil {
+		t.Fatalf("Failed to create stream: %v", err)
+	}
+	if err := s.CreateTopic("orders", 4, 0); err != nil {
+		t.Fatalf("Failed to create topic: %v", err)
+	}
+	opts := SubscribeOptions{SessionTimeout: time.Minute, Strategy: StrategyRoundRobin}
+	for _, id := range []string{"c1", "c2"} {
+		if err := s.SubscribeWithOptions("orders", "g1", id, opts); err != nil {
+			t.Fatalf("Failed to subscribe %s: %v", id, err)
+		}
+	}
+	// c1 joined before c2 and must rejoin to see the current assignment
+	s.Subscribe("orders", "g1", "c1")
+
+	before, err := s.Assignment("orders", "g1", "c1")
+	if err != nil {
+		t.Fatalf("Failed to get assignment: %v", err)
+	}
+	for p := 0; p < 4; p++ {
+		s.Publish("orders", p, "", []byte(fmt.Sprintf("p%d-0", p)))
+		s.Publish("orders", p, "", []byte(fmt.Sprintf("p%d-1", p)))
+	}
+	for _, p := range before.Partitions {
+		if err := s.CommitAs("orders", "g1", "c1", p, 1); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+	}
+	s.Close()
+
+	s, err = New(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen stream: %v", err)
+	}
+	defer s.Close()
+
+	g := s.groups["g1"]
+	if g == nil {
+		t.Fatal("Expected the group to be restored")
+	}
+	if g.Topic != "orders" || g.Strategy != StrategyRoundRobin || g.SessionTimeout != time.Minute || len(g.Consumers) != 2 {
+		t.Errorf("Expected the group's settings and 2 members, got topic %s, strategy %s, timeout %v and %d members",
+			g.Topic, g.Strategy, g.SessionTimeout, len(g.Consumers))
+	}
+
+	// The restart counts as a rebalance
+	if _, err := s.Consume("orders", "g1", "c1", 10); err != ErrRebalanceInProgress {
+		t.Errorf("Expected ErrRebalanceInProgress before rejoining, got %v", err)
+	}
+	if err := s.Subscribe("orders", "g1", "c1"); err != nil {
+		t.Fatalf("Failed to rejoin: %v", err)
+	}
+	after, err := s.Assignment("orders", "g1", "c1")
+	if err != nil {
+		t.Fatalf("Failed to get assignment: %v", err)
+	}
+	if fmt.Sprint(after.Partitions) != fmt.Sprint(before.Partitions) || after.Generation <= before.Generation {
+		t.Errorf("Expected partitions %v in a later generation than %d, got %v in %d",
+			before.Partitions, before.Generation, after.Partitions, after.Generation)
+	}
+
+	msgs, err := s.Consume("orders", "g1", "c1", 10)
+	if err != nil {
+		t.Fatalf("Failed to consume: %v", err)
+	}
+	if len(msgs) != len(before.Partitions) {
+		t.Fatalf("Expected one message per partition, got %d", len(msgs))
+	}
+	for _, m := range msgs {
+		if m.Offset != 1 {
+			t.Errorf("Expected to resume at the committed offset 1, got %d in partition %d", m.Offset, m.Partition)
+		}
+	}
+}
+
+// TestSeekMovesConsumerPosition tests that Consume tracks its position
+// without commits and that each seek commits a new position the next
+// Consume starts from
+func TestSeekMovesConsumerPosition(t *testing.T) {
+	s := createTestStream(t)
+	if err := s.CreateTopic("orders", 1, 0); err != nil {
+		t.Fatalf("Failed to create topic: %v", err)
+	}
+	if err := s.Subscribe("orders", "g1", "c1"); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		s.Publish("orders", 0, "", []byte(fmt.Sprintf("m%d", i)))
+	}
+	time.Sleep(5 * time.Millisecond)
+	cut := time.Now().UnixMilli()
+	for i := 3; i < 5; i++ {
+		s.Publish("orders", 0, "", []byte(fmt.Sprintf("m%d", i)))
+	}
+
+	consume := func(count int) string {
+		msgs, err := s.Consume("orders", "g1", "c1", count)
+		if err != nil {
+			t.Fatalf("Failed to consume: %v", err)
+		}
+		values := make([]string, len(msgs))
+		for i, m := range msgs {
+			values[i] = string(m.Value)
+		}
+		return fmt.Sprint(values)
+	}
+
+	// Consecutive reads continue without a commit
+	if got := consume(2); got != "[m0 m1]" {
+		t.Errorf("Expected [m0 m1], got %s", got)
+	}
+	if got := consume(2); got != "[m2 m3]" {
+		t.Errorf("Expected [m2 m3], got %s", got)
+	}
+	if _, ok, _ := s.CommittedOffset("g1", "orders", 0); ok {
+		t.Error("Expected reading not to commit")
+	}
+
+	tests := []struct {
+		name   string
+		seek   func() error
+		offset int64
+		want   string
+	}{
+		{"offset", func() error { return s.Seek("g1", "orders", 0, 1) }, 1, "[m1 m2]"},
+		{"end", func() error { return s.SeekToEnd("g1", "orders", 0) }, 5, "[]"},
+		{"beginning of all partitions", func() error { return s.SeekToBeginning("g1", "orders", -1) }, 0, "[m0 m1]"},
+		{"timestamp", func() error { return s.SeekToTimestamp("g1", "orders", 0, cut) }, 3, "[m3 m4]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.seek(); err != nil {
+				t.Fatalf("Failed to seek: %v", err)
+			}
+			if offset, ok, _ := s.CommittedOffset("g1", "orders", 0); !ok || offset != tt.offset {
+				t.Errorf("Expected committed offset %d, got %d (%v)", tt.offset, offset, ok)
+			}
+			if got := consume(2); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	// A seek applies to a group that has no members yet too
+	if err := s.Seek("g2", "orders", 0, 4); err != nil {
+		t.Fatalf("Failed to seek: %v", err)
+	}
+	s.Subscribe("orders", "g2", "c1")
+	msgs, _ := s.Consume("orders", "g2", "c1", 10)
+	if len(msgs) != 1 || msgs[0].Offset != 4 {
+		t.Errorf("Expected to start at offset 4, got %d messages", len(msgs))
+	}
+
+	if err := s.Seek("g1", "orders", 1, 0); err == nil {
+		t.Error("Expected a seek to a missing partition to fail")
+	}
+}
+
+// TestConsumeAsyncWaitsForMessages tests that a long-poll consume is
+// completed by a publish, by enough bytes or by its deadline
+func TestConsumeAsyncWaitsForMessages(t *testing.T) {
+	s := createTestStream(t)
+	if err := s.CreateTopic("orders", 2, 0); err != nil {
+		t.Fatalf("Failed to create topic: %v", err)
+	}
+	if err := s.Subscribe("orders", "g1", "c1"); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	type result struct {
+		keys []string
+		err  error
+	}
+	poll := func(opts ConsumeOptions) chan result {
+		ch := make(chan result, 1)
+		s.ConsumeAsync("orders", "g1", "c1", 10, opts, func(msgs []*storage.Message, err error) {
+			var keys []string
+			for _, m := range msgs {
+				keys = append(keys, m.Key)
+			}
+			ch <- result{keys, err}
+		})
+		return ch
+	}
+	wait := func(ch chan result) result {
+		t.Helper()
+		select {
+		case r := <-ch:
+			if r.err != nil {
+				t.Fatalf("Failed to consume: %v", r.err)
+			}
+			return r
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for the consume to complete")
+		}
+		return result{}
+	}
+	pending := func(ch chan result) {
+		t.Helper()
+		select {
+		case r := <-ch:
+			t.Fatalf("Expected the consume to keep waiting, got %v (%v)", r.keys, r.err)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+
+	// A publish to either partition wakes the request
+	ch := poll(ConsumeOptions{MaxWait: 10 * time.Second})
+	pending(ch)
+	start := time.Now()
+	s.Publish("orders", 1, "a", []byte("1"))
+	if r := wait(ch); fmt.Sprint(r.keys) != "[a]" || time.Since(start) > time.Second {
+		t.Errorf("Expected [a] soon after the publish, got %v after %v", r.keys, time.Since(start))
+	}
+
+	// Available messages complete it at once
+	s.Publish("orders", 0, "b", []byte("2"))
+	ch = poll(ConsumeOptions{MaxWait: 10 * time.Second})
+	select {
+	case r := <-ch:
+		if fmt.Sprint(r.keys) != "[b]" {
+			t.Errorf("Expected [b], got %v", r.keys)
+		}
+	default:
+		t.Error("Expected available messages to be returned without waiting")
+	}
+
+	// It keeps collecting until MinBytes
+	ch = poll(ConsumeOptions{MaxWait: 10 * time.Second, MinBytes: 8})
+	s.Publish("orders", 0, "c", []byte("1234"))
+	pending(ch)
+	s.Publish("orders", 1, "d", []byte("5678"))
+	if r := wait(ch); fmt.Sprint(r.keys) != "[c d]" {
+		t.Errorf("Expected [c d], got %v", r.keys)
+	}
+
+	// Rejected messages do not complete a filtered request
+	ch = poll(ConsumeOptions{MaxWait: 10 * time.Second, Filter: "key = e"})
+	s.Publish("orders", 0, "x", nil)
+	pending(ch)
+	s.Publish("orders", 0, "e", nil)
+	if r := wait(ch); fmt.Sprint(r.keys) != "[e]" {
+		t.Errorf("Expected [e], got %v", r.keys)
+	}
+
+	// The deadline completes it empty
+	start = time.Now()
+	ch = poll(ConsumeOptions{MaxWait: 50 * time.Millisecond})
+	if r := wait(ch); len(r.keys) != 0 || time.Since(start) < 50*time.Millisecond {
+		t.Errorf("Expected nothing after the deadline, got %v after %v", r.keys, time.Since(start))
+	}
+
+	ch = make(chan result, 1)
+	s.ConsumeAsync("orders", "g1", "c9", 10, ConsumeOptions{MaxWait: time.Second}, func(msgs []*storage.Message, err error) {
+		ch <- result{nil, err}
+	})
+	if r := <-ch; r.err != ErrConsumerNotFound {
+		t.Errorf("Expected ErrConsumerNotFound, got %v", r.err)
+	}
+}
+
+// TestGroupLag tests lag and group listing for a group with members and a
+// group that only has committed offsets
+func TestGroupLag(t *testing.T) {
+	s := createTestStream(t)
+	if err := s.CreateTopic("orders", 2, 0); err != nil {
+		t.Fatalf("Failed to create topic: %v", err)
+	}
+	if err := s.CreateTopic("audit", 1, 0); err != nil {
+		t.Fatalf("Failed to create topic: %v", err)
+	}
+	if err := s.Subscribe("orders", "g1", "c1"); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		s.Publish("orders", 0, "", []byte("o"))
+	}
+	s.Publish("orders", 1, "", []byte("o"))
+	s.Publish("audit", 0, "", []byte("a"))
+	s.Publish("audit", 0, "", []byte("a"))
+	if err := s.CommitAs("orders", "g1", "c1", 0, 2); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if err := s.Commit("audit", "g2", 0, 0); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	groups, err := s.ListGroups()
+	if err != nil {
+		t.Fatalf("Failed to list groups: %v", err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, got %+v", groups)
+	}
+	if g := groups[0]; g.Name != "g1" || fmt.Sprint(g.Topics) != "[orders]" || g.Members != 1 || g.Strategy != DefaultStrategy || g.Generation == 0 {
+		t.Errorf("Expected g1 with one member on orders, got %+v", g)
+	}
+	if g := groups[1]; g.Name != "g2" || fmt.Sprint(g.Topics) != "[audit]" || g.Members != 0 {
+		t.Errorf("Expected g2 without members on audit, got %+v", g)
+	}
+
+	lags, err := s.GroupLag("g1")
+	if err != nil {
+		t.Fatalf("Failed to get lag: %v", err)
+	}
+	if len(lags) != 2 {
+		t.Fatalf("Expected lag for 2 partitions, got %d", len(lags))
+	}
+	want := []struct {
+		committed, hw, lag int64
+		committedEver      bool
+	}{
+		{2, 3, 1, true},
+		{0, 1, 1, false},
+	}
+	for p, w := range want {
+		l := lags[p]
+		if l.Partition != p || l.Committed != w.committed || l.HighWatermark != w.hw || l.Lag != w.lag || l.Consumer != "c1" {
+			t.Errorf("Expected partition %d at %d of %d with lag %d owned by c1, got %+v", p, w.committed, w.hw, w.lag, l)
+		}
+		if (l.LastCommit != 0) != w.committedEver {
+			t.Errorf("Expected a commit time only for committed partitions, got %d on partition %d", l.LastCommit, p)
+		}
+	}
+
+	lags, err = s.GroupLag("g2")
+	if err != nil {
+		t.Fatalf("Failed to get lag: %v", err)
+	}
+	if len(lags) != 1 || lags[0].Topic != "audit" || lags[0].Lag != 2 || lags[0].Consumer != "" {
+		t.Errorf("Expected lag 2 on audit without an owner, got %+v", lags)
+	}
+
+	if _, err := s.GroupLag("g3"); err != ErrGroupNotFound {
+		t.Errorf("Expected ErrGroupNotFound, got %v", err)
+	}
+	if all, err := s.AllGroupLag(); err != nil || len(all) != 3 {
+		t.Errorf("Expected 3 partitions across groups, got %d (%v)", len(all), err)
+	}
+}
+
+// TestHeadersRoundTrip tests that headers and event times are returned as
+// published, whatever the topic's compression
+func TestHeadersRoundTrip(t *testing.T) {
+	s := createTestStream(t)
+
+	eventTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).UnixMilli()
+	records := []storage.Record{
+		{Key: "a", Value: []byte("1"), EventTime: eventTime, Headers: map[string]string{"trace-id": "abc", "content-type": "application/json"}},
+		{Key: "b", Value: []byte("2")},
+		{Key: "c", Value: []byte("3"), Headers: map[string]string{"empty": ""}},
+	}
+
+	for _, codec := range []string{"none", "snappy", "zstd", "gzip"} {
+		t.Run(codec, func(t *testing.T) {
+			topic := "orders-" + codec
+			if err := s.CreateTopicWithConfig(topic, TopicConfig{Partitions: 1, Compression: codec}); err != nil {
+				t.Fatalf("Failed to create topic: %v", err)
+			}
+			before := time.Now().UnixMilli()
+			if _, _, err := s.PublishBatch(topic, 0, records); err != nil {
+				t.Fatalf("Failed to publish: %v", err)
+			}
+
+			msgs, err := s.Fetch(topic, 0, 0, 10)
+			if err != nil {
+				t.Fatalf("Failed to fetch: %v", err)
+			}
+			if len(msgs) != len(records) {
+				t.Fatalf("Expected %d messages, got %d", len(records), len(msgs))
+			}
+			for i, m := range msgs {
+				want := records[i]
+				if m.Key != want.Key || string(m.Value) != string(want.Value) || m.EventTime != want.EventTime {
+					t.Errorf("Expected %s=%s at %d, got %s=%s at %d", want.Key, want.Value, want.EventTime, m.Key, m.Value, m.EventTime)
+				}
+				if fmt.Sprint(m.Headers) != fmt.Sprint(want.Headers) || len(m.Headers) != len(want.Headers) {
+					t.Errorf("Expected headers %v, got %v", want.Headers, m.Headers)
+				}
+				// The server's own timestamp is kept alongside
+				if m.Timestamp < before {
+					t.Errorf("Expected the append time as timestamp, got %d", m.Timestamp)
+				}
+			}
+		})
+	}
+}